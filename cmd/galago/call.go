@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs/jni"
+	"github.com/zboralski/galago/internal/ui/colorize"
+)
+
+// callTarget is the native method `galago call` invokes, after JNI_OnLoad
+// has registered it or directly if it is an exported Java_* function.
+var callTarget *nativeCall
+
+// callStatic passes the method's jclass instead of a new object.
+var callStatic bool
+
+// nativeCall names a Java native method: class and signature are optional
+// as long as the match is unique.
+type nativeCall struct {
+	Class string // JNI form, e.g. com/example/Native
+	Name  string
+	Sig   string
+	Args  []string
+}
+
+// callResult is the outcome of invoking a native method.
+type callResult struct {
+	Method jni.NativeMethod
+	Args   []string
+	Value  jni.Value
+}
+
+// parseCallTarget parses "[pkg.Class.]method[(sig)]". Dots or slashes
+// separate the package.
+func parseCallTarget(s string) (*nativeCall, error) {
+	c := &nativeCall{}
+	if i := strings.IndexByte(s, '('); i >= 0 {
+		s, c.Sig = s[:i], s[i:]
+		if _, _, err := jni.ParseSignature(c.Sig); err != nil {
+			return nil, err
+		}
+	}
+	s = strings.ReplaceAll(s, ".", "/")
+	if i := strings.LastIndexByte(s, '/'); i >= 0 {
+		c.Class, s = s[:i], s[i+1:]
+	}
+	if s == "" {
+		return nil, fmt.Errorf("call target: missing method name")
+	}
+	c.Name = s
+	return c, nil
+}
+
+// matches reports whether a native fits the target. A Java_* export
+// carries at most its parameter list, which must prefix the target's
+// signature.
+func (c *nativeCall) matches(n jni.NativeMethod) bool {
+	return n.Name == c.Name &&
+		(c.Class == "" || n.Class == c.Class) &&
+		(c.Sig == "" || strings.HasPrefix(c.Sig, n.Signature))
+}
+
+// resolve picks the one native that fits the target, from the
+// RegisterNatives tables or else the Java_* exports, and fills in the
+// target's signature.
+func (c *nativeCall) resolve(natives []jni.NativeMethod, exports []jni.Export) (jni.NativeMethod, error) {
+	registered := make(map[uint64]bool, len(natives))
+	var found []jni.NativeMethod
+	for _, n := range natives {
+		registered[n.Fn] = true
+		if c.matches(n) {
+			found = append(found, n)
+		}
+	}
+	for _, x := range exports {
+		if !registered[x.Fn] && c.matches(x.NativeMethod) {
+			found = append(found, x.NativeMethod)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return jni.NativeMethod{}, fmt.Errorf("call: no native matches %s (%d registered, %d exported)", c.Name, len(natives), len(exports))
+	case 1:
+		m := found[0]
+		if c.Sig != "" {
+			m.Signature = c.Sig
+		}
+		if _, _, err := jni.ParseSignature(m.Signature); err != nil {
+			return jni.NativeMethod{}, fmt.Errorf("call: %s is exported without a return type; give the full signature as %s(params)ret", m, m.Name)
+		}
+		return m, nil
+	}
+	names := make([]string, len(found))
+	for i, n := range found {
+		names[i] = n.String()
+	}
+	sort.Strings(names)
+	return jni.NativeMethod{}, fmt.Errorf("call: %s is ambiguous: %s", c.Name, strings.Join(names, ", "))
+}
+
+func runCall(cmd *cobra.Command, args []string) error {
+	target, err := parseCallTarget(args[1])
+	if err != nil {
+		return err
+	}
+	target.Args = args[2:]
+	callTarget = target
+	return runTrace(cmd, args[:1])
+}
+
+// callNative invokes the call target, if any, once the entry point has run.
+// sp and lr are the stack and return address the entry point started with.
+// A nil result with an error means the method could not be invoked; a
+// result with an error means it was invoked and the emulation failed.
+func callNative(emu *emulator.Emulator, info *emulator.ELFInfo, sp, lr uint64) (*callResult, error) {
+	if callTarget == nil {
+		return nil, nil
+	}
+	return invokeNative(emu, callTarget, jni.Exports(info.Symbols), sp, lr)
+}
+
+// invokeNative calls the target with its arguments marshalled from the
+// method signature and returns the decoded result. this is the jclass of
+// the method's class for static methods, from --static or the JNI model,
+// and a fresh model object of the class otherwise.
+func invokeNative(emu *emulator.Emulator, c *nativeCall, exports []jni.Export, sp, lr uint64) (*callResult, error) {
+	env := jni.GetCurrentEnv()
+	if env == nil {
+		return nil, fmt.Errorf("call: JNI is not active for this binary")
+	}
+
+	m, err := c.resolve(env.Natives(), exports)
+	if err != nil {
+		return nil, err
+	}
+	params, ret, err := jni.ParseSignature(m.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("call: %s: %w", m, err)
+	}
+	if len(c.Args) != len(params) {
+		return nil, fmt.Errorf("call: %s takes %d arguments, got %d", m, len(params), len(c.Args))
+	}
+	values := make([]jni.Value, len(params))
+	for i, p := range params {
+		if values[i], err = jni.ParseArg(p, c.Args[i]); err != nil {
+			return nil, fmt.Errorf("call: argument %d: %w", i+1, err)
+		}
+	}
+
+	var this uint64
+	model := jni.CurrentModel()
+	if callStatic || model.FindMethod(m.Class, m.Name, m.Signature, true) != nil {
+		this = env.ClassRef(m.Class)
+	} else {
+		this = env.NewObjectRef(model.NewObject(m.Class))
+	}
+	if err := env.SetArgs(emu, this, params, values); err != nil {
+		return nil, fmt.Errorf("call: %s: %w", m, err)
+	}
+	emu.SetSP(sp)
+	emu.SetLR(lr)
+
+	runErr := emu.RunFrom(m.Fn)
+	return &callResult{Method: m, Args: c.Args, Value: env.ReturnValue(emu, ret)}, runErr
+}
+
+// printCallResult prints the decoded return value of an invoked native.
+func printCallResult(r *callResult) {
+	if r == nil {
+		return
+	}
+	fmt.Printf("call %s %s %s\n", colorize.FuncName(r.Method.String()), colorize.Detail("="), colorize.String(jni.Describe(r.Value)))
+}
+
+// printNatives lists the RegisterNatives tables.
+func printNatives(natives []jni.NativeMethod, addrToSym map[uint64]string) {
+	if len(natives) == 0 {
+		return
+	}
+	fmt.Println()
+	for _, n := range natives {
+		line := fmt.Sprintf("native %s %s %s", colorize.FuncName(n.String()), colorize.Detail("->"), colorize.Address(n.Fn))
+		if sym := addrToSym[n.Fn]; sym != "" {
+			line += " " + colorize.Detail(emulator.DemangleName(sym))
+		}
+		fmt.Println(line)
+	}
+}
+
+// printExports lists the exported Java_* methods for info --jni.
+func printExports(exports []jni.Export) {
+	if len(exports) == 0 {
+		fmt.Println("\nJNI exports: none")
+		return
+	}
+	fmt.Println("\nJNI exports:")
+	for _, x := range exports {
+		fmt.Printf("  0x%x %s  %s\n", x.Fn, x, x.Symbol)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/zboralski/galago/internal/calltree"
+)
+
+var callsOut string
+
+// writeCallTree saves the call tree for --calls: Graphviz for .dot, JSON
+// for .json, and an indented tree otherwise or on stdout for "-".
+func writeCallTree(t *calltree.Tracker) error {
+	write := t.WriteText
+	switch filepath.Ext(callsOut) {
+	case ".dot", ".gv":
+		write = t.WriteDOT
+	case ".json":
+		write = t.WriteJSON
+	}
+
+	var w io.Writer = os.Stdout
+	if callsOut != "-" {
+		f, err := os.Create(callsOut)
+		if err != nil {
+			return fmt.Errorf("--calls: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := write(w); err != nil {
+		return fmt.Errorf("--calls: %w", err)
+	}
+	return nil
+}
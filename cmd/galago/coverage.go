@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/zboralski/galago/internal/coverage"
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/ui/colorize"
+)
+
+var (
+	covOut   string
+	infoCovs []string
+)
+
+// installCoverage starts block coverage for --cov, or returns nil.
+func installCoverage(emu *emulator.Emulator) (*coverage.Coverage, error) {
+	if covOut == "" {
+		return nil, nil
+	}
+	cov := coverage.New()
+	if err := cov.Install(emu); err != nil {
+		return nil, fmt.Errorf("coverage: %w", err)
+	}
+	return cov, nil
+}
+
+// writeCoverage saves a run's blocks as a drcov log.
+func writeCoverage(cov *coverage.Coverage, info *emulator.ELFInfo) error {
+	f, err := os.Create(covOut)
+	if err != nil {
+		return fmt.Errorf("--cov: %w", err)
+	}
+	defer f.Close()
+	if err := coverage.WriteDrcov(f, info, cov.Blocks()); err != nil {
+		return fmt.Errorf("--cov: %w", err)
+	}
+	return f.Close()
+}
+
+// printCoverage lists the functions a run entered and how many of their
+// blocks ran.
+func printCoverage(funcs []coverage.FuncCoverage) {
+	if len(funcs) == 0 {
+		return
+	}
+	fmt.Println()
+	for _, fn := range funcs {
+		fmt.Printf("cov %s %s %s\n",
+			colorize.FuncName(fmt.Sprintf("%4d/%-4d %3d%%", fn.Hit, fn.Blocks, percent(fn.Hit, fn.Blocks))),
+			colorize.Address(fn.Addr),
+			colorize.Detail(funcLabel(fn)))
+	}
+}
+
+func percent(n, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return 100 * n / total
+}
+
+func funcLabel(fn coverage.FuncCoverage) string {
+	if fn.Name == "" {
+		return fmt.Sprintf("sub_%x", fn.Addr)
+	}
+	return emulator.DemangleName(fn.Name)
+}
+
+// readCoverage loads a drcov log of info's binary.
+func readCoverage(path string, info *emulator.ELFInfo) ([]coverage.Block, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	blocks, err := coverage.ReadDrcov(f, info)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return blocks, nil
+}
+
+// printInfoCoverage summarizes one drcov log per function for info, or
+// compares two runs: the functions whose coverage differs and the blocks
+// each run alone reached.
+func printInfoCoverage(info *emulator.ELFInfo, paths []string) error {
+	if len(paths) > 2 {
+		return fmt.Errorf("--cov: give one log to summarize or two to compare")
+	}
+	runs := make([][]coverage.Block, len(paths))
+	for i, path := range paths {
+		blocks, err := readCoverage(path, info)
+		if err != nil {
+			return err
+		}
+		runs[i] = blocks
+	}
+
+	if len(runs) == 1 {
+		fmt.Printf("Coverage: %s (%d blocks)\n", paths[0], len(runs[0]))
+		for _, fn := range coverage.Summarize(info, runs[0]) {
+			fmt.Printf("  %4d/%-4d %3d%%  0x%x %s\n", fn.Hit, fn.Blocks, percent(fn.Hit, fn.Blocks), fn.Addr, funcLabel(fn))
+		}
+		fmt.Println()
+		return nil
+	}
+
+	onlyA, onlyB := coverage.Diff(runs[0], runs[1])
+	fmt.Printf("Coverage diff: %s (%d blocks, %d only here) vs %s (%d blocks, %d only here)\n",
+		paths[0], len(runs[0]), len(onlyA), paths[1], len(runs[1]), len(onlyB))
+	type pair struct{ a, b coverage.FuncCoverage }
+	byAddr := make(map[uint64]*pair)
+	for _, fn := range coverage.Summarize(info, runs[0]) {
+		byAddr[fn.Addr] = &pair{a: fn, b: fn}
+		byAddr[fn.Addr].b.Hit = 0
+	}
+	for _, fn := range coverage.Summarize(info, runs[1]) {
+		if p, ok := byAddr[fn.Addr]; ok {
+			p.b = fn
+		} else {
+			a := fn
+			a.Hit = 0
+			byAddr[fn.Addr] = &pair{a: a, b: fn}
+		}
+	}
+	addrs := make([]uint64, 0, len(byAddr))
+	for addr, p := range byAddr {
+		if p.a.Hit != p.b.Hit {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	for _, addr := range addrs {
+		p := byAddr[addr]
+		fmt.Printf("  %4d/%-4d -> %4d/%-4d  0x%x %s\n", p.a.Hit, p.a.Blocks, p.b.Hit, p.b.Blocks, addr, funcLabel(p.a))
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs/setters"
+	"github.com/zboralski/galago/internal/ui/colorize"
+)
+
+var (
+	harvest   bool
+	harvestAt []string
+)
+
+// installHarvester snapshots memory for --harvest and --harvest-at, or
+// returns nil when neither is given.
+func installHarvester(emu *emulator.Emulator, info *emulator.ELFInfo) (*setters.Harvester, error) {
+	if !harvest && len(harvestAt) == 0 {
+		return nil, nil
+	}
+	var at []uint64
+	for _, s := range harvestAt {
+		addr, err := resolveAddress(info, s)
+		if err != nil {
+			return nil, fmt.Errorf("--harvest-at: %w", err)
+		}
+		at = append(at, addr)
+	}
+	h := setters.NewHarvester(info)
+	if err := h.Install(emu, at); err != nil {
+		return nil, fmt.Errorf("harvest: %w", err)
+	}
+	return h, nil
+}
+
+// resolveAddress parses a hex address or looks up a symbol, mangled or
+// demangled.
+func resolveAddress(info *emulator.ELFInfo, s string) (uint64, error) {
+	if hex, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		return strconv.ParseUint(hex, 16, 64)
+	}
+	if addr, ok := info.Symbols[s]; ok {
+		return addr, nil
+	}
+	for name, addr := range info.Symbols {
+		if emulator.DemangleName(name) == s {
+			return addr, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown symbol %q", s)
+}
+
+// splitHarvested separates harvested keys from setter captures.
+func splitHarvested(keys []setters.CapturedKey) (captured, harvested []setters.CapturedKey) {
+	for _, k := range keys {
+		if k.Harvested() {
+			harvested = append(harvested, k)
+		} else {
+			captured = append(captured, k)
+		}
+	}
+	return captured, harvested
+}
+
+// printHarvest lists harvested candidates, best first, with their writers.
+func printHarvest(keys []setters.CapturedKey) {
+	if len(keys) == 0 {
+		return
+	}
+	fmt.Println()
+	eq := colorize.Detail("=")
+	for _, k := range keys {
+		fmt.Printf("%s %s %s  %s\n", k.KeyType, eq, colorize.String(fmt.Sprintf("%q", k.Value)), colorize.Detail(k.Source))
+	}
+}
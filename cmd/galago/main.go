@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -12,11 +13,18 @@ import (
 	"golang.org/x/arch/arm64/arm64asm"
 
 	"github.com/spf13/cobra"
+	"github.com/zboralski/galago/internal/apk"
+	"github.com/zboralski/galago/internal/calltree"
+	"github.com/zboralski/galago/internal/coverage"
 	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/fingerprint"
 	glog "github.com/zboralski/galago/internal/log"
 	"github.com/zboralski/galago/internal/stubs"
 	_ "github.com/zboralski/galago/internal/stubs/all"
+	"github.com/zboralski/galago/internal/stubs/android"
 	"github.com/zboralski/galago/internal/stubs/jni"
+	"github.com/zboralski/galago/internal/stubs/libc"
+	"github.com/zboralski/galago/internal/stubs/network"
 	"github.com/zboralski/galago/internal/stubs/setters"
 	"github.com/zboralski/galago/internal/trace"
 	"github.com/zboralski/galago/internal/ui/colorize"
@@ -26,6 +34,28 @@ var (
 	verbose bool
 	quiet   bool
 	maxInsn int
+
+	il2cppMetadata string
+	metadataOut    string
+
+	sessionTime string
+	sessionSeed uint64
+
+	propFile      string
+	propOverrides []string
+
+	jniModel    string
+	apkPath     string
+	certPath    string
+	packageName string
+
+	responseDir string
+	forwardAddr string
+
+	jsonOutput bool
+	cryptoTag  bool
+
+	infoJNI bool
 )
 
 func main() {
@@ -50,15 +80,53 @@ Examples:
   galago libcocos2djs.so              # Extract keys with colorized trace
   galago libcocos2djs.so -q           # Quiet mode - keys and stats only
   galago libcocos2djs.so -v           # Verbose debug output
-  galago info libil2cpp.so            # Show binary info`,
+  galago libil2cpp.so --il2cpp global-metadata.dat  # Decrypt IL2CPP metadata
+  galago libgame.so --time 2025-06-01T00:00:00Z --seed 7  # Replay with another clock/RNG
+  galago libgame.so --prop ro.debuggable=1 --prop ro.build.version.sdk=29
+  galago libgame.so --jni java.yaml  # Answer JNI calls from a Java object model
+  galago libgame.so --apk game.apk   # Real package name and signing certificate for JNI
+  galago libgame.so --json           # Machine-readable run report
+  galago libgame.so --responses srv/ # Answer HTTP requests from srv/<host>/<path>
+  galago libgame.so --harvest -q     # Also diff memory for computed strings and keys
+  galago libgame.so --crypto-tag     # Tag AES/XXTEA/RC4 code by its constant tables
+  galago libgame.so --cov run.drcov  # Block coverage for Lighthouse, summarized per function
+  galago libgame.so --calls calls.dot # Call tree with arguments (.dot, .json, or text)
+  galago libgame.so --record run.trace -q  # Record the whole run for galago trace view
+  galago call libgame.so 'com.example.Native.decrypt([B)[B' hex:00ff  # Invoke a native method
+  galago info libil2cpp.so            # Show binary info
+  galago info --jni libgame.so        # List exported Java_* methods
+  galago info libgame.so --cov a.drcov --cov b.drcov  # Compare coverage of two runs
+  galago trace view run.trace --func xxtea --tag xor  # Filter a recorded run offline
+  galago sigs --match 'xxtea|XXTea' libcocos2dlua.so -o cocos.sigs  # Signatures from an unstripped build
+  galago libstripped.so --sigs cocos.sigs  # Name stripped functions by signature`,
 		Args:                  cobra.MaximumNArgs(1),
 		DisableFlagsInUseLine: true,
 		RunE:                  runTrace,
 	}
 
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "verbose debug output")
-	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "quiet mode (keys + stats only)")
-	rootCmd.Flags().IntVarP(&maxInsn, "num", "n", 500, "max instructions to show")
+	addRunFlags(rootCmd)
+	rootCmd.Flags().StringVar(&il2cppMetadata, "il2cpp", "", "run il2cpp_init with this global-metadata.dat")
+	rootCmd.Flags().StringVar(&metadataOut, "dump-metadata", "", "write decrypted IL2CPP metadata to this file (default <metadata>.dec)")
+
+	callCmd := &cobra.Command{
+		Use:   "call <binary.so> <[pkg.Class.]method[(sig)]> [args...]",
+		Short: "Invoke a native method registered through RegisterNatives or exported as Java_*",
+		Long: `Run JNI_OnLoad, then invoke a native method from the RegisterNatives tables
+or an exported Java_* function. Exported names carry no return type, so give
+the full signature when calling one.
+
+Arguments are converted from the method signature: integers for I/J/S/B/C,
+true/false for Z, text for String, hex:/base64:/text for byte[], and null for
+any reference. Returned strings and byte arrays are printed decoded.
+
+Static methods get their class as the jclass argument; they are recognized
+from the JNI model, or pass --static.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: runCall,
+	}
+	addRunFlags(callCmd)
+	callCmd.Flags().BoolVar(&callStatic, "static", false, "the method is static: pass its jclass instead of a new object")
+	rootCmd.AddCommand(callCmd)
 
 	infoCmd := &cobra.Command{
 		Use:   "info <binary.so>",
@@ -66,13 +134,56 @@ Examples:
 		Args:  cobra.ExactArgs(1),
 		RunE:  showInfo,
 	}
+	infoCmd.Flags().BoolVar(&infoJNI, "jni", false, "list exported Java_* native methods")
+	infoCmd.Flags().StringArrayVar(&sigFiles, "sigs", nil, "function signature database for stripped binaries (repeatable)")
+	infoCmd.Flags().StringArrayVar(&infoCovs, "cov", nil, "summarize a drcov log per function; give two to compare runs")
 	rootCmd.AddCommand(infoCmd)
 
+	sigsCmd := &cobra.Command{
+		Use:   "sigs <unstripped.so>...",
+		Short: "Build function signatures from unstripped binaries",
+		Long: `Build a signature database from the function symbols of unstripped
+binaries. Give it to --sigs to name the same functions in stripped builds
+of that engine or library version. Only signatures that match exactly once
+in their sample are kept.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: buildSigs,
+	}
+	sigsCmd.Flags().StringVar(&sigsMatch, "match", "", "only functions whose mangled or demangled name matches this regexp")
+	sigsCmd.Flags().StringVarP(&sigsOut, "output", "o", "", "write the database to this file instead of stdout")
+	rootCmd.AddCommand(sigsCmd)
+	rootCmd.AddCommand(newTraceCmd())
+
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
+// addRunFlags registers the flags shared by commands that run a binary.
+func addRunFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "verbose debug output")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "quiet mode (keys + stats only)")
+	cmd.Flags().IntVarP(&maxInsn, "num", "n", 500, "max instructions to show")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "print a JSON run report instead of the trace")
+	cmd.Flags().StringVar(&sessionTime, "time", "2024-01-01T00:00:00Z", "guest wall clock at start (RFC 3339)")
+	cmd.Flags().Uint64Var(&sessionSeed, "seed", 1, "seed for rand, arc4random, getrandom, and /dev/urandom")
+	cmd.Flags().StringVar(&propFile, "props", "", "system property overrides in build.prop format")
+	cmd.Flags().StringArrayVar(&propOverrides, "prop", nil, "set a system property (name=value, empty value unsets; repeatable)")
+	cmd.Flags().StringVar(&jniModel, "jni", "", "Java object model (YAML) for JNI method and field values")
+	cmd.Flags().StringVar(&apkPath, "apk", "", "APK whose package name and signing certificate JNI calls should see")
+	cmd.Flags().StringVar(&certPath, "cert", "", "signing certificate for JNI calls (PEM, DER, or PKCS#7 such as CERT.RSA); needs --package or --apk")
+	cmd.Flags().StringVar(&packageName, "package", "", "package name for JNI calls (default: from --apk); needs --cert or --apk")
+	cmd.Flags().StringVar(&responseDir, "responses", "", "answer HTTP requests from canned responses in <dir>/<host>/<path>")
+	cmd.Flags().StringVar(&forwardAddr, "forward", "", "relay guest connections to this local TCP address (host:port)")
+	cmd.Flags().StringArrayVar(&sigFiles, "sigs", nil, "function signature database for stripped binaries (repeatable)")
+	cmd.Flags().BoolVar(&harvest, "harvest", false, "diff heap, stack, and .data/.bss after the run for new strings and key-sized blobs")
+	cmd.Flags().BoolVar(&cryptoTag, "crypto-tag", false, "tag functions that read crypto constant tables and report their key arguments")
+	cmd.Flags().StringArrayVar(&harvestAt, "harvest-at", nil, "also harvest when execution reaches this address or symbol (repeatable)")
+	cmd.Flags().StringVar(&covOut, "cov", "", "write basic-block coverage to this drcov file (Lighthouse, Dragon Dance)")
+	cmd.Flags().StringVar(&recordOut, "record", "", "record every instruction, register change, memory write, and stub call to this trace file")
+	cmd.Flags().StringVar(&callsOut, "calls", "", "write the call tree to this file: .dot, .json, or indented text (- for stdout)")
+}
+
 type traceCollector struct {
 	mu     sync.Mutex
 	events []*trace.Event
@@ -128,10 +239,7 @@ func (w *outputWriter) run() {
 }
 
 func (w *outputWriter) Write(line string) {
-	select {
-	case w.ch <- line:
-	default:
-	}
+	w.ch <- line
 }
 
 func (w *outputWriter) Close() {
@@ -272,6 +380,7 @@ func formatLine(addr uint64, code []byte, dis string, funcName string, events []
 	var hasContent bool
 
 	if funcName != "" {
+		funcName = emulator.DemangleName(funcName)
 		b.WriteString(colorize.FuncName(funcName))
 		visibleLen += len(funcName)
 		hasContent = true
@@ -315,6 +424,28 @@ func printHeader(w *outputWriter, binary string, base, entry uint64, numImports,
 	w.Write("")
 }
 
+// printDetectors writes the detector activation report below the header.
+func printDetectors(w *outputWriter, report []stubs.DetectorMatch) {
+	if len(report) == 0 {
+		return
+	}
+	for _, m := range report {
+		state := colorize.Detail("skipped")
+		if m.Activated {
+			state = colorize.FuncName(fmt.Sprintf("%d hooks", m.Hooks))
+		}
+		line := fmt.Sprintf("  %s %s %s %s",
+			colorize.Detail("Detector:"), colorize.FuncName(m.Name),
+			colorize.Detail(fmt.Sprintf("%.2f", m.Confidence)), state)
+		if m.Fingerprint != "" {
+			line += "  " + colorize.String(m.Fingerprint)
+		}
+		line += colorize.Detail(fmt.Sprintf("  (%d symbols)", m.Count))
+		w.Write(line)
+	}
+	w.Write("")
+}
+
 func printKeys(keys []setters.CapturedKey) {
 	if len(keys) == 0 {
 		return
@@ -415,12 +546,88 @@ func disasm(code []byte) string {
 	return inst.String()
 }
 
+// loadProperties applies --props and then --prop over the default device profile.
+func loadProperties() error {
+	android.ResetProperties()
+	if propFile != "" {
+		if err := android.LoadProperties(propFile); err != nil {
+			return fmt.Errorf("--props: %w", err)
+		}
+	}
+	for _, p := range propOverrides {
+		name, value, err := android.ParseProperty(p)
+		if err != nil {
+			return fmt.Errorf("--prop: %w", err)
+		}
+		android.SetProperty(name, value)
+	}
+	return nil
+}
+
+// loadJNIModel installs the --jni object model, or an empty one, and adds
+// the package identity from --apk, --cert and --package.
+func loadJNIModel() error {
+	m := jni.NewModel()
+	if jniModel != "" {
+		var err error
+		if m, err = jni.LoadModel(jniModel); err != nil {
+			return fmt.Errorf("--jni: %w", err)
+		}
+	}
+
+	if apkPath != "" || certPath != "" || packageName != "" {
+		// Guests read both the name and signatures[0]; don't leave either empty
+		if apkPath == "" && (certPath == "" || packageName == "") {
+			return errors.New("--cert and --package need each other unless --apk is given")
+		}
+		pkg := jni.Package{Name: packageName}
+		if apkPath != "" && (pkg.Name == "" || certPath == "") {
+			a, err := apk.Load(apkPath)
+			if err != nil {
+				return fmt.Errorf("--apk: %w", err)
+			}
+			if pkg.Name == "" {
+				if pkg.Name, err = a.PackageName(); err != nil {
+					return fmt.Errorf("--apk: %w", err)
+				}
+			}
+			if certPath == "" {
+				signers, err := a.SigningCertificates()
+				if err != nil {
+					return fmt.Errorf("--apk: %w", err)
+				}
+				pkg.Certs = signers.Certs
+			}
+		}
+		if certPath != "" {
+			signers, err := apk.LoadCertificate(certPath)
+			if err != nil {
+				return fmt.Errorf("--cert: %w", err)
+			}
+			pkg.Certs = signers.Certs
+		}
+		jni.AddPackage(m, pkg)
+	}
+
+	jni.SetModel(m)
+	return nil
+}
+
 func runTrace(cmd *cobra.Command, args []string) error {
 	if len(args) == 0 {
 		return cmd.Help()
 	}
 	binaryPath := args[0]
 
+	start, err := time.Parse(time.RFC3339, sessionTime)
+	if err != nil {
+		return fmt.Errorf("--time: %w", err)
+	}
+
+	if jsonOutput {
+		quiet, verbose = true, false
+	}
+
 	if verbose {
 		glog.Init(true)
 		stubs.Debug = true
@@ -438,27 +645,71 @@ func runTrace(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("load ELF: %w", err)
 	}
+	if _, err := identifyFunctions(info); err != nil {
+		return err
+	}
 
 	setters.ClearCapturedKeys()
+	setters.ClearMetadataDumps()
+	libc.ClearFiles()
+	libc.SetTime(start)
+	libc.SetSeed(sessionSeed)
+	if err := loadProperties(); err != nil {
+		return err
+	}
+	if err := loadJNIModel(); err != nil {
+		return err
+	}
+	if err := loadResponder(); err != nil {
+		return err
+	}
+
+	if il2cppMetadata != "" {
+		data, err := os.ReadFile(il2cppMetadata)
+		if err != nil {
+			return fmt.Errorf("read metadata: %w", err)
+		}
+		libc.AddFile("Metadata/global-metadata.dat", data)
+		setters.SetIL2CPPMetadata(data)
+	}
 
 	installed := stubs.Install(emu, info.Imports, info.Symbols)
 
 	hookHitCount := 0
 	installVtableStubHooks(emu, info, &hookHitCount)
+	if cryptoTag {
+		if err := setters.NewCryptoTagger(info, fingerprint.CryptoConstants(info)).Install(emu); err != nil {
+			return fmt.Errorf("crypto tagger: %w", err)
+		}
+	}
 
 	collector := &traceCollector{}
 	stubCallCount := 0
+	var rec *recording
 	stubs.DefaultRegistry.OnCall = func(category, name, detail string) {
 		stubCallCount++
+		if rec != nil {
+			rec.Event(category, name, detail)
+		}
 		e := trace.NewEvent(emu.PC(), category, name, detail)
 		trace.DefaultEnricher(e)
 		collector.Add(e)
 	}
 
 	entry := info.FindEntryPoint("")
+	if callTarget != nil {
+		// Natives are registered from JNI_OnLoad; Java_* exports need no setup
+		entry = info.FindJNIOnLoad()
+	}
+	if il2cppMetadata != "" {
+		entry = info.FindSymbol("il2cpp_init")
+		if entry == 0 {
+			return fmt.Errorf("il2cpp_init not found in %s", binaryPath)
+		}
+	}
 	entryName := ""
 	for name, addr := range info.Symbols {
-		if addr == entry {
+		if entry != 0 && addr == entry {
 			entryName = name
 			break
 		}
@@ -474,7 +725,16 @@ func runTrace(cmd *cobra.Command, args []string) error {
 	javaVM := jni.GetJavaVM()
 	mockObj := emu.GetMockObject()
 
-	if strings.Contains(entryName, "cocos_android_app_init") {
+	if entryName == "il2cpp_init" {
+		// int il2cpp_init(const char* domain_name)
+		domain := emu.Malloc(32)
+		emu.MemWriteString(domain, "IL2CPP Root Domain")
+		emu.SetX(0, domain)
+	} else if entryName == "JNI_OnLoad" && javaVM != 0 {
+		// jint JNI_OnLoad(JavaVM* vm, void* reserved)
+		emu.SetX(0, javaVM)
+		emu.SetX(1, 0)
+	} else if strings.Contains(entryName, "cocos_android_app_init") {
 		emu.SetX(0, javaVM)
 		emu.SetX(1, mockObj)
 	} else if strings.Contains(entryName, "lua_State") {
@@ -486,11 +746,29 @@ func runTrace(cmd *cobra.Command, args []string) error {
 	}
 
 	sentinel := uint64(0xDEADBEEF)
+	initialSP := emu.SP()
 	emu.SetLR(sentinel)
 	emu.HookAddress(sentinel, func(e *emulator.Emulator) bool {
 		return true
 	})
 
+	harvester, err := installHarvester(emu, info)
+	if err != nil {
+		return err
+	}
+	cov, err := installCoverage(emu)
+	if err != nil {
+		return err
+	}
+	var calls *calltree.Tracker
+	if callsOut != "" {
+		calls = calltree.New(info)
+		calls.Install(emu)
+	}
+	if rec, err = installRecorder(emu, info, binaryPath, entry); err != nil {
+		return err
+	}
+
 	addrToSym := make(map[uint64]string, len(info.Symbols))
 	for name, addr := range info.Symbols {
 		if existing, ok := addrToSym[addr]; !ok || len(name) < len(existing) {
@@ -509,9 +787,24 @@ func runTrace(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Imports: %d, Symbols: %d\n", len(info.Imports), len(info.Symbols))
 		fmt.Printf("Installed %d hooks\n", installed)
 		fmt.Printf("Entry: 0x%x (%s)\n", entry, entryName)
+		fmt.Println("\nDetectors:")
+		for _, m := range stubs.Report() {
+			fmt.Printf("  %s confidence=%.2f activated=%v hooks=%d %s\n",
+				m.Name, m.Confidence, m.Activated, m.Hooks, m.Fingerprint)
+			for pattern, syms := range m.Matched {
+				fmt.Printf("    %s: %s\n", pattern, strings.Join(syms, ", "))
+			}
+			if len(m.Missing) > 0 {
+				fmt.Printf("    missing: %s\n", strings.Join(m.Missing, ", "))
+			}
+			if len(m.Excluded) > 0 {
+				fmt.Printf("    excluded: %s\n", strings.Join(m.Excluded, ", "))
+			}
+		}
 		fmt.Println("\nStarting emulation...")
 	} else if !quiet {
 		printHeader(out, binaryPath, info.BaseAddr, entry, len(info.Imports), len(info.Symbols), installed, entryName)
+		printDetectors(out, stubs.Report())
 	}
 
 	count := 0
@@ -548,7 +841,7 @@ func runTrace(cmd *cobra.Command, args []string) error {
 		if verbose {
 			fmt.Printf("  [%3d] 0x%08x  %s", count, addr, dis)
 			if funcName != "" {
-				fmt.Printf("  <%s>", funcName)
+				fmt.Printf("  <%s>", emulator.DemangleName(funcName))
 			}
 			for _, ev := range events {
 				fmt.Printf("  %s %s", ev.PrimaryTag(), ev.Name)
@@ -562,12 +855,47 @@ func runTrace(cmd *cobra.Command, args []string) error {
 		}
 	})
 
-	err = emu.RunFrom(entry)
+	var runErr error
+	if entry != 0 {
+		runErr = emu.RunFrom(entry)
+	}
+	called, callErr := callNative(emu, info, initialSP, sentinel)
+	err = errors.Join(runErr, callErr)
+
+	// The run is reported and its files finished even when it failed; the
+	// command fails afterwards if an output could not be written or the
+	// call target could not be invoked
+	var failed error
+	if called == nil {
+		failed = callErr
+	}
 	if out != nil {
 		out.Close()
 	}
+	if harvester != nil {
+		harvester.Harvest(emu)
+	}
+	var covered []coverage.FuncCoverage
+	if cov != nil {
+		failed = errors.Join(failed, writeCoverage(cov, info))
+		covered = coverage.Summarize(info, cov.Blocks())
+	}
+	if calls != nil {
+		failed = errors.Join(failed, writeCallTree(calls))
+	}
+	if rec != nil {
+		failed = errors.Join(failed, rec.Close())
+	}
 
 	keys := setters.GetCapturedKeys()
+	natives := jni.RegisteredNatives()
+	hosts := network.GetCapturedHosts()
+	requests := network.GetHTTPRequests()
+	if jsonOutput {
+		r := newRunReport(binaryPath, entryName, count, err, keys, natives, addrToSym, called)
+		r.addTraffic(hosts, requests)
+		return errors.Join(writeReport(r), failed)
+	}
 	if verbose {
 		fmt.Printf("\nEmulation finished: %v\n", err)
 		fmt.Printf("Instructions: %d\n", count)
@@ -582,13 +910,62 @@ func runTrace(cmd *cobra.Command, args []string) error {
 		} else {
 			fmt.Println("\nNo keys captured")
 		}
+		if len(natives) > 0 {
+			fmt.Println("\n=== REGISTERED NATIVES ===")
+			for _, n := range natives {
+				fmt.Printf("  %s -> 0x%x %s\n", n, n.Fn, addrToSym[n.Fn])
+			}
+		}
+		if called != nil {
+			fmt.Printf("\nCall %s = %s\n", called.Method, jni.Describe(called.Value))
+		}
+		printTraffic(hosts, requests)
+		printCoverage(covered)
 	} else if quiet {
-		printQuietSummary(binaryPath, count, xorCount, retCount, brCount, stubCallCount, installed, hookHitCount, keys)
+		captured, harvested := splitHarvested(keys)
+		printQuietSummary(binaryPath, count, xorCount, retCount, brCount, stubCallCount, installed, hookHitCount, captured)
+		printHarvest(harvested)
+		printCallResult(called)
 	} else {
-		printKeys(keys)
-		printStats(count, keys, err)
+		captured, harvested := splitHarvested(keys)
+		printKeys(captured)
+		printHarvest(harvested)
+		printNatives(natives, addrToSym)
+		printTraffic(hosts, requests)
+		printCoverage(covered)
+		printCallResult(called)
+		printStats(count, captured, err)
+	}
+
+	if il2cppMetadata != "" {
+		failed = errors.Join(failed, writeMetadataDumps(setters.GetMetadataDumps()))
+	}
+	return failed
+}
+
+// writeMetadataDumps saves the IL2CPP metadata returned by the loader.
+func writeMetadataDumps(dumps []setters.MetadataDump) error {
+	if len(dumps) == 0 {
+		fmt.Println("No IL2CPP metadata captured")
+		return nil
 	}
 
+	// The last load wins; earlier ones are usually the same buffer
+	d := dumps[len(dumps)-1]
+	path := metadataOut
+	if path == "" {
+		path = il2cppMetadata + ".dec"
+	}
+	if err := os.WriteFile(path, d.Data, 0644); err != nil {
+		return fmt.Errorf("write metadata: %w", err)
+	}
+
+	state := "plain"
+	if d.Decrypted {
+		state = "decrypted"
+	}
+	fmt.Printf("metadata %s v%d %s (%d bytes) %s %s\n",
+		colorize.Detail("="), d.Version, state, len(d.Data), colorize.Detail("->"), path)
 	return nil
 }
 
@@ -659,8 +1036,9 @@ func isSetterSymbol(symName string, patterns []string) bool {
 		return false
 	}
 	lower := strings.ToLower(symName)
+	demangled := strings.ToLower(emulator.DemangleName(symName))
 	for _, p := range patterns {
-		if strings.Contains(lower, p) {
+		if strings.Contains(lower, p) || strings.Contains(demangled, p) {
 			return true
 		}
 	}
@@ -702,7 +1080,57 @@ func showInfo(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Base:   0x%x\n", elfInfo.BaseAddr)
 	fmt.Printf("End:    0x%x\n", elfInfo.EndAddr)
 	fmt.Printf("Entry:  0x%x\n", elfInfo.Entry)
-	fmt.Printf("Symbols: %d\n\n", len(elfInfo.Symbols))
+	fmt.Printf("Symbols: %d\n", len(elfInfo.Symbols))
+	fmt.Printf("Imports: %d\n\n", len(elfInfo.Imports))
+
+	identified, err := identifyFunctions(elfInfo)
+	if err != nil {
+		return err
+	}
+
+	fp := fingerprint.Analyze(elfInfo)
+	fmt.Printf("Engine:   %s\n", fp.Engine)
+	if fp.RuntimeLib != "" {
+		fmt.Printf("Runtime:  %s (%s)\n", fp.Runtime, fp.RuntimeLib)
+	} else {
+		fmt.Printf("Runtime:  %s\n", fp.Runtime)
+	}
+	if fp.Stripped {
+		fmt.Println("Stripped: yes")
+	} else {
+		fmt.Println("Stripped: no")
+	}
+	if len(fp.Protections) == 0 {
+		fmt.Println("Protections: none")
+	} else {
+		fmt.Println("Protections:")
+		for _, p := range fp.Protections {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	fmt.Println()
+
+	printIdentified(identified)
+	printCryptoConstants(fingerprint.CryptoConstants(elfInfo), elfInfo.AddrNames())
+	if len(infoCovs) > 0 {
+		if err := printInfoCoverage(elfInfo, infoCovs); err != nil {
+			return err
+		}
+	}
+
+	matches := stubs.Detect(emu, elfInfo.Symbols)
+
+	if len(matches) > 0 {
+		fmt.Println("Detectors:")
+		for _, m := range matches {
+			state := "skip"
+			if m.Activated {
+				state = "use "
+			}
+			fmt.Printf("  %s %-14s %.2f  %-24s %d symbols\n", state, m.Name, m.Confidence, m.Fingerprint, m.Count)
+		}
+		fmt.Println()
+	}
 
 	fmt.Println("Key entry points:")
 	entryPoint := elfInfo.FindEntryPoint("")
@@ -714,6 +1142,17 @@ func showInfo(cmd *cobra.Command, args []string) error {
 		fmt.Printf("  JNI_OnLoad: 0x%x\n", jniOnLoad)
 	}
 
+	if candidates := elfInfo.EntryCandidates(); len(candidates) > 0 {
+		fmt.Println("\nEntry candidates:")
+		for _, c := range candidates {
+			mark := " "
+			if c.Addr == entryPoint {
+				mark = "*"
+			}
+			fmt.Printf("  %s %d 0x%x %s\n", mark, c.Priority, c.Addr, c.Name)
+		}
+	}
+
 	interesting := []string{
 		"JNI_OnLoad",
 		"il2cpp_init",
@@ -734,5 +1173,9 @@ func showInfo(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if infoJNI {
+		printExports(jni.Exports(elfInfo.Symbols))
+	}
+
 	return nil
 }
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/zboralski/galago/internal/stubs/network"
+	"github.com/zboralski/galago/internal/ui/colorize"
+)
+
+// loadResponder resets the network capture and sets what answers guest
+// connections from --responses or --forward.
+func loadResponder() error {
+	network.ClearCapturedHosts()
+	network.ClearTraffic()
+
+	switch {
+	case responseDir != "" && forwardAddr != "":
+		return fmt.Errorf("--responses and --forward are mutually exclusive")
+	case responseDir != "":
+		if fi, err := os.Stat(responseDir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("--responses: %s is not a directory", responseDir)
+		}
+		network.SetResponder(network.Dir(responseDir))
+	case forwardAddr != "":
+		network.SetResponder(network.Forward(forwardAddr))
+	default:
+		network.SetResponder(nil)
+	}
+	return nil
+}
+
+// printTraffic lists the hosts the guest looked up or connected to and
+// the HTTP requests it sent.
+func printTraffic(hosts []network.CapturedHost, requests []network.HTTPRequest) {
+	if len(hosts) == 0 && len(requests) == 0 {
+		return
+	}
+	fmt.Println()
+	for _, h := range hosts {
+		addr := fmt.Sprintf("%s:%d", h.IP, h.Port)
+		if h.Hostname != "" {
+			addr = fmt.Sprintf("%s:%d", h.Hostname, h.Port)
+		}
+		fmt.Printf("host %s %s\n", colorize.String(addr), colorize.Detail(h.Source))
+	}
+	for _, r := range requests {
+		fmt.Printf("http %s %s%s", r.Method, colorize.String(r.Host), colorize.String(r.Target))
+		if len(r.Body) > 0 {
+			fmt.Printf(" %s", colorize.Detail(fmt.Sprintf("(%d bytes)", len(r.Body))))
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/trace"
+	"github.com/zboralski/galago/internal/ui/colorize"
+)
+
+var (
+	recordOut string
+
+	viewFunc  string
+	viewAddr  string
+	viewTags  []string
+	viewFrom  int
+	viewTo    int
+	viewRegs  bool
+	viewLimit int
+)
+
+// recording is a run being recorded for --record.
+type recording struct {
+	*trace.Recorder
+	f *os.File
+}
+
+// installRecorder starts recording the run for --record, or returns nil.
+func installRecorder(emu *emulator.Emulator, info *emulator.ELFInfo, binaryPath string, entry uint64) (*recording, error) {
+	if recordOut == "" {
+		return nil, nil
+	}
+	f, err := os.Create(recordOut)
+	if err != nil {
+		return nil, fmt.Errorf("--record: %w", err)
+	}
+	w := trace.NewWriter(f, trace.Header{Binary: binaryPath, Base: info.BaseAddr, Entry: entry})
+	rec := trace.NewRecorder(w, info)
+	if err := rec.Install(emu); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("--record: %w", err)
+	}
+	return &recording{rec, f}, nil
+}
+
+// Close finishes the trace file.
+func (r *recording) Close() error {
+	err := r.Recorder.Close()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("--record: %w", err)
+	}
+	return nil
+}
+
+func newTraceCmd() *cobra.Command {
+	traceCmd := &cobra.Command{
+		Use:   "trace",
+		Short: "Work with traces recorded by --record",
+	}
+	viewCmd := &cobra.Command{
+		Use:   "view <file.trace>",
+		Short: "Print a recorded trace without running the binary again",
+		Long: `Print a trace recorded with --record in the same format as a live run.
+Filters combine: an instruction is shown when it passes all of them.
+Instructions are numbered from 1 in the order they ran; --from and --to
+select a window of those numbers.`,
+		Args: cobra.ExactArgs(1),
+		RunE: viewTrace,
+	}
+	viewCmd.Flags().StringVar(&viewFunc, "func", "", "only instructions in functions whose name matches this regexp")
+	viewCmd.Flags().StringVar(&viewAddr, "addr", "", "only instructions in this address range (lo-hi, hex)")
+	viewCmd.Flags().StringArrayVar(&viewTags, "tag", nil, "only instructions with this tag, such as xor, crypto, or call (repeatable)")
+	viewCmd.Flags().IntVar(&viewFrom, "from", 0, "first instruction number to show")
+	viewCmd.Flags().IntVar(&viewTo, "to", 0, "last instruction number to show")
+	viewCmd.Flags().BoolVar(&viewRegs, "regs", false, "show the registers and memory each instruction changed")
+	viewCmd.Flags().IntVarP(&viewLimit, "num", "n", 0, "max instructions to show (0 for all)")
+	traceCmd.AddCommand(viewCmd)
+	return traceCmd
+}
+
+// traceFilter selects steps for trace view.
+type traceFilter struct {
+	fn     *regexp.Regexp
+	lo, hi uint64
+	tags   []string
+}
+
+func newTraceFilter() (*traceFilter, error) {
+	f := &traceFilter{hi: ^uint64(0)}
+	if viewFunc != "" {
+		re, err := regexp.Compile(viewFunc)
+		if err != nil {
+			return nil, fmt.Errorf("--func: %w", err)
+		}
+		f.fn = re
+	}
+	if viewAddr != "" {
+		lo, hi, ok := strings.Cut(viewAddr, "-")
+		var err error
+		if f.lo, err = parseHex(lo); err == nil && ok {
+			f.hi, err = parseHex(hi)
+		}
+		if err != nil || !ok || f.hi < f.lo {
+			return nil, fmt.Errorf("--addr: want lo-hi, got %q", viewAddr)
+		}
+	}
+	for _, tag := range viewTags {
+		f.tags = append(f.tags, "#"+strings.TrimPrefix(tag, "#"))
+	}
+	return f, nil
+}
+
+func parseHex(s string) (uint64, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+func (f *traceFilter) match(r *trace.Reader, step *trace.Step, dis string) bool {
+	if step.PC < f.lo || step.PC > f.hi {
+		return false
+	}
+	if f.fn != nil {
+		sym, ok := r.Symbol(step.PC)
+		if !ok || !f.fn.MatchString(sym.Name) && !f.fn.MatchString(emulator.DemangleName(sym.Name)) {
+			return false
+		}
+	}
+	if len(f.tags) == 0 {
+		return true
+	}
+	tags := instructionTags(dis)
+	for _, e := range step.Events {
+		tags = append(tags, e.Tags.Strings()...)
+	}
+	for _, want := range f.tags {
+		if containsTag(tags, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// viewTrace prints a recorded trace through the filters.
+func viewTrace(cmd *cobra.Command, args []string) error {
+	filter, err := newTraceFilter()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := trace.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	out := newOutputWriter()
+	defer out.Close()
+	out.Write(colorize.Header(fmt.Sprintf("%s  base 0x%x  entry 0x%x", r.Header.Binary, r.Header.Base, r.Header.Entry)))
+	out.Write("")
+
+	shown := 0
+	for {
+		step, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		if step.Index < viewFrom {
+			continue
+		}
+		if viewTo > 0 && step.Index > viewTo {
+			return nil
+		}
+
+		code := []byte{byte(step.Word), byte(step.Word >> 8), byte(step.Word >> 16), byte(step.Word >> 24)}
+		dis := disasm(code)
+		if !filter.match(r, step, dis) {
+			continue
+		}
+		if viewLimit > 0 && shown == viewLimit {
+			return nil
+		}
+		shown++
+
+		funcName := ""
+		if sym, ok := r.Symbol(step.PC); ok && sym.Addr == step.PC {
+			funcName = sym.Name
+		}
+		out.Write(formatLine(step.PC, code, dis, funcName, step.Events))
+		if viewRegs {
+			writeStepChanges(out, step)
+		}
+		if isBlockEnd(dis) && len(filter.tags) == 0 {
+			out.Write("")
+		}
+	}
+}
+
+// writeStepChanges prints the registers and memory a step changed under
+// its line. Stub writes are marked.
+func writeStepChanges(out *outputWriter, step *trace.Step) {
+	const indent = "                    "
+	if len(step.Regs) > 0 {
+		regs := make([]string, len(step.Regs))
+		for i, c := range step.Regs {
+			regs[i] = fmt.Sprintf("%s=0x%x", trace.RegName(c.Reg), c.Value)
+		}
+		out.Write(indent + colorize.Detail(strings.Join(regs, " ")))
+	}
+	for _, w := range step.Writes {
+		data := w.Data
+		more := ""
+		if len(data) > 32 {
+			data, more = data[:32], fmt.Sprintf("... (%d bytes)", len(w.Data))
+		}
+		line := fmt.Sprintf("[0x%x] = %s%s", w.Addr, hex.EncodeToString(data), more)
+		if w.Host {
+			line += " stub"
+		}
+		out.Write(indent + colorize.Detail(line))
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zboralski/galago/internal/stubs/jni"
+	"github.com/zboralski/galago/internal/stubs/network"
+	"github.com/zboralski/galago/internal/stubs/setters"
+)
+
+// runReport is the --json summary of a run.
+type runReport struct {
+	Binary       string         `json:"binary"`
+	Entry        string         `json:"entry"`
+	Instructions int            `json:"instructions"`
+	Error        string         `json:"error,omitempty"`
+	Keys         []keyReport    `json:"keys"`
+	Natives      []nativeReport `json:"natives,omitempty"`
+	Call         *callReport    `json:"call,omitempty"`
+	Hosts        []hostReport   `json:"hosts,omitempty"`
+	Requests     []httpReport   `json:"requests,omitempty"`
+}
+
+type keyReport struct {
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+	Source  string `json:"source"`
+	Address string `json:"address"`
+	Risk    string `json:"risk,omitempty"`
+}
+
+type nativeReport struct {
+	Class     string `json:"class"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Fn        string `json:"fn"`
+	Symbol    string `json:"symbol,omitempty"`
+}
+
+type callReport struct {
+	Method string   `json:"method"`
+	Args   []string `json:"args"`
+	Result string   `json:"result"`
+}
+
+type hostReport struct {
+	IP       string `json:"ip"`
+	Port     uint16 `json:"port"`
+	Hostname string `json:"hostname,omitempty"`
+	Source   string `json:"source"`
+}
+
+type httpReport struct {
+	FD      int               `json:"fd"`
+	Method  string            `json:"method"`
+	Host    string            `json:"host"`
+	Target  string            `json:"target"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// newRunReport collects the results of a run.
+func newRunReport(binary, entry string, count int, err error, keys []setters.CapturedKey, natives []jni.NativeMethod, addrToSym map[uint64]string, call *callResult) *runReport {
+	r := &runReport{
+		Binary:       filepath.Base(binary),
+		Entry:        entry,
+		Instructions: count,
+		Keys:         []keyReport{},
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	for _, k := range keys {
+		r.Keys = append(r.Keys, keyReport{
+			Type:    k.KeyType,
+			Value:   k.Value,
+			Source:  k.Source,
+			Address: fmt.Sprintf("0x%x", k.Address),
+			Risk:    k.RiskLevel,
+		})
+	}
+	for _, n := range natives {
+		r.Natives = append(r.Natives, nativeReport{
+			Class:     n.Class,
+			Name:      n.Name,
+			Signature: n.Signature,
+			Fn:        fmt.Sprintf("0x%x", n.Fn),
+			Symbol:    addrToSym[n.Fn],
+		})
+	}
+	if call != nil {
+		r.Call = &callReport{
+			Method: call.Method.String(),
+			Args:   call.Args,
+			Result: jni.Describe(call.Value),
+		}
+	}
+	return r
+}
+
+// addTraffic adds the captured hosts and HTTP requests to the report.
+func (r *runReport) addTraffic(hosts []network.CapturedHost, requests []network.HTTPRequest) {
+	for _, h := range hosts {
+		r.Hosts = append(r.Hosts, hostReport{
+			IP:       h.IP,
+			Port:     h.Port,
+			Hostname: h.Hostname,
+			Source:   h.Source,
+		})
+	}
+	for _, req := range requests {
+		headers := make(map[string]string, len(req.Header))
+		for name, values := range req.Header {
+			headers[name] = strings.Join(values, ", ")
+		}
+		r.Requests = append(r.Requests, httpReport{
+			FD:      req.FD,
+			Method:  req.Method,
+			Host:    req.Host,
+			Target:  req.Target,
+			Headers: headers,
+			Body:    string(req.Body),
+		})
+	}
+}
+
+// writeReport prints the report as indented JSON on stdout.
+func writeReport(r *runReport) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/fingerprint"
+	"github.com/zboralski/galago/internal/sigs"
+	"github.com/zboralski/galago/internal/stubs/setters"
+)
+
+var (
+	sigFiles []string
+
+	sigsMatch string
+	sigsOut   string
+)
+
+// identifyFunctions names functions a stripped binary's symbol table
+// lacks, from the crypto constant tables and the signature databases, and
+// adds them to info.Symbols so detectors and setter hooks see them.
+func identifyFunctions(info *emulator.ELFInfo) (map[string]uint64, error) {
+	db := sigs.Builtin
+	for _, path := range sigFiles {
+		loaded, err := sigs.Load(path)
+		if err != nil {
+			return nil, fmt.Errorf("--sigs: %w", err)
+		}
+		db = append(loaded, db...) // Given databases take precedence
+	}
+	found, err := sigs.Match(info, db)
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		found = make(map[string]uint64)
+	}
+	for name, addr := range setters.FindCryptoFunctions(info) {
+		if _, ok := found[name]; !ok {
+			found[name] = addr
+		}
+	}
+	for name, addr := range found {
+		info.Symbols[name] = addr
+	}
+	return found, nil
+}
+
+// printIdentified lists functions named by identifyFunctions for info.
+func printIdentified(found map[string]uint64) {
+	if len(found) == 0 {
+		return
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return found[names[i]] < found[names[j]] })
+	fmt.Println("Identified functions:")
+	for _, name := range names {
+		fmt.Printf("  0x%x %s\n", found[name], emulator.DemangleName(name))
+	}
+	fmt.Println()
+}
+
+// buildSigs writes a signature database built from unstripped binaries.
+func buildSigs(cmd *cobra.Command, args []string) error {
+	var keep func(string) bool
+	if sigsMatch != "" {
+		re, err := regexp.Compile(sigsMatch)
+		if err != nil {
+			return fmt.Errorf("--match: %w", err)
+		}
+		keep = func(name string) bool {
+			return re.MatchString(name) || re.MatchString(emulator.DemangleName(name))
+		}
+	}
+
+	var db []sigs.Signature
+	for _, path := range args {
+		built, err := sigs.Build(path, keep)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d signatures\n", path, len(built))
+		db = append(db, built...)
+	}
+
+	out := os.Stdout
+	if sigsOut != "" {
+		f, err := os.Create(sigsOut)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return sigs.Write(out, db)
+}
+
+// printCryptoConstants lists the crypto constants found by the static scan
+// and the functions that use them, for info.
+func printCryptoConstants(consts []fingerprint.CryptoConstant, names map[uint64]string) {
+	if len(consts) == 0 {
+		return
+	}
+	fmt.Println("Crypto constants:")
+	for _, c := range consts {
+		where := "table"
+		if c.Code {
+			where = "code"
+		}
+		var funcs []string
+		for _, fn := range c.Funcs {
+			if name, ok := names[fn]; ok {
+				funcs = append(funcs, emulator.DemangleName(name))
+			} else {
+				funcs = append(funcs, fmt.Sprintf("sub_%x", fn))
+			}
+		}
+		fmt.Printf("  %-7s %-13s %-5s 0x%x  %s\n", c.Algorithm, c.Name, where, c.Addr, strings.Join(funcs, ", "))
+	}
+	fmt.Println()
+}
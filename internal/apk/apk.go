@@ -0,0 +1,177 @@
+// Package apk reads the parts of an Android APK that native code can observe
+// through the framework: the package name and the signing certificates.
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Scheme identifies where signing certificates were found.
+type Scheme string
+
+const (
+	SchemeV1   Scheme = "v1" // JAR signing: META-INF/*.RSA, *.DSA, *.EC
+	SchemeV2   Scheme = "v2" // APK Signature Scheme v2 block
+	SchemeV3   Scheme = "v3" // APK Signature Scheme v3 block
+	SchemeFile Scheme = "file"
+)
+
+// Signers holds one DER certificate per signer.
+type Signers struct {
+	Scheme Scheme
+	Certs  [][]byte
+}
+
+// ErrNotSigned is returned when an APK has no signature in any scheme.
+var ErrNotSigned = errors.New("apk: no signing certificate found")
+
+// APK is an APK read into memory, for reading several of its parts
+// without opening it again.
+type APK struct {
+	data []byte
+	zip  *zip.Reader
+}
+
+// Load reads the APK at path.
+func Load(path string) (*APK, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("apk: %w", err)
+	}
+	return &APK{data: data, zip: zr}, nil
+}
+
+// SigningCertificates returns the signer certificates of the APK at path.
+func SigningCertificates(path string) (*Signers, error) {
+	a, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return a.SigningCertificates()
+}
+
+// SigningCertificates returns the signer certificates, preferring the v3
+// block, then v2, then v1 JAR signatures; the same order the platform
+// verifies them in.
+func (a *APK) SigningCertificates() (*Signers, error) {
+	block, err := signingBlock(a.data)
+	if err != nil && !errors.Is(err, errNoSigningBlock) {
+		return nil, err
+	}
+	if block != nil {
+		for _, s := range []struct {
+			id     uint32
+			scheme Scheme
+		}{{blockIDv3, SchemeV3}, {blockIDv2, SchemeV2}} {
+			value, ok := block[s.id]
+			if !ok {
+				continue
+			}
+			certs, err := blockCertificates(value)
+			if err != nil {
+				return nil, fmt.Errorf("apk: %s block: %w", s.scheme, err)
+			}
+			if len(certs) > 0 {
+				return &Signers{Scheme: s.scheme, Certs: certs}, nil
+			}
+		}
+	}
+
+	certs, err := jarCertificates(a.zip)
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, ErrNotSigned
+	}
+	return &Signers{Scheme: SchemeV1, Certs: certs}, nil
+}
+
+// jarCertificates returns the first certificate of each META-INF signature
+// block file.
+func jarCertificates(zr *zip.Reader) ([][]byte, error) {
+	var names []string
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		dir, name := path.Split(f.Name)
+		if dir != "META-INF/" {
+			continue
+		}
+		switch strings.ToUpper(path.Ext(name)) {
+		case ".RSA", ".DSA", ".EC":
+			names = append(names, f.Name)
+			files[f.Name] = f
+		}
+	}
+	sort.Strings(names)
+
+	var certs [][]byte
+	for _, name := range names {
+		raw, err := readZipFile(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("apk: %s: %w", name, err)
+		}
+		chain, err := pkcs7Certificates(raw)
+		if err != nil {
+			return nil, fmt.Errorf("apk: %s: %w", name, err)
+		}
+		if len(chain) > 0 {
+			certs = append(certs, chain[0])
+		}
+	}
+	return certs, nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// LoadCertificate reads a user-supplied certificate: PEM, DER, or a PKCS#7
+// signature block such as META-INF/CERT.RSA.
+func LoadCertificate(path string) (*Signers, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(string(data), "-----BEGIN") {
+		var certs [][]byte
+		for {
+			var b *pem.Block
+			b, data = pem.Decode(data)
+			if b == nil {
+				break
+			}
+			if b.Type == "CERTIFICATE" {
+				certs = append(certs, b.Bytes)
+			}
+		}
+		if len(certs) == 0 {
+			return nil, fmt.Errorf("%s: no CERTIFICATE block", path)
+		}
+		return &Signers{Scheme: SchemeFile, Certs: certs}, nil
+	}
+
+	if certs, err := pkcs7Certificates(data); err == nil && len(certs) > 0 {
+		return &Signers{Scheme: SchemeFile, Certs: certs[:1]}, nil
+	}
+	return &Signers{Scheme: SchemeFile, Certs: [][]byte{data}}, nil
+}
@@ -0,0 +1,279 @@
+package apk
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func testCert(t *testing.T, cn string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(1<<31, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// testPKCS7 wraps cert in a SignedData ContentInfo with no signer infos.
+func testPKCS7(t *testing.T, cert []byte) []byte {
+	t.Helper()
+	data, _ := asn1.Marshal(struct{ OID asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}})
+	sd, err := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      asn1.RawValue
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      asn1.RawValue{FullBytes: data},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert},
+		SignerInfos:      asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ci
+}
+
+// testManifest builds a binary AndroidManifest.xml with a UTF-16 string
+// pool and a single <manifest package=...> element.
+func testManifest(pkg string) []byte {
+	le := binary.LittleEndian
+	strs := []string{"manifest", "package", pkg}
+
+	var offsets, data []byte
+	for _, s := range strs {
+		offsets = le.AppendUint32(offsets, uint32(len(data)))
+		units := utf16.Encode([]rune(s))
+		data = le.AppendUint16(data, uint16(len(units)))
+		for _, u := range units {
+			data = le.AppendUint16(data, u)
+		}
+		data = le.AppendUint16(data, 0)
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	var pool []byte
+	pool = le.AppendUint16(pool, chunkStringPool)
+	pool = le.AppendUint16(pool, 28)
+	pool = le.AppendUint32(pool, uint32(28+len(offsets)+len(data)))
+	pool = le.AppendUint32(pool, uint32(len(strs)))
+	pool = le.AppendUint32(pool, 0) // styles
+	pool = le.AppendUint32(pool, 0) // flags: UTF-16
+	pool = le.AppendUint32(pool, uint32(28+len(offsets)))
+	pool = le.AppendUint32(pool, 0)
+	pool = append(append(pool, offsets...), data...)
+
+	var elem []byte
+	elem = le.AppendUint16(elem, chunkStartElement)
+	elem = le.AppendUint16(elem, 16)
+	elem = le.AppendUint32(elem, 36+20)
+	elem = le.AppendUint32(elem, 1)          // line
+	elem = le.AppendUint32(elem, 0xffffffff) // comment
+	elem = le.AppendUint32(elem, 0xffffffff) // ns
+	elem = le.AppendUint32(elem, 0)          // name: "manifest"
+	elem = le.AppendUint16(elem, 20)         // attributeStart
+	elem = le.AppendUint16(elem, 20)         // attributeSize
+	elem = le.AppendUint16(elem, 1)          // attributeCount
+	elem = le.AppendUint16(elem, 0)
+	elem = le.AppendUint16(elem, 0)
+	elem = le.AppendUint16(elem, 0)
+	elem = le.AppendUint32(elem, 0xffffffff) // attr ns
+	elem = le.AppendUint32(elem, 1)          // attr name: "package"
+	elem = le.AppendUint32(elem, 2)          // raw value
+	elem = le.AppendUint16(elem, 8)
+	elem = append(elem, 0, 3) // TYPE_STRING
+	elem = le.AppendUint32(elem, 2)
+
+	var doc []byte
+	doc = le.AppendUint16(doc, chunkXML)
+	doc = le.AppendUint16(doc, 8)
+	doc = le.AppendUint32(doc, uint32(8+len(pool)+len(elem)))
+	return append(append(doc, pool...), elem...)
+}
+
+func testZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withV2Block inserts an APK Signing Block carrying a v2 signer for cert
+// before the central directory.
+func withV2Block(apk, cert []byte) []byte {
+	le := binary.LittleEndian
+	lp := func(parts ...[]byte) []byte {
+		var body []byte
+		for _, p := range parts {
+			body = append(body, p...)
+		}
+		return append(le.AppendUint32(nil, uint32(len(body))), body...)
+	}
+
+	signed := append(append(lp(), lp(lp(cert))...), lp()...) // digests, certificates, attributes
+	signer := append(append(lp(signed), lp()...), lp()...)   // signed data, signatures, public key
+	value := lp(lp(signer))
+
+	pair := le.AppendUint64(nil, uint64(4+len(value)))
+	pair = le.AppendUint32(pair, blockIDv2)
+	pair = append(pair, value...)
+
+	size := uint64(len(pair) + blockTrailer)
+	block := le.AppendUint64(nil, size)
+	block = append(block, pair...)
+	block = le.AppendUint64(block, size)
+	block = append(block, blockMagic...)
+
+	eocd := findEOCD(apk)
+	cd := le.Uint32(apk[eocd+16:])
+	out := append(append(append([]byte{}, apk[:cd]...), block...), apk[cd:]...)
+	le.PutUint32(out[eocd+len(block)+16:], cd+uint32(len(block)))
+	return out
+}
+
+func TestSigningCertificates(t *testing.T) {
+	dir := t.TempDir()
+	v1Cert := testCert(t, "v1")
+	v2Cert := testCert(t, "v2")
+
+	apk := testZip(t, map[string][]byte{
+		"AndroidManifest.xml":   testManifest("com.example.game"),
+		"META-INF/CERT.RSA":     testPKCS7(t, v1Cert),
+		"lib/arm64-v8a/libx.so": {0x7f, 'E', 'L', 'F'},
+	})
+	v1Path := filepath.Join(dir, "v1.apk")
+	os.WriteFile(v1Path, apk, 0o644)
+	v2Path := filepath.Join(dir, "v2.apk")
+	os.WriteFile(v2Path, withV2Block(apk, v2Cert), 0o644)
+
+	for _, tc := range []struct {
+		path   string
+		scheme Scheme
+		cert   []byte
+	}{
+		{v1Path, SchemeV1, v1Cert},
+		{v2Path, SchemeV2, v2Cert},
+	} {
+		s, err := SigningCertificates(tc.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.scheme, err)
+		}
+		if s.Scheme != tc.scheme || len(s.Certs) != 1 || !bytes.Equal(s.Certs[0], tc.cert) {
+			t.Errorf("%s: got scheme %s with %d certs", tc.scheme, s.Scheme, len(s.Certs))
+		}
+	}
+
+	// The v2 block must not disturb ZIP reading
+	a, err := Load(v2Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := a.PackageName(); err != nil || name != "com.example.game" {
+		t.Errorf("PackageName = %q, %v; want com.example.game", name, err)
+	}
+	if s, err := a.SigningCertificates(); err != nil || s.Scheme != SchemeV2 {
+		t.Errorf("SigningCertificates after PackageName = %+v, %v", s, err)
+	}
+
+	unsigned := filepath.Join(dir, "unsigned.apk")
+	os.WriteFile(unsigned, testZip(t, map[string][]byte{"classes.dex": nil}), 0o644)
+	if _, err := SigningCertificates(unsigned); err != ErrNotSigned {
+		t.Errorf("unsigned: err = %v, want ErrNotSigned", err)
+	}
+}
+
+func TestSigningBlockSize(t *testing.T) {
+	le := binary.LittleEndian
+	apk := withV2Block(testZip(t, map[string][]byte{"classes.dex": nil}), testCert(t, "v2"))
+	cd := uint64(le.Uint32(apk[findEOCD(apk)+16:]))
+
+	// The size in the footer is checked before the block is located by it
+	for _, size := range []uint64{1<<64 - 1, cd, cd - 7, blockTrailer - 1} {
+		bad := bytes.Clone(apk)
+		le.PutUint64(bad[cd-blockTrailer:], size)
+		if _, err := signingBlock(bad); err == nil {
+			t.Errorf("size %#x: no error", size)
+		}
+	}
+	if _, err := signingBlock(apk); err != nil {
+		t.Errorf("valid block: %v", err)
+	}
+
+	// A central directory at EOF, with the footer in the EOCD comment
+	eocd := le.AppendUint32(nil, eocdMagic)
+	eocd = append(eocd, make([]byte, 12)...)
+	eocd = le.AppendUint32(eocd, eocdSize+blockTrailer) // Central directory offset
+	eocd = le.AppendUint16(eocd, blockTrailer)          // Comment length
+	eocd = le.AppendUint64(eocd, 1<<64-1)
+	eocd = append(eocd, blockMagic...)
+	if _, err := signingBlock(eocd); err == nil {
+		t.Error("size 2^64-1 at EOF: no error")
+	}
+}
+
+func TestLoadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	cert := testCert(t, "user")
+
+	files := map[string][]byte{
+		"cert.pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+		"cert.der": cert,
+		"CERT.RSA": testPKCS7(t, cert),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, data, 0o644)
+		s, err := LoadCertificate(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(s.Certs) != 1 || !bytes.Equal(s.Certs[0], cert) {
+			t.Errorf("%s: certificate mismatch", name)
+		}
+	}
+}
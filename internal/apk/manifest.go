@@ -0,0 +1,180 @@
+package apk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Binary XML chunk types
+const (
+	chunkStringPool   = 0x0001
+	chunkXML          = 0x0003
+	chunkStartElement = 0x0102
+)
+
+const stringPoolUTF8 = 1 << 8
+
+// PackageName returns the package name of the APK at path.
+func PackageName(path string) (string, error) {
+	a, err := Load(path)
+	if err != nil {
+		return "", err
+	}
+	return a.PackageName()
+}
+
+// PackageName returns the package attribute of the APK's binary
+// AndroidManifest.xml.
+func (a *APK) PackageName() (string, error) {
+	for _, f := range a.zip.File {
+		if f.Name != "AndroidManifest.xml" {
+			continue
+		}
+		manifest, err := readZipFile(f)
+		if err != nil {
+			return "", fmt.Errorf("apk: AndroidManifest.xml: %w", err)
+		}
+		name, err := manifestPackage(manifest)
+		if err != nil {
+			return "", fmt.Errorf("apk: AndroidManifest.xml: %w", err)
+		}
+		return name, nil
+	}
+	return "", errors.New("apk: no AndroidManifest.xml")
+}
+
+// manifestPackage walks a binary XML document to the <manifest> element and
+// returns its package attribute.
+func manifestPackage(data []byte) (string, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != chunkXML {
+		return "", errors.New("not binary XML")
+	}
+
+	var pool []string
+	off := uint32(binary.LittleEndian.Uint16(data[2:])) // XML header size
+	for int(off)+8 <= len(data) {
+		typ := binary.LittleEndian.Uint16(data[off:])
+		size := binary.LittleEndian.Uint32(data[off+4:])
+		if size < 8 || int(off)+int(size) > len(data) {
+			return "", fmt.Errorf("bad chunk at %#x", off)
+		}
+		chunk := data[off : off+size]
+
+		switch typ {
+		case chunkStringPool:
+			var err error
+			if pool, err = stringPool(chunk); err != nil {
+				return "", err
+			}
+		case chunkStartElement:
+			if len(chunk) < 36 {
+				return "", errors.New("truncated start element")
+			}
+			if str(pool, binary.LittleEndian.Uint32(chunk[20:])) != "manifest" {
+				break
+			}
+			attrStart := 16 + uint32(binary.LittleEndian.Uint16(chunk[24:]))
+			attrSize := uint32(binary.LittleEndian.Uint16(chunk[26:]))
+			count := uint32(binary.LittleEndian.Uint16(chunk[28:]))
+			for i := uint32(0); i < count; i++ {
+				a := attrStart + i*attrSize
+				if int(a)+20 > len(chunk) {
+					break
+				}
+				if str(pool, binary.LittleEndian.Uint32(chunk[a+4:])) == "package" {
+					return str(pool, binary.LittleEndian.Uint32(chunk[a+8:])), nil
+				}
+			}
+			return "", errors.New("manifest has no package attribute")
+		}
+		off += size
+	}
+	return "", errors.New("no manifest element")
+}
+
+func str(pool []string, i uint32) string {
+	if int(i) < len(pool) {
+		return pool[i]
+	}
+	return ""
+}
+
+// stringPool decodes a ResStringPool chunk.
+func stringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errors.New("truncated string pool")
+	}
+	headerSize := uint32(binary.LittleEndian.Uint16(chunk[2:]))
+	count := binary.LittleEndian.Uint32(chunk[8:])
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := binary.LittleEndian.Uint32(chunk[20:])
+	if uint64(headerSize)+uint64(count)*4 > uint64(len(chunk)) || stringsStart > uint32(len(chunk)) {
+		return nil, errors.New("bad string pool header")
+	}
+
+	pool := make([]string, count)
+	for i := range pool {
+		off := stringsStart + binary.LittleEndian.Uint32(chunk[headerSize+uint32(i)*4:])
+		if off >= uint32(len(chunk)) {
+			continue
+		}
+		if flags&stringPoolUTF8 != 0 {
+			pool[i] = utf8String(chunk[off:])
+		} else {
+			pool[i] = utf16String(chunk[off:])
+		}
+	}
+	return pool, nil
+}
+
+// utf8String decodes a UTF-8 pool entry: UTF-16 length, UTF-8 length, bytes.
+func utf8String(b []byte) string {
+	_, n1 := poolLen8(b)
+	if n1 >= len(b) {
+		return ""
+	}
+	size, n2 := poolLen8(b[n1:])
+	start := n1 + n2
+	if start+size > len(b) {
+		return ""
+	}
+	return string(b[start : start+size])
+}
+
+// utf16String decodes a UTF-16 pool entry: length in units, then units.
+func utf16String(b []byte) string {
+	if len(b) < 2 {
+		return ""
+	}
+	n := int(binary.LittleEndian.Uint16(b))
+	start := 2
+	if n&0x8000 != 0 {
+		if len(b) < 4 {
+			return ""
+		}
+		n = (n&0x7fff)<<16 | int(binary.LittleEndian.Uint16(b[2:]))
+		start = 4
+	}
+	if start+2*n > len(b) {
+		return ""
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[start+2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// poolLen8 reads a UTF-8 pool length: one byte, or two if the high bit is
+// set.
+func poolLen8(b []byte) (int, int) {
+	if len(b) == 0 {
+		return 0, 1
+	}
+	if b[0]&0x80 != 0 && len(b) > 1 {
+		return int(b[0]&0x7f)<<8 | int(b[1]), 2
+	}
+	return int(b[0]), 1
+}
@@ -0,0 +1,56 @@
+package apk
+
+import (
+	"encoding/asn1"
+	"errors"
+	"fmt"
+)
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional,tag:0"` // [0] EXPLICIT SignedData
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// pkcs7Certificates returns the DER certificates embedded in a PKCS#7
+// SignedData blob, in encoded order. Only the certificate set is decoded;
+// signatures are not verified.
+func pkcs7Certificates(der []byte) ([][]byte, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("pkcs7: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("pkcs7: content type %v is not signedData", ci.ContentType)
+	}
+
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("pkcs7: signedData: %w", err)
+	}
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, errors.New("pkcs7: no certificates")
+	}
+
+	var certs [][]byte
+	rest := sd.Certificates.Bytes
+	for len(rest) > 0 {
+		var cert asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &cert); err != nil {
+			return nil, fmt.Errorf("pkcs7: certificate: %w", err)
+		}
+		certs = append(certs, cert.FullBytes)
+	}
+	return certs, nil
+}
@@ -0,0 +1,138 @@
+package apk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// APK Signing Block IDs
+const (
+	blockIDv2 = 0x7109871a
+	blockIDv3 = 0xf05368c0
+)
+
+const (
+	eocdMagic    = 0x06054b50
+	eocdSize     = 22
+	blockMagic   = "APK Sig Block 42"
+	blockTrailer = 24 // u64 size + 16-byte magic
+)
+
+var errNoSigningBlock = errors.New("apk: no signing block")
+
+// signingBlock returns the ID-value pairs of the APK Signing Block, which
+// sits immediately before the ZIP central directory.
+func signingBlock(data []byte) (map[uint32][]byte, error) {
+	eocd := findEOCD(data)
+	if eocd < 0 {
+		return nil, errors.New("apk: not a ZIP file")
+	}
+	cdOffset := uint64(binary.LittleEndian.Uint32(data[eocd+16:]))
+	if cdOffset < blockTrailer || cdOffset > uint64(len(data)) {
+		return nil, errNoSigningBlock
+	}
+
+	footer := data[cdOffset-blockTrailer : cdOffset]
+	if string(footer[8:]) != blockMagic {
+		return nil, errNoSigningBlock
+	}
+	size := binary.LittleEndian.Uint64(footer)
+	if size < blockTrailer || size > cdOffset-8 {
+		return nil, fmt.Errorf("apk: bad signing block size %d", size)
+	}
+
+	start := cdOffset - size - 8
+	if binary.LittleEndian.Uint64(data[start:]) != size {
+		return nil, errors.New("apk: signing block size mismatch")
+	}
+
+	pairs := data[start+8 : cdOffset-blockTrailer]
+	block := make(map[uint32][]byte)
+	for len(pairs) > 0 {
+		if len(pairs) < 12 {
+			return nil, errors.New("apk: truncated signing block")
+		}
+		n := binary.LittleEndian.Uint64(pairs)
+		if n < 4 || n > uint64(len(pairs)-8) {
+			return nil, fmt.Errorf("apk: bad signing block entry length %d", n)
+		}
+		id := binary.LittleEndian.Uint32(pairs[8:])
+		block[id] = pairs[12 : 8+n]
+		pairs = pairs[8+n:]
+	}
+	return block, nil
+}
+
+// findEOCD returns the offset of the End of Central Directory record.
+func findEOCD(data []byte) int {
+	if len(data) < eocdSize {
+		return -1
+	}
+	stop := len(data) - eocdSize - 0xffff // Maximum comment length
+	if stop < 0 {
+		stop = 0
+	}
+	for i := len(data) - eocdSize; i >= stop; i-- {
+		if binary.LittleEndian.Uint32(data[i:]) == eocdMagic {
+			return i
+		}
+	}
+	return -1
+}
+
+// blockCertificates returns the first certificate of each signer in a v2
+// or v3 block value. Both schemes put the certificate list second in the
+// signer's signed data:
+//
+//	signers:     lp(lp(signer)...)
+//	signer:      lp(signed data) ...
+//	signed data: lp(digests) lp(lp(certificate)...) ...
+func blockCertificates(value []byte) ([][]byte, error) {
+	signers, _, err := lengthPrefixed(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs [][]byte
+	for len(signers) > 0 {
+		var signer []byte
+		if signer, signers, err = lengthPrefixed(signers); err != nil {
+			return nil, err
+		}
+		signed, _, err := lengthPrefixed(signer)
+		if err != nil {
+			return nil, err
+		}
+		_, rest, err := lengthPrefixed(signed) // digests
+		if err != nil {
+			return nil, err
+		}
+		list, _, err := lengthPrefixed(rest)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			continue
+		}
+		cert, _, err := lengthPrefixed(list)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, bytes.Clone(cert))
+	}
+	return certs, nil
+}
+
+// lengthPrefixed splits a u32 little-endian length-prefixed value from b.
+func lengthPrefixed(b []byte) (value, rest []byte, err error) {
+	if len(b) < 4 {
+		return nil, nil, errors.New("truncated length prefix")
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, fmt.Errorf("length %d exceeds %d remaining bytes", n, len(b)-4)
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
@@ -0,0 +1,85 @@
+// Package callstack follows guest calls with a shadow call stack.
+package callstack
+
+// Op is what call tracking needs to know about an instruction.
+type Op uint8
+
+const (
+	OpOther   Op = iota
+	OpCall       // BL
+	OpCallReg    // BLR Xn, BLRAAZ, BLRABZ: the register is insn>>5&0x1f
+	OpRet        // RET, RETAA, RETAB
+)
+
+// Decode recognizes the instructions that make and end calls.
+func Decode(insn uint32) Op {
+	switch {
+	case insn&0xfc000000 == 0x94000000:
+		return OpCall
+	case insn&0xfffff000 == 0xd63f0000:
+		return OpCallReg
+	case insn&0xfffff000 == 0xd65f0000:
+		return OpRet
+	}
+	return OpOther
+}
+
+// Frame is a call in progress.
+type Frame struct {
+	Entry uint64    // Callee entry
+	Ret   uint64    // Return address
+	SP    uint64    // Stack pointer at entry
+	Args  [8]uint64 // X0-X7 at entry
+	Data  any       // The caller's record of the call, if any
+}
+
+// Stack is a shadow call stack. Calls are matched to returns by the
+// stack pointer rather than by RET, so that stubs, which return by
+// setting PC, and unwinding past several frames pop them too.
+type Stack struct {
+	Max    int // Oldest frames are dropped past this many; 0 for no limit
+	frames []Frame
+}
+
+// Push enters a call.
+func (s *Stack) Push(f Frame) {
+	if s.Max > 0 && len(s.frames) == s.Max {
+		s.frames = append(s.frames[:0], s.frames[1:]...)
+	}
+	s.frames = append(s.frames, f)
+}
+
+// Top returns the innermost call, or nil.
+func (s *Stack) Top() *Frame {
+	if len(s.frames) == 0 {
+		return nil
+	}
+	return &s.frames[len(s.frames)-1]
+}
+
+// Len returns the number of calls in progress.
+func (s *Stack) Len() int {
+	return len(s.frames)
+}
+
+// Unwind drops the calls entered below sp, which have returned.
+func (s *Stack) Unwind(sp uint64) {
+	n := len(s.frames)
+	for n > 0 && s.frames[n-1].SP < sp {
+		n--
+	}
+	s.frames = s.frames[:n]
+}
+
+// Leave unwinds to sp and pops the innermost call if execution at addr
+// with the stack pointer sp is its return. It returns the popped call.
+func (s *Stack) Leave(addr, sp uint64) (Frame, bool) {
+	s.Unwind(sp)
+	n := len(s.frames)
+	if n == 0 || s.frames[n-1].Ret != addr || s.frames[n-1].SP != sp {
+		return Frame{}, false
+	}
+	f := s.frames[n-1]
+	s.frames = s.frames[:n-1]
+	return f, true
+}
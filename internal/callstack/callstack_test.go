@@ -0,0 +1,38 @@
+package callstack
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	for insn, want := range map[uint32]Op{
+		0x94000010: OpCall,    // BL
+		0xd63f0200: OpCallReg, // BLR X16
+		0xd63f081f: OpCallReg, // BLRAAZ X0
+		0xd65f03c0: OpRet,     // RET
+		0xd65f0bff: OpRet,     // RETAA
+		0x14000010: OpOther,   // B
+	} {
+		if got := Decode(insn); got != want {
+			t.Errorf("Decode(%08x) = %d, want %d", insn, got, want)
+		}
+	}
+}
+
+func TestStack(t *testing.T) {
+	s := Stack{Max: 3}
+	for i, sp := range []uint64{0x1000, 0xff0, 0xfe0, 0xfd0} {
+		s.Push(Frame{Entry: uint64(i), Ret: 0x100 + uint64(i), SP: sp})
+	}
+	if s.Len() != 3 || s.Top().Entry != 3 {
+		t.Fatalf("after 4 pushes with Max 3: len %d, top %+v", s.Len(), s.Top())
+	}
+	if _, ok := s.Leave(0x103, 0xfe0); ok {
+		t.Error("Leave at the wrong stack pointer popped a call")
+	}
+	// The call at 0xfd0 was unwound by the stack pointer moving above it
+	if s.Len() != 2 || s.Top().Entry != 2 {
+		t.Errorf("after unwinding: len %d, top %+v", s.Len(), s.Top())
+	}
+	if f, ok := s.Leave(0x102, 0xfe0); !ok || f.Entry != 2 {
+		t.Errorf("Leave = %+v, %v; want the call to 2", f, ok)
+	}
+}
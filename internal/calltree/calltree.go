@@ -0,0 +1,229 @@
+// Package calltree reconstructs the dynamic call tree of an emulation
+// run: every BL and BLR, stub calls, and virtual calls through a vtable,
+// with the arguments each callee was entered with and what it returned.
+package calltree
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/zboralski/galago/internal/callstack"
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// Node is one call.
+type Node struct {
+	Addr     uint64    // Callee entry
+	Name     string    // Symbol, sub_<addr>, or vtable[<slot>]
+	Kind     string    // "entry", "call", "indirect", "vtable", "stub"
+	Site     uint64    // Call instruction; 0 for an entry
+	Slot     int       // vtable slot for "vtable" calls, else -1
+	Depth    int       // 0 for an entry
+	Args     [8]uint64 // X0-X7 at entry
+	ArgText  [8]string // Args decoded as string, integer, or pointer
+	Ret      uint64    // X0 on return
+	RetText  string    // Ret decoded
+	Returned bool      // False if the run ended or unwound past the call
+	Children []*Node
+}
+
+// maxNodes bounds the recorded tree; later calls are still tracked so
+// returns match, but not kept.
+const maxNodes = 200000
+
+// Tracker builds the call tree from executed instructions.
+type Tracker struct {
+	Roots     []*Node // One per run entered
+	Truncated bool    // More than maxNodes calls were made
+
+	names   map[uint64]string
+	stubs   map[uint64]bool
+	vtables uint64 // Base of the emulator's vtable stubs
+	insns   map[uint64]callInsn
+	stack   callstack.Stack // Frame.Data is the call's node, nil once the tree is full
+	pending *pendingCall
+	nodes   int
+}
+
+// pendingCall is a call just made, with the arguments as they were at
+// the call: stub hooks run before the callee is seen and may already have
+// set X0 or written through a pointer.
+type pendingCall struct {
+	callInsn
+	args [8]uint64
+	text [8]string
+}
+
+// callInsn is what the tracker knows about an instruction.
+type callInsn struct {
+	kind string // "call", "indirect", "vtable", or "" for anything else
+	site uint64
+	slot int
+}
+
+// New prepares a tracker for a loaded binary. Calls into imports are
+// marked as stubs.
+func New(info *emulator.ELFInfo) *Tracker {
+	t := &Tracker{
+		names: info.AddrNames(),
+		stubs: make(map[uint64]bool),
+		insns: make(map[uint64]callInsn),
+	}
+	for _, addr := range info.Imports {
+		t.stubs[addr] = true
+	}
+	return t
+}
+
+// Install hooks every instruction.
+func (t *Tracker) Install(emu *emulator.Emulator) {
+	t.vtables = emu.GetVtableStubs()
+	emu.HookCode(t.step)
+}
+
+func (t *Tracker) step(emu *emulator.Emulator, addr uint64, size uint32) {
+	sp := emu.SP()
+	call := t.pending
+	t.pending = nil
+	if call != nil && emu.LR() == call.site+4 { // Not a stale call from a stopped run
+		t.enter(emu, addr, sp, *call)
+	} else {
+		t.leave(emu, addr, sp)
+		if t.stack.Len() == 0 {
+			t.enter(emu, addr, sp, t.call(emu, callInsn{kind: "entry", slot: -1}))
+		}
+	}
+
+	insn, ok := t.insns[addr]
+	if !ok {
+		insn = t.classify(emu, addr)
+		t.insns[addr] = insn
+	}
+	if insn.kind != "" {
+		call := t.call(emu, insn)
+		t.pending = &call
+	}
+}
+
+// classify recognizes BL and BLR. A BLR right after a load from
+// [Xn, #imm] into its register is a virtual call of slot imm/8.
+func (t *Tracker) classify(emu *emulator.Emulator, addr uint64) callInsn {
+	insn, err := emu.MemReadU32(addr)
+	if err != nil {
+		return callInsn{slot: -1}
+	}
+	switch callstack.Decode(insn) {
+	case callstack.OpCall:
+		return callInsn{kind: "call", site: addr, slot: -1}
+	case callstack.OpCallReg:
+		prev, err := emu.MemReadU32(addr - 4)
+		if err == nil && prev&0xffc00000 == 0xf9400000 && prev&0x1f == insn>>5&0x1f { // LDR Xn, [Xm, #imm]
+			return callInsn{kind: "vtable", site: addr, slot: int(prev >> 10 & 0xfff)}
+		}
+		return callInsn{kind: "indirect", site: addr, slot: -1}
+	}
+	return callInsn{slot: -1}
+}
+
+// leave pops the calls that have returned. Execution back at a call's
+// return address with its stack pointer restored is its return, whether
+// through RET or a stub; frames above the stack pointer were unwound.
+func (t *Tracker) leave(emu *emulator.Emulator, addr, sp uint64) {
+	if f, ok := t.stack.Leave(addr, sp); ok {
+		if node, ok := f.Data.(*Node); ok {
+			node.Ret = emu.X(0)
+			node.RetText = decode(emu, node.Ret)
+			node.Returned = true
+		}
+	}
+}
+
+func (t *Tracker) call(emu *emulator.Emulator, insn callInsn) pendingCall {
+	c := pendingCall{callInsn: insn}
+	for i := range c.args {
+		c.args[i] = emu.X(i)
+		c.text[i] = decode(emu, c.args[i])
+	}
+	return c
+}
+
+func (t *Tracker) enter(emu *emulator.Emulator, addr, sp uint64, call pendingCall) {
+	f := callstack.Frame{Entry: addr, Ret: call.site + 4, SP: sp, Args: call.args}
+	if call.kind == "entry" {
+		f.Ret = emu.LR()
+	}
+	var parent *Node
+	if top := t.stack.Top(); top != nil {
+		parent, _ = top.Data.(*Node)
+	}
+	if parent == nil && t.stack.Len() > 0 { // Under a call that was not kept
+		t.stack.Push(f)
+		return
+	}
+	if t.nodes == maxNodes {
+		t.Truncated = true
+		t.stack.Push(f)
+		return
+	}
+
+	node := &Node{
+		Addr:    addr,
+		Name:    t.name(addr),
+		Kind:    call.kind,
+		Site:    call.site,
+		Slot:    call.slot,
+		Depth:   t.stack.Len(),
+		Args:    call.args,
+		ArgText: call.text,
+	}
+	switch {
+	case addr >= t.vtables && addr < t.vtables+emulator.VtableStubCount*4:
+		node.Kind, node.Slot = "vtable", int(addr-t.vtables)/4
+		node.Name = fmt.Sprintf("vtable[%d]", node.Slot)
+	case t.stubs[addr]:
+		node.Kind = "stub"
+	}
+	if node.Kind != "vtable" {
+		node.Slot = -1
+	}
+
+	if parent != nil {
+		parent.Children = append(parent.Children, node)
+	} else {
+		t.Roots = append(t.Roots, node)
+	}
+	t.nodes++
+	f.Data = node
+	t.stack.Push(f)
+}
+
+func (t *Tracker) name(addr uint64) string {
+	if name, ok := t.names[addr]; ok {
+		return name
+	}
+	return fmt.Sprintf("sub_%x", addr)
+}
+
+// decode shows a register as a quoted C string if it points at one, as a
+// signed integer if it is small, or in hex.
+func decode(emu *emulator.Emulator, v uint64) string {
+	if int64(v) > -0x10000 && int64(v) < 0x10000 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	if data, err := emu.MemRead(v, maxString); err == nil {
+		n := 0
+		for n < len(data) && data[n] >= 0x20 && data[n] <= 0x7e {
+			n++
+		}
+		switch {
+		case n >= 2 && n < len(data) && data[n] == 0:
+			return strconv.Quote(string(data[:n]))
+		case n == len(data):
+			return strconv.Quote(string(data)) + "..."
+		}
+	}
+	return fmt.Sprintf("0x%x", v)
+}
+
+// maxString is how much of a string argument is shown.
+const maxString = 64
@@ -0,0 +1,105 @@
+package calltree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+func TestTracker(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	code := uint64(emulator.CodeBase)
+	f, strlen, g := code+0x100, code+0x200, code+0x300
+	emu.MemWrite(code, []byte{
+		0x40, 0x00, 0x00, 0x94, // BL f
+		0x1f, 0x20, 0x03, 0xd5, // NOP
+	})
+	emu.MemWrite(f, []byte{
+		0xfd, 0x7b, 0xbf, 0xa9, // STP X29, X30, [SP, #-16]!
+		0xfd, 0x03, 0x00, 0x91, // MOV X29, SP
+		0x3e, 0x00, 0x00, 0x94, // BL strlen
+		0x30, 0x0c, 0x40, 0xf9, // LDR X16, [X1, #24]
+		0x00, 0x02, 0x3f, 0xd6, // BLR X16
+		0xfd, 0x7b, 0xc1, 0xa8, // LDP X29, X30, [SP], #16
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+	})
+	emu.MemWrite(g, []byte{
+		0xe0, 0x00, 0x80, 0xd2, // MOV X0, #7
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+	})
+	emu.HookAddress(strlen, func(e *emulator.Emulator) bool {
+		s, _ := e.MemReadString(e.X(0), 0)
+		e.SetX(0, uint64(len(s)))
+		stubs.ReturnFromStub(e)
+		return false
+	})
+
+	info := &emulator.ELFInfo{
+		Symbols: map[string]uint64{"start": code, "f": f, "strlen": strlen, "g": g},
+		Imports: map[string]uint64{"strlen": strlen},
+	}
+	tr := New(info)
+	tr.Install(emu)
+
+	key := emu.Malloc(16)
+	emu.MemWriteString(key, "key")
+	obj := emu.Malloc(32)
+	emu.MemWriteU64(obj+24, g)
+	emu.SetX(0, key)
+	emu.SetX(1, obj)
+	emu.SetLR(code + 0x800)
+	if err := emu.Run(code, code+8); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	var text bytes.Buffer
+	if err := tr.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	ptr := fmt.Sprintf("0x%x", obj)
+	want := `start("key", ` + ptr + `) = ?
+  f("key", ` + ptr + `) = 7  call 0x10000
+    strlen("key", ` + ptr + `) = 3  stub 0x10108
+    g(3, ` + ptr + `) = 7  vtable slot 3 0x10110
+`
+	if text.String() != want {
+		t.Errorf("WriteText =\n%s\nwant\n%s", text.String(), want)
+	}
+
+	var dot bytes.Buffer
+	if err := tr.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{`"strlen" [style=dashed];`, `"start" -> "f" [label=1];`, `"f" -> "g" [label=1];`} {
+		if !strings.Contains(dot.String(), line) {
+			t.Errorf("WriteDOT missing %q:\n%s", line, dot.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := tr.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Calls []jsonNode `json:"calls"`
+	}
+	if err := json.Unmarshal(js.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Calls) != 1 || len(out.Calls[0].Calls) != 1 || len(out.Calls[0].Calls[0].Calls) != 2 {
+		t.Fatalf("WriteJSON = %s", js.String())
+	}
+	if vg := out.Calls[0].Calls[0].Calls[1]; vg.Name != "g" || vg.Slot == nil || *vg.Slot != 3 || vg.Ret == nil || *vg.Ret != "7" || len(vg.Args) != 8 {
+		t.Errorf("vtable call = %+v", vg)
+	}
+}
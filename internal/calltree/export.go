@@ -0,0 +1,156 @@
+package calltree
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// WriteText writes the tree indented by depth, one call per line:
+// name(args) = return value, then the kind of call and its site.
+// Arguments stop at the last nonzero register.
+func (t *Tracker) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		ret := "?"
+		if n.Returned {
+			ret = n.RetText
+		}
+		fmt.Fprintf(bw, "%s%s(%s) = %s", strings.Repeat("  ", n.Depth), emulator.DemangleName(n.Name), strings.Join(n.args(), ", "), ret)
+		switch n.Kind {
+		case "entry":
+		case "vtable":
+			fmt.Fprintf(bw, "  vtable slot %d 0x%x", n.Slot, n.Site)
+		default:
+			fmt.Fprintf(bw, "  %s 0x%x", n.Kind, n.Site)
+		}
+		fmt.Fprintln(bw)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	for _, root := range t.Roots {
+		walk(root)
+	}
+	if t.Truncated {
+		fmt.Fprintf(bw, "... truncated after %d calls\n", maxNodes)
+	}
+	return bw.Flush()
+}
+
+// args returns the decoded arguments up to the last nonzero one.
+func (n *Node) args() []string {
+	last := len(n.Args)
+	for last > 0 && n.Args[last-1] == 0 {
+		last--
+	}
+	return n.ArgText[:last]
+}
+
+// WriteDOT writes the call graph for Graphviz: one node per function and
+// one edge per caller and callee, labeled with the number of calls.
+// Stubs are dashed.
+func (t *Tracker) WriteDOT(w io.Writer) error {
+	type edge struct{ from, to string }
+	counts := make(map[edge]int)
+	stubs := make(map[string]bool)
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.Kind == "stub" || strings.HasPrefix(n.Name, "vtable[") { // Emulator vtable stubs
+			stubs[n.Name] = true
+		}
+		for _, c := range n.Children {
+			counts[edge{n.Name, c.Name}]++
+			walk(c)
+		}
+	}
+	for _, root := range t.Roots {
+		walk(root)
+	}
+	edges := make([]edge, 0, len(counts))
+	for e := range counts {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		return edges[i].to < edges[j].to
+	})
+	names := make([]string, 0, len(stubs))
+	for name := range stubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	label := func(name string) string { return strconv.Quote(emulator.DemangleName(name)) }
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph calls {")
+	fmt.Fprintln(bw, "  node [shape=box, fontname=monospace];")
+	for _, name := range names {
+		fmt.Fprintf(bw, "  %s [style=dashed];\n", label(name))
+	}
+	for _, e := range edges {
+		fmt.Fprintf(bw, "  %s -> %s [label=%d];\n", label(e.from), label(e.to), counts[e])
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// jsonNode is a call in the JSON export.
+type jsonNode struct {
+	Addr  string     `json:"addr"`
+	Name  string     `json:"name"`
+	Kind  string     `json:"kind"`
+	Site  string     `json:"site,omitempty"`
+	Slot  *int       `json:"slot,omitempty"`
+	Depth int        `json:"depth"`
+	Args  []string   `json:"args"`
+	Ret   *string    `json:"ret,omitempty"`
+	Calls []jsonNode `json:"calls,omitempty"`
+}
+
+// WriteJSON writes the tree as nested calls with all eight argument
+// registers decoded. ret is absent for calls that never returned.
+func (t *Tracker) WriteJSON(w io.Writer) error {
+	var convert func(n *Node) jsonNode
+	convert = func(n *Node) jsonNode {
+		j := jsonNode{
+			Addr:  fmt.Sprintf("0x%x", n.Addr),
+			Name:  n.Name,
+			Kind:  n.Kind,
+			Depth: n.Depth,
+			Args:  n.ArgText[:],
+		}
+		if n.Site != 0 {
+			j.Site = fmt.Sprintf("0x%x", n.Site)
+		}
+		if n.Slot >= 0 {
+			j.Slot = &n.Slot
+		}
+		if n.Returned {
+			j.Ret = &n.RetText
+		}
+		for _, c := range n.Children {
+			j.Calls = append(j.Calls, convert(c))
+		}
+		return j
+	}
+	out := struct {
+		Calls     []jsonNode `json:"calls"`
+		Truncated bool       `json:"truncated,omitempty"`
+	}{Calls: []jsonNode{}, Truncated: t.Truncated}
+	for _, root := range t.Roots {
+		out.Calls = append(out.Calls, convert(root))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
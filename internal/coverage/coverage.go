@@ -0,0 +1,178 @@
+// Package coverage records the basic blocks an emulation run executes,
+// exports them in drcov format for Lighthouse (IDA, Binary Ninja) and
+// Ghidra's Dragon Dance, and summarizes them per function.
+package coverage
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// Block is an executed basic block.
+type Block struct {
+	Addr uint64
+	Size uint32
+	Hits uint64
+}
+
+// Coverage collects executed blocks.
+type Coverage struct {
+	blocks map[uint64]*Block
+}
+
+// New returns an empty collector.
+func New() *Coverage {
+	return &Coverage{blocks: make(map[uint64]*Block)}
+}
+
+// Install hooks block execution.
+func (c *Coverage) Install(emu *emulator.Emulator) error {
+	return emu.HookBlock(func(e *emulator.Emulator, addr uint64, size uint32) {
+		c.Add(addr, size)
+	})
+}
+
+// Add records one execution of a block.
+func (c *Coverage) Add(addr uint64, size uint32) {
+	b, ok := c.blocks[addr]
+	if !ok {
+		b = &Block{Addr: addr, Size: size}
+		c.blocks[addr] = b
+	}
+	if size > b.Size {
+		b.Size = size
+	}
+	b.Hits++
+}
+
+// Blocks returns the executed blocks in address order.
+func (c *Coverage) Blocks() []Block {
+	blocks := make([]Block, 0, len(c.blocks))
+	for _, b := range c.blocks {
+		blocks = append(blocks, *b)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Addr < blocks[j].Addr })
+	return blocks
+}
+
+// FuncCoverage is how many of a function's static basic blocks ran.
+type FuncCoverage struct {
+	Name   string
+	Addr   uint64
+	Size   uint64
+	Blocks int
+	Hit    int
+}
+
+// Summarize counts the executed blocks of every function blocks touch.
+// Function bounds come from symbol sizes, or the next .eh_frame start
+// when a function has no size. Each function is split into basic blocks
+// at branches and branch targets; a block counts as hit when its first
+// instruction ran.
+func Summarize(info *emulator.ELFInfo, blocks []Block) []FuncCoverage {
+	blocks = append([]Block(nil), blocks...)
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Addr < blocks[j].Addr })
+	ran := make(map[uint64]bool)
+	for _, b := range blocks {
+		for pc := b.Addr; pc < b.Addr+uint64(b.Size); pc += 4 {
+			ran[pc] = true
+		}
+	}
+
+	names := info.AddrNames()
+
+	var funcs []FuncCoverage
+	for _, fn := range functions(info) {
+		if !touched(blocks, fn.Addr, fn.Addr+fn.Size) {
+			continue
+		}
+		code := codeAt(info, fn.Addr, fn.Size)
+		if code == nil {
+			continue
+		}
+		fn.Name = names[fn.Addr]
+		for _, leader := range leaders(code, fn.Addr) {
+			fn.Blocks++
+			if ran[leader] {
+				fn.Hit++
+			}
+		}
+		funcs = append(funcs, fn)
+	}
+	return funcs
+}
+
+// functions lists function bounds in address order.
+func functions(info *emulator.ELFInfo) []FuncCoverage {
+	var funcs []FuncCoverage
+	for addr, size := range info.FuncSizes {
+		funcs = append(funcs, FuncCoverage{Addr: addr, Size: size})
+	}
+	for i, addr := range info.FuncStarts {
+		if _, ok := info.FuncSizes[addr]; ok || i+1 == len(info.FuncStarts) {
+			continue
+		}
+		funcs = append(funcs, FuncCoverage{Addr: addr, Size: info.FuncStarts[i+1] - addr})
+	}
+	sort.Slice(funcs, func(i, j int) bool { return funcs[i].Addr < funcs[j].Addr })
+	return funcs
+}
+
+// touched reports whether any of the sorted blocks starts in [start, end).
+func touched(blocks []Block, start, end uint64) bool {
+	i := sort.Search(len(blocks), func(i int) bool { return blocks[i].Addr >= start })
+	return i < len(blocks) && blocks[i].Addr < end
+}
+
+func codeAt(info *emulator.ELFInfo, addr, size uint64) []byte {
+	for _, seg := range info.Segments {
+		if seg.IsExecutable() && addr >= seg.VAddr && addr+size <= seg.VAddr+uint64(len(seg.Data)) {
+			return seg.Data[addr-seg.VAddr : addr-seg.VAddr+size]
+		}
+	}
+	return nil
+}
+
+// leaders returns the first instruction of each basic block in code: the
+// start, each branch target inside it, and each instruction after a
+// branch or return. Calls do not end a block.
+func leaders(code []byte, start uint64) []uint64 {
+	end := start + uint64(len(code)&^3)
+	set := map[uint64]bool{start: true}
+	for off := 0; off+4 <= len(code); off += 4 {
+		pc := start + uint64(off)
+		target, ok, ends := branch(binary.LittleEndian.Uint32(code[off:]), pc)
+		if ok && target >= start && target < end {
+			set[target] = true
+		}
+		if ends && pc+4 < end {
+			set[pc+4] = true
+		}
+	}
+	addrs := make([]uint64, 0, len(set))
+	for addr := range set {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	return addrs
+}
+
+// branch decodes a branch: its direct target if it has one, and whether
+// it ends a basic block.
+func branch(insn uint32, pc uint64) (target uint64, direct, ends bool) {
+	switch {
+	case insn&0xfc000000 == 0x14000000: // B
+		return pc + uint64(int64(int32(insn<<6))>>4), true, true
+	case insn&0xff000010 == 0x54000000, // B.cond
+		insn&0x7e000000 == 0x34000000: // CBZ, CBNZ
+		return pc + uint64(int64(int32(insn<<8))>>11&^3), true, true
+	case insn&0x7e000000 == 0x36000000: // TBZ, TBNZ
+		return pc + uint64(int64(int32(insn<<13))>>16&^3), true, true
+	case insn&0xfffffc1f == 0xd61f0000, // BR
+		insn&0xfffffc1f == 0xd65f0000: // RET
+		return 0, false, true
+	}
+	return 0, false, false
+}
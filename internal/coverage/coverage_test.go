@@ -0,0 +1,72 @@
+package coverage
+
+import (
+	"bytes"
+	"debug/elf"
+	"reflect"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+func TestCoverage(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	code := uint64(emulator.CodeBase)
+	fn := []byte{
+		0x60, 0x00, 0x00, 0xb4, // CBZ X0, #12
+		0x20, 0x00, 0x80, 0xd2, // MOV X0, #1
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+		0x40, 0x00, 0x80, 0xd2, // MOV X0, #2
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+	}
+	emu.MemWrite(code, fn)
+
+	cov := New()
+	if err := cov.Install(emu); err != nil {
+		t.Fatal(err)
+	}
+	emu.SetX(0, 1)
+	emu.SetLR(code + 0x100)
+	if err := emu.Run(code, code+0x100); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	blocks := cov.Blocks()
+	if want := []Block{{code, 4, 1}, {code + 4, 8, 1}}; !reflect.DeepEqual(blocks, want) {
+		t.Fatalf("Blocks = %+v, want %+v", blocks, want)
+	}
+
+	info := &emulator.ELFInfo{
+		Path:      "/data/app/lib/arm64/libf.so",
+		Symbols:   map[string]uint64{"f": code},
+		Segments:  []emulator.Segment{{VAddr: code, Data: fn, Flags: elf.PF_R | elf.PF_X}},
+		BaseAddr:  code,
+		EndAddr:   code + 0x1000,
+		FuncSizes: map[uint64]uint64{code: uint64(len(fn))},
+	}
+	got := Summarize(info, blocks)
+	if want := []FuncCoverage{{Name: "f", Addr: code, Size: 20, Blocks: 3, Hit: 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Summarize = %+v, want %+v", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDrcov(&buf, info, append(blocks, Block{Addr: 0xdead0000, Size: 4})); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadDrcov(&buf, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, blocks) {
+		t.Errorf("ReadDrcov = %+v, want %+v", read, blocks)
+	}
+
+	onlyA, onlyB := Diff(blocks, []Block{{code, 4, 1}, {code + 12, 8, 1}})
+	if len(onlyA) != 1 || onlyA[0].Addr != code+4 || len(onlyB) != 1 || onlyB[0].Addr != code+12 {
+		t.Errorf("Diff = %+v, %+v", onlyA, onlyB)
+	}
+}
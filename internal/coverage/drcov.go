@@ -0,0 +1,162 @@
+package coverage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// WriteDrcov writes the blocks inside the loaded binary as a drcov
+// version 2 log with one module, which Lighthouse and Dragon Dance load
+// against the library's disassembly.
+func WriteDrcov(w io.Writer, info *emulator.ELFInfo, blocks []Block) error {
+	var inside []Block
+	for _, b := range blocks {
+		if b.Addr >= info.BaseAddr && b.Addr < info.EndAddr {
+			inside = append(inside, b)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "DRCOV VERSION: 2\n")
+	fmt.Fprintf(bw, "DRCOV FLAVOR: galago\n")
+	fmt.Fprintf(bw, "Module Table: version 2, count 1\n")
+	fmt.Fprintf(bw, "Columns: id, base, end, entry, checksum, timestamp, path\n")
+	fmt.Fprintf(bw, "  0, 0x%016x, 0x%016x, 0x%016x, 0x00000000, 0x00000000, %s\n",
+		info.BaseAddr, info.EndAddr, info.Entry, info.Path)
+	fmt.Fprintf(bw, "BB Table: %d bbs\n", len(inside))
+	entry := make([]byte, 8) // uint32 start offset, uint16 size, uint16 module id
+	for _, b := range inside {
+		binary.LittleEndian.PutUint32(entry[0:], uint32(b.Addr-info.BaseAddr))
+		binary.LittleEndian.PutUint16(entry[4:], uint16(min(b.Size, 0xffff)))
+		binary.LittleEndian.PutUint16(entry[6:], 0)
+		bw.Write(entry)
+	}
+	return bw.Flush()
+}
+
+// ReadDrcov reads the blocks of info's binary from a drcov log, by module
+// file name or as the only module, and places them at its load address.
+// Hit counts are not recorded in drcov and read as 1.
+func ReadDrcov(r io.Reader, info *emulator.ELFInfo) ([]Block, error) {
+	br := bufio.NewReader(r)
+	line := func() (string, error) {
+		s, err := br.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("drcov: truncated header")
+		}
+		return strings.TrimRight(s, "\r\n"), nil
+	}
+
+	var (
+		count   int
+		columns []string
+		modules = make(map[string]string) // id -> path
+		want    = filepath.Base(info.Path)
+		module  = -1
+	)
+	for {
+		s, err := line()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(s, "Module Table:"):
+			n := strings.LastIndex(s, "count ")
+			if n < 0 {
+				return nil, fmt.Errorf("drcov: bad module table %q", s)
+			}
+			if count, err = strconv.Atoi(strings.TrimSpace(s[n+len("count "):])); err != nil {
+				return nil, fmt.Errorf("drcov: bad module table %q", s)
+			}
+		case strings.HasPrefix(s, "Columns:"):
+			for _, c := range strings.Split(strings.TrimPrefix(s, "Columns:"), ",") {
+				columns = append(columns, strings.TrimSpace(c))
+			}
+			for i := 0; i < count; i++ {
+				s, err := line()
+				if err != nil {
+					return nil, err
+				}
+				fields := strings.SplitN(s, ",", len(columns))
+				if len(fields) != len(columns) {
+					return nil, fmt.Errorf("drcov: bad module %q", s)
+				}
+				var id, path string
+				for j, c := range columns {
+					switch c {
+					case "id":
+						id = strings.TrimSpace(fields[j])
+					case "path":
+						path = strings.TrimSpace(fields[j])
+					}
+				}
+				modules[id] = path
+			}
+		case strings.HasPrefix(s, "BB Table:"):
+			for id, path := range modules {
+				if filepath.Base(path) == want || len(modules) == 1 {
+					if module, err = strconv.Atoi(id); err != nil {
+						return nil, fmt.Errorf("drcov: bad module id %q", id)
+					}
+				}
+			}
+			if module < 0 {
+				return nil, fmt.Errorf("drcov: no module %s", want)
+			}
+			var n int
+			if _, err := fmt.Sscanf(s, "BB Table: %d bbs", &n); err != nil {
+				return nil, fmt.Errorf("drcov: bad block table %q", s)
+			}
+			return readBlocks(br, n, uint16(module), info.BaseAddr)
+		}
+	}
+}
+
+func readBlocks(r io.Reader, n int, module uint16, base uint64) ([]Block, error) {
+	var blocks []Block
+	entry := make([]byte, 8)
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(r, entry); err != nil {
+			return nil, fmt.Errorf("drcov: block %d of %d: %w", i, n, err)
+		}
+		if binary.LittleEndian.Uint16(entry[6:]) != module {
+			continue
+		}
+		blocks = append(blocks, Block{
+			Addr: base + uint64(binary.LittleEndian.Uint32(entry[0:])),
+			Size: uint32(binary.LittleEndian.Uint16(entry[4:])),
+			Hits: 1,
+		})
+	}
+	return blocks, nil
+}
+
+// Diff returns the blocks only a has and only b has, by start address.
+func Diff(a, b []Block) (onlyA, onlyB []Block) {
+	inA := make(map[uint64]bool, len(a))
+	inB := make(map[uint64]bool, len(b))
+	for _, x := range a {
+		inA[x.Addr] = true
+	}
+	for _, x := range b {
+		inB[x.Addr] = true
+	}
+	for _, x := range a {
+		if !inB[x.Addr] {
+			onlyA = append(onlyA, x)
+		}
+	}
+	for _, x := range b {
+		if !inA[x.Addr] {
+			onlyB = append(onlyB, x)
+		}
+	}
+	return onlyA, onlyB
+}
@@ -0,0 +1,2208 @@
+package emulator
+
+// Itanium C++ ABI demangler.
+//
+// The parser builds a small node tree and prints it the way libc++abi's
+// __cxa_demangle does, so names match what the guest would see at runtime:
+//
+//	_ZN7cocos2d9FileUtils11setXXTeaKeyEPKci
+//	cocos2d::FileUtils::setXXTeaKey(char const*, int)
+//
+// Types are printed in two halves (left and right of the declarator) so that
+// function pointers and arrays come out as "void (*)(int)" and "int (&) [4]".
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotMangled is returned by Demangle for names without the _Z prefix.
+var ErrNotMangled = errors.New("not an Itanium C++ mangled name")
+
+// Demangle decodes an Itanium C++ ABI mangled symbol name, including special
+// names such as "vtable for X", thunks, and guard variables.
+func Demangle(name string) (string, error) {
+	var pos int
+	switch {
+	case strings.HasPrefix(name, "_Z"):
+		pos = 2
+	case strings.HasPrefix(name, "__Z"):
+		pos = 3
+	default:
+		return "", ErrNotMangled
+	}
+	return runDemangler(name, pos, func(d *demangler) node {
+		n := d.parseEncoding()
+		if d.look(0) == '.' {
+			n = &cloneSuffix{encoding: n, suffix: d.s[d.pos:]}
+			d.pos = len(d.s)
+		}
+		return n
+	})
+}
+
+// DemangleType decodes a mangled type, e.g. "PKc" -> "char const*".
+// __cxa_demangle accepts bare types as well as symbol names.
+func DemangleType(s string) (string, error) {
+	return runDemangler(s, 0, (*demangler).parseType)
+}
+
+// demangledNames caches DemangleName, which trace output and symbol
+// matching call for the same names over and over. A full cache is dropped
+// and refilled, so a long run keeps its hot names without the cache
+// growing with every symbol it sees.
+var (
+	demangledNames   = make(map[string]string)
+	demangledNamesMu sync.Mutex
+)
+
+// maxDemangledNames bounds the DemangleName cache.
+const maxDemangledNames = 1 << 16
+
+// DemangleName returns the demangled form of a symbol, or name unchanged if it
+// is not a mangled C++ name. ELF version suffixes (@VER, @@VER) are preserved.
+func DemangleName(name string) string {
+	demangledNamesMu.Lock()
+	v, ok := demangledNames[name]
+	demangledNamesMu.Unlock()
+	if ok {
+		return v
+	}
+	d := name
+	base, version := name, ""
+	if idx := strings.IndexByte(name, '@'); idx > 0 {
+		base, version = name[:idx], name[idx:]
+	}
+	if s, err := Demangle(base); err == nil {
+		d = s + version
+	}
+	demangledNamesMu.Lock()
+	if len(demangledNames) >= maxDemangledNames {
+		demangledNames = make(map[string]string)
+	}
+	demangledNames[name] = d
+	demangledNamesMu.Unlock()
+	return d
+}
+
+// runDemangler parses s from pos with parse and prints the result.
+func runDemangler(s string, pos int, parse func(*demangler) node) (result string, err error) {
+	d := &demangler{s: s, pos: pos}
+	defer func() {
+		if r := recover(); r != nil {
+			de, ok := r.(demangleError)
+			if !ok {
+				panic(r)
+			}
+			result, err = "", de
+		}
+	}()
+
+	n := parse(d)
+	if d.pos != len(d.s) {
+		d.fail("trailing characters")
+	}
+	for _, fr := range d.forwardRefs {
+		if fr.index >= len(d.templateParams) {
+			d.fail("unresolved template parameter")
+		}
+		fr.ref = d.templateParams[fr.index]
+	}
+	return nodeString(n), nil
+}
+
+// demangleError reports where parsing stopped.
+type demangleError struct {
+	msg string
+	pos int
+}
+
+func (e demangleError) Error() string {
+	return fmt.Sprintf("demangle: %s at offset %d", e.msg, e.pos)
+}
+
+// demangler holds the parse state for one mangled name.
+type demangler struct {
+	s   string
+	pos int
+
+	subs           []node               // Substitution candidates (S_, S0_, ...)
+	templateParams []node               // Template arguments of the innermost encoding (T_, T0_, ...)
+	forwardRefs    []*templateParamNode // T_ seen before its template arguments (conversion operators)
+
+	inConversion  int // Parsing a conversion operator type: template args belong to the operator
+	permitForward int // Inside a conversion operator type: T_ may precede its template args
+	inLambda      int // Parsing lambda parameters: T_ is an auto parameter
+}
+
+// nameState records properties of an encoding's name that affect how the
+// rest of the encoding is parsed and printed.
+type nameState struct {
+	ctorDtorConversion   bool   // No return type is mangled
+	endsWithTemplateArgs bool   // Function templates mangle their return type
+	quals                string // Member function cv-qualifiers
+	ref                  string // Member function ref-qualifier
+}
+
+func (d *demangler) fail(msg string) {
+	panic(demangleError{msg: msg, pos: d.pos})
+}
+
+func (d *demangler) look(i int) byte {
+	if d.pos+i < len(d.s) {
+		return d.s[d.pos+i]
+	}
+	return 0
+}
+
+func (d *demangler) consume(prefix string) bool {
+	if strings.HasPrefix(d.s[d.pos:], prefix) {
+		d.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (d *demangler) expect(c byte) {
+	if d.look(0) != c {
+		d.fail(fmt.Sprintf("expected %q", c))
+	}
+	d.pos++
+}
+
+func (d *demangler) eof() bool {
+	return d.pos >= len(d.s)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isLower(c byte) bool { return c >= 'a' && c <= 'z' }
+func isUpper(c byte) bool { return c >= 'A' && c <= 'Z' }
+
+// parseNumber parses <number> ::= [n] <decimal>, returning "-" for the n prefix.
+func (d *demangler) parseNumber() string {
+	neg := d.consume("n")
+	start := d.pos
+	for isDigit(d.look(0)) {
+		d.pos++
+	}
+	if d.pos == start {
+		d.fail("expected number")
+	}
+	if neg {
+		return "-" + d.s[start:d.pos]
+	}
+	return d.s[start:d.pos]
+}
+
+// parseCount parses an optional <number> followed by '_', as used by
+// unnamed types and closures. The count is printed as mangled.
+func (d *demangler) parseCount() string {
+	start := d.pos
+	for isDigit(d.look(0)) {
+		d.pos++
+	}
+	count := d.s[start:d.pos]
+	d.expect('_')
+	return count
+}
+
+// parseSeqID parses a base-36 <seq-id> terminated by '_'.
+// Returns 0 for "_" and id+1 otherwise.
+func (d *demangler) parseSeqID() int {
+	if d.consume("_") {
+		return 0
+	}
+	id := 0
+	for {
+		c := d.look(0)
+		switch {
+		case isDigit(c):
+			id = id*36 + int(c-'0')
+		case isUpper(c):
+			id = id*36 + int(c-'A') + 10
+		case c == '_':
+			d.pos++
+			return id + 1
+		default:
+			d.fail("bad seq-id")
+		}
+		d.pos++
+	}
+}
+
+// parseDiscriminator skips <discriminator> ::= _ <digit> | __ <number> _
+func (d *demangler) parseDiscriminator() {
+	if d.look(0) != '_' {
+		return
+	}
+	if isDigit(d.look(1)) {
+		d.pos += 2
+		return
+	}
+	if d.look(1) == '_' {
+		save := d.pos
+		d.pos += 2
+		for isDigit(d.look(0)) {
+			d.pos++
+		}
+		if d.look(0) == '_' && d.pos > save+2 {
+			d.pos++
+			return
+		}
+		d.pos = save
+	}
+}
+
+// atEncodingEnd reports whether an encoding has no further parameters.
+func (d *demangler) atEncodingEnd() bool {
+	c := d.look(0)
+	return d.eof() || c == 'E' || c == '.'
+}
+
+// parseEncoding parses <encoding> ::= <function name> <bare-function-type> | <data name> | <special-name>
+func (d *demangler) parseEncoding() node {
+	if c := d.look(0); c == 'G' || c == 'T' {
+		return d.parseSpecialName()
+	}
+
+	st := &nameState{}
+	name := d.parseName(st)
+	if d.atEncodingEnd() {
+		return name
+	}
+
+	// Clang's enable_if attribute: Ua9enable_ifI...E
+	var attrs *templateArgs
+	if d.consume("Ua9enable_if") {
+		attrs = d.parseTemplateArgs(false)
+	}
+
+	fn := &functionEncoding{name: name, quals: st.quals, ref: st.ref, attrs: attrs}
+	if st.endsWithTemplateArgs && !st.ctorDtorConversion {
+		fn.ret = d.parseType()
+	}
+	// A lone "v" is an empty parameter list
+	if d.look(0) == 'v' {
+		d.pos++
+		if d.atEncodingEnd() {
+			return fn
+		}
+		d.pos--
+	}
+	for !d.atEncodingEnd() {
+		fn.params = append(fn.params, d.parseType())
+	}
+	return fn
+}
+
+// parseSpecialName parses vtables, typeinfo, thunks, and guard variables.
+func (d *demangler) parseSpecialName() node {
+	switch {
+	case d.consume("TV"):
+		return &specialName{prefix: "vtable for ", child: d.parseType()}
+	case d.consume("TT"):
+		return &specialName{prefix: "VTT for ", child: d.parseType()}
+	case d.consume("TI"):
+		return &specialName{prefix: "typeinfo for ", child: d.parseType()}
+	case d.consume("TS"):
+		return &specialName{prefix: "typeinfo name for ", child: d.parseType()}
+	case d.consume("Th"):
+		d.parseCallOffset('h')
+		return &specialName{prefix: "non-virtual thunk to ", child: d.parseEncoding()}
+	case d.consume("Tv"):
+		d.parseCallOffset('v')
+		return &specialName{prefix: "virtual thunk to ", child: d.parseEncoding()}
+	case d.consume("Tc"):
+		d.parseCallOffset(0)
+		d.parseCallOffset(0)
+		return &specialName{prefix: "covariant return thunk to ", child: d.parseEncoding()}
+	case d.consume("TC"):
+		first := d.parseType()
+		d.parseNumber()
+		d.expect('_')
+		second := d.parseType()
+		return &ctorVtable{first: first, second: second}
+	case d.consume("TW"):
+		return &specialName{prefix: "thread-local wrapper routine for ", child: d.parseName(nil)}
+	case d.consume("TH"):
+		return &specialName{prefix: "thread-local initialization routine for ", child: d.parseName(nil)}
+	case d.consume("TA"):
+		return &specialName{prefix: "template parameter object for ", child: d.parseTemplateArg()}
+	case d.consume("GV"):
+		return &specialName{prefix: "guard variable for ", child: d.parseName(nil)}
+	case d.consume("GR"):
+		n := d.parseName(nil)
+		if !d.eof() {
+			d.parseSeqID()
+		}
+		return &specialName{prefix: "reference temporary for ", child: n}
+	case d.consume("GTt"):
+		return &specialName{prefix: "transaction clone for ", child: d.parseEncoding()}
+	case d.consume("GTn"):
+		return &specialName{prefix: "non-transaction clone for ", child: d.parseEncoding()}
+	}
+	d.fail("unknown special name")
+	return nil
+}
+
+// parseCallOffset parses h <nv-offset> _ or v <offset> _ <virtual offset> _.
+// kind restricts the form; 0 accepts either.
+func (d *demangler) parseCallOffset(kind byte) {
+	if kind == 0 {
+		kind = d.look(0)
+		d.pos++
+	}
+	switch kind {
+	case 'h':
+		d.parseNumber()
+		d.expect('_')
+	case 'v':
+		d.parseNumber()
+		d.expect('_')
+		d.parseNumber()
+		d.expect('_')
+	default:
+		d.fail("bad call offset")
+	}
+}
+
+// parseName parses <name> ::= <nested-name> | <local-name> | <unscoped-template-name> <template-args> | <unscoped-name>
+// st is non-nil only for the name of an encoding.
+func (d *demangler) parseName(st *nameState) node {
+	switch d.look(0) {
+	case 'N':
+		return d.parseNestedName(st)
+	case 'Z':
+		return d.parseLocalName(st)
+	}
+
+	if d.look(0) == 'S' && d.look(1) != 't' {
+		sub := d.parseSubstitution()
+		if d.look(0) != 'I' {
+			d.fail("expected template args after substitution")
+		}
+		args := d.parseTemplateArgs(st != nil)
+		if st != nil {
+			st.endsWithTemplateArgs = true
+		}
+		return &templateName{name: sub, args: args}
+	}
+
+	n := d.parseUnscopedName(st)
+	if d.look(0) == 'I' {
+		d.subs = append(d.subs, n)
+		args := d.parseTemplateArgs(st != nil)
+		if st != nil {
+			st.endsWithTemplateArgs = true
+		}
+		return &templateName{name: n, args: args}
+	}
+	return n
+}
+
+// parseUnscopedName parses <unscoped-name> ::= <unqualified-name> | St <unqualified-name>
+func (d *demangler) parseUnscopedName(st *nameState) node {
+	std := d.consume("St")
+	n := d.parseUnqualifiedName(st)
+	if std {
+		return &nestedName{qual: &nameNode{name: "std"}, name: n}
+	}
+	return n
+}
+
+// parseNestedName parses N [<CV-qualifiers>] [<ref-qualifier>] <prefix> <unqualified-name> E
+func (d *demangler) parseNestedName(st *nameState) node {
+	d.expect('N')
+	quals := d.parseCVQuals()
+	ref := ""
+	if d.consume("O") {
+		ref = " &&"
+	} else if d.consume("R") {
+		ref = " &"
+	}
+	if st != nil {
+		st.quals = quals
+		st.ref = ref
+	}
+
+	var soFar node
+	push := func(n node) {
+		if soFar == nil {
+			soFar = n
+		} else {
+			soFar = &nestedName{qual: soFar, name: n}
+		}
+		if st != nil {
+			st.endsWithTemplateArgs = false
+		}
+	}
+
+	if d.consume("St") {
+		soFar = &nameNode{name: "std"}
+	}
+
+	for !d.consume("E") {
+		if d.eof() {
+			d.fail("unterminated nested name")
+		}
+		d.consume("L")
+
+		// <data-member-prefix> ::= <member source-name> M
+		if d.consume("M") {
+			if soFar == nil {
+				d.fail("empty data member prefix")
+			}
+			continue
+		}
+
+		c := d.look(0)
+		switch {
+		case c == 'T':
+			push(d.parseTemplateParam())
+		case c == 'I':
+			if soFar == nil {
+				d.fail("template args without template name")
+			}
+			args := d.parseTemplateArgs(st != nil)
+			soFar = &templateName{name: soFar, args: args}
+			if st != nil {
+				st.endsWithTemplateArgs = true
+			}
+		case c == 'D' && (d.look(1) == 't' || d.look(1) == 'T'):
+			push(d.parseDecltype())
+		case c == 'S' && d.look(1) != 't':
+			sub := d.parseSubstitution()
+			push(sub)
+			if soFar == sub {
+				// Already a substitution candidate
+				continue
+			}
+		case c == 'C' || (c == 'D' && d.look(1) != 'C'):
+			push(d.parseCtorDtorName(soFar, st))
+		default:
+			push(d.parseUnqualifiedName(st))
+		}
+		d.subs = append(d.subs, soFar)
+	}
+
+	if soFar == nil || len(d.subs) == 0 {
+		d.fail("empty nested name")
+	}
+	// The complete name is not a substitution candidate
+	d.subs = d.subs[:len(d.subs)-1]
+	return soFar
+}
+
+// parseLocalName parses Z <function encoding> E <entity name> [<discriminator>]
+func (d *demangler) parseLocalName(st *nameState) node {
+	d.expect('Z')
+	enc := d.parseEncoding()
+	d.expect('E')
+
+	if d.consume("s") {
+		d.parseDiscriminator()
+		return &localName{encoding: enc, entity: &nameNode{name: "string literal"}}
+	}
+
+	// Default argument scope: Z <encoding> Ed [<number>] _ <entity name>
+	if d.consume("d") {
+		if d.look(0) != '_' {
+			d.parseNumber()
+		}
+		d.expect('_')
+		return &localName{encoding: enc, entity: d.parseName(st)}
+	}
+
+	entity := d.parseName(st)
+	d.parseDiscriminator()
+	return &localName{encoding: enc, entity: entity}
+}
+
+// parseUnqualifiedName parses operator, source, unnamed-type, and structured
+// binding names, followed by optional ABI tags.
+func (d *demangler) parseUnqualifiedName(st *nameState) node {
+	d.consume("L")
+
+	var n node
+	c := d.look(0)
+	switch {
+	case isDigit(c):
+		n = d.parseSourceName()
+	case c == 'U' && d.look(1) == 't':
+		d.pos += 2
+		n = &nameNode{name: "'unnamed" + d.parseCount() + "'"}
+	case c == 'U' && d.look(1) == 'l':
+		n = d.parseClosure()
+	case c == 'D' && d.look(1) == 'C':
+		d.pos += 2
+		var names []string
+		for !d.consume("E") {
+			names = append(names, nodeString(d.parseSourceName()))
+		}
+		n = &nameNode{name: "[" + strings.Join(names, ", ") + "]"}
+	case isLower(c):
+		n = d.parseOperatorName(st)
+	default:
+		d.fail("bad unqualified name")
+	}
+	return d.parseABITags(n)
+}
+
+// parseABITags parses B <source-name> tags, e.g. std::__cxx11 "[abi:cxx11]".
+func (d *demangler) parseABITags(n node) node {
+	for d.look(0) == 'B' {
+		d.pos++
+		n = &abiTagged{base: n, tag: nodeString(d.parseSourceName())}
+	}
+	return n
+}
+
+// parseSourceName parses <source-name> ::= <length> <identifier>
+func (d *demangler) parseSourceName() node {
+	start := d.pos
+	length := 0
+	for isDigit(d.look(0)) {
+		length = length*10 + int(d.look(0)-'0')
+		d.pos++
+		if length > len(d.s) {
+			d.fail("source name too long")
+		}
+	}
+	if d.pos == start || length == 0 || d.pos+length > len(d.s) {
+		d.pos = start
+		d.fail("bad source name")
+	}
+	name := d.s[d.pos : d.pos+length]
+	d.pos += length
+	if strings.HasPrefix(name, "_GLOBAL__N") {
+		return &nameNode{name: "(anonymous namespace)"}
+	}
+	return &nameNode{name: name}
+}
+
+// parseClosure parses Ul <lambda-sig> E [<number>] _
+func (d *demangler) parseClosure() node {
+	d.pos += 2
+
+	// Explicit template parameter declarations (C++20 lambdas)
+	for d.look(0) == 'T' && (d.look(1) == 'y' || d.look(1) == 'n' || d.look(1) == 't') {
+		kind := d.look(1)
+		d.pos += 2
+		if kind == 'n' {
+			d.parseType()
+		}
+	}
+
+	d.inLambda++
+	var params []node
+	if !d.consume("v") {
+		for d.look(0) != 'E' {
+			if d.eof() {
+				d.fail("unterminated lambda signature")
+			}
+			params = append(params, d.parseType())
+		}
+	}
+	d.inLambda--
+	d.expect('E')
+	return &closureName{params: params, count: d.parseCount()}
+}
+
+// parseCtorDtorName parses C1-C5, CI1/CI2 <base type> (inheriting constructors), and D0-D5.
+func (d *demangler) parseCtorDtorName(soFar node, st *nameState) node {
+	if soFar == nil {
+		d.fail("constructor without class")
+	}
+	if ss, ok := soFar.(*specialSubst); ok {
+		ss.expanded = true
+	}
+	if st != nil {
+		st.ctorDtorConversion = true
+	}
+
+	base := baseName(soFar)
+	if d.consume("C") {
+		inheriting := d.consume("I")
+		if c := d.look(0); c < '1' || c > '5' {
+			d.fail("bad constructor")
+		}
+		d.pos++
+		if inheriting {
+			d.parseType()
+		}
+		return d.parseABITags(&nameNode{name: base})
+	}
+	d.expect('D')
+	if c := d.look(0); c < '0' || c > '5' {
+		d.fail("bad destructor")
+	}
+	d.pos++
+	return d.parseABITags(&nameNode{name: "~" + base})
+}
+
+// baseName returns the unqualified name of a class, without template args,
+// for use as a constructor or destructor name.
+func baseName(n node) string {
+	switch n := n.(type) {
+	case *nameNode:
+		return n.name
+	case *nestedName:
+		return baseName(n.name)
+	case *templateName:
+		return baseName(n.name)
+	case *abiTagged:
+		return baseName(n.base)
+	case *localName:
+		return baseName(n.entity)
+	case *specialSubst:
+		return n.baseName()
+	case *templateParamNode:
+		if n.ref != nil {
+			return baseName(n.ref)
+		}
+	}
+	return nodeString(n)
+}
+
+// parseOperatorName parses <operator-name>, including conversion and literal operators.
+func (d *demangler) parseOperatorName(st *nameState) node {
+	if d.consume("cv") {
+		d.inConversion++
+		d.permitForward++
+		t := d.parseType()
+		d.inConversion--
+		d.permitForward--
+		if st != nil {
+			st.ctorDtorConversion = true
+		}
+		return &conversionOperator{typ: t}
+	}
+	if d.consume("li") {
+		return &nameNode{name: `operator"" ` + nodeString(d.parseSourceName())}
+	}
+	if d.look(0) == 'v' && isDigit(d.look(1)) {
+		d.pos += 2
+		return &nameNode{name: "operator " + nodeString(d.parseSourceName())}
+	}
+
+	if d.pos+2 > len(d.s) {
+		d.fail("bad operator name")
+	}
+	op, ok := operators[d.s[d.pos:d.pos+2]]
+	if !ok {
+		d.fail("unknown operator")
+	}
+	d.pos += 2
+	if isLower(op.sym[0]) {
+		return &nameNode{name: "operator " + op.sym}
+	}
+	return &nameNode{name: "operator" + op.sym}
+}
+
+// parseSubstitution parses S_, S<seq-id>_, and the std:: abbreviations.
+func (d *demangler) parseSubstitution() node {
+	d.expect('S')
+	if c := d.look(0); isLower(c) {
+		d.pos++
+		if _, ok := specialSubstNames[c]; !ok {
+			d.fail("unknown std:: substitution")
+		}
+		return d.parseABITags(&specialSubst{kind: c})
+	}
+	id := d.parseSeqID()
+	if id >= len(d.subs) {
+		d.fail("substitution out of range")
+	}
+	return d.subs[id]
+}
+
+// parseTemplateArgs parses I <template-arg>+ E. When tag is set, the arguments
+// become the targets of template parameter references (T_) in the encoding.
+func (d *demangler) parseTemplateArgs(tag bool) *templateArgs {
+	d.expect('I')
+	conv := d.inConversion
+	d.inConversion = 0
+	var args []node
+	for !d.consume("E") {
+		if d.eof() {
+			d.fail("unterminated template args")
+		}
+		args = append(args, d.parseTemplateArg())
+	}
+	d.inConversion = conv
+	if tag {
+		d.templateParams = args
+	}
+	return &templateArgs{args: args}
+}
+
+// parseTemplateArg parses a type, expression, literal, or argument pack.
+func (d *demangler) parseTemplateArg() node {
+	switch d.look(0) {
+	case 'X':
+		d.pos++
+		e := d.parseExpr()
+		d.expect('E')
+		return e
+	case 'J':
+		d.pos++
+		var args []node
+		for !d.consume("E") {
+			if d.eof() {
+				d.fail("unterminated argument pack")
+			}
+			args = append(args, d.parseTemplateArg())
+		}
+		return &templateArgPack{args: args}
+	case 'L':
+		if d.look(1) == 'Z' {
+			d.pos += 2
+			e := d.parseEncoding()
+			d.expect('E')
+			return e
+		}
+		return d.parseExprPrimary()
+	}
+	return d.parseType()
+}
+
+// parseTemplateParam parses T_ and T<number>_.
+func (d *demangler) parseTemplateParam() node {
+	d.expect('T')
+	idx := 0
+	if !d.consume("_") {
+		n, err := strconv.Atoi(d.parseNumber())
+		if err != nil || n < 0 {
+			d.fail("bad template parameter")
+		}
+		d.expect('_')
+		idx = n + 1
+	}
+
+	if d.inLambda > 0 {
+		return &nameNode{name: "auto"}
+	}
+	if idx < len(d.templateParams) {
+		return &templateParamNode{index: idx, ref: d.templateParams[idx]}
+	}
+	if d.permitForward > 0 {
+		fr := &templateParamNode{index: idx}
+		d.forwardRefs = append(d.forwardRefs, fr)
+		return fr
+	}
+	d.fail("template parameter out of range")
+	return nil
+}
+
+// parseCVQuals parses [r] [V] [K] and returns them in print order.
+func (d *demangler) parseCVQuals() string {
+	var q string
+	restrict := d.consume("r")
+	volatile := d.consume("V")
+	if d.consume("K") {
+		q += " const"
+	}
+	if volatile {
+		q += " volatile"
+	}
+	if restrict {
+		q += " restrict"
+	}
+	return q
+}
+
+// builtinTypes maps single-letter <builtin-type> codes to their names.
+var builtinTypes = map[byte]string{
+	'v': "void",
+	'w': "wchar_t",
+	'b': "bool",
+	'c': "char",
+	'a': "signed char",
+	'h': "unsigned char",
+	's': "short",
+	't': "unsigned short",
+	'i': "int",
+	'j': "unsigned int",
+	'l': "long",
+	'm': "unsigned long",
+	'x': "long long",
+	'y': "unsigned long long",
+	'n': "__int128",
+	'o': "unsigned __int128",
+	'f': "float",
+	'd': "double",
+	'e': "long double",
+	'g': "__float128",
+	'z': "...",
+}
+
+// dBuiltinTypes maps D-prefixed <builtin-type> codes to their names.
+var dBuiltinTypes = map[byte]string{
+	'd': "decimal64",
+	'e': "decimal128",
+	'f': "decimal32",
+	'h': "half",
+	'i': "char32_t",
+	's': "char16_t",
+	'u': "char8_t",
+	'a': "auto",
+	'c': "decltype(auto)",
+	'n': "std::nullptr_t",
+}
+
+// parseType parses <type> and records it as a substitution candidate.
+// Builtin types and plain substitutions are not candidates.
+func (d *demangler) parseType() node {
+	var result node
+
+	switch c := d.look(0); c {
+	case 'r', 'V', 'K':
+		if d.isFunctionType() {
+			result = d.parseFunctionType()
+			break
+		}
+		quals := d.parseCVQuals()
+		result = &qualType{child: d.parseType(), quals: quals}
+	case 'U':
+		d.pos++
+		vendor := nodeString(d.parseSourceName())
+		var args *templateArgs
+		if d.look(0) == 'I' {
+			args = d.parseTemplateArgs(false)
+		}
+		result = &vendorQualType{child: d.parseType(), qual: vendor, args: args}
+	case 'F':
+		result = d.parseFunctionType()
+	case 'A':
+		result = d.parseArrayType()
+	case 'M':
+		d.pos++
+		class := d.parseType()
+		member := d.parseType()
+		result = &pointerToMember{class: class, member: member}
+	case 'T':
+		// Elaborated type specifiers: Ts (struct), Tu (union), Te (enum)
+		if n := d.look(1); n == 's' || n == 'u' || n == 'e' {
+			d.pos += 2
+			result = d.parseName(nil)
+			break
+		}
+		result = d.parseTemplateParam()
+		// Template template parameter with arguments
+		if d.look(0) == 'I' && d.inConversion == 0 {
+			d.subs = append(d.subs, result)
+			result = &templateName{name: result, args: d.parseTemplateArgs(false)}
+		}
+	case 'P':
+		d.pos++
+		result = &pointerType{pointee: d.parseType()}
+	case 'R':
+		d.pos++
+		result = &referenceType{pointee: d.parseType()}
+	case 'O':
+		d.pos++
+		result = &referenceType{pointee: d.parseType(), rvalue: true}
+	case 'C':
+		d.pos++
+		result = &postfixType{child: d.parseType(), suffix: " _Complex"}
+	case 'G':
+		d.pos++
+		result = &postfixType{child: d.parseType(), suffix: " _Imaginary"}
+	case 'S':
+		if d.look(1) == 't' {
+			result = d.parseName(nil)
+			break
+		}
+		sub := d.parseSubstitution()
+		if d.look(0) == 'I' && d.inConversion == 0 {
+			result = &templateName{name: sub, args: d.parseTemplateArgs(false)}
+			break
+		}
+		return sub
+	case 'D':
+		c1 := d.look(1)
+		if name, ok := dBuiltinTypes[c1]; ok {
+			d.pos += 2
+			return &nameNode{name: name}
+		}
+		switch c1 {
+		case 'F':
+			// _Float<N>
+			d.pos += 2
+			bits := d.parseNumber()
+			d.expect('_')
+			return &nameNode{name: "_Float" + bits}
+		case 'p':
+			d.pos += 2
+			result = &packExpansion{child: d.parseType()}
+		case 't', 'T':
+			result = d.parseDecltype()
+		case 'v':
+			result = d.parseVectorType()
+		case 'O', 'o', 'w', 'x':
+			result = d.parseFunctionType()
+		default:
+			d.fail("unknown D type")
+		}
+	case 'u':
+		d.pos++
+		result = d.parseSourceName()
+		if d.look(0) == 'I' {
+			result = &templateName{name: result, args: d.parseTemplateArgs(false)}
+		}
+	default:
+		if name, ok := builtinTypes[c]; ok {
+			d.pos++
+			return &nameNode{name: name}
+		}
+		if c == 0 {
+			d.fail("unexpected end of type")
+		}
+		result = d.parseName(nil)
+	}
+
+	d.subs = append(d.subs, result)
+	return result
+}
+
+// parseExceptionSpec parses Do, DO <expr> E, Dw <type>+ E, and Dx.
+func (d *demangler) parseExceptionSpec() string {
+	var spec string
+	switch {
+	case d.consume("Do"):
+		spec = " noexcept"
+	case d.consume("DO"):
+		e := d.parseExpr()
+		d.expect('E')
+		spec = " noexcept(" + nodeString(e) + ")"
+	case d.consume("Dw"):
+		var types []string
+		for !d.consume("E") {
+			types = append(types, nodeString(d.parseType()))
+		}
+		spec = " throw(" + strings.Join(types, ", ") + ")"
+	}
+	if d.consume("Dx") {
+		spec += " transaction_safe"
+	}
+	return spec
+}
+
+// isFunctionType reports whether the cv-qualifiers at the current position
+// belong to a function type (K F...E), which is a single substitution candidate.
+func (d *demangler) isFunctionType() bool {
+	i := 0
+	for c := d.look(i); c == 'r' || c == 'V' || c == 'K'; c = d.look(i) {
+		i++
+	}
+	switch d.look(i) {
+	case 'F':
+		return true
+	case 'D':
+		c := d.look(i + 1)
+		return c == 'O' || c == 'o' || c == 'w' || c == 'x'
+	}
+	return false
+}
+
+// parseFunctionType parses [<CV-qualifiers>] [<exception-spec>] F [Y] <return type> <parameter types> [<ref-qualifier>] E
+func (d *demangler) parseFunctionType() node {
+	quals := d.parseCVQuals()
+	except := d.parseExceptionSpec()
+	d.expect('F')
+	d.consume("Y")
+	fn := &functionType{ret: d.parseType(), quals: quals, except: except}
+	for {
+		switch {
+		case d.consume("E"):
+			return fn
+		case d.consume("RE"):
+			fn.ref = " &"
+			return fn
+		case d.consume("OE"):
+			fn.ref = " &&"
+			return fn
+		case d.consume("v"):
+			continue
+		case d.eof():
+			d.fail("unterminated function type")
+		}
+		fn.params = append(fn.params, d.parseType())
+	}
+}
+
+// parseArrayType parses A <dimension> _ <element type>
+func (d *demangler) parseArrayType() node {
+	d.expect('A')
+	var dim node
+	switch c := d.look(0); {
+	case isDigit(c):
+		dim = &nameNode{name: d.parseNumber()}
+	case c != '_':
+		dim = d.parseExpr()
+	}
+	d.expect('_')
+	return &arrayType{base: d.parseType(), dim: dim}
+}
+
+// parseVectorType parses Dv <number> _ <type> and Dv _ <expr> _ <type>
+func (d *demangler) parseVectorType() node {
+	d.pos += 2
+	var dim string
+	if isDigit(d.look(0)) {
+		dim = d.parseNumber()
+	} else {
+		d.expect('_')
+		dim = nodeString(d.parseExpr())
+	}
+	d.expect('_')
+	if d.consume("p") {
+		return &nameNode{name: "pixel vector[" + dim + "]"}
+	}
+	return &postfixType{child: d.parseType(), suffix: " vector[" + dim + "]"}
+}
+
+// parseDecltype parses Dt <expr> E and DT <expr> E
+func (d *demangler) parseDecltype() node {
+	d.pos += 2
+	e := d.parseExpr()
+	d.expect('E')
+	return &enclosingExpr{pre: "decltype(", child: e, post: ")"}
+}
+
+// Expressions
+
+// opKind classifies how an operator's operands are parsed and printed.
+type opKind int
+
+const (
+	opBinary opKind = iota
+	opPrefix
+	opPostfix // ++ and --: prefix when followed by '_'
+	opMember
+	opCall
+	opCast
+	opConversion
+	opConditional
+	opOfType // sizeof (T), alignof (T), typeid (T)
+	opOfExpr // sizeof (e), alignof (e), typeid (e), noexcept (e)
+	opNew
+	opDelete
+	opThrow
+)
+
+type opInfo struct {
+	sym  string
+	kind opKind
+}
+
+// operators maps two-letter <operator-name> codes to their spelling.
+var operators = map[string]opInfo{
+	"aN": {"&=", opBinary},
+	"aS": {"=", opBinary},
+	"aa": {"&&", opBinary},
+	"ad": {"&", opPrefix},
+	"an": {"&", opBinary},
+	"at": {"alignof", opOfType},
+	"aw": {"co_await", opPrefix},
+	"az": {"alignof", opOfExpr},
+	"cc": {"const_cast", opCast},
+	"cl": {"()", opCall},
+	"cm": {",", opBinary},
+	"co": {"~", opPrefix},
+	"cv": {"", opConversion},
+	"dV": {"/=", opBinary},
+	"da": {"delete[]", opDelete},
+	"dc": {"dynamic_cast", opCast},
+	"de": {"*", opPrefix},
+	"dl": {"delete", opDelete},
+	"ds": {".*", opBinary},
+	"dt": {".", opMember},
+	"dv": {"/", opBinary},
+	"eO": {"^=", opBinary},
+	"eo": {"^", opBinary},
+	"eq": {"==", opBinary},
+	"ge": {">=", opBinary},
+	"gt": {">", opBinary},
+	"ix": {"[]", opBinary},
+	"lS": {"<<=", opBinary},
+	"le": {"<=", opBinary},
+	"ls": {"<<", opBinary},
+	"lt": {"<", opBinary},
+	"mI": {"-=", opBinary},
+	"mL": {"*=", opBinary},
+	"mi": {"-", opBinary},
+	"ml": {"*", opBinary},
+	"mm": {"--", opPostfix},
+	"na": {"new[]", opNew},
+	"ne": {"!=", opBinary},
+	"ng": {"-", opPrefix},
+	"nt": {"!", opPrefix},
+	"nw": {"new", opNew},
+	"nx": {"noexcept", opOfExpr},
+	"oR": {"|=", opBinary},
+	"oo": {"||", opBinary},
+	"or": {"|", opBinary},
+	"pL": {"+=", opBinary},
+	"pl": {"+", opBinary},
+	"pm": {"->*", opBinary},
+	"pp": {"++", opPostfix},
+	"ps": {"+", opPrefix},
+	"pt": {"->", opMember},
+	"qu": {"?", opConditional},
+	"rM": {"%=", opBinary},
+	"rS": {">>=", opBinary},
+	"rc": {"reinterpret_cast", opCast},
+	"rm": {"%", opBinary},
+	"rs": {">>", opBinary},
+	"sc": {"static_cast", opCast},
+	"ss": {"<=>", opBinary},
+	"st": {"sizeof", opOfType},
+	"sz": {"sizeof", opOfExpr},
+	"te": {"typeid", opOfExpr},
+	"ti": {"typeid", opOfType},
+	"tw": {"throw", opThrow},
+}
+
+// parseExpr parses an <expression>.
+func (d *demangler) parseExpr() node {
+	global := d.consume("gs")
+
+	switch c := d.look(0); {
+	case c == 'L':
+		return d.parseExprPrimary()
+	case c == 'T':
+		return d.parseTemplateParam()
+	case c == 'f' && d.look(1) == 'p':
+		// Function parameter: fp [<cv-qualifiers>] [<number>] _
+		d.pos += 2
+		d.parseCVQuals()
+		if d.consume("T") {
+			return &nameNode{name: "this"}
+		}
+		return &nameNode{name: "fp" + d.parseCount()}
+	case c == 'f' && d.look(1) == 'L':
+		// Function parameter of an enclosing scope: fL <level> p [<cv-qualifiers>] [<number>] _
+		d.pos += 2
+		d.parseNumber()
+		d.expect('p')
+		d.parseCVQuals()
+		return &nameNode{name: "fp" + d.parseCount()}
+	case c == 'i' && d.look(1) == 'l':
+		d.pos += 2
+		return &enclosingExpr{pre: "{", child: d.parseExprList('E'), post: "}"}
+	case c == 't' && d.look(1) == 'l':
+		d.pos += 2
+		t := d.parseType()
+		return &binaryNode{left: t, sep: "", right: &enclosingExpr{pre: "{", child: d.parseExprList('E'), post: "}"}}
+	case c == 't' && d.look(1) == 'r':
+		d.pos += 2
+		return &nameNode{name: "throw"}
+	case c == 's' && d.look(1) == 'r':
+		return d.parseUnresolvedName(global)
+	case c == 's' && d.look(1) == 'Z':
+		d.pos += 2
+		var pack node
+		if d.look(0) == 'T' {
+			pack = d.parseTemplateParam()
+		} else {
+			pack = d.parseExpr()
+		}
+		return &enclosingExpr{pre: "sizeof...(", child: pack, post: ")"}
+	case c == 's' && d.look(1) == 'P':
+		d.pos += 2
+		return &enclosingExpr{pre: "sizeof...(", child: d.parseExprList('E'), post: ")"}
+	case c == 's' && d.look(1) == 'p':
+		d.pos += 2
+		return &packExpansion{child: d.parseExpr()}
+	case c == 'u':
+		// Vendor extended expression: u <source-name> <template-arg>* E
+		d.pos++
+		name := d.parseSourceName()
+		var args []node
+		for !d.consume("E") {
+			if d.eof() {
+				d.fail("unterminated vendor expression")
+			}
+			args = append(args, d.parseTemplateArg())
+		}
+		return &callExpr{callee: name, args: args}
+	case isDigit(c):
+		return d.parseUnresolvedName(global)
+	case c == 'o' && d.look(1) == 'n':
+		return d.parseUnresolvedName(global)
+	case c == 'd' && d.look(1) == 'n':
+		return d.parseUnresolvedName(global)
+	}
+
+	if d.pos+2 > len(d.s) {
+		d.fail("unexpected end of expression")
+	}
+	code := d.s[d.pos : d.pos+2]
+	op, ok := operators[code]
+	if !ok {
+		d.fail("unknown expression")
+	}
+	d.pos += 2
+
+	prefix := ""
+	if global {
+		prefix = "::"
+	}
+
+	switch op.kind {
+	case opBinary:
+		left := d.parseExpr()
+		right := d.parseExpr()
+		return &binaryExpr{left: left, op: op.sym, right: right}
+	case opPrefix:
+		return &enclosingExpr{pre: op.sym + "(", child: d.parseExpr(), post: ")"}
+	case opPostfix:
+		if d.consume("_") {
+			return &enclosingExpr{pre: op.sym + "(", child: d.parseExpr(), post: ")"}
+		}
+		return &enclosingExpr{pre: "(", child: d.parseExpr(), post: ")" + op.sym}
+	case opMember:
+		left := d.parseExpr()
+		right := d.parseExpr()
+		return &binaryNode{left: left, sep: op.sym, right: right}
+	case opCall:
+		callee := d.parseExpr()
+		return &callExpr{callee: callee, args: d.parseExprs('E')}
+	case opCast:
+		t := d.parseType()
+		e := d.parseExpr()
+		return &binaryNode{
+			left:  &enclosingExpr{pre: op.sym + "<", child: t, post: ">"},
+			right: &enclosingExpr{pre: "(", child: e, post: ")"},
+		}
+	case opConversion:
+		d.inConversion++
+		t := d.parseType()
+		d.inConversion--
+		var args node
+		if d.consume("_") {
+			args = d.parseExprList('E')
+		} else {
+			args = d.parseExpr()
+		}
+		return &binaryNode{
+			left:  &enclosingExpr{pre: "(", child: t, post: ")"},
+			right: &enclosingExpr{pre: "(", child: args, post: ")"},
+		}
+	case opConditional:
+		cond := d.parseExpr()
+		then := d.parseExpr()
+		els := d.parseExpr()
+		return &conditionalExpr{cond: cond, then: then, els: els}
+	case opOfType:
+		return &enclosingExpr{pre: op.sym + " (", child: d.parseType(), post: ")"}
+	case opOfExpr:
+		return &enclosingExpr{pre: op.sym + " (", child: d.parseExpr(), post: ")"}
+	case opThrow:
+		return &enclosingExpr{pre: "throw ", child: d.parseExpr()}
+	case opDelete:
+		return &enclosingExpr{pre: prefix + op.sym + " ", child: d.parseExpr()}
+	case opNew:
+		// nw <expression>* _ <type> [pi <expression>* E] E
+		placement := d.parseExprs('_')
+		t := d.parseType()
+		var init []node
+		hasInit := false
+		if d.consume("pi") {
+			hasInit = true
+			init = d.parseExprs('E')
+		}
+		d.expect('E')
+		return &newExpr{global: global, op: op.sym, placement: placement, typ: t, init: init, hasInit: hasInit}
+	}
+	d.fail("unsupported expression")
+	return nil
+}
+
+// parseExprs parses expressions up to and including the terminator.
+func (d *demangler) parseExprs(term byte) []node {
+	var exprs []node
+	for d.look(0) != term {
+		if d.eof() {
+			d.fail("unterminated expression list")
+		}
+		exprs = append(exprs, d.parseExpr())
+	}
+	d.pos++
+	return exprs
+}
+
+// parseExprList parses expressions up to the terminator as a comma-separated list.
+func (d *demangler) parseExprList(term byte) node {
+	return &templateArgPack{args: d.parseExprs(term)}
+}
+
+// parseUnresolvedName parses <unresolved-name> in dependent expressions.
+func (d *demangler) parseUnresolvedName(global bool) node {
+	var qual node
+	if d.consume("sr") {
+		if d.consume("N") {
+			qual = d.parseUnresolvedType()
+			for !d.consume("E") {
+				if d.eof() {
+					d.fail("unterminated unresolved name")
+				}
+				qual = &nestedName{qual: qual, name: d.parseSimpleID()}
+			}
+		} else if isDigit(d.look(0)) {
+			// gs sr <unresolved-qualifier-level>+ E <base-unresolved-name>
+			qual = d.parseSimpleID()
+			for !d.consume("E") {
+				if d.eof() {
+					d.fail("unterminated unresolved name")
+				}
+				qual = &nestedName{qual: qual, name: d.parseSimpleID()}
+			}
+		} else {
+			qual = d.parseUnresolvedType()
+		}
+	}
+
+	base := d.parseBaseUnresolvedName()
+	var n node = base
+	if qual != nil {
+		n = &nestedName{qual: qual, name: base}
+	}
+	if global {
+		n = &enclosingExpr{pre: "::", child: n}
+	}
+	return n
+}
+
+// parseUnresolvedType parses a template parameter, decltype, or substitution
+// used as the qualifier of an unresolved name.
+func (d *demangler) parseUnresolvedType() node {
+	var t node
+	switch {
+	case d.look(0) == 'T':
+		t = d.parseTemplateParam()
+	case d.look(0) == 'D' && (d.look(1) == 't' || d.look(1) == 'T'):
+		t = d.parseDecltype()
+	case d.look(0) == 'S':
+		return d.parseSubstitution()
+	default:
+		return d.parseSimpleID()
+	}
+	if d.look(0) == 'I' {
+		t = &templateName{name: t, args: d.parseTemplateArgs(false)}
+	}
+	d.subs = append(d.subs, t)
+	return t
+}
+
+// parseSimpleID parses <source-name> [<template-args>]
+func (d *demangler) parseSimpleID() node {
+	n := d.parseSourceName()
+	if d.look(0) == 'I' {
+		return &templateName{name: n, args: d.parseTemplateArgs(false)}
+	}
+	return n
+}
+
+// parseBaseUnresolvedName parses <simple-id>, on <operator-name> [<template-args>], or dn <destructor-name>.
+func (d *demangler) parseBaseUnresolvedName() node {
+	if d.consume("on") {
+		n := d.parseOperatorName(nil)
+		if d.look(0) == 'I' {
+			return &templateName{name: n, args: d.parseTemplateArgs(false)}
+		}
+		return n
+	}
+	if d.consume("dn") {
+		var t node
+		if isDigit(d.look(0)) {
+			t = d.parseSimpleID()
+		} else {
+			t = d.parseUnresolvedType()
+		}
+		return &enclosingExpr{pre: "~", child: t}
+	}
+	return d.parseSimpleID()
+}
+
+// literalTypes maps builtin codes to the suffix (up to 3 chars) or cast
+// (longer names) used to print integer literals.
+var literalTypes = map[byte]string{
+	'a': "signed char",
+	'c': "char",
+	'h': "unsigned char",
+	's': "short",
+	't': "unsigned short",
+	'i': "",
+	'j': "u",
+	'l': "l",
+	'm': "ul",
+	'x': "ll",
+	'y': "ull",
+	'n': "__int128",
+	'o': "unsigned __int128",
+	'w': "wchar_t",
+}
+
+// parseExprPrimary parses L <type> <value> E, L <mangled-name> E, and nullptr.
+func (d *demangler) parseExprPrimary() node {
+	d.expect('L')
+
+	if d.consume("_Z") {
+		e := d.parseEncoding()
+		d.expect('E')
+		return e
+	}
+	if d.consume("DnE") || d.consume("Dn0E") {
+		return &nameNode{name: "nullptr"}
+	}
+
+	c := d.look(0)
+	if c == 'b' && (d.look(1) == '0' || d.look(1) == '1') && d.look(2) == 'E' {
+		d.pos += 3
+		if d.s[d.pos-2] == '1' {
+			return &nameNode{name: "true"}
+		}
+		return &nameNode{name: "false"}
+	}
+	if typ, ok := literalTypes[c]; ok {
+		d.pos++
+		value := d.parseNumber()
+		d.expect('E')
+		return &integerLiteral{typ: typ, value: value}
+	}
+	if c == 'f' || c == 'd' {
+		d.pos++
+		start := d.pos
+		for d.look(0) != 'E' && !d.eof() {
+			d.pos++
+		}
+		hexBits := d.s[start:d.pos]
+		d.expect('E')
+		return &nameNode{name: formatFloatLiteral(c, hexBits)}
+	}
+
+	// Enumerator or other literal of class type: (T)value
+	t := d.parseType()
+	if d.consume("E") {
+		// String literal of type T
+		return &enclosingExpr{pre: "\"<", child: t, post: ">\""}
+	}
+	value := d.parseNumber()
+	d.expect('E')
+	return &binaryNode{left: &enclosingExpr{pre: "(", child: t, post: ")"}, right: &nameNode{name: value}}
+}
+
+// formatFloatLiteral prints a float (f) or double (d) literal mangled as its
+// big-endian hex bit pattern.
+func formatFloatLiteral(code byte, hexBits string) string {
+	bits, err := strconv.ParseUint(hexBits, 16, 64)
+	if err != nil {
+		return "[" + hexBits + "]"
+	}
+	if code == 'f' {
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(bits))), 'g', -1, 32) + "f"
+	}
+	return strconv.FormatFloat(math.Float64frombits(bits), 'g', -1, 64)
+}
+
+// Nodes
+
+// node is a parsed name, type, or expression. Types print in two parts around
+// the declarator; hasRight reports whether the right part is non-empty.
+type node interface {
+	printLeft(p *printer)
+	printRight(p *printer)
+	hasRight() bool
+}
+
+// printer accumulates demangled output.
+type printer struct {
+	strings.Builder
+	templateDepth int // Inside <...>: '>' operators need parentheses
+
+	// Pack expansion state: while expanding, parameter packs print the
+	// element at packIndex and record their length in packMax.
+	packIndex int
+	packMax   int
+}
+
+// sub returns an empty printer with the same context.
+func (p *printer) sub() *printer {
+	return &printer{templateDepth: p.templateDepth, packIndex: p.packIndex, packMax: p.packMax}
+}
+
+func (p *printer) last() byte {
+	s := p.String()
+	if len(s) == 0 {
+		return 0
+	}
+	return s[len(s)-1]
+}
+
+func printNode(p *printer, n node) {
+	n.printLeft(p)
+	n.printRight(p)
+}
+
+// printList prints nodes separated by commas. Empty packs print nothing
+// and take no separator.
+func printList(p *printer, nodes []node) {
+	first := true
+	for _, n := range nodes {
+		sp := p.sub()
+		printNode(sp, n)
+		if sp.Len() == 0 {
+			continue
+		}
+		if !first {
+			p.WriteString(", ")
+		}
+		p.WriteString(sp.String())
+		first = false
+	}
+}
+
+func nodeString(n node) string {
+	p := printer{packIndex: -1}
+	printNode(&p, n)
+	return p.String()
+}
+
+// leaf provides the right-hand side of nodes that print in one piece.
+type leaf struct{}
+
+func (leaf) printRight(*printer) {}
+func (leaf) hasRight() bool      { return false }
+
+type nameNode struct {
+	leaf
+	name string
+}
+
+func (n *nameNode) printLeft(p *printer) { p.WriteString(n.name) }
+
+type nestedName struct {
+	leaf
+	qual, name node
+}
+
+func (n *nestedName) printLeft(p *printer) {
+	printNode(p, n.qual)
+	p.WriteString("::")
+	printNode(p, n.name)
+}
+
+type templateArgs struct {
+	leaf
+	args []node
+}
+
+func (n *templateArgs) printLeft(p *printer) {
+	p.templateDepth++
+	p.WriteByte('<')
+	printList(p, n.args)
+	// libc++abi separates nested closing brackets: "vector<int, allocator<int> >"
+	if p.last() == '>' {
+		p.WriteByte(' ')
+	}
+	p.WriteByte('>')
+	p.templateDepth--
+}
+
+type templateName struct {
+	leaf
+	name node
+	args *templateArgs
+}
+
+func (n *templateName) printLeft(p *printer) {
+	printNode(p, n.name)
+	n.args.printLeft(p)
+}
+
+type templateArgPack struct {
+	leaf
+	args []node
+}
+
+func (n *templateArgPack) printLeft(p *printer) { printList(p, n.args) }
+
+// templateParamNode is a T_ reference; forward references are resolved
+// after the template arguments they refer to have been parsed.
+type templateParamNode struct {
+	index    int
+	ref      node
+	printing bool // Guards against malformed names whose arguments refer to themselves
+}
+
+func (n *templateParamNode) printLeft(p *printer) {
+	if n.printing {
+		return
+	}
+	n.printing = true
+	defer func() { n.printing = false }()
+	if r := resolve(p, n); r != n {
+		r.printLeft(p)
+	} else if n.ref != nil {
+		n.ref.printLeft(p)
+	}
+}
+
+func (n *templateParamNode) printRight(p *printer) {
+	if n.printing {
+		return
+	}
+	n.printing = true
+	defer func() { n.printing = false }()
+	if r := resolve(p, n); r != n {
+		r.printRight(p)
+	} else if n.ref != nil {
+		n.ref.printRight(p)
+	}
+}
+
+func (n *templateParamNode) hasRight() bool {
+	r := resolve(nil, n)
+	if r == node(n) {
+		return false
+	}
+	return r.hasRight()
+}
+
+type abiTagged struct {
+	leaf
+	base node
+	tag  string
+}
+
+func (n *abiTagged) printLeft(p *printer) {
+	printNode(p, n.base)
+	p.WriteString("[abi:" + n.tag + "]")
+}
+
+// specialSubstNames are the std:: abbreviations St, Sa, Sb, Ss, Si, So, Sd.
+// Expanded forms are used when the abbreviation prefixes a constructor name.
+var specialSubstNames = map[byte]struct{ short, expanded, base string }{
+	'a': {"std::allocator", "std::allocator", "allocator"},
+	'b': {"std::basic_string", "std::basic_string", "basic_string"},
+	's': {"std::string", "std::basic_string<char, std::char_traits<char>, std::allocator<char> >", "basic_string"},
+	'i': {"std::istream", "std::basic_istream<char, std::char_traits<char> >", "basic_istream"},
+	'o': {"std::ostream", "std::basic_ostream<char, std::char_traits<char> >", "basic_ostream"},
+	'd': {"std::iostream", "std::basic_iostream<char, std::char_traits<char> >", "basic_iostream"},
+}
+
+type specialSubst struct {
+	leaf
+	kind     byte
+	expanded bool
+}
+
+func (n *specialSubst) printLeft(p *printer) {
+	if n.expanded {
+		p.WriteString(specialSubstNames[n.kind].expanded)
+	} else {
+		p.WriteString(specialSubstNames[n.kind].short)
+	}
+}
+
+func (n *specialSubst) baseName() string { return specialSubstNames[n.kind].base }
+
+type conversionOperator struct {
+	leaf
+	typ node
+}
+
+func (n *conversionOperator) printLeft(p *printer) {
+	p.WriteString("operator ")
+	printNode(p, n.typ)
+}
+
+type closureName struct {
+	leaf
+	params []node
+	count  string
+}
+
+func (n *closureName) printLeft(p *printer) {
+	p.WriteString("'lambda" + n.count + "'(")
+	printList(p, n.params)
+	p.WriteByte(')')
+}
+
+type localName struct {
+	leaf
+	encoding, entity node
+}
+
+func (n *localName) printLeft(p *printer) {
+	printNode(p, n.encoding)
+	p.WriteString("::")
+	printNode(p, n.entity)
+}
+
+type specialName struct {
+	leaf
+	prefix string
+	child  node
+}
+
+func (n *specialName) printLeft(p *printer) {
+	p.WriteString(n.prefix)
+	printNode(p, n.child)
+}
+
+type ctorVtable struct {
+	leaf
+	first, second node
+}
+
+func (n *ctorVtable) printLeft(p *printer) {
+	p.WriteString("construction vtable for ")
+	printNode(p, n.first)
+	p.WriteString("-in-")
+	printNode(p, n.second)
+}
+
+type cloneSuffix struct {
+	leaf
+	encoding node
+	suffix   string
+}
+
+func (n *cloneSuffix) printLeft(p *printer) {
+	printNode(p, n.encoding)
+	p.WriteString(" (" + n.suffix + ")")
+}
+
+type functionEncoding struct {
+	ret        node // Return type, only mangled for function templates
+	name       node
+	params     []node
+	quals, ref string
+	attrs      *templateArgs
+}
+
+func (n *functionEncoding) printLeft(p *printer) {
+	if n.ret != nil {
+		n.ret.printLeft(p)
+		if !n.ret.hasRight() {
+			p.WriteByte(' ')
+		}
+	}
+	printNode(p, n.name)
+}
+
+func (n *functionEncoding) printRight(p *printer) {
+	p.WriteByte('(')
+	printList(p, n.params)
+	p.WriteByte(')')
+	if n.ret != nil {
+		n.ret.printRight(p)
+	}
+	p.WriteString(n.quals)
+	p.WriteString(n.ref)
+	if n.attrs != nil {
+		p.WriteString(" [enable_if:")
+		printList(p, n.attrs.args)
+		p.WriteByte(']')
+	}
+}
+
+func (n *functionEncoding) hasRight() bool { return true }
+
+type functionType struct {
+	ret        node
+	params     []node
+	quals, ref string
+	except     string
+}
+
+func (n *functionType) printLeft(p *printer) {
+	n.ret.printLeft(p)
+	p.WriteByte(' ')
+}
+
+func (n *functionType) printRight(p *printer) {
+	p.WriteByte('(')
+	printList(p, n.params)
+	p.WriteByte(')')
+	n.ret.printRight(p)
+	p.WriteString(n.quals)
+	p.WriteString(n.ref)
+	p.WriteString(n.except)
+}
+
+func (n *functionType) hasRight() bool { return true }
+
+type qualType struct {
+	child node
+	quals string
+}
+
+func (n *qualType) printLeft(p *printer) {
+	n.child.printLeft(p)
+	p.WriteString(n.quals)
+}
+
+func (n *qualType) printRight(p *printer) { n.child.printRight(p) }
+func (n *qualType) hasRight() bool        { return n.child.hasRight() }
+
+type vendorQualType struct {
+	leaf
+	child node
+	qual  string
+	args  *templateArgs
+}
+
+func (n *vendorQualType) printLeft(p *printer) {
+	printNode(p, n.child)
+	p.WriteString(" " + n.qual)
+	if n.args != nil {
+		n.args.printLeft(p)
+	}
+}
+
+// postfixType prints a type followed by a fixed suffix (_Complex, vector[N]).
+type postfixType struct {
+	leaf
+	child  node
+	suffix string
+}
+
+func (n *postfixType) printLeft(p *printer) {
+	printNode(p, n.child)
+	p.WriteString(n.suffix)
+}
+
+// resolve follows template parameter references to the type they name,
+// selecting the current element while expanding a parameter pack.
+// p may be nil outside of printing.
+func resolve(p *printer, n node) node {
+	for range maxResolveDepth {
+		tp, ok := n.(*templateParamNode)
+		if !ok || tp.ref == nil {
+			return n
+		}
+		pack, isPack := tp.ref.(*templateArgPack)
+		if !isPack {
+			n = tp.ref
+			continue
+		}
+		if p == nil || p.packIndex < 0 {
+			return n
+		}
+		p.packMax = max(p.packMax, len(pack.args))
+		if p.packIndex >= len(pack.args) {
+			return n
+		}
+		n = pack.args[p.packIndex]
+	}
+	return n
+}
+
+// maxResolveDepth bounds chains of template parameters referring to each other.
+const maxResolveDepth = 32
+
+// isArray reports whether n is an array type, possibly cv-qualified.
+func isArray(p *printer, n node) bool {
+	switch n := resolve(p, n).(type) {
+	case *arrayType:
+		return true
+	case *qualType:
+		return isArray(p, n.child)
+	}
+	return false
+}
+
+// isFunction reports whether n is a function type, possibly cv-qualified.
+func isFunction(p *printer, n node) bool {
+	switch n := resolve(p, n).(type) {
+	case *functionType:
+		return true
+	case *qualType:
+		return isFunction(p, n.child)
+	}
+	return false
+}
+
+// printDeclaratorLeft prints the left half of a pointer, reference, or
+// pointer-to-member declarator. Arrays and functions need parentheses:
+// "int (*) [4]", "void (&)(int)".
+func printDeclaratorLeft(p *printer, pointee node, op string) {
+	pointee.printLeft(p)
+	array := isArray(p, pointee)
+	if array {
+		p.WriteByte(' ')
+	}
+	if array || isFunction(p, pointee) {
+		p.WriteByte('(')
+	}
+	p.WriteString(op)
+}
+
+func printDeclaratorRight(p *printer, pointee node) {
+	if isArray(p, pointee) || isFunction(p, pointee) {
+		p.WriteByte(')')
+	}
+	pointee.printRight(p)
+}
+
+type pointerType struct {
+	pointee node
+}
+
+func (n *pointerType) printLeft(p *printer)  { printDeclaratorLeft(p, n.pointee, "*") }
+func (n *pointerType) printRight(p *printer) { printDeclaratorRight(p, n.pointee) }
+func (n *pointerType) hasRight() bool        { return n.pointee.hasRight() }
+
+type referenceType struct {
+	pointee node
+	rvalue  bool
+}
+
+// collapse applies reference collapsing through template parameters:
+// T& & -> T&, T&& && -> T&&, and mixed -> T&.
+func (n *referenceType) collapse(p *printer) (node, bool) {
+	pointee, rvalue := n.pointee, n.rvalue
+	for range maxResolveDepth {
+		r, ok := resolve(p, pointee).(*referenceType)
+		if !ok {
+			break
+		}
+		pointee, rvalue = r.pointee, rvalue && r.rvalue
+	}
+	return pointee, rvalue
+}
+
+func (n *referenceType) printLeft(p *printer) {
+	pointee, rvalue := n.collapse(p)
+	if rvalue {
+		printDeclaratorLeft(p, pointee, "&&")
+	} else {
+		printDeclaratorLeft(p, pointee, "&")
+	}
+}
+
+func (n *referenceType) printRight(p *printer) {
+	pointee, _ := n.collapse(p)
+	printDeclaratorRight(p, pointee)
+}
+
+func (n *referenceType) hasRight() bool {
+	pointee, _ := n.collapse(nil)
+	return pointee.hasRight()
+}
+
+type pointerToMember struct {
+	class, member node
+}
+
+func (n *pointerToMember) printLeft(p *printer) {
+	n.member.printLeft(p)
+	if isArray(p, n.member) || isFunction(p, n.member) {
+		p.WriteByte('(')
+	} else {
+		p.WriteByte(' ')
+	}
+	printNode(p, n.class)
+	p.WriteString("::*")
+}
+
+func (n *pointerToMember) printRight(p *printer) {
+	if isArray(p, n.member) || isFunction(p, n.member) {
+		p.WriteByte(')')
+	}
+	n.member.printRight(p)
+}
+
+func (n *pointerToMember) hasRight() bool { return n.member.hasRight() }
+
+type arrayType struct {
+	base node
+	dim  node // nil for unknown bound
+}
+
+func (n *arrayType) printLeft(p *printer) { n.base.printLeft(p) }
+
+func (n *arrayType) printRight(p *printer) {
+	if p.last() != ']' {
+		p.WriteByte(' ')
+	}
+	p.WriteByte('[')
+	if n.dim != nil {
+		printNode(p, n.dim)
+	}
+	p.WriteByte(']')
+	n.base.printRight(p)
+}
+
+func (n *arrayType) hasRight() bool { return true }
+
+type packExpansion struct {
+	leaf
+	child node
+}
+
+// printLeft prints the pattern once per element of the packs it references,
+// e.g. "int, double" for Dp T_ with T_ = {int, double}. If no pack is known,
+// the pattern is printed with "...".
+func (n *packExpansion) printLeft(p *printer) {
+	probe := p.sub()
+	probe.packIndex = 0
+	probe.packMax = -1
+	printNode(probe, n.child)
+	if probe.packMax < 0 {
+		printNode(p, n.child)
+		p.WriteString("...")
+		return
+	}
+
+	for i := 0; i < probe.packMax; i++ {
+		if i > 0 {
+			p.WriteString(", ")
+		}
+		ep := p.sub()
+		ep.packIndex = i
+		printNode(ep, n.child)
+		p.WriteString(ep.String())
+	}
+}
+
+type integerLiteral struct {
+	leaf
+	typ, value string
+}
+
+func (n *integerLiteral) printLeft(p *printer) {
+	if len(n.typ) > 3 {
+		p.WriteString("(" + n.typ + ")")
+	}
+	p.WriteString(n.value)
+	if len(n.typ) <= 3 {
+		p.WriteString(n.typ)
+	}
+}
+
+// enclosingExpr prints pre, child, post.
+type enclosingExpr struct {
+	leaf
+	pre   string
+	child node
+	post  string
+}
+
+func (n *enclosingExpr) printLeft(p *printer) {
+	p.WriteString(n.pre)
+	printNode(p, n.child)
+	p.WriteString(n.post)
+}
+
+// binaryNode prints left, sep, right with no added spacing.
+type binaryNode struct {
+	leaf
+	left  node
+	sep   string
+	right node
+}
+
+func (n *binaryNode) printLeft(p *printer) {
+	printNode(p, n.left)
+	p.WriteString(n.sep)
+	printNode(p, n.right)
+}
+
+type binaryExpr struct {
+	leaf
+	left  node
+	op    string
+	right node
+}
+
+func (n *binaryExpr) printLeft(p *printer) {
+	// A bare '>' would close the enclosing template argument list
+	paren := n.op == ">" && p.templateDepth > 0
+	if paren {
+		p.WriteByte('(')
+	}
+	p.WriteByte('(')
+	printNode(p, n.left)
+	if n.op == "," {
+		p.WriteString("), (")
+	} else if n.op == "[]" {
+		p.WriteString(")[")
+	} else {
+		p.WriteString(") " + n.op + " (")
+	}
+	printNode(p, n.right)
+	if n.op == "[]" {
+		p.WriteByte(']')
+	} else {
+		p.WriteByte(')')
+	}
+	if paren {
+		p.WriteByte(')')
+	}
+}
+
+type conditionalExpr struct {
+	leaf
+	cond, then, els node
+}
+
+func (n *conditionalExpr) printLeft(p *printer) {
+	p.WriteByte('(')
+	printNode(p, n.cond)
+	p.WriteString(") ? (")
+	printNode(p, n.then)
+	p.WriteString(") : (")
+	printNode(p, n.els)
+	p.WriteByte(')')
+}
+
+type callExpr struct {
+	leaf
+	callee node
+	args   []node
+}
+
+func (n *callExpr) printLeft(p *printer) {
+	printNode(p, n.callee)
+	p.WriteByte('(')
+	printList(p, n.args)
+	p.WriteByte(')')
+}
+
+type newExpr struct {
+	leaf
+	global    bool
+	op        string
+	placement []node
+	typ       node
+	init      []node
+	hasInit   bool
+}
+
+func (n *newExpr) printLeft(p *printer) {
+	if n.global {
+		p.WriteString("::")
+	}
+	p.WriteString(n.op)
+	if len(n.placement) > 0 {
+		p.WriteString(" (")
+		printList(p, n.placement)
+		p.WriteByte(')')
+	}
+	p.WriteByte(' ')
+	printNode(p, n.typ)
+	if n.hasInit {
+		p.WriteByte('(')
+		printList(p, n.init)
+		p.WriteByte(')')
+	}
+}
@@ -0,0 +1,89 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestDemangle checks the demangler against llvm-cxxfilt output
+func TestDemangle(t *testing.T) {
+	tests := []struct {
+		mangled string
+		want    string
+	}{
+		{"_ZN7cocos2d9FileUtils11setXXTeaKeyEPKci", "cocos2d::FileUtils::setXXTeaKey(char const*, int)"},
+		{"_ZTVN7cocos2d8LuaStackE", "vtable for cocos2d::LuaStack"},
+		{"_Z1fPFviE", "f(void (*)(int))"},
+		{"_Z1fRA4_i", "f(int (&) [4])"},
+		{"_ZNK1A1fEv", "A::f() const"},
+		{"_ZN1AD2Ev", "A::~A()"},
+		{"_ZSt4moveIRiEONSt16remove_referenceIT_E4typeEOS2_", "std::remove_reference<int&>::type&& std::move<int&>(int&)"},
+		{"_Z1fIidEvT_T0_", "void f<int, double>(int, double)"},
+		{"_ZZ4mainENK3$_0clEv", "main::$_0::operator()() const"},
+		{"_ZZ4mainENKUlvE_clEv", "main::'lambda'()::operator()() const"},
+		{"_ZThn8_N1B1fEv", "non-virtual thunk to B::f()"},
+		{"_ZNSt6vectorIiSaIiEEC1Ev", "std::vector<int, std::allocator<int> >::vector()"},
+		{"_Z3foov.cold", "foo() (.cold)"},
+		{"_ZN1AcviIiEEv", "A::operator int<int>()"},
+		{"__ZN1A1fEv", "A::f()"},
+	}
+
+	for _, tt := range tests {
+		got, err := Demangle(tt.mangled)
+		if err != nil {
+			t.Errorf("Demangle(%q): %v", tt.mangled, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Demangle(%q) = %q, want %q", tt.mangled, got, tt.want)
+		}
+	}
+}
+
+// TestDemangleErrors checks invalid and unmangled input
+func TestDemangleErrors(t *testing.T) {
+	if _, err := Demangle("notmangled"); !errors.Is(err, ErrNotMangled) {
+		t.Errorf("Demangle(notmangled) error = %v, want ErrNotMangled", err)
+	}
+	for _, s := range []string{"_Z", "_ZN1A", "_Z1fPFv"} {
+		if _, err := Demangle(s); err == nil {
+			t.Errorf("Demangle(%q) succeeded, want error", s)
+		}
+	}
+	if got := DemangleName("memcpy@LIBC"); got != "memcpy@LIBC" {
+		t.Errorf("DemangleName(memcpy@LIBC) = %q", got)
+	}
+	if got, err := DemangleType("PKc"); err != nil || got != "char const*" {
+		t.Errorf("DemangleType(PKc) = %q, %v", got, err)
+	}
+}
+
+func TestDemangleNameCache(t *testing.T) {
+	for i := 0; i <= maxDemangledNames; i++ {
+		DemangleName(fmt.Sprintf("_Z1fv@V%d", i))
+	}
+	demangledNamesMu.Lock()
+	n := len(demangledNames)
+	demangledNamesMu.Unlock()
+	if n > maxDemangledNames {
+		t.Errorf("cache holds %d names, want at most %d", n, maxDemangledNames)
+	}
+	if got := DemangleName("_Z1fv@V0"); got != "f()@V0" {
+		t.Errorf("DemangleName after a reset = %q", got)
+	}
+}
+
+// TestExtractClassName checks class names recovered from vtable symbols
+func TestExtractClassName(t *testing.T) {
+	tests := map[string]string{
+		"_ZTVN7cocos2d8LuaStackE":          "cocos2d::LuaStack",
+		"_ZTVN7cocos2d9extension7ManagerE": "cocos2d::extension::Manager",
+		"_ZTV7AppBase":                     "AppBase",
+	}
+	for sym, want := range tests {
+		if got := extractClassName(sym); got != want {
+			t.Errorf("extractClassName(%q) = %q, want %q", sym, got, want)
+		}
+	}
+}
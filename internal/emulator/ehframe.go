@@ -0,0 +1,102 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// DWARF exception header pointer encodings (LSB Core, .eh_frame_hdr).
+const (
+	dwEhPeOmit    = 0xff
+	dwEhPeUdata4  = 0x03
+	dwEhPeSdata4  = 0x0b
+	dwEhPeUdata8  = 0x04
+	dwEhPeSdata8  = 0x0c
+	dwEhPePcrel   = 0x10
+	dwEhPeDatarel = 0x30
+)
+
+// parseEHFrameHdr returns the sorted function start addresses from the
+// binary search table of an .eh_frame_hdr loaded at vaddr. Every function
+// with unwind information has an entry, which survives stripping.
+func parseEHFrameHdr(data []byte, vaddr uint64) []uint64 {
+	if len(data) < 4 || data[0] != 1 {
+		return nil
+	}
+	ptrEnc, countEnc, tableEnc := data[1], data[2], data[3]
+	r := ehReader{data: data, pos: 4, base: vaddr}
+	if _, ok := r.read(ptrEnc); !ok {
+		return nil
+	}
+	count, ok := r.read(countEnc)
+	if !ok || tableEnc == dwEhPeOmit || count > uint64(len(data)) {
+		return nil
+	}
+
+	starts := make([]uint64, 0, count)
+	for i := uint64(0); i < count; i++ {
+		start, ok1 := r.read(tableEnc)
+		_, ok2 := r.read(tableEnc) // FDE address
+		if !ok1 || !ok2 {
+			return nil
+		}
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts
+}
+
+// ehReader decodes encoded pointers from an .eh_frame_hdr.
+type ehReader struct {
+	data []byte
+	pos  int
+	base uint64 // Address of data[0], for pcrel and datarel
+}
+
+func (r *ehReader) read(enc byte) (uint64, bool) {
+	if enc == dwEhPeOmit {
+		return 0, true
+	}
+	pc := r.base + uint64(r.pos)
+	var v uint64
+	switch enc & 0x0f {
+	case dwEhPeUdata4, dwEhPeSdata4:
+		if r.pos+4 > len(r.data) {
+			return 0, false
+		}
+		v = uint64(binary.LittleEndian.Uint32(r.data[r.pos:]))
+		if enc&0x0f == dwEhPeSdata4 {
+			v = uint64(int64(int32(v)))
+		}
+		r.pos += 4
+	case dwEhPeUdata8, dwEhPeSdata8:
+		if r.pos+8 > len(r.data) {
+			return 0, false
+		}
+		v = binary.LittleEndian.Uint64(r.data[r.pos:])
+		r.pos += 8
+	default:
+		return 0, false
+	}
+	switch enc & 0x70 {
+	case 0:
+	case dwEhPePcrel:
+		v += pc
+	case dwEhPeDatarel:
+		v += r.base
+	default:
+		return 0, false
+	}
+	return v, true
+}
+
+// FunctionStart returns the start of the function containing addr, from
+// the .eh_frame_hdr table. It fails for addresses before the first
+// function or binaries without the table.
+func (info *ELFInfo) FunctionStart(addr uint64) (uint64, bool) {
+	i := sort.Search(len(info.FuncStarts), func(i int) bool { return info.FuncStarts[i] > addr })
+	if i == 0 {
+		return 0, false
+	}
+	return info.FuncStarts[i-1], true
+}
@@ -1,10 +1,12 @@
 package emulator
 
 import (
+	"bytes"
 	"debug/elf"
 	"encoding/binary"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -27,6 +29,11 @@ type ELFInfo struct {
 	BaseAddr uint64     // Load base address
 	EndAddr  uint64     // End of loaded memory
 	VTables  *VTableMap // Resolved C++ vtables (slot -> function mapping)
+	Needed   []string   // DT_NEEDED shared library dependencies
+	Stripped bool       // True if the file has no .symtab
+
+	FuncStarts []uint64          // Sorted function starts from .eh_frame_hdr
+	FuncSizes  map[uint64]uint64 // Function start -> size from STT_FUNC symbols
 }
 
 // Segment represents a loadable ELF segment
@@ -103,13 +110,14 @@ func (e *Emulator) LoadELFAt(path string, loadBase uint64) (*ELFInfo, error) {
 	}
 
 	info := &ELFInfo{
-		Path:     path,
-		Machine:  f.Machine,
-		Entry:    f.Entry + relocOffset,
-		Symbols:  make(map[string]uint64),
-		Imports:  make(map[string]uint64),
-		BaseAddr: fileBase + relocOffset,
-		EndAddr:  fileEnd + relocOffset,
+		Path:      path,
+		Machine:   f.Machine,
+		Entry:     f.Entry + relocOffset,
+		Symbols:   make(map[string]uint64),
+		Imports:   make(map[string]uint64),
+		BaseAddr:  fileBase + relocOffset,
+		EndAddr:   fileEnd + relocOffset,
+		FuncSizes: make(map[uint64]uint64),
 	}
 
 	// Load symbols from .dynsym and .symtab (with relocation)
@@ -120,6 +128,7 @@ func (e *Emulator) LoadELFAt(path string, loadBase uint64) (*ELFInfo, error) {
 			if sym.Value != 0 && sym.Name != "" {
 				addr := sym.Value + relocOffset
 				info.Symbols[sym.Name] = addr
+				info.addFuncSize(sym, addr)
 				// Also store without version suffix for easier lookup
 				if idx := strings.Index(sym.Name, "@@"); idx != -1 {
 					info.Symbols[sym.Name[:idx]] = addr
@@ -131,14 +140,18 @@ func (e *Emulator) LoadELFAt(path string, loadBase uint64) (*ELFInfo, error) {
 	}
 
 	syms, err = f.Symbols()
+	info.Stripped = err != nil || len(syms) == 0
 	if err == nil {
 		for _, sym := range syms {
 			if sym.Value != 0 && sym.Name != "" {
 				info.Symbols[sym.Name] = sym.Value + relocOffset
+				info.addFuncSize(sym, sym.Value+relocOffset)
 			}
 		}
 	}
 
+	info.Needed, _ = f.ImportedLibraries()
+
 	// Read file data for segments
 	fileData, err := os.ReadFile(path)
 	if err != nil {
@@ -196,6 +209,12 @@ func (e *Emulator) LoadELFAt(path string, loadBase uint64) (*ELFInfo, error) {
 		}
 	}
 
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_GNU_EH_FRAME && prog.Off+prog.Filesz <= uint64(len(fileData)) {
+			info.FuncStarts = parseEHFrameHdr(fileData[prog.Off:prog.Off+prog.Filesz], prog.Vaddr+relocOffset)
+		}
+	}
+
 	// Build PLT stub address map FIRST (needed for relocation second pass)
 	// PLT addresses go to Imports map (for stub installation) AND Symbols map (for lookups)
 	addPLTSymbols(f, relocOffset, info.Symbols, info.Imports)
@@ -218,6 +237,7 @@ func (e *Emulator) LoadELFAt(path string, loadBase uint64) (*ELFInfo, error) {
 	// that need to be initialized to point to the empty string representation
 	e.initStringGlobals(info.Symbols)
 
+	e.image = info
 	return info, nil
 }
 
@@ -395,7 +415,7 @@ func (e *Emulator) applyRelocations(f *elf.File, relocOffset uint64, imports map
 					} else if sym.Name == "__stack_chk_guard" {
 						// External symbol from libc - point to our TLS canary
 						// The canary value is at TLS+0x28
-						canaryAddr := uint64(TLSBase + 0x28)
+						canaryAddr := TLSBase + TLSGuardOffset
 						buf := make([]byte, 8)
 						binary.LittleEndian.PutUint64(buf, canaryAddr)
 						_ = e.MemWrite(targetAddr, buf)
@@ -450,6 +470,26 @@ func (e *Emulator) applyRelocations(f *elf.File, relocOffset uint64, imports map
 	return nil
 }
 
+// addFuncSize records the size of a function symbol.
+func (info *ELFInfo) addFuncSize(sym elf.Symbol, addr uint64) {
+	if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Size > 0 {
+		info.FuncSizes[addr] = sym.Size
+	}
+}
+
+// AddrNames maps each symbol address to its shortest name, which drops
+// version suffixes and the longer of aliases. Ties go to the first name in
+// order, so the choice doesn't depend on map iteration.
+func (info *ELFInfo) AddrNames() map[uint64]string {
+	names := make(map[uint64]string, len(info.Symbols))
+	for name, addr := range info.Symbols {
+		if old, ok := names[addr]; !ok || len(name) < len(old) || len(name) == len(old) && name < old {
+			names[addr] = name
+		}
+	}
+	return names
+}
+
 // FindSymbol looks up a symbol by name, returns 0 if not found
 func (info *ELFInfo) FindSymbol(name string) uint64 {
 	return info.Symbols[name]
@@ -501,13 +541,29 @@ func (info *ELFInfo) FindEntryPoint(preferredEntry string) uint64 {
 		}
 	}
 
-	// Build list of candidate entry points with priorities
-	type candidate struct {
-		name     string
-		addr     uint64
-		priority int
+	if candidates := info.EntryCandidates(); len(candidates) > 0 {
+		return candidates[0].Addr
+	}
+
+	// Fallback to JNI_OnLoad
+	if addr := info.FindJNIOnLoad(); addr != 0 {
+		return addr
 	}
-	var candidates []candidate
+
+	// Fallback to ELF entry point
+	return info.Entry
+}
+
+// EntryCandidate is a symbol considered by FindEntryPoint.
+type EntryCandidate struct {
+	Name     string
+	Addr     uint64
+	Priority int // Lower is preferred
+}
+
+// EntryCandidates returns the automatic entry point candidates, best first.
+func (info *ELFInfo) EntryCandidates() []EntryCandidate {
+	var candidates []EntryCandidate
 
 	for name, addr := range info.Symbols {
 		if addr == 0 {
@@ -525,64 +581,54 @@ func (info *ELFInfo) FindEntryPoint(preferredEntry string) uint64 {
 
 		// Priority 0: regist_lua (Lua games - direct key setup)
 		if strings.Contains(lower, "regist_lua") {
-			candidates = append(candidates, candidate{name, addr, 0})
+			candidates = append(candidates, EntryCandidate{name, addr, 0})
 			continue
 		}
 		// Priority 1: AppDelegate::applicationDidFinishLaunching (most reliable for key extraction)
 		if strings.Contains(lower, "appdelegate") && strings.Contains(lower, "didfinish") {
-			candidates = append(candidates, candidate{name, addr, 1})
+			candidates = append(candidates, EntryCandidate{name, addr, 1})
 			continue
 		}
 		// Priority 2: CCGameMain::applicationDidFinishLaunching (Lua games - less reliable)
 		if strings.Contains(lower, "ccgamemain") && strings.Contains(lower, "didfinish") {
-			candidates = append(candidates, candidate{name, addr, 2})
+			candidates = append(candidates, EntryCandidate{name, addr, 2})
 			continue
 		}
 		// Priority 3: Generic applicationDidFinishLaunching
 		if strings.Contains(lower, "didfinishlaunching") {
-			candidates = append(candidates, candidate{name, addr, 3})
+			candidates = append(candidates, EntryCandidate{name, addr, 3})
 			continue
 		}
 		// Priority 4: cocos_android_app_init
 		if strings.Contains(lower, "cocos_android_app_init") {
-			candidates = append(candidates, candidate{name, addr, 4})
+			candidates = append(candidates, EntryCandidate{name, addr, 4})
 			continue
 		}
 		// Priority 5: cocos_main (Cocos Creator 3.x)
 		if strings.Contains(lower, "cocos_main") {
-			candidates = append(candidates, candidate{name, addr, 5})
+			candidates = append(candidates, EntryCandidate{name, addr, 5})
 			continue
 		}
 		// Priority 6: Game::init (Cocos Creator 3.x) - _ZN4Game...initEv
 		if strings.HasPrefix(lower, "_zn4game") && strings.Contains(lower, "initev") {
-			candidates = append(candidates, candidate{name, addr, 6})
+			candidates = append(candidates, EntryCandidate{name, addr, 6})
 			continue
 		}
 		// Priority 7: JNI_OnLoad
 		if strings.EqualFold(name, "JNI_OnLoad") {
-			candidates = append(candidates, candidate{name, addr, 7})
+			candidates = append(candidates, EntryCandidate{name, addr, 7})
 			continue
 		}
 	}
 
-	// Sort by priority and return best
-	if len(candidates) > 0 {
-		best := candidates[0]
-		for _, c := range candidates[1:] {
-			if c.priority < best.priority {
-				best = c
-			}
+	// Sort by priority, then name for a stable order
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority < candidates[j].Priority
 		}
-		return best.addr
-	}
-
-	// Fallback to JNI_OnLoad
-	if addr := info.FindJNIOnLoad(); addr != 0 {
-		return addr
-	}
-
-	// Fallback to ELF entry point
-	return info.Entry
+		return candidates[i].Name < candidates[j].Name
+	})
+	return candidates
 }
 
 // FindSymbolsMatching returns all symbols matching a predicate
@@ -603,6 +649,85 @@ func (info *ELFInfo) FindSymbolsBySubstring(substr string) map[string]uint64 {
 	})
 }
 
+// FindStringsFunc returns printable strings of at least minLen bytes in loaded
+// segments for which match returns true, in file order. At most limit strings
+// are returned (0 means no limit).
+func (info *ELFInfo) FindStringsFunc(minLen int, match func(s string) bool, limit int) []string {
+	var result []string
+	seen := make(map[string]bool)
+
+	for _, seg := range info.Segments {
+		data := seg.Data
+		start := -1
+		for i := 0; i <= len(data); i++ {
+			if i < len(data) && isPrintableByte(data[i]) {
+				if start < 0 {
+					start = i
+				}
+				continue
+			}
+			if start >= 0 && i-start >= minLen {
+				str := string(data[start:i])
+				if !seen[str] && match(str) {
+					seen[str] = true
+					result = append(result, str)
+					if limit > 0 && len(result) >= limit {
+						return result
+					}
+				}
+			}
+			start = -1
+		}
+	}
+	return result
+}
+
+// FindStrings returns NUL-terminated printable strings in loaded segments
+// that contain substr, in file order. At most limit strings are returned
+// (0 means no limit).
+func (info *ELFInfo) FindStrings(substr string, limit int) []string {
+	var result []string
+	seen := make(map[string]bool)
+	needle := []byte(substr)
+
+	for _, seg := range info.Segments {
+		data := seg.Data
+		for off := 0; off < len(data); {
+			idx := bytes.Index(data[off:], needle)
+			if idx < 0 {
+				break
+			}
+			pos := off + idx
+
+			// Expand to the enclosing printable run
+			start := pos
+			for start > 0 && isPrintableByte(data[start-1]) {
+				start--
+			}
+			end := pos + len(needle)
+			for end < len(data) && isPrintableByte(data[end]) {
+				end++
+			}
+			off = end
+
+			str := string(data[start:end])
+			if seen[str] {
+				continue
+			}
+			seen[str] = true
+			result = append(result, str)
+			if limit > 0 && len(result) >= limit {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+func isPrintableByte(b byte) bool {
+	return b >= 0x20 && b < 0x7f
+}
+
 // IsExecutable returns true if the segment is executable
 func (s *Segment) IsExecutable() bool {
 	return s.Flags&elf.PF_X != 0
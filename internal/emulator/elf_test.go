@@ -1,7 +1,9 @@
 package emulator
 
 import (
+	"encoding/binary"
 	"os"
+	"slices"
 	"testing"
 )
 
@@ -146,3 +148,32 @@ func TestFindEntryPoint(t *testing.T) {
 		t.Errorf("Expected AppDelegate (0x5000) over JNI_OnLoad, got 0x%x", entry)
 	}
 }
+
+func TestParseEHFrameHdr(t *testing.T) {
+	const vaddr = 0x1000
+	// version 1, eh_frame_ptr pcrel|sdata4, fde_count udata4, table datarel|sdata4
+	hdr := []byte{1, 0x1b, 0x03, 0x3b, 0, 0, 0, 0, 3, 0, 0, 0}
+	for _, start := range []int32{0x300, -0x800, 0x100} {
+		hdr = binary.LittleEndian.AppendUint32(hdr, uint32(start))
+		hdr = binary.LittleEndian.AppendUint32(hdr, 0x2000)
+	}
+	info := &ELFInfo{FuncStarts: parseEHFrameHdr(hdr, vaddr)}
+	want := []uint64{0x800, 0x1100, 0x1300}
+	if !slices.Equal(info.FuncStarts, want) {
+		t.Fatalf("FuncStarts = %#x, want %#x", info.FuncStarts, want)
+	}
+
+	for _, tt := range []struct {
+		addr, start uint64
+		ok          bool
+	}{
+		{0x7ff, 0, false},
+		{0x800, 0x800, true},
+		{0x12fc, 0x1100, true},
+		{0x5000, 0x1300, true},
+	} {
+		if start, ok := info.FunctionStart(tt.addr); start != tt.start || ok != tt.ok {
+			t.Errorf("FunctionStart(%#x) = %#x, %v; want %#x, %v", tt.addr, start, ok, tt.start, tt.ok)
+		}
+	}
+}
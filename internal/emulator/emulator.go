@@ -27,6 +27,12 @@ const (
 	StubSize    = 0x00100000 // 1MB for stubs
 )
 
+// TLS slot layout (offsets from TPIDR_EL0, matching bionic's arm64 slots)
+const (
+	TLSErrnoOffset uint64 = 0x10 // TLS_SLOT_APP, historically errno
+	TLSGuardOffset uint64 = 0x28 // TLS_SLOT_STACK_GUARD (stack canary)
+)
+
 // Libc global layout
 const (
 	CtypeTableOffset   uint64 = 0x0000 // _ctype_ table: 257 bytes (index -1 to 255)
@@ -57,9 +63,23 @@ type TraceEvent struct {
 // CodeHookFunc is called for each instruction
 type CodeHookFunc func(emu *Emulator, addr uint64, size uint32)
 
+// BlockHookFunc is called when execution enters a basic block
+type BlockHookFunc func(emu *Emulator, addr uint64, size uint32)
+
 // AddressHookFunc is called when execution reaches a specific address
 type AddressHookFunc func(emu *Emulator) bool // return true to stop emulation
 
+// MemHookFunc is called for a memory access in a hooked range.
+type MemHookFunc func(emu *Emulator, addr uint64, size int)
+
+// InterruptHookFunc is called when the CPU raises an exception such as SVC.
+// PC already points past the excepting instruction. It returns true if it
+// handled the exception.
+type InterruptHookFunc func(emu *Emulator, intno uint32) bool
+
+// IntrSVC is the interrupt number Unicorn reports for SVC (QEMU's EXCP_SWI)
+const IntrSVC = 2
+
 // Emulator wraps Unicorn for ARM64 emulation
 type Emulator struct {
 	mu uc.Unicorn
@@ -71,6 +91,8 @@ type Emulator struct {
 	codeHooks   []CodeHookFunc
 	addrHooks   map[uint64]AddressHookFunc
 	addrHooksMu sync.RWMutex
+	intrHooks   []InterruptHookFunc
+	hostWrites  []MemHookFunc
 
 	// Trace collection
 	traceEnabled bool
@@ -80,8 +102,14 @@ type Emulator struct {
 	// Stop flag
 	stopped bool
 
+	// Exception no interrupt hook handled, returned by Run
+	fault error
+
 	// libstdc++ COW empty string data pointer
 	emptyStringData uint64
+
+	// Most recently loaded ELF image
+	image *ELFInfo
 }
 
 // New creates a new ARM64 emulator
@@ -166,7 +194,7 @@ func (e *Emulator) mapMemory() error {
 		return fmt.Errorf("set TPIDR_EL0: %w", err)
 	}
 
-	// Initialize TLS area with zeros
+	// Initialize TLS area with zeros (errno starts at 0)
 	zeros := make([]byte, 256)
 	if err := e.mu.MemWrite(TLSBase, zeros); err != nil {
 		return fmt.Errorf("init TLS: %w", err)
@@ -177,7 +205,7 @@ func (e *Emulator) mapMemory() error {
 	canary := uint64(0xDEADBEEFDEADBEEF)
 	canaryBytes := make([]byte, 8)
 	binary.LittleEndian.PutUint64(canaryBytes, canary)
-	if err := e.mu.MemWrite(TLSBase+0x28, canaryBytes); err != nil {
+	if err := e.mu.MemWrite(TLSBase+TLSGuardOffset, canaryBytes); err != nil {
 		return fmt.Errorf("set stack canary: %w", err)
 	}
 
@@ -388,6 +416,11 @@ func (e *Emulator) mapMemory() error {
 	return nil
 }
 
+// Image returns the most recently loaded ELF image, or nil.
+func (e *Emulator) Image() *ELFInfo {
+	return e.image
+}
+
 // GetMockObject returns the main mock C++ object address.
 // Use this as the "this" pointer for member methods.
 func (e *Emulator) GetMockObject() uint64 {
@@ -578,7 +611,13 @@ func (e *Emulator) MemRead(addr, size uint64) ([]byte, error) {
 
 // MemWrite writes bytes to memory
 func (e *Emulator) MemWrite(addr uint64, data []byte) error {
-	return e.mu.MemWrite(addr, data)
+	if err := e.mu.MemWrite(addr, data); err != nil {
+		return err
+	}
+	for _, h := range e.hostWrites {
+		h(e, addr, len(data))
+	}
+	return nil
 }
 
 // MemReadU64 reads a uint64 from memory (little endian)
@@ -594,7 +633,7 @@ func (e *Emulator) MemReadU64(addr uint64) (uint64, error) {
 func (e *Emulator) MemWriteU64(addr, val uint64) error {
 	data := make([]byte, 8)
 	binary.LittleEndian.PutUint64(data, val)
-	return e.mu.MemWrite(addr, data)
+	return e.MemWrite(addr, data)
 }
 
 // MemReadU32 reads a uint32 from memory (little endian)
@@ -610,7 +649,7 @@ func (e *Emulator) MemReadU32(addr uint64) (uint32, error) {
 func (e *Emulator) MemWriteU32(addr uint64, val uint32) error {
 	data := make([]byte, 4)
 	binary.LittleEndian.PutUint32(data, val)
-	return e.mu.MemWrite(addr, data)
+	return e.MemWrite(addr, data)
 }
 
 // MemReadU16 reads a uint16 from memory (little endian)
@@ -626,7 +665,7 @@ func (e *Emulator) MemReadU16(addr uint64) (uint16, error) {
 func (e *Emulator) MemWriteU16(addr uint64, val uint16) error {
 	data := make([]byte, 2)
 	binary.LittleEndian.PutUint16(data, val)
-	return e.mu.MemWrite(addr, data)
+	return e.MemWrite(addr, data)
 }
 
 // MemReadU8 reads a single byte from memory
@@ -640,7 +679,7 @@ func (e *Emulator) MemReadU8(addr uint64) (uint8, error) {
 
 // MemWriteU8 writes a single byte to memory
 func (e *Emulator) MemWriteU8(addr uint64, val uint8) error {
-	return e.mu.MemWrite(addr, []byte{val})
+	return e.MemWrite(addr, []byte{val})
 }
 
 // MemReadString reads a null-terminated string from memory
@@ -665,7 +704,7 @@ func (e *Emulator) MemReadString(addr uint64, maxLen int) (string, error) {
 // MemWriteString writes a null-terminated string to memory
 func (e *Emulator) MemWriteString(addr uint64, s string) error {
 	data := append([]byte(s), 0)
-	return e.mu.MemWrite(addr, data)
+	return e.MemWrite(addr, data)
 }
 
 // RegRead reads a register value
@@ -687,6 +726,25 @@ func (e *Emulator) X(n int) uint64 {
 	return val
 }
 
+// regFile lists X0-X30 and SP for Regs.
+var regFile = func() []int {
+	regs := make([]int, 0, 32)
+	for n := 0; n <= 28; n++ {
+		regs = append(regs, uc.ARM64_REG_X0+n)
+	}
+	return append(regs, uc.ARM64_REG_X29, uc.ARM64_REG_X30, uc.ARM64_REG_SP)
+}()
+
+// Regs reads X0-X30 and SP (index 31) in one call
+func (e *Emulator) Regs() [32]uint64 {
+	var regs [32]uint64
+	vals, err := e.mu.RegReadBatch(regFile)
+	if err == nil {
+		copy(regs[:], vals)
+	}
+	return regs
+}
+
 // SetX writes general-purpose register X0-X30
 func (e *Emulator) SetX(n int, val uint64) error {
 	if n < 0 || n > 30 {
@@ -695,6 +753,24 @@ func (e *Emulator) SetX(n int, val uint64) error {
 	return e.mu.RegWrite(uc.ARM64_REG_X0+n, val)
 }
 
+// D reads the low 64 bits of SIMD/FP register V0-V31 (the D view).
+// Doubles are passed in D0-D7 and floats are promoted to double for variadic calls.
+func (e *Emulator) D(n int) uint64 {
+	if n < 0 || n > 31 {
+		return 0
+	}
+	val, _ := e.mu.RegRead(uc.ARM64_REG_D0 + n)
+	return val
+}
+
+// SetD writes the low 64 bits of SIMD/FP register V0-V31
+func (e *Emulator) SetD(n int, val uint64) error {
+	if n < 0 || n > 31 {
+		return fmt.Errorf("invalid register D%d", n)
+	}
+	return e.mu.RegWrite(uc.ARM64_REG_D0+n, val)
+}
+
 // PC returns the program counter
 func (e *Emulator) PC() uint64 {
 	pc, _ := e.mu.RegRead(uc.ARM64_REG_PC)
@@ -728,6 +804,29 @@ func (e *Emulator) SetLR(val uint64) error {
 	return e.mu.RegWrite(uc.ARM64_REG_LR, val)
 }
 
+// ThreadPointer returns TPIDR_EL0, the base of the current thread's TLS block
+func (e *Emulator) ThreadPointer() uint64 {
+	tp, _ := e.mu.RegRead(uc.ARM64_REG_TPIDR_EL0)
+	return tp
+}
+
+// ErrnoAddr returns the address of the current thread's errno.
+// This is what bionic's __errno() returns.
+func (e *Emulator) ErrnoAddr() uint64 {
+	return e.ThreadPointer() + TLSErrnoOffset
+}
+
+// Errno reads the current thread's errno
+func (e *Emulator) Errno() int {
+	v, _ := e.MemReadU32(e.ErrnoAddr())
+	return int(int32(v))
+}
+
+// SetErrno writes the current thread's errno
+func (e *Emulator) SetErrno(errno int) error {
+	return e.MemWriteU32(e.ErrnoAddr(), uint32(errno))
+}
+
 // Malloc allocates memory from the heap (bump allocator).
 // Panics if heap is exhausted - this indicates a fundamental emulation problem.
 func (e *Emulator) Malloc(size uint64) uint64 {
@@ -744,6 +843,11 @@ func (e *Emulator) Malloc(size uint64) uint64 {
 	return addr
 }
 
+// HeapEnd returns the end of the allocated heap.
+func (e *Emulator) HeapEnd() uint64 {
+	return e.heapPtr
+}
+
 // HookCode adds a code hook called for every instruction
 func (e *Emulator) HookCode(fn CodeHookFunc) {
 	e.codeHooks = append(e.codeHooks, fn)
@@ -756,6 +860,73 @@ func (e *Emulator) HookAddress(addr uint64, fn AddressHookFunc) {
 	e.addrHooks[addr] = fn
 }
 
+// TryHookAddress adds a hook for addr unless one is already installed there,
+// and reports whether it did. Detectors use it so that two of them matching
+// the same function do not replace each other's hooks.
+func (e *Emulator) TryHookAddress(addr uint64, fn AddressHookFunc) bool {
+	e.addrHooksMu.Lock()
+	defer e.addrHooksMu.Unlock()
+	if _, ok := e.addrHooks[addr]; ok {
+		return false
+	}
+	e.addrHooks[addr] = fn
+	return true
+}
+
+// HookInterrupt adds a hook called for every CPU exception. An exception
+// no hook handles stops emulation with UC_ERR_EXCEPTION, as without hooks.
+func (e *Emulator) HookInterrupt(fn InterruptHookFunc) error {
+	if len(e.intrHooks) == 0 {
+		_, err := e.mu.HookAdd(uc.HOOK_INTR, func(mu uc.Unicorn, intno uint32) {
+			handled := false
+			for _, h := range e.intrHooks {
+				if h(e, intno) {
+					handled = true
+				}
+			}
+			if !handled {
+				e.fault = fmt.Errorf("%w: intno=%d pc=0x%x", uc.UcError(uc.ERR_EXCEPTION), intno, e.PC())
+				e.Stop()
+			}
+		}, 1, 0)
+		if err != nil {
+			return err
+		}
+	}
+	e.intrHooks = append(e.intrHooks, fn)
+	return nil
+}
+
+// HookMemRead adds a hook called for every read in [begin, end].
+func (e *Emulator) HookMemRead(begin, end uint64, fn MemHookFunc) error {
+	_, err := e.mu.HookAdd(uc.HOOK_MEM_READ, func(mu uc.Unicorn, access int, addr uint64, size int, value int64) {
+		fn(e, addr, size)
+	}, begin, end)
+	return err
+}
+
+// HookBlock adds a hook called for every basic block executed.
+func (e *Emulator) HookBlock(fn BlockHookFunc) error {
+	_, err := e.mu.HookAdd(uc.HOOK_BLOCK, func(mu uc.Unicorn, addr uint64, size uint32) {
+		fn(e, addr, size)
+	}, 1, 0)
+	return err
+}
+
+// HookMemWrite adds a hook called for every guest write in [begin, end].
+func (e *Emulator) HookMemWrite(begin, end uint64, fn MemHookFunc) error {
+	_, err := e.mu.HookAdd(uc.HOOK_MEM_WRITE, func(mu uc.Unicorn, access int, addr uint64, size int, value int64) {
+		fn(e, addr, size)
+	}, begin, end)
+	return err
+}
+
+// HookHostWrite adds a hook called for every write stubs make through
+// MemWrite and its helpers, which guest write hooks do not see.
+func (e *Emulator) HookHostWrite(fn MemHookFunc) {
+	e.hostWrites = append(e.hostWrites, fn)
+}
+
 // RemoveAddressHook removes an address hook
 func (e *Emulator) RemoveAddressHook(addr uint64) {
 	e.addrHooksMu.Lock()
@@ -796,15 +967,21 @@ func (e *Emulator) ClearTrace() {
 
 // Run starts emulation from addr
 func (e *Emulator) Run(start, end uint64) error {
-	e.stopped = false
-	return e.mu.Start(start, end)
+	e.stopped, e.fault = false, nil
+	if err := e.mu.Start(start, end); err != nil {
+		return err
+	}
+	return e.fault
 }
 
 // RunFrom starts emulation from current PC
 func (e *Emulator) RunFrom(start uint64) error {
-	e.stopped = false
+	e.stopped, e.fault = false, nil
 	// Use 0 as end address to run until stop
-	return e.mu.Start(start, 0)
+	if err := e.mu.Start(start, 0); err != nil {
+		return err
+	}
+	return e.fault
 }
 
 // Stop stops emulation
@@ -204,3 +204,37 @@ func TestCodeHook(t *testing.T) {
 		t.Errorf("Expected 4 instructions, got %d", instrCount)
 	}
 }
+
+func TestQRegister(t *testing.T) {
+	emu, err := New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	emu.SetX(17, 0x1717)
+	if err := emu.SetQ(1, 0x1111222233334444, 0x5555666677778888); err != nil {
+		t.Fatalf("SetQ: %v", err)
+	}
+	if lo, hi := emu.Q(1); lo != 0x1111222233334444 || hi != 0x5555666677778888 {
+		t.Errorf("Q1 = %#x:%#x", hi, lo)
+	}
+	if d := emu.D(1); d != 0x1111222233334444 {
+		t.Errorf("D1 = %#x, want the low half", d)
+	}
+	if lo, hi := emu.Q(2); lo != 0 || hi != 0 {
+		t.Errorf("Q2 = %#x:%#x, want untouched", hi, lo)
+	}
+	if x := emu.X(17); x != 0x1717 {
+		t.Errorf("X17 = %#x, want untouched", x)
+	}
+
+	// The guest sees the high half: UMOV X0, V1.D[1]
+	emu.LoadCode([]byte{0x20, 0x3c, 0x18, 0x4e})
+	if err := emu.Run(CodeBase, CodeBase+4); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if x := emu.X(0); x != 0x5555666677778888 {
+		t.Errorf("UMOV X0, V1.D[1] = %#x", x)
+	}
+}
@@ -0,0 +1,47 @@
+package emulator
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unsafe"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+// #include <unicorn/unicorn.h>
+import "C"
+
+// The Unicorn Go bindings read and write registers as uint64, so the
+// 128-bit registers go through uc_reg_read and uc_reg_write directly,
+// with the engine handle the bindings expose.
+
+// Q reads a 128-bit SIMD/FP register, such as a long double argument in Q0-Q7.
+func (e *Emulator) Q(n int) (lo, hi uint64) {
+	if n < 0 || n > 31 {
+		return 0, 0
+	}
+	var buf [16]byte
+	if C.uc_reg_read(e.handle(), C.int(uc.ARM64_REG_Q0+n), unsafe.Pointer(&buf[0])) != C.UC_ERR_OK {
+		return 0, 0
+	}
+	return binary.LittleEndian.Uint64(buf[:8]), binary.LittleEndian.Uint64(buf[8:])
+}
+
+// SetQ writes a 128-bit SIMD/FP register, such as a long double returned in Q0.
+func (e *Emulator) SetQ(n int, lo, hi uint64) error {
+	if n < 0 || n > 31 {
+		return fmt.Errorf("invalid register Q%d", n)
+	}
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], lo)
+	binary.LittleEndian.PutUint64(buf[8:], hi)
+	if err := C.uc_reg_write(e.handle(), C.int(uc.ARM64_REG_Q0+n), unsafe.Pointer(&buf[0])); err != C.UC_ERR_OK {
+		return uc.UcError(err)
+	}
+	return nil
+}
+
+// handle returns the engine handle as this package's C type.
+func (e *Emulator) handle() *C.uc_engine {
+	return (*C.uc_engine)(unsafe.Pointer(e.mu.Handle()))
+}
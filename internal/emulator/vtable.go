@@ -229,103 +229,17 @@ func BuildVTableMap(f *elf.File, relocOffset uint64) (*VTableMap, error) {
 	return vtm, nil
 }
 
-// extractClassName extracts class name from mangled vtable symbol.
+// extractClassName extracts the demangled class name from a vtable symbol.
 // _ZTVN7cocos2d8LuaStackE -> cocos2d::LuaStack
 func extractClassName(mangledName string) string {
 	if !strings.HasPrefix(mangledName, "_ZTV") {
 		return ""
 	}
-
-	// Handle nested names: _ZTVN<parts>E
-	if strings.HasPrefix(mangledName, "_ZTVN") {
-		rest := mangledName[5:] // Skip _ZTVN
-		return parseNestedName(rest)
-	}
-
-	// Handle simple names: _ZTV<length><name>
-	rest := mangledName[4:] // Skip _ZTV
-	if len(rest) > 0 && rest[0] >= '1' && rest[0] <= '9' {
-		length, name := parseLengthPrefixedName(rest)
-		if length > 0 {
-			return name
-		}
-	}
-
-	return ""
-}
-
-// parseNestedName parses Itanium nested name encoding
-func parseNestedName(s string) string {
-	parts := []string{}
-	rest := s
-
-	for len(rest) > 0 && rest[0] != 'E' {
-		// Skip template arguments
-		if rest[0] == 'I' {
-			break
-		}
-
-		// Parse length-prefixed component
-		length, name := parseLengthPrefixedName(rest)
-		if length > 0 && name != "" {
-			parts = append(parts, name)
-			rest = rest[length:]
-			// Skip the parsed name
-			if len(rest) >= len(name) {
-				// Already consumed by parseLengthPrefixedName
-			}
-		} else {
-			break
-		}
-
-		// Advance past the name we just parsed
-		if len(rest) > 0 {
-			consumed := 0
-			for consumed < len(rest) && rest[consumed] >= '0' && rest[consumed] <= '9' {
-				consumed++
-			}
-			if consumed > 0 && consumed < len(rest) {
-				numLen := 0
-				for _, c := range rest[:consumed] {
-					numLen = numLen*10 + int(c-'0')
-				}
-				if consumed+numLen <= len(rest) {
-					rest = rest[consumed+numLen:]
-				} else {
-					break
-				}
-			} else {
-				break
-			}
-		}
-	}
-
-	if len(parts) > 0 {
-		return strings.Join(parts, "::")
-	}
-	return ""
-}
-
-// parseLengthPrefixedName parses a length-prefixed name like "7cocos2d"
-// Returns (total bytes consumed, name)
-func parseLengthPrefixedName(s string) (int, string) {
-	if len(s) == 0 || s[0] < '1' || s[0] > '9' {
-		return 0, ""
-	}
-
-	// Parse multi-digit length
-	i := 0
-	length := 0
-	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
-		length = length*10 + int(s[i]-'0')
-		i++
-	}
-
-	if i+length > len(s) {
-		return 0, ""
+	name, err := Demangle(mangledName)
+	if err != nil {
+		return ""
 	}
-
-	return i + length, s[i : i+length]
+	return strings.TrimPrefix(name, "vtable for ")
 }
 
 // cleanSymbolName removes version suffixes from symbol names
@@ -393,14 +307,18 @@ func (vtm *VTableMap) FindSetterSlots(setterPatterns []string) map[uint64]map[ui
 	return result
 }
 
-// isSetterSymbol checks if a symbol name matches setter patterns
+// isSetterSymbol checks if a symbol name matches setter patterns.
+// Patterns are matched case-insensitively against both the mangled and
+// demangled names, so "setxxteakey" and "cocos2d::FileUtils::setXXTeaKey" both work.
 func isSetterSymbol(symName string, patterns []string) bool {
 	if symName == "" {
 		return false
 	}
 	lower := strings.ToLower(symName)
+	demangled := strings.ToLower(DemangleName(symName))
 	for _, p := range patterns {
-		if strings.Contains(lower, strings.ToLower(p)) {
+		p = strings.ToLower(p)
+		if strings.Contains(lower, p) || strings.Contains(demangled, p) {
 			return true
 		}
 	}
@@ -0,0 +1,85 @@
+package emulator
+
+import "encoding/binary"
+
+// maxFunctionScan bounds how far back from an instruction the prologue
+// walk searches for its function's start.
+const maxFunctionScan = 16 * 1024
+
+// LoadedAddress decodes an ADR, or an ADRP followed within a few
+// instructions by an ADD to the same register, at code[off], where code
+// is loaded so that code[off] is at pc.
+func LoadedAddress(code []byte, off int, pc uint64) (uint64, bool) {
+	insn := binary.LittleEndian.Uint32(code[off:])
+	imm := int64(insn>>29&3 | insn>>5&0x7ffff<<2)
+	imm = imm << 43 >> 43 // Sign-extend 21 bits
+	switch insn & 0x9f000000 {
+	case 0x10000000: // ADR
+		return pc + uint64(imm), true
+	case 0x90000000: // ADRP
+		rd := insn & 0x1f
+		page := pc&^0xfff + uint64(imm<<12)
+		for i := off + 4; i < off+24 && i+4 <= len(code); i += 4 {
+			next := binary.LittleEndian.Uint32(code[i:])
+			// ADD Xd, Xd, #imm12 (unshifted)
+			if next&0xffc00000 == 0x91000000 && next&0x1f == rd && next>>5&0x1f == rd {
+				return page + uint64(next>>10&0xfff), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// ContainingFunction returns the start of the function around addr: from
+// .eh_frame_hdr when the binary has one, or by walking back to the
+// prologue in addr's segment.
+func (info *ELFInfo) ContainingFunction(addr uint64) (uint64, bool) {
+	if start, ok := info.FunctionStart(addr); ok {
+		return start, true
+	}
+	for _, seg := range info.Segments {
+		if addr >= seg.VAddr && addr+4 <= seg.VAddr+uint64(len(seg.Data)) {
+			if start := prologueStart(seg.Data, int(addr-seg.VAddr)&^3); start >= 0 {
+				return seg.VAddr + uint64(start), true
+			}
+			break
+		}
+	}
+	return 0, false
+}
+
+// prologueStart walks back from code[off] to the prologue of the function
+// around it: the STP X29, X30 that builds the frame, moved back over a
+// preceding SUB SP and PACIASP or BTI. A RET first means a frameless
+// function that starts after it and any padding. Returns -1 if neither is
+// found.
+func prologueStart(code []byte, off int) int {
+	for i := off; i >= 0 && off-i <= maxFunctionScan; i -= 4 {
+		insn := binary.LittleEndian.Uint32(code[i:])
+		switch {
+		case insn&0xffc07fff == 0xa9807bfd: // STP X29, X30, [SP, #-n]!
+		case insn&0xffc07fff == 0xa9007bfd: // STP X29, X30, [SP, #n]
+			if i < 4 || binary.LittleEndian.Uint32(code[i-4:])&0xff8003ff != 0xd10003ff { // SUB SP, SP, #n
+				continue
+			}
+			i -= 4
+		case insn == 0xd65f03c0: // RET
+			for i += 4; i < off; i += 4 {
+				if next := binary.LittleEndian.Uint32(code[i:]); next != 0 && next != 0xd503201f { // NOP
+					break
+				}
+			}
+			return i
+		default:
+			continue
+		}
+		if i >= 4 {
+			switch binary.LittleEndian.Uint32(code[i-4:]) {
+			case 0xd503233f, 0xd503245f, 0xd503249f, 0xd50324df: // PACIASP, BTI c/j/jc
+				i -= 4
+			}
+		}
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,210 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// CryptoConstant is a known cryptographic constant found in a binary.
+type CryptoConstant struct {
+	Algorithm string   // "xxtea", "aes", "md5", "sha1", "sha256", "sha512", "chacha", "rc4"
+	Name      string   // Which constant, e.g. "delta", "sbox", "K"
+	Addr      uint64   // Table address, or the instruction that uses it
+	Size      uint64   // Table size; 0 for code
+	Code      bool     // An immediate or loop shape rather than a table
+	Funcs     []uint64 // Starts of the functions that use it
+}
+
+// cryptoTable is a constant table identified by its opening bytes.
+type cryptoTable struct {
+	algorithm, name string
+	prefix          []byte
+	size            uint64
+	align           uint64
+}
+
+func u32s(vals ...uint32) []byte {
+	b := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+func u64s(vals ...uint64) []byte {
+	b := make([]byte, 8*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint64(b[8*i:], v)
+	}
+	return b
+}
+
+// cryptoTables are checked in order; a later table starting where an
+// earlier one matched is skipped, so SHA-1's five-word IV wins over the
+// four words it shares with MD5.
+var cryptoTables = []cryptoTable{
+	{"aes", "sbox", []byte{0x63, 0x7c, 0x77, 0x7b, 0xf2, 0x6b, 0x6f, 0xc5, 0x30, 0x01, 0x67, 0x2b, 0xfe, 0xd7, 0xab, 0x76}, 256, 1},
+	{"aes", "inverse sbox", []byte{0x52, 0x09, 0x6a, 0xd5, 0x30, 0x36, 0xa5, 0x38, 0xbf, 0x40, 0xa3, 0x9e, 0x81, 0xf3, 0xd7, 0xfb}, 256, 1},
+	{"aes", "Te0", u32s(0xc66363a5, 0xf87c7c84, 0xee777799, 0xf67b7b8d), 1024, 4},
+	{"aes", "Td0", u32s(0x51f4a750, 0x7e416553, 0x1a17a4c3, 0x3a275e96), 1024, 4},
+	{"aes", "rcon", u32s(0x01000000, 0x02000000, 0x04000000, 0x08000000, 0x10000000), 40, 4},
+	{"md5", "T", u32s(0xd76aa478, 0xe8c7b756, 0x242070db, 0xc1bdceee), 256, 4},
+	{"sha1", "IV", u32s(0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476, 0xc3d2e1f0), 20, 4},
+	{"md5", "IV", u32s(0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476), 16, 4},
+	{"sha1", "K", u32s(0x5a827999, 0x6ed9eba1, 0x8f1bbcdc, 0xca62c1d6), 16, 4},
+	{"sha256", "K", u32s(0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5), 256, 4},
+	{"sha256", "IV", u32s(0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a), 32, 4},
+	{"sha512", "K", u64s(0x428a2f98d728ae22, 0x7137449123ef65cd), 640, 8},
+	{"sha512", "IV", u64s(0x6a09e667f3bcc908, 0xbb67ae8584caa73b), 64, 8},
+	{"chacha", "sigma", []byte("expand 32-byte k"), 16, 1},
+	{"chacha", "tau", []byte("expand 16-byte k"), 16, 1},
+	{"xxtea", "delta", u32s(0x9e3779b9), 4, 4},
+}
+
+// CryptoImmediate names a 32-bit constant that crypto code builds in a
+// register.
+type CryptoImmediate struct {
+	Algorithm, Name string
+}
+
+// CryptoImmediates are the 32-bit constants recognized when code builds
+// them with MOV and MOVK or loads them from a literal pool.
+var CryptoImmediates = map[uint32]CryptoImmediate{
+	0x9e3779b9: {"xxtea", "delta"},
+	0x61c88647: {"xxtea", "-delta"}, // sum -= 0x61c88647
+	0xd76aa478: {"md5", "T[0]"},
+	0xc3d2e1f0: {"sha1", "IV[4]"},
+	0x5a827999: {"sha1", "K[0]"},
+	0x6ed9eba1: {"sha1", "K[1]"},
+	0x8f1bbcdc: {"sha1", "K[2]"},
+	0xca62c1d6: {"sha1", "K[3]"},
+	0x6a09e667: {"sha256", "IV[0]"},
+	0x428a2f98: {"sha256", "K[0]"},
+}
+
+// CryptoConstants scans a binary for cryptographic tables in any segment,
+// constants built in code, and RC4 key schedule loops, and finds the
+// functions that use each.
+func CryptoConstants(info *emulator.ELFInfo) []CryptoConstant {
+	var found []CryptoConstant
+	taken := make(map[uint64]bool)
+	for _, t := range cryptoTables {
+		for _, seg := range info.Segments {
+			for off := 0; ; {
+				i := bytes.Index(seg.Data[off:], t.prefix)
+				if i < 0 {
+					break
+				}
+				addr := seg.VAddr + uint64(off+i)
+				off += i + 1
+				if addr%t.align != 0 || taken[addr] {
+					continue
+				}
+				taken[addr] = true
+				found = append(found, CryptoConstant{Algorithm: t.algorithm, Name: t.name, Addr: addr, Size: t.size})
+			}
+		}
+	}
+	found = append(found, codeConstants(info)...)
+
+	// Tables are referenced by ADR or ADRP+ADD, single words also by LDR
+	tables := make([]*CryptoConstant, 0, len(found))
+	for i := range found {
+		if !found[i].Code {
+			tables = append(tables, &found[i])
+		}
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Addr < tables[j].Addr })
+	for _, seg := range info.Segments {
+		if !seg.IsExecutable() || len(tables) == 0 {
+			continue
+		}
+		for off := 0; off+4 <= len(seg.Data); off += 4 {
+			pc := seg.VAddr + uint64(off)
+			target, ok := emulator.LoadedAddress(seg.Data, off, pc)
+			if insn := binary.LittleEndian.Uint32(seg.Data[off:]); insn&0xbf000000 == 0x18000000 { // LDR Rt, literal
+				target, ok = pc+uint64(int64(int32(insn<<8))>>11&^3), true
+			}
+			if !ok {
+				continue
+			}
+			i := sort.Search(len(tables), func(i int) bool { return tables[i].Addr > target }) - 1
+			if i < 0 || target >= tables[i].Addr+tables[i].Size {
+				continue
+			}
+			if start, ok := info.ContainingFunction(pc); ok {
+				tables[i].Funcs = appendUnique(tables[i].Funcs, start)
+			}
+		}
+	}
+	return found
+}
+
+// codeConstants finds crypto immediates built by MOV and MOVK and RC4 key
+// schedule loops, reporting each once per function.
+func codeConstants(info *emulator.ELFInfo) []CryptoConstant {
+	var found []CryptoConstant
+	seen := make(map[CryptoImmediate]map[uint64]bool)
+	add := func(alg, name string, pc uint64) {
+		k := CryptoImmediate{alg, name}
+		start, ok := info.ContainingFunction(pc)
+		if !ok {
+			start = pc
+		}
+		if seen[k] == nil {
+			seen[k] = make(map[uint64]bool)
+		}
+		if seen[k][start] {
+			return
+		}
+		seen[k][start] = true
+		found = append(found, CryptoConstant{Algorithm: alg, Name: name, Addr: pc, Code: true, Funcs: []uint64{start}})
+	}
+
+	for _, seg := range info.Segments {
+		if !seg.IsExecutable() {
+			continue
+		}
+		code := seg.Data
+		word := func(i int) uint32 { return binary.LittleEndian.Uint32(code[i:]) }
+		for off := 0; off+4 <= len(code); off += 4 {
+			insn := word(off)
+			pc := seg.VAddr + uint64(off)
+			switch {
+			case insn&0x7fe00000 == 0x52800000: // MOVZ Rd, #imm16
+				rd := insn & 0x1f
+				for i := off + 4; i < off+20 && i+4 <= len(code); i += 4 {
+					next := word(i)
+					if next&0x7fe0001f == 0x72a00000|rd { // MOVK Rd, #imm16, LSL #16
+						v := next>>5&0xffff<<16 | insn>>5&0xffff
+						if c, ok := CryptoImmediates[v]; ok {
+							add(c.Algorithm, c.Name, pc)
+						}
+						break
+					}
+				}
+			case insn&0xffe00c00 == 0x38200800 && insn&0x1f == insn>>16&0x1f: // STRB Wi, [Xn, Xi]
+				// S[i] = i next to a compare with 256: the RC4 key schedule
+				for i := max(off-24, 0); i < off+24 && i+4 <= len(code); i += 4 {
+					if c := word(i) & 0x7ffffc1f; c == 0x7104001f || c == 0x7103fc1f { // CMP Rn, #0x100 / #0xff
+						add("rc4", "KSA", pc)
+						break
+					}
+				}
+			}
+		}
+	}
+	return found
+}
+
+func appendUnique(s []uint64, v uint64) []uint64 {
+	for _, x := range s {
+		if x == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
@@ -0,0 +1,70 @@
+package fingerprint
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+func TestCryptoConstants(t *testing.T) {
+	const (
+		text uint64 = 0x400000
+		data uint64 = 0x500000
+		sbox        = data + 0x100
+	)
+	var code []byte
+	emit := func(insns ...uint32) uint64 {
+		start := text + uint64(len(code))
+		for _, insn := range insns {
+			code = binary.LittleEndian.AppendUint32(code, insn)
+		}
+		return start
+	}
+	const (
+		prologue = 0xa9bf7bfd // STP X29, X30, [SP, #-16]!
+		frame    = 0x910003fd // MOV X29, SP
+		epilogue = 0xa8c17bfd // LDP X29, X30, [SP], #16
+		ret      = 0xd65f03c0
+	)
+	pageDelta := uint32(sbox>>12 - text>>12)
+	usesSbox := emit(prologue, frame,
+		0x90000008|(pageDelta&3)<<29|(pageDelta>>2)<<5, // ADRP X8, sbox
+		0x91000108|uint32(sbox&0xfff)<<10,              // ADD X8, X8, #:lo12:sbox
+		epilogue, ret)
+	usesDelta := emit(prologue, frame,
+		0x528f3729, // MOV W9, #0x79b9
+		0x72b3c6e9, // MOVK W9, #0x9e37, LSL #16
+		epilogue, ret)
+	ksa := emit(prologue, frame,
+		0x52800008, // MOV W8, #0
+		0x38286808, // STRB W8, [X0, X8]
+		0x91000508, // ADD X8, X8, #1
+		0xf104011f, // CMP X8, #0x100
+		0x54ffffa1, // B.NE -12
+		epilogue, ret)
+
+	rodata := make([]byte, 0x300)
+	copy(rodata[0x100:], cryptoTables[0].prefix)
+	copy(rodata[0x200:], u32s(0x67452301, 0xefcdab89, 0x98badcfe, 0x10325476, 0xc3d2e1f0))
+
+	info := &emulator.ELFInfo{
+		Symbols: map[string]uint64{},
+		Segments: []emulator.Segment{
+			{VAddr: text, Data: code, Flags: elf.PF_R | elf.PF_X},
+			{VAddr: data, Data: rodata, Flags: elf.PF_R},
+		},
+	}
+	got := CryptoConstants(info)
+	want := []CryptoConstant{
+		{Algorithm: "aes", Name: "sbox", Addr: sbox, Size: 256, Funcs: []uint64{usesSbox}},
+		{Algorithm: "sha1", Name: "IV", Addr: data + 0x200, Size: 20},
+		{Algorithm: "xxtea", Name: "delta", Addr: usesDelta + 8, Code: true, Funcs: []uint64{usesDelta}},
+		{Algorithm: "rc4", Name: "KSA", Addr: ksa + 12, Code: true, Funcs: []uint64{ksa}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CryptoConstants =\n%+v\nwant\n%+v", got, want)
+	}
+}
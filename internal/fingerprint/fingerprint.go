@@ -0,0 +1,320 @@
+// Package fingerprint identifies the engine, C++ runtime, and protections of
+// a loaded ARM64 ELF binary from its symbols, imports, and embedded strings.
+package fingerprint
+
+import (
+	"debug/elf"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// Engine identifies a game engine or framework.
+type Engine struct {
+	Name    string // "cocos2d-x", "cocos creator", "unity il2cpp", "unreal", "godot", "libgdx", "custom"
+	Version string // Engine version if known
+	Script  string // Scripting layer if known ("lua", "js")
+}
+
+// String formats the engine as "<name> [version] [script]", e.g. "cocos2d-x 3.17 lua".
+func (e Engine) String() string {
+	parts := []string{e.Name}
+	if e.Version != "" {
+		parts = append(parts, e.Version)
+	}
+	if e.Script != "" {
+		parts = append(parts, e.Script)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Report is the static fingerprint of a binary.
+type Report struct {
+	Engine      Engine
+	Runtime     string   // "libc++", "libstdc++", or "unknown"
+	RuntimeLib  string   // Shared runtime library, or "static"
+	Stripped    bool     // No .symtab
+	Protections []string // Packers, anti-debug, and anti-hook indicators
+}
+
+// Analyze fingerprints a loaded binary.
+func Analyze(info *emulator.ELFInfo) Report {
+	runtime, lib := Runtime(info)
+	return Report{
+		Engine:      DetectEngine(info),
+		Runtime:     runtime,
+		RuntimeLib:  lib,
+		Stripped:    info.Stripped,
+		Protections: Protections(info),
+	}
+}
+
+// DetectEngine returns the first engine that matches, or "custom".
+func DetectEngine(info *emulator.ELFInfo) Engine {
+	for _, detect := range []func(*emulator.ELFInfo) (Engine, bool){
+		Unreal, Unity, Godot, Cocos, LibGDX,
+	} {
+		if e, ok := detect(info); ok {
+			return e
+		}
+	}
+	return Engine{Name: "custom"}
+}
+
+// Cocos identifies Cocos2d-x and Cocos Creator. Cocos2d-x embeds
+// "cocos2d-x-<version>" for cocos2dVersion(); Cocos Creator 3.x uses the
+// cc:: namespace.
+func Cocos(info *emulator.ELFInfo) (Engine, bool) {
+	versions := info.FindStrings("cocos2d-x-", 4)
+	if len(versions) == 0 && !hasSymbol(info, "cocos2d", "_ZN2cc") {
+		return Engine{}, false
+	}
+
+	e := Engine{Name: "cocos2d-x"}
+	for _, s := range versions {
+		if v := versionAfter(s, "cocos2d-x-"); v != "" {
+			e.Version = v
+			break
+		}
+	}
+	if len(info.FindStrings("Cocos Creator", 1)) > 0 {
+		e.Name = "cocos creator"
+	}
+	if e.Version == "" && hasSymbol(info, "_ZN2cc") {
+		e.Name = "cocos creator"
+		e.Version = "3.x"
+	}
+
+	switch {
+	case hasSymbol(info, "LuaEngine", "LuaStack", "luaL_"):
+		e.Script = "lua"
+	case hasSymbol(info, "ScriptingCore", "_ZN2se12ScriptEngine", "jsb_"):
+		e.Script = "js"
+	}
+	return e, true
+}
+
+// unityVersion matches Unity release strings such as "2020.3.48f1".
+var unityVersion = regexp.MustCompile(`^(19|20)\d\d\.\d+\.\d+[abfp]\d+$`)
+
+// Unity identifies Unity IL2CPP and Mono builds. libil2cpp.so rarely embeds
+// the Unity version, so it is only reported when a release string is present.
+func Unity(info *emulator.ELFInfo) (Engine, bool) {
+	var e Engine
+	switch {
+	case hasSymbol(info, "il2cpp_init"):
+		e.Name = "unity il2cpp"
+	case hasSymbol(info, "mono_jit_init"):
+		e.Name = "unity mono"
+	default:
+		return Engine{}, false
+	}
+	if v := info.FindStringsFunc(8, unityVersion.MatchString, 1); len(v) > 0 {
+		e.Version = v[0]
+	}
+	return e, true
+}
+
+// Unreal identifies Unreal Engine from its "++UE4+Release-4.27" build string
+// or core engine symbols.
+func Unreal(info *emulator.ELFInfo) (Engine, bool) {
+	for _, major := range []string{"UE5", "UE4"} {
+		prefix := "++" + major + "+Release-"
+		for _, s := range info.FindStrings(prefix, 4) {
+			if v := versionAfter(s, prefix); v != "" {
+				return Engine{Name: "unreal", Version: v}, true
+			}
+		}
+	}
+	if hasSymbol(info, "FCoreDelegates", "FEngineLoop") {
+		return Engine{Name: "unreal"}, true
+	}
+	return Engine{}, false
+}
+
+// Godot identifies Godot from its "Godot Engine v3.5.1.stable" version string.
+func Godot(info *emulator.ELFInfo) (Engine, bool) {
+	strs := info.FindStrings("Godot Engine", 8)
+	if len(strs) == 0 && !hasSymbol(info, "godot_") {
+		return Engine{}, false
+	}
+	e := Engine{Name: "godot"}
+	for _, s := range strs {
+		if v := versionAfter(s, "Godot Engine v"); v != "" {
+			e.Version = v
+			break
+		}
+	}
+	return e, true
+}
+
+// LibGDX identifies libgdx.so by its JNI exports.
+func LibGDX(info *emulator.ELFInfo) (Engine, bool) {
+	if hasSymbol(info, "Java_com_badlogic_gdx") {
+		return Engine{Name: "libgdx"}, true
+	}
+	return Engine{}, false
+}
+
+// Runtime reports the C++ standard library and how it is linked.
+// libc++ places everything in the std::__ndk1 inline namespace; libstdc++
+// uses std::__cxx11 or the COW std::string (Ss).
+func Runtime(info *emulator.ELFInfo) (string, string) {
+	for _, lib := range info.Needed {
+		switch {
+		case strings.HasPrefix(lib, "libc++"):
+			return "libc++", lib
+		case strings.HasPrefix(lib, "libgnustl"), strings.HasPrefix(lib, "libstdc++") && hasSymbol(info, "_ZNSs", "_ZNKSs", "__cxx11"):
+			return "libstdc++", lib
+		}
+	}
+	switch {
+	case hasSymbol(info, "__ndk1"):
+		return "libc++", "static"
+	case hasSymbol(info, "_ZNSs", "_ZNKSs", "__cxx11"):
+		return "libstdc++", "static"
+	}
+	return "unknown", ""
+}
+
+// packerMarkers maps library names and strings to the packers that embed them.
+var packerMarkers = []struct {
+	marker string
+	name   string
+}{
+	{"UPX!", "UPX"},
+	{"libjiagu", "360 Jiagu"},
+	{"libshella", "Tencent Legu"},
+	{"libshellx", "Tencent Legu"},
+	{"libsecexe", "Bangcle"},
+	{"libDexHelper", "SecNeo"},
+	{"ijiami", "ijiami"},
+	{"libnesec", "NetEase"},
+	{"libexecmain", "ijiami"},
+}
+
+// antiDebugImports are imports used to detect or block debuggers.
+var antiDebugImports = []string{"ptrace", "inotify_add_watch"}
+
+// antiDebugStrings are strings used by debugger, Frida, and hook detection.
+var antiDebugStrings = []struct {
+	marker string
+	name   string
+}{
+	{"TracerPid", "anti-debug: TracerPid check"},
+	{"gdbserver", "anti-debug: gdbserver check"},
+	{"android_server", "anti-debug: IDA server check"},
+	{"frida", "anti-frida"},
+	{"gum-js-loop", "anti-frida"},
+	{"xposed", "anti-hook: Xposed"},
+	{"substrate", "anti-hook: Substrate"},
+}
+
+// highEntropy is the bits/byte above which code is considered packed or encrypted.
+// Normal ARM64 code sits around 5.5-6.5.
+const highEntropy = 7.5
+
+// Protections lists packer, anti-debug, and anti-hook indicators.
+func Protections(info *emulator.ELFInfo) []string {
+	var result []string
+	seen := make(map[string]bool)
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+
+	if f, err := elf.Open(info.Path); err == nil {
+		if len(f.Sections) == 0 || (len(f.Sections) == 1 && f.Sections[0].Type == elf.SHT_NULL) {
+			add("packed: no section headers")
+		}
+		f.Close()
+	}
+
+	for _, seg := range info.Segments {
+		if seg.IsExecutable() && len(seg.Data) >= 4096 {
+			if h := Entropy(seg.Data); h > highEntropy {
+				add(fmt.Sprintf("packed: high-entropy code at 0x%x (%.2f bits/byte)", seg.VAddr, h))
+			}
+		}
+	}
+
+	for _, p := range packerMarkers {
+		for _, lib := range info.Needed {
+			if strings.Contains(lib, p.marker) {
+				add("packer: " + p.name)
+			}
+		}
+		if len(info.FindStrings(p.marker, 1)) > 0 {
+			add("packer: " + p.name)
+		}
+	}
+
+	for _, name := range antiDebugImports {
+		if _, ok := info.Imports[name]; ok {
+			add("anti-debug: " + name + " import")
+		}
+	}
+	for _, s := range antiDebugStrings {
+		if len(info.FindStrings(s.marker, 1)) > 0 {
+			add(s.name)
+		}
+	}
+	return result
+}
+
+// Entropy returns the Shannon entropy of data in bits per byte.
+func Entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	h := 0.0
+	n := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// versionAfter extracts a dotted version number following prefix in s.
+// For example, versionAfter("cocos2d-x-3.17.2", "cocos2d-x-") returns "3.17.2".
+func versionAfter(s, prefix string) string {
+	idx := strings.Index(s, prefix)
+	if idx < 0 {
+		return ""
+	}
+	rest := s[idx+len(prefix):]
+	end := 0
+	for end < len(rest) && (rest[end] == '.' || (rest[end] >= '0' && rest[end] <= '9')) {
+		end++
+	}
+	version := strings.Trim(rest[:end], ".")
+	if version == "" || version[0] < '0' || version[0] > '9' {
+		return ""
+	}
+	return version
+}
+
+// hasSymbol reports whether any symbol contains one of the substrings.
+func hasSymbol(info *emulator.ELFInfo, substrs ...string) bool {
+	for name := range info.Symbols {
+		for _, sub := range substrs {
+			if strings.Contains(name, sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package fingerprint
+
+import (
+	"debug/elf"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// testInfo returns a binary with the given symbols and NUL-terminated
+// strings in one read-only segment.
+func testInfo(symbols, strs []string) *emulator.ELFInfo {
+	info := &emulator.ELFInfo{
+		Symbols: make(map[string]uint64),
+		Imports: make(map[string]uint64),
+		Segments: []emulator.Segment{{
+			VAddr: 0x1000,
+			Flags: elf.PF_R,
+			Data:  []byte("\x00" + strings.Join(strs, "\x00") + "\x00"),
+		}},
+	}
+	for i, name := range symbols {
+		info.Symbols[name] = 0x2000 + uint64(i)*0x10
+	}
+	return info
+}
+
+func TestDetectEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		symbols []string
+		strs    []string
+		want    string
+	}{
+		{"cocos2d-x", []string{"_ZN7cocos2d8Director11getInstanceEv", "_ZN7cocos2d9LuaEngine11getInstanceEv"}, []string{"cocos2d-x-3.17.2"}, "cocos2d-x 3.17.2 lua"},
+		{"cocos creator 2", []string{"_ZN7cocos2d8Director11getInstanceEv", "jsb_register_all"}, []string{"cocos2d-x-2.4.3", "Cocos Creator"}, "cocos creator 2.4.3 js"},
+		{"cocos creator 3", []string{"_ZN2cc6engine6EngineC1Ev", "_ZN2se12ScriptEngine11getInstanceEv"}, nil, "cocos creator 3.x js"},
+		{"unity il2cpp", []string{"il2cpp_init"}, []string{"2020.3.48f1"}, "unity il2cpp 2020.3.48f1"},
+		{"unity mono", []string{"mono_jit_init"}, nil, "unity mono"},
+		{"unreal string", nil, []string{"++UE4+Release-4.27"}, "unreal 4.27"},
+		{"unreal symbols", []string{"_ZN14FCoreDelegates27GetPakEncryptionKeyDelegateEv"}, nil, "unreal"},
+		{"godot", nil, []string{"Godot Engine v3.5.1.stable"}, "godot 3.5.1"},
+		{"libgdx", []string{"Java_com_badlogic_gdx_utils_BufferUtils_copyJni"}, nil, "libgdx"},
+		{"custom", []string{"main"}, []string{"hello"}, "custom"},
+	}
+	for _, tt := range tests {
+		if got := DetectEngine(testInfo(tt.symbols, tt.strs)).String(); got != tt.want {
+			t.Errorf("%s: DetectEngine = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		needed  []string
+		symbols []string
+		runtime string
+		lib     string
+	}{
+		{"libc++ shared", []string{"libc.so", "libc++_shared.so"}, nil, "libc++", "libc++_shared.so"},
+		{"gnustl shared", []string{"libgnustl_shared.so"}, nil, "libstdc++", "libgnustl_shared.so"},
+		{"libstdc++ COW", []string{"libstdc++.so"}, []string{"_ZNSsC1EPKcRKSaIcE"}, "libstdc++", "libstdc++.so"},
+		{"libstdc++ cxx11", []string{"libstdc++.so"}, []string{"_ZNKSt7__cxx1112basic_stringIcSt11char_traitsIcESaIcEE4sizeEv"}, "libstdc++", "libstdc++.so"},
+		// The system libstdc++ is only new/delete: without its std::string
+		// symbols a static libc++ wins
+		{"system libstdc++", []string{"libstdc++.so"}, []string{"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEED2Ev"}, "libc++", "static"},
+		{"static libc++", nil, []string{"_ZNSt6__ndk16vectorIhNS_9allocatorIhEEED2Ev"}, "libc++", "static"},
+		{"static libstdc++", nil, []string{"_ZNSs4_Rep10_M_destroyERKSaIcE"}, "libstdc++", "static"},
+		{"none", []string{"libc.so"}, []string{"main"}, "unknown", ""},
+	}
+	for _, tt := range tests {
+		info := testInfo(tt.symbols, nil)
+		info.Needed = tt.needed
+		if runtime, lib := Runtime(info); runtime != tt.runtime || lib != tt.lib {
+			t.Errorf("%s: Runtime = %q, %q; want %q, %q", tt.name, runtime, lib, tt.runtime, tt.lib)
+		}
+	}
+}
+
+func TestProtections(t *testing.T) {
+	code := make([]byte, 4096)
+	for i := range code {
+		code[i] = byte(i) // 8 bits/byte
+	}
+	info := testInfo(nil, []string{"/proc/self/status TracerPid:", "frida-agent"})
+	info.Segments = append(info.Segments, emulator.Segment{VAddr: 0x10000, Flags: elf.PF_R | elf.PF_X, Data: code})
+	info.Needed = []string{"libc.so", "libjiagu.so"}
+	info.Imports["ptrace"] = 0x3000
+
+	want := []string{
+		"packed: high-entropy code at 0x10000 (8.00 bits/byte)",
+		"packer: 360 Jiagu",
+		"anti-debug: ptrace import",
+		"anti-debug: TracerPid check",
+		"anti-frida",
+	}
+	if got := Protections(info); !reflect.DeepEqual(got, want) {
+		t.Errorf("Protections = %q, want %q", got, want)
+	}
+	if got := Protections(testInfo([]string{"main"}, []string{"hello"})); len(got) != 0 {
+		t.Errorf("Protections of a plain binary = %q", got)
+	}
+}
+
+func TestVersionAfter(t *testing.T) {
+	tests := []struct {
+		s, prefix, want string
+	}{
+		{"cocos2d-x-3.17.2", "cocos2d-x-", "3.17.2"},
+		{"Godot Engine v3.5.1.stable", "Godot Engine v", "3.5.1"},
+		{"++UE4+Release-4.27-CL-0", "++UE4+Release-", "4.27"},
+		{"cocos2d-x-.x", "cocos2d-x-", ""},
+		{"no version here", "cocos2d-x-", ""},
+	}
+	for _, tt := range tests {
+		if got := versionAfter(tt.s, tt.prefix); got != tt.want {
+			t.Errorf("versionAfter(%q, %q) = %q, want %q", tt.s, tt.prefix, got, tt.want)
+		}
+	}
+}
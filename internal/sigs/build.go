@@ -0,0 +1,147 @@
+package sigs
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// minSigInsns is the shortest function a signature is built for.
+	minSigInsns = 6
+	// maxSigInsns caps how many opening instructions a signature covers.
+	maxSigInsns = 32
+	// minFixedInsns is how many instructions must survive wildcarding
+	// for a signature to be specific enough.
+	minFixedInsns = 4
+)
+
+// Build makes signatures from the function symbols of an unstripped
+// ARM64 binary, for names keep accepts (nil accepts all). Functions too
+// short to identify or whose pattern also matches elsewhere in the binary
+// are skipped.
+func Build(path string, keep func(name string) bool) ([]Signature, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open ELF: %w", err)
+	}
+	defer f.Close()
+	if f.Machine != elf.EM_AARCH64 {
+		return nil, fmt.Errorf("expected ARM64 (EM_AARCH64), got %v", f.Machine)
+	}
+
+	var code []region
+	sections := make(map[elf.SectionIndex][]byte)
+	for i, s := range f.Sections {
+		if s.Type != elf.SHT_PROGBITS || s.Flags&elf.SHF_EXECINSTR == 0 {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", s.Name, err)
+		}
+		sections[elf.SectionIndex(i)] = data
+		code = append(code, region{addr: s.Addr, data: data})
+	}
+
+	symtab, _ := f.Symbols()
+	dynsym, _ := f.DynamicSymbols()
+	seen := make(map[string]bool)
+	var funcs []function
+	for _, sym := range append(symtab, dynsym...) {
+		name, _, _ := strings.Cut(sym.Name, "@")
+		if elf.ST_TYPE(sym.Info) != elf.STT_FUNC || name == "" || seen[name] ||
+			(keep != nil && !keep(name)) {
+			continue
+		}
+		data, ok := sections[sym.Section]
+		if !ok {
+			continue
+		}
+		s := f.Sections[sym.Section]
+		off := sym.Value - s.Addr
+		if sym.Value < s.Addr || off+sym.Size > uint64(len(data)) {
+			continue
+		}
+		seen[name] = true
+		funcs = append(funcs, function{name: name, code: data[off : off+sym.Size]})
+	}
+	return build(funcs, code), nil
+}
+
+// function is a named function's code.
+type function struct {
+	name string
+	code []byte
+}
+
+// build makes the signatures of funcs that match once in code.
+func build(funcs []function, code []region) []Signature {
+	var pats []*pattern
+	for _, fn := range funcs {
+		if len(fn.code) < 4*minSigInsns {
+			continue
+		}
+		if p := functionPattern(fn.name, fn.code[:min(len(fn.code), 4*maxSigInsns)]); p != nil {
+			pats = append(pats, p)
+		}
+	}
+
+	hits := scan(pats, code)
+	var sigs []Signature
+	for i, p := range pats {
+		if len(hits[i]) == 1 {
+			sigs = append(sigs, Signature{Name: p.name, Pattern: format(p.value, p.mask)})
+		}
+	}
+	sort.Slice(sigs, func(i, j int) bool { return sigs[i].Name < sigs[j].Name })
+	return sigs
+}
+
+// functionPattern wildcards the position-dependent fields of a function's
+// opening instructions, or returns nil if too few stay fixed.
+func functionPattern(name string, code []byte) *pattern {
+	p := &pattern{name: name, anchor: -1}
+	var pageRegs uint32 // Registers loaded by ADRP
+	fixed := 0
+	for off := 0; off+4 <= len(code); off += 4 {
+		insn := binary.LittleEndian.Uint32(code[off:])
+		mask := relocMask(insn, pageRegs)
+		if insn&0x9f000000 == 0x90000000 { // ADRP
+			pageRegs |= 1 << (insn & 0x1f)
+		}
+		if mask == 0xffffffff {
+			if p.anchor < 0 {
+				p.anchor = len(p.value)
+			}
+			fixed++
+		}
+		p.value = append(p.value, insn&mask)
+		p.mask = append(p.mask, mask)
+	}
+	if fixed < minFixedInsns {
+		return nil
+	}
+	return p
+}
+
+// relocMask returns the bits of an instruction that stay the same when
+// the code and its data are linked at another address.
+func relocMask(insn, pageRegs uint32) uint32 {
+	rn := insn >> 5 & 0x1f
+	switch {
+	case insn&0x7c000000 == 0x14000000: // B, BL
+		return 0xfc000000
+	case insn&0x1f000000 == 0x10000000: // ADR, ADRP
+		return 0x9f00001f
+	case insn&0x3b000000 == 0x18000000: // LDR (literal)
+		return 0xff00001f
+	case insn&0x7f800000 == 0x11000000 && pageRegs&(1<<rn) != 0: // ADD #lo12
+		return 0xffc003ff
+	case insn&0x3b000000 == 0x39000000 && pageRegs&(1<<rn) != 0: // LDR/STR [Xn, #lo12]
+		return 0xffc003ff
+	}
+	return 0xffffffff
+}
@@ -0,0 +1,258 @@
+// Package sigs identifies functions in stripped ARM64 binaries by
+// instruction patterns and names them, so detectors and setter hooks work
+// without a symbol table.
+//
+// A signature is the opening instructions of a function with the fields
+// that change between builds (branch targets, page addresses, literal
+// offsets) wildcarded. It is written as hex in memory order, one group of
+// eight nibbles per instruction, with '?' for a wildcard nibble:
+//
+//	# name  pattern
+//	xxtea_decrypt  fd7bbea9 fd030091 ??????94 ...
+//
+// A signature names a function only when it matches exactly once.
+package sigs
+
+import (
+	"bufio"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// Signature is a named instruction pattern.
+type Signature struct {
+	Name    string
+	Pattern string // Hex nibbles in memory order, '?' for any
+}
+
+// Builtin holds signatures for hand-written assembly, which assembles to
+// the same instructions in every build. Compiled functions differ by
+// compiler and flags, so the engine functions detectors look for
+// (xxtea_decrypt, ResourcesDecode::setXXTeaKey, FileUtils::getInstance,
+// luaL_loadbuffer) are not built in: build them from an unstripped sample
+// of the same engine version with `galago sigs` and pass them with --sigs.
+var Builtin = []Signature{
+	// aesv8-armx.pl .Lenc_key (OpenSSL aes_v8_*, BoringSSL aes_hw_*):
+	// STP X29, X30; MOV X29, SP; MOV X3, #-1; CMP X0, #0; B.EQ abort;
+	// CMP X2, #0; B.EQ abort; MOV X3, #-2; CMP W1, #128; B.LT abort;
+	// CMP W1, #256; B.GT abort; TST W1, #0x3f; B.NE abort
+	{Name: "aes_hw_set_encrypt_key", Pattern: "fd7bbfa9 fd030091 03008092 1f0000f1 ?0????54 5f0000f1 ?0????54 23008092 " +
+		"3f000271 ?b????54 3f000471 ?c????54 3f140072 ?1????54"},
+	// STP X29, X30; MOV X29, SP; BL .Lenc_key; CMP X0, #0; B.NE abort;
+	// SUB X2, X2, #240; MOV X4, #-16; ADD X0, X2, X12, LSL #4
+	{Name: "aes_hw_set_decrypt_key", Pattern: "fd7bbfa9 fd030091 ??????9? 1f0000f1 ?1????54 42c003d1 e4018092 40100c8b"},
+}
+
+// Load reads a signature file: one signature per line, the name followed
+// by the pattern. Blank lines and lines starting with '#' are skipped.
+func Load(path string) ([]Signature, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sigs, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return sigs, nil
+}
+
+// Parse reads signatures in the Load format.
+func Parse(r io.Reader) ([]Signature, error) {
+	var sigs []Signature
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: want name and pattern", n)
+		}
+		sig := Signature{Name: fields[0], Pattern: strings.Join(fields[1:], " ")}
+		if _, err := compile(sig); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, sc.Err()
+}
+
+// Write writes signatures in the Load format.
+func Write(w io.Writer, sigs []Signature) error {
+	bw := bufio.NewWriter(w)
+	for _, sig := range sigs {
+		fmt.Fprintf(bw, "%s  %s\n", sig.Name, sig.Pattern)
+	}
+	return bw.Flush()
+}
+
+// Match finds the signatures in the executable segments of a binary and
+// returns the functions they name. Names already in info.Symbols and
+// signatures that match more than once are left out. When a name has
+// several signatures, the first that matches wins.
+func Match(info *emulator.ELFInfo, sigs []Signature) (map[string]uint64, error) {
+	var pats []*pattern
+	for _, sig := range sigs {
+		if _, named := info.Symbols[sig.Name]; named {
+			continue
+		}
+		p, err := compile(sig)
+		if err != nil {
+			return nil, fmt.Errorf("signature %s: %w", sig.Name, err)
+		}
+		pats = append(pats, p)
+	}
+	if len(pats) == 0 {
+		return nil, nil
+	}
+
+	var code []region
+	for _, seg := range info.Segments {
+		if seg.Flags&elf.PF_X != 0 {
+			code = append(code, region{addr: seg.VAddr, data: seg.Data})
+		}
+	}
+	hits := scan(pats, code)
+
+	found := make(map[string]uint64)
+	for i, p := range pats {
+		if _, done := found[p.name]; !done && len(hits[i]) == 1 {
+			found[p.name] = hits[i][0]
+		}
+	}
+	return found, nil
+}
+
+// pattern is a compiled signature: instruction words and the bits of each
+// that must match.
+type pattern struct {
+	name   string
+	value  []uint32
+	mask   []uint32
+	anchor int // Index of the fully fixed word scans look up
+}
+
+func compile(sig Signature) (*pattern, error) {
+	hex := strings.Join(strings.Fields(sig.Pattern), "")
+	if hex == "" || len(hex)%8 != 0 {
+		return nil, fmt.Errorf("pattern is not whole instructions")
+	}
+	p := &pattern{name: sig.Name, anchor: -1}
+	for i := 0; i < len(hex); i += 8 {
+		var b, m [4]byte
+		for j := 0; j < 8; j++ {
+			c := hex[i+j]
+			shift := 4 * (1 - j%2) // High nibble first
+			switch {
+			case c == '?':
+				continue
+			case c >= '0' && c <= '9':
+				b[j/2] |= (c - '0') << shift
+			case c >= 'a' && c <= 'f':
+				b[j/2] |= (c - 'a' + 10) << shift
+			case c >= 'A' && c <= 'F':
+				b[j/2] |= (c - 'A' + 10) << shift
+			default:
+				return nil, fmt.Errorf("bad pattern character %q", c)
+			}
+			m[j/2] |= 0xf << shift
+		}
+		p.value = append(p.value, binary.LittleEndian.Uint32(b[:]))
+		p.mask = append(p.mask, binary.LittleEndian.Uint32(m[:]))
+	}
+	for i, m := range p.mask {
+		if m == 0xffffffff {
+			p.anchor = i
+			break
+		}
+	}
+	if p.anchor < 0 {
+		return nil, fmt.Errorf("pattern has no fixed instruction")
+	}
+	return p, nil
+}
+
+// format renders instruction words and masks as a pattern.
+func format(value, mask []uint32) string {
+	const digits = "0123456789abcdef"
+	var sb strings.Builder
+	for i := range value {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		for j := 0; j < 4; j++ {
+			b, m := byte(value[i]>>(8*j)), byte(mask[i]>>(8*j))
+			for _, shift := range []uint{4, 0} {
+				if m>>shift&0xf == 0xf {
+					sb.WriteByte(digits[b>>shift&0xf])
+				} else {
+					sb.WriteByte('?')
+				}
+			}
+		}
+	}
+	return sb.String()
+}
+
+// region is a block of code at an address.
+type region struct {
+	addr uint64
+	data []byte
+}
+
+// scan returns the addresses where each pattern matches. Each pattern is
+// looked up by its rarest fixed instruction, so common prologues do not
+// make every function a candidate.
+func scan(pats []*pattern, code []region) [][]uint64 {
+	freq := make(map[uint32]int)
+	for _, r := range code {
+		for off := 0; off+4 <= len(r.data); off += 4 {
+			freq[binary.LittleEndian.Uint32(r.data[off:])]++
+		}
+	}
+	byWord := make(map[uint32][]int)
+	for i, p := range pats {
+		for j, m := range p.mask {
+			if m == 0xffffffff && freq[p.value[j]] < freq[p.value[p.anchor]] {
+				p.anchor = j
+			}
+		}
+		if freq[p.value[p.anchor]] > 0 {
+			byWord[p.value[p.anchor]] = append(byWord[p.value[p.anchor]], i)
+		}
+	}
+
+	hits := make([][]uint64, len(pats))
+	for _, r := range code {
+		n := len(r.data) / 4
+		for w := 0; w < n; w++ {
+			for _, i := range byWord[binary.LittleEndian.Uint32(r.data[4*w:])] {
+				p := pats[i]
+				start := w - p.anchor
+				if start >= 0 && start+len(p.value) <= n && p.matchAt(r.data[4*start:]) {
+					hits[i] = append(hits[i], r.addr+uint64(4*start))
+				}
+			}
+		}
+	}
+	return hits
+}
+
+func (p *pattern) matchAt(data []byte) bool {
+	for i, v := range p.value {
+		if binary.LittleEndian.Uint32(data[4*i:])&p.mask[i] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,220 @@
+package sigs
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+func words(insns ...uint32) []byte {
+	var b []byte
+	for _, insn := range insns {
+		b = binary.LittleEndian.AppendUint32(b, insn)
+	}
+	return b
+}
+
+// decrypt returns a function body that loads a global through ADRP+LDR
+// and calls out with BL; page, lo12, and call vary with the link address.
+func decrypt(page, lo12, call uint32) []byte {
+	return words(
+		0xa9be7bfd,                           // STP X29, X30, [SP, #-32]!
+		0x910003fd,                           // MOV X29, SP
+		0x90000008|(page&3)<<29|(page>>2)<<5, // ADRP X8, page
+		0xf9400108|(lo12/8)<<10,              // LDR X8, [X8, #lo12]
+		0x528f3729,                           // MOV W9, #0x79b9
+		0x72b3c6e9,                           // MOVK W9, #0x9e37, LSL #16
+		0x94000000|call,                      // BL call
+		0x1b097c00,                           // MUL W0, W0, W9
+		0xa8c27bfd,                           // LDP X29, X30, [SP], #32
+		0xd65f03c0,                           // RET
+	)
+}
+
+func TestBuildAndMatch(t *testing.T) {
+	filler := words(0xd503201f, 0xd503201f) // NOP; NOP
+	generic := words(0xa9bf7bfd, 0x910003fd, 0x94000010, 0xa8c17bfd, 0xd65f03c0, 0xd503201f)
+
+	fn := decrypt(0x12, 0x40, 0x100)
+	var sample []byte
+	for _, b := range [][]byte{filler, fn, generic, filler, generic} {
+		sample = append(sample, b...)
+	}
+	sigs := build([]function{
+		{name: "xxtea_decrypt", code: fn},
+		{name: "helper", code: generic}, // Appears twice
+		{name: "tiny", code: filler},    // Too short
+	}, []region{{addr: 0x1000, data: sample}})
+	if len(sigs) != 1 || sigs[0].Name != "xxtea_decrypt" {
+		t.Fatalf("build = %+v, want xxtea_decrypt only", sigs)
+	}
+	if want := "fd7bbea9 fd030091 ?8?????0 08????f9 29378f52 e9c6b372 ??????9? 007c091b fd7bc2a8 c0035fd6"; sigs[0].Pattern != want {
+		t.Errorf("pattern = %s", sigs[0].Pattern)
+	}
+
+	var sb strings.Builder
+	Write(&sb, sigs)
+	parsed, err := Parse(strings.NewReader("# built\n\n" + sb.String()))
+	if err != nil || len(parsed) != 1 || parsed[0] != sigs[0] {
+		t.Fatalf("Parse(Write) = %+v, %v", parsed, err)
+	}
+
+	// The same function linked elsewhere in a stripped binary
+	stripped := append(append([]byte{}, filler...), decrypt(0x7ffff, 0x1f8, 0x3ffff00)...)
+	info := &emulator.ELFInfo{
+		Symbols:  map[string]uint64{},
+		Segments: []emulator.Segment{{VAddr: 0x40000000, Data: stripped, Flags: elf.PF_R | elf.PF_X}},
+	}
+	found, err := Match(info, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found["xxtea_decrypt"] != 0x40000008 || len(found) != 1 {
+		t.Errorf("Match = %#v, want xxtea_decrypt at 0x40000008", found)
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	// aesv8-armx .Lenc_key, as assembled, branching to an abort at +0x110
+	encKey := words(
+		0xa9bf7bfd, 0x910003fd, 0x92800003, 0xf100001f, 0x54000800, 0xf100005f, 0x540007c0,
+		0x92800023, 0x7102003f, 0x5400076b, 0x7104003f, 0x5400072c, 0x7200143f, 0x540006e1,
+	)
+	code := append(words(0xd503245f), encKey...) // BTI c
+	info := &emulator.ELFInfo{
+		Symbols:  map[string]uint64{},
+		Segments: []emulator.Segment{{VAddr: 0x1000, Data: code, Flags: elf.PF_R | elf.PF_X}},
+	}
+	found, err := Match(info, Builtin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found["aes_hw_set_encrypt_key"] != 0x1004 || len(found) != 1 {
+		t.Errorf("Match = %#v", found)
+	}
+
+	// Named functions are not searched for
+	info.Symbols["aes_hw_set_encrypt_key"] = 0x1004
+	if found, _ := Match(info, Builtin); len(found) != 0 {
+		t.Errorf("Match with symbol = %#v", found)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		"name",
+		"name fd7bbfa9 fd03",
+		"name ???????? ????????",
+		"name fd7bbfa9 fd0300zz",
+	} {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("Parse(%q) succeeded", in)
+		}
+	}
+}
+
+// writeELF writes an unstripped ARM64 shared object whose .text at 0x1000
+// holds code, with a function symbol for each entry of funcs.
+func writeELF(t *testing.T, code []byte, funcs map[string][2]uint64) string {
+	t.Helper()
+	strtab := []byte{0}
+	syms := []elf.Sym64{{}}
+	for name, f := range funcs {
+		syms = append(syms, elf.Sym64{
+			Name:  uint32(len(strtab)),
+			Info:  elf.ST_INFO(elf.STB_GLOBAL, elf.STT_FUNC),
+			Shndx: 1,
+			Value: 0x1000 + f[0],
+			Size:  f[1],
+		})
+		strtab = append(append(strtab, name...), 0)
+	}
+	var symtab bytes.Buffer
+	binary.Write(&symtab, binary.LittleEndian, syms)
+	shstrtab := []byte("\x00.text\x00.symtab\x00.strtab\x00.shstrtab\x00")
+
+	// Header, then section contents, then section headers
+	off := uint64(64)
+	var body bytes.Buffer
+	place := func(data []byte) uint64 {
+		o := off + uint64(body.Len())
+		body.Write(data)
+		for body.Len()%8 != 0 {
+			body.WriteByte(0)
+		}
+		return o
+	}
+	textOff, symOff, strOff, shstrOff := place(code), place(symtab.Bytes()), place(strtab), place(shstrtab)
+	shdrs := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Flags: uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR), Addr: 0x1000, Off: textOff, Size: uint64(len(code)), Addralign: 4},
+		{Name: 7, Type: uint32(elf.SHT_SYMTAB), Off: symOff, Size: uint64(symtab.Len()), Link: 3, Info: 1, Addralign: 8, Entsize: 24},
+		{Name: 15, Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint64(len(strtab)), Addralign: 1},
+		{Name: 23, Type: uint32(elf.SHT_STRTAB), Off: shstrOff, Size: uint64(len(shstrtab)), Addralign: 1},
+	}
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_DYN),
+		Machine:   uint16(elf.EM_AARCH64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     off + uint64(body.Len()),
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     uint16(len(shdrs)),
+		Shstrndx:  4,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var out bytes.Buffer
+	binary.Write(&out, binary.LittleEndian, hdr)
+	out.Write(body.Bytes())
+	binary.Write(&out, binary.LittleEndian, shdrs)
+	path := filepath.Join(t.TempDir(), "sample.so")
+	if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuildFile(t *testing.T) {
+	// An unstripped sample: xxtea_decrypt, then a helper too short to sign
+	fn := decrypt(0x12, 0x40, 0x100)
+	code := append(append([]byte{}, fn...), words(0xd503201f, 0xd65f03c0)...) // NOP; RET
+	path := writeELF(t, code, map[string][2]uint64{
+		"xxtea_decrypt": {0, uint64(len(fn))},
+		"helper":        {uint64(len(fn)), 8},
+	})
+
+	built, err := Build(path, func(name string) bool { return strings.Contains(name, "xxtea") || name == "helper" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(built) != 1 || built[0].Name != "xxtea_decrypt" {
+		t.Fatalf("Build = %+v, want xxtea_decrypt only", built)
+	}
+
+	// The signature names the function in a stripped build linked elsewhere
+	info := &emulator.ELFInfo{
+		Symbols:  map[string]uint64{},
+		Segments: []emulator.Segment{{VAddr: 0x7000, Data: decrypt(0x3, 0x88, 0x2000), Flags: elf.PF_R | elf.PF_X}},
+	}
+	found, err := Match(info, append(built, Builtin...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found["xxtea_decrypt"] != 0x7000 || len(found) != 1 {
+		t.Errorf("Match = %#v, want xxtea_decrypt at 0x7000", found)
+	}
+
+	if _, err := Build(filepath.Join(t.TempDir(), "missing.so"), nil); err == nil {
+		t.Error("Build of a missing file succeeded")
+	}
+}
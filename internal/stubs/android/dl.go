@@ -64,13 +64,13 @@ func stubDlsym(emu *emulator.Emulator) bool {
 	lib, ok := dlHandles[handle]
 	dlMu.Unlock()
 
-	if !ok && handle != 0 {
-		// Unknown handle
-		dlMu.Lock()
-		dlLastError = "invalid handle"
-		dlMu.Unlock()
-		emu.SetX(0, 0)
-		stubs.ReturnFromStub(emu)
+	// RTLD_DEFAULT (0) and RTLD_NEXT (-1) search every library
+	if !ok && handle != 0 && handle != ^uint64(0) {
+		dlFail(emu, "invalid handle: "+stubs.FormatHex(handle))
+		return false
+	}
+	if symbolPtr == 0 || symbol == "" {
+		dlFail(emu, "dlsym symbol name is null")
 		return false
 	}
 
@@ -88,14 +88,36 @@ func stubDlclose(emu *emulator.Emulator) bool {
 	handle := emu.X(0)
 
 	dlMu.Lock()
+	_, ok := dlHandles[handle]
 	delete(dlHandles, handle)
 	dlMu.Unlock()
 
+	if !ok {
+		dlSetError("invalid handle: " + stubs.FormatHex(handle))
+		stubs.ReturnError(emu, stubs.EINVAL)
+		return false
+	}
+
 	emu.SetX(0, 0) // Success
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
+// dlSetError records the message returned by the next dlerror call.
+func dlSetError(msg string) {
+	dlMu.Lock()
+	dlLastError = msg
+	dlMu.Unlock()
+}
+
+// dlFail fails a pointer-returning dl call: it sets the dlerror message and
+// returns NULL. errno is set as well for callers that report strerror(errno).
+func dlFail(emu *emulator.Emulator, msg string) {
+	dlSetError(msg)
+	stubs.DefaultRegistry.Log("android", "dlerror", msg)
+	stubs.ReturnNull(emu, stubs.EINVAL)
+}
+
 func stubDlerror(emu *emulator.Emulator) bool {
 	dlMu.Lock()
 	err := dlLastError
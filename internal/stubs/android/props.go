@@ -0,0 +1,326 @@
+package android
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// System property limits (sys/system_properties.h)
+const (
+	propNameMax  = 32
+	propValueMax = 92 // Including the terminator
+)
+
+// prop_info layout: serial (u32), value[PROP_VALUE_MAX], name (NUL-terminated)
+const (
+	propInfoValue = 4
+	propInfoName  = propInfoValue + propValueMax
+)
+
+// DefaultProperties is the device profile guest code sees: a retail,
+// locked Pixel 7 on Android 14. Emulator and root markers (ro.kernel.qemu,
+// ro.debuggable=1, test-keys) are deliberately absent.
+var DefaultProperties = map[string]string{
+	"ro.build.version.sdk":                 "34",
+	"ro.build.version.release":             "14",
+	"ro.build.version.release_or_codename": "14",
+	"ro.build.version.codename":            "REL",
+	"ro.build.version.incremental":         "11228894",
+	"ro.build.version.security_patch":      "2024-01-05",
+	"ro.build.id":                          "UQ1A.240105.004",
+	"ro.build.display.id":                  "UQ1A.240105.004",
+	"ro.build.type":                        "user",
+	"ro.build.tags":                        "release-keys",
+	"ro.build.user":                        "android-build",
+	"ro.build.host":                        "abfarm-release-rbe-64-00044",
+	"ro.build.date.utc":                    "1702341866",
+	"ro.build.characteristics":             "nosdcard",
+	"ro.build.fingerprint":                 "google/panther/panther:14/UQ1A.240105.004/11228894:user/release-keys",
+	"ro.build.description":                 "panther-user 14 UQ1A.240105.004 11228894 release-keys",
+	"ro.product.model":                     "Pixel 7",
+	"ro.product.brand":                     "google",
+	"ro.product.name":                      "panther",
+	"ro.product.device":                    "panther",
+	"ro.product.board":                     "panther",
+	"ro.product.manufacturer":              "Google",
+	"ro.product.first_api_level":           "33",
+	"ro.product.locale":                    "en-US",
+	"ro.product.cpu.abi":                   "arm64-v8a",
+	"ro.product.cpu.abilist":               "arm64-v8a,armeabi-v7a,armeabi",
+	"ro.product.cpu.abilist32":             "armeabi-v7a,armeabi",
+	"ro.product.cpu.abilist64":             "arm64-v8a",
+	"ro.hardware":                          "panther",
+	"ro.board.platform":                    "gs201",
+	"ro.bootloader":                        "cloudripper-14.0-11116591",
+	"ro.serialno":                          "28201FDH2004KQ",
+	"ro.boot.serialno":                     "28201FDH2004KQ",
+	"ro.boot.hardware":                     "panther",
+	"ro.boot.verifiedbootstate":            "green",
+	"ro.boot.flash.locked":                 "1",
+	"ro.boot.vbmeta.device_state":          "locked",
+	"ro.debuggable":                        "0",
+	"ro.secure":                            "1",
+	"ro.adb.secure":                        "1",
+	"ro.crypto.state":                      "encrypted",
+	"ro.zygote":                            "zygote64_32",
+	"ro.opengles.version":                  "196610",
+	"ro.sf.lcd_density":                    "420",
+	"dalvik.vm.heapsize":                   "512m",
+	"persist.sys.timezone":                 "UTC",
+	"sys.boot_completed":                   "1",
+	"init.svc.adbd":                        "stopped",
+}
+
+var (
+	properties = copyProperties(DefaultProperties)
+	propSerial = make(map[string]uint32) // name -> serial, bumped on set
+	propInfos  = make(map[string]uint64) // name -> guest prop_info
+	propNames  = make(map[uint64]string) // guest prop_info -> name
+	propEmu    *emulator.Emulator        // Emulator propInfos belong to
+	propMu     sync.Mutex
+)
+
+func init() {
+	stubs.RegisterFunc("android", "__system_property_get", stubPropertyGet)
+	stubs.RegisterFunc("android", "__system_property_find", stubPropertyFind)
+	stubs.RegisterFunc("android", "__system_property_read", stubPropertyRead)
+	stubs.RegisterFunc("android", "__system_property_read_callback", stubPropertyReadCallback)
+	stubs.RegisterFunc("android", "__system_property_set", stubPropertySet)
+}
+
+func copyProperties(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// ResetProperties restores the default device profile.
+func ResetProperties() {
+	propMu.Lock()
+	properties = copyProperties(DefaultProperties)
+	propSerial = make(map[string]uint32)
+	propMu.Unlock()
+}
+
+// SetProperty sets a system property. An empty value removes it.
+func SetProperty(name, value string) {
+	propMu.Lock()
+	defer propMu.Unlock()
+	if value == "" {
+		delete(properties, name)
+	} else {
+		properties[name] = value
+	}
+	propSerial[name] += 2 // Even serials are stable values
+}
+
+// GetProperty returns a system property.
+func GetProperty(name string) (string, bool) {
+	propMu.Lock()
+	defer propMu.Unlock()
+	v, ok := properties[name]
+	return v, ok
+}
+
+// Properties returns the names of all set properties, sorted.
+func Properties() []string {
+	propMu.Lock()
+	defer propMu.Unlock()
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseProperty parses a "name=value" assignment.
+func ParseProperty(s string) (string, string, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("property %q: want name=value", s)
+	}
+	return name, strings.TrimSpace(value), nil
+}
+
+// LoadProperties reads overrides in build.prop format: one name=value per
+// line, with blank lines and # comments ignored.
+func LoadProperties(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, err := ParseProperty(text)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		SetProperty(name, value)
+	}
+	return scanner.Err()
+}
+
+// truncateValue limits a value to what fits in PROP_VALUE_MAX.
+func truncateValue(v string) string {
+	if len(v) >= propValueMax {
+		return v[:propValueMax-1]
+	}
+	return v
+}
+
+// findProperty returns the guest prop_info for a property, or 0 if unset.
+// prop_info objects are allocated once per name and refreshed on lookup.
+func findProperty(emu *emulator.Emulator, name string) uint64 {
+	propMu.Lock()
+	defer propMu.Unlock()
+
+	if propEmu != emu {
+		propEmu = emu
+		propInfos = make(map[string]uint64)
+		propNames = make(map[uint64]string)
+	}
+	value, ok := properties[name]
+	if !ok {
+		return 0
+	}
+	pi, ok := propInfos[name]
+	if !ok {
+		pi = emu.Malloc(uint64(propInfoName + len(name) + 1))
+		emu.MemWriteString(pi+propInfoName, name)
+		propInfos[name] = pi
+		propNames[pi] = name
+	}
+	value = truncateValue(value)
+	emu.MemWriteU32(pi, propSerial[name])
+	emu.MemWrite(pi+propInfoValue, append([]byte(value), 0))
+	return pi
+}
+
+// propertyOf returns the name and value behind a prop_info.
+func propertyOf(pi uint64) (string, string, bool) {
+	propMu.Lock()
+	defer propMu.Unlock()
+	name, ok := propNames[pi]
+	if !ok {
+		return "", "", false
+	}
+	return name, truncateValue(properties[name]), true
+}
+
+func stubPropertyGet(emu *emulator.Emulator) bool {
+	// int __system_property_get(const char *name, char *value)
+	name, _ := emu.MemReadString(emu.X(0), propNameMax*4)
+	valuePtr := emu.X(1)
+
+	value, ok := GetProperty(name)
+	value = truncateValue(value)
+	if valuePtr != 0 {
+		emu.MemWrite(valuePtr, append([]byte(value), 0))
+	}
+	if ok {
+		stubs.DefaultRegistry.Log("android", "__system_property_get", name+" = "+value)
+	} else {
+		stubs.DefaultRegistry.Log("android", "__system_property_get", name+" (unset)")
+	}
+	emu.SetX(0, uint64(len(value)))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubPropertyFind(emu *emulator.Emulator) bool {
+	// const prop_info *__system_property_find(const char *name)
+	name, _ := emu.MemReadString(emu.X(0), propNameMax*4)
+	pi := findProperty(emu, name)
+	stubs.DefaultRegistry.Log("android", "__system_property_find", name+" -> "+stubs.FormatHex(pi))
+	emu.SetX(0, pi)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubPropertyRead(emu *emulator.Emulator) bool {
+	// int __system_property_read(const prop_info *pi, char *name, char *value)
+	pi := emu.X(0)
+	namePtr := emu.X(1)
+	valuePtr := emu.X(2)
+
+	name, value, ok := propertyOf(pi)
+	if !ok {
+		emu.SetX(0, 0)
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+	if namePtr != 0 {
+		// The legacy API truncates names to PROP_NAME_MAX
+		n := name
+		if len(n) >= propNameMax {
+			n = n[:propNameMax-1]
+		}
+		emu.MemWrite(namePtr, append([]byte(n), 0))
+	}
+	if valuePtr != 0 {
+		emu.MemWrite(valuePtr, append([]byte(value), 0))
+	}
+	stubs.DefaultRegistry.Log("android", "__system_property_read", name+" = "+value)
+	emu.SetX(0, uint64(len(value)))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubPropertyReadCallback(emu *emulator.Emulator) bool {
+	// void __system_property_read_callback(const prop_info *pi,
+	//     void (*callback)(void *cookie, const char *name, const char *value, uint32_t serial),
+	//     void *cookie)
+	pi := emu.X(0)
+	callback := emu.X(1)
+	cookie := emu.X(2)
+
+	name, _, ok := propertyOf(pi)
+	if !ok || callback == 0 {
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+	findProperty(emu, name) // Refresh the value and serial in guest memory
+	serial, _ := emu.MemReadU32(pi)
+	stubs.DefaultRegistry.Log("android", "__system_property_read_callback", name+" -> "+stubs.FormatHex(callback))
+
+	// Tail-call the callback: it returns straight to our caller through LR
+	emu.SetX(0, cookie)
+	emu.SetX(1, pi+propInfoName)
+	emu.SetX(2, pi+propInfoValue)
+	emu.SetX(3, uint64(serial))
+	emu.SetPC(callback)
+	return false
+}
+
+func stubPropertySet(emu *emulator.Emulator) bool {
+	// int __system_property_set(const char *name, const char *value)
+	name, _ := emu.MemReadString(emu.X(0), propNameMax*4)
+	value, _ := emu.MemReadString(emu.X(1), propValueMax)
+	if name == "" || len(value) >= propValueMax {
+		emu.SetX(0, ^uint64(0))
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+	stubs.DefaultRegistry.Log("android", "__system_property_set", name+" = "+value)
+	SetProperty(name, value)
+	emu.SetX(0, 0)
+	stubs.ReturnFromStub(emu)
+	return false
+}
@@ -0,0 +1,66 @@
+package android
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+func TestSystemProperties(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	defer ResetProperties()
+
+	SetProperty("ro.debuggable", "1")
+	SetProperty("ro.product.model", "")
+
+	name := emu.Malloc(64)
+	value := emu.Malloc(propValueMax)
+
+	get := func(prop string) (uint64, string) {
+		emu.MemWriteString(name, prop)
+		emu.SetX(0, name)
+		emu.SetX(1, value)
+		testutil.CallStub(t, emu, stubPropertyGet)
+		s, _ := emu.MemReadString(value, propValueMax)
+		return emu.X(0), s
+	}
+	if n, v := get("ro.build.version.sdk"); n != 2 || v != "34" {
+		t.Errorf("sdk = %d %q, want 2 \"34\"", n, v)
+	}
+	if n, v := get("ro.debuggable"); n != 1 || v != "1" {
+		t.Errorf("debuggable = %d %q, want override 1", n, v)
+	}
+	if n, v := get("ro.product.model"); n != 0 || v != "" {
+		t.Errorf("unset model = %d %q, want empty", n, v)
+	}
+
+	// __system_property_find + __system_property_read_callback: the
+	// callback at CodeBase+0x100 saves the value pointer in X19 and returns
+	emu.MemWriteString(name, "ro.build.version.release")
+	emu.SetX(0, name)
+	testutil.CallStub(t, emu, stubPropertyFind)
+	pi := emu.X(0)
+	if pi == 0 {
+		t.Fatal("__system_property_find returned NULL")
+	}
+
+	callback := uint64(emulator.CodeBase + 0x100)
+	code := make([]byte, 8)
+	binary.LittleEndian.PutUint32(code, 0xaa0203f3)     // MOV X19, X2
+	binary.LittleEndian.PutUint32(code[4:], 0xd65f03c0) // RET
+	emu.MemWrite(callback, code)
+
+	emu.SetX(0, pi)
+	emu.SetX(1, callback)
+	emu.SetX(2, 0)
+	testutil.CallStub(t, emu, stubPropertyReadCallback)
+	if v, _ := emu.MemReadString(emu.X(19), propValueMax); v != "14" {
+		t.Errorf("callback value = %q, want 14", v)
+	}
+}
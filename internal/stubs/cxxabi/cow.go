@@ -0,0 +1,113 @@
+package cxxabi
+
+import (
+	"encoding/binary"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// COW String Layout (libstdc++ before the C++11 ABI, std::string = Ss):
+//
+// The std::string object is a single pointer to the character data. The
+// data is preceded by its _Rep header:
+//
+//   data - 24: size_t _M_length
+//   data - 16: size_t _M_capacity
+//   data -  8: int    _M_refcount (-1 for the shared empty rep)
+//   data +  0: char   [_M_capacity + 1]
+
+const (
+	COWObjSize = 8  // Size of std::string object
+	COWRepSize = 24 // Size of the _Rep header before the data
+)
+
+// ReadCOWString reads a libstdc++ COW std::string from memory.
+func ReadCOWString(emu *emulator.Emulator, addr uint64) (string, bool) {
+	dataPtr := GetCOWDataPtr(emu, addr)
+	if dataPtr < 0x1000+COWRepSize {
+		return "", false
+	}
+	length, err := emu.MemReadU64(dataPtr - COWRepSize)
+	if err != nil || length > maxStringLen {
+		return "", false
+	}
+	if length == 0 {
+		return "", true
+	}
+	data, err := emu.MemRead(dataPtr, length)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// WriteCOWString writes a string to memory in libstdc++ COW format. Every
+// write gets a fresh unshared rep, except the empty string, which points
+// at the emulator's shared empty rep like a default-constructed string.
+func WriteCOWString(emu *emulator.Emulator, addr uint64, str string) error {
+	dataPtr := emu.GetEmptyStringData()
+	if str != "" || dataPtr == 0 {
+		capacity := uint64(len(str))
+		rep := emu.Malloc(COWRepSize + capacity + 1)
+
+		header := make([]byte, COWRepSize)
+		binary.LittleEndian.PutUint64(header[0:8], uint64(len(str)))
+		binary.LittleEndian.PutUint64(header[8:16], capacity)
+		// _M_refcount = 0: one owner
+		if err := emu.MemWrite(rep, header); err != nil {
+			return err
+		}
+		dataPtr = rep + COWRepSize
+		if err := emu.MemWrite(dataPtr, append([]byte(str), 0)); err != nil {
+			return err
+		}
+	}
+	return emu.MemWriteU64(addr, dataPtr)
+}
+
+// AssignCOWString stores a new value in an existing libstdc++ string. An
+// unshared rep is reused when its capacity is enough; otherwise the new rep
+// at least doubles it, so repeated appends do not allocate every time.
+func AssignCOWString(emu *emulator.Emulator, addr uint64, str string) error {
+	dataPtr := GetCOWDataPtr(emu, addr)
+	if str == "" || dataPtr < 0x1000+COWRepSize || dataPtr == emu.GetEmptyStringData() {
+		return WriteCOWString(emu, addr, str)
+	}
+	header, err := emu.MemRead(dataPtr-COWRepSize, COWRepSize)
+	if err != nil || int32(binary.LittleEndian.Uint32(header[16:20])) != 0 { // Shared
+		return WriteCOWString(emu, addr, str)
+	}
+	capacity := binary.LittleEndian.Uint64(header[8:16])
+	if capacity > maxStringLen {
+		return WriteCOWString(emu, addr, str)
+	}
+	if uint64(len(str)) > capacity {
+		capacity = max(uint64(len(str)), 2*capacity)
+		dataPtr = emu.Malloc(COWRepSize+capacity+1) + COWRepSize
+		if err := emu.MemWrite(dataPtr-COWRepSize, make([]byte, COWRepSize)); err != nil {
+			return err
+		}
+	}
+	if err := emu.MemWriteU64(dataPtr-COWRepSize, uint64(len(str))); err != nil {
+		return err
+	}
+	if err := emu.MemWriteU64(dataPtr-COWRepSize+8, capacity); err != nil {
+		return err
+	}
+	if err := emu.MemWrite(dataPtr, append([]byte(str), 0)); err != nil {
+		return err
+	}
+	return emu.MemWriteU64(addr, dataPtr)
+}
+
+// GetCOWDataPtr returns a pointer to the string data (for c_str()/data()).
+func GetCOWDataPtr(emu *emulator.Emulator, addr uint64) uint64 {
+	if addr == 0 || addr < 0x1000 {
+		return 0
+	}
+	dataPtr, err := emu.MemReadU64(addr)
+	if err != nil {
+		return 0
+	}
+	return dataPtr
+}
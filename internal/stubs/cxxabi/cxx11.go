@@ -0,0 +1,38 @@
+package cxxabi
+
+import (
+	"encoding/binary"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// C++11 ABI String Layout (libstdc++, std::__cxx11::basic_string):
+//
+//   bytes 0-7:   pointer to the character data (bytes 16-31 when short)
+//   bytes 8-15:  length
+//   bytes 16-31: inline character data, or the capacity when long
+//
+// Only a reader is provided: the string hooks leave this layout alone.
+
+const CXX11ObjSize = 32 // Size of std::string object
+
+// ReadCXX11String reads a libstdc++ C++11 ABI std::string from memory.
+func ReadCXX11String(emu *emulator.Emulator, addr uint64) (string, bool) {
+	obj, err := emu.MemRead(addr, 16)
+	if err != nil {
+		return "", false
+	}
+	dataPtr := binary.LittleEndian.Uint64(obj[0:8])
+	length := binary.LittleEndian.Uint64(obj[8:16])
+	if length > maxStringLen || dataPtr < 0x1000 {
+		return "", false
+	}
+	if length == 0 {
+		return "", true
+	}
+	data, err := emu.MemRead(dataPtr, length)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
@@ -1,8 +1,10 @@
 // Package cxxabi provides stub implementations for C++ ABI functions.
-// This file implements stubs for libc++ (NDK) std::string with SSO (Short String Optimization).
+// This file implements stubs for std::string in both the libc++ (NDK) SSO
+// layout and the libstdc++ COW layout (see cow.go).
 package cxxabi
 
 import (
+	"encoding/binary"
 	"strings"
 	"sync"
 
@@ -39,23 +41,27 @@ var (
 )
 
 func init() {
-	// Register __cxa_demangle as a simple stub
+	// Register __cxa_demangle
 	stubs.Register(stubs.StubDef{
 		Name:     "__cxa_demangle",
 		Category: "cxxabi",
 		Hook:     stubCxaDemangle,
 	})
 
-	// Register std::string as a detector - activates on mangled basic_string symbols
+	// Register std::string as a detector - activates on mangled basic_string symbols.
+	// Any C++ binary has _ZNSt symbols, so one pattern alone is not enough:
+	// libc++ matches basic_string and __ndk1, libstdc++ _ZNSs and _ZNSt.
 	stubs.RegisterDetector(stubs.Detector{
 		Name: "cxxabi-string",
 		Patterns: []string{
 			"basic_string",
 			"_ZNSt",
+			"_ZNSs",
 			"__ndk1",
 		},
-		Activate:    activateStringHooks,
-		Description: "C++ std::string SSO implementation",
+		MinConfidence: 0.5,
+		Activate:      activateStringHooks,
+		Description:   "C++ std::string (libc++ SSO, libstdc++ COW)",
 	})
 }
 
@@ -69,8 +75,10 @@ func activateStringHooks(emu *emulator.Emulator, imports, symbols map[string]uin
 	return installed
 }
 
-// InstallStringHooks scans imports and installs std::string hooks based on mangled names.
-// This must be called after loading the binary to match the actual mangled names.
+// InstallStringHooks scans symbols and hooks the std::string functions listed
+// in stringOverloads and stringOperators, in the layout of the library that
+// defines them. This must be called after loading the binary to match the
+// actual mangled names.
 func InstallStringHooks(emu *emulator.Emulator, imports map[string]uint64) int {
 	installed := 0
 
@@ -78,57 +86,19 @@ func InstallStringHooks(emu *emulator.Emulator, imports map[string]uint64) int {
 		if addr == 0 {
 			continue
 		}
-
-		// Match std::string constructors
-		// _ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEEC2IDnEEPKc
-		if containsAll(name, "basic_string", "char_traits", "C2") && strings.Contains(name, "PKc") {
-			emu.HookAddress(addr, stubStringCtor)
-			installed++
-			continue
-		}
-
-		// Match std::string::assign(const char*)
-		// _ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE6assignEPKc
-		if containsAll(name, "basic_string", "6assignEPKc") {
-			emu.HookAddress(addr, stubStringAssign)
-			installed++
-			continue
-		}
-
-		// Match std::string::c_str() or data()
-		if containsAll(name, "basic_string", "c_str") || containsAll(name, "basic_string", "4data") {
-			emu.HookAddress(addr, stubStringCStr)
-			installed++
-			continue
-		}
-
-		// Match std::string::size() or length()
-		if containsAll(name, "basic_string", "4size") || containsAll(name, "basic_string", "6length") {
-			emu.HookAddress(addr, stubStringSize)
-			installed++
+		// Cheap filter before demangling: libc++ names spell out
+		// basic_string, libstdc++ members use the Ss abbreviation.
+		if !strings.Contains(name, "basic_string") && !strings.HasPrefix(name, "_ZNSs") &&
+			!strings.HasPrefix(name, "_ZNKSs") && !strings.Contains(name, "char_traits") {
 			continue
 		}
 
-		// Match std::string::empty()
-		if containsAll(name, "basic_string", "5empty") {
-			emu.HookAddress(addr, stubStringEmpty)
-			installed++
-			continue
-		}
-
-		// Match std::string::clear()
-		if containsAll(name, "basic_string", "5clear") {
-			emu.HookAddress(addr, stubStringClear)
-			installed++
-			continue
-		}
-
-		// Match std::string::operator[]
-		if containsAll(name, "basic_string", "ixEm") {
-			emu.HookAddress(addr, stubStringIndex)
-			installed++
+		h, ok := lookupStringHook(name)
+		if !ok {
 			continue
 		}
+		emu.HookAddress(addr, h.hook())
+		installed++
 	}
 
 	return installed
@@ -156,7 +126,7 @@ func ReadSSOString(emu *emulator.Emulator, addr uint64) (string, bool) {
 		dataPtr := uint64(data[16]) | uint64(data[17])<<8 | uint64(data[18])<<16 | uint64(data[19])<<24 |
 			uint64(data[20])<<32 | uint64(data[21])<<40 | uint64(data[22])<<48 | uint64(data[23])<<56
 
-		if length > 4096 || dataPtr < 0x1000 {
+		if length > maxStringLen || dataPtr < 0x1000 {
 			return "", false
 		}
 
@@ -195,48 +165,41 @@ func WriteSSOString(emu *emulator.Emulator, addr uint64, str string) error {
 	// Long string - allocate heap buffer
 	bufSize := uint64(strLen + 1) // +1 for null terminator
 	bufSize = (bufSize + 15) & ^uint64(15)
-	dataPtr := emu.Malloc(bufSize)
+	return writeSSOLong(emu, addr, str, emu.Malloc(bufSize), bufSize)
+}
+
+// AssignSSOString stores a new value in an existing libc++ string. A long
+// string's buffer is reused when it is big enough and otherwise at least
+// doubled, so repeated appends do not allocate every time.
+func AssignSSOString(emu *emulator.Emulator, addr uint64, str string) error {
+	data, err := emu.MemRead(addr, SSOObjSize)
+	if err != nil || data[0]&1 == 0 || len(str) <= SSOMaxLen {
+		return WriteSSOString(emu, addr, str)
+	}
+	capacity := binary.LittleEndian.Uint64(data[0:8]) &^ 1
+	dataPtr := binary.LittleEndian.Uint64(data[16:24])
+	if capacity > maxStringLen || dataPtr < 0x1000 {
+		return WriteSSOString(emu, addr, str)
+	}
+	if need := uint64(len(str) + 1); need > capacity {
+		capacity = (max(need, 2*capacity) + 15) & ^uint64(15)
+		dataPtr = emu.Malloc(capacity)
+	}
+	return writeSSOLong(emu, addr, str, dataPtr, capacity)
+}
 
-	// Write string data to heap
-	dataWithNull := append(strBytes, 0)
-	if err := emu.MemWrite(dataPtr, dataWithNull); err != nil {
+// writeSSOLong writes str to the buffer at dataPtr and a long string
+// object pointing at it.
+func writeSSOLong(emu *emulator.Emulator, addr uint64, str string, dataPtr, bufSize uint64) error {
+	if err := emu.MemWrite(dataPtr, append([]byte(str), 0)); err != nil {
 		return err
 	}
 
-	// Write std::string object
+	// Capacity with long bit set (bit 0 = 1), length, data pointer
 	ssoData := make([]byte, SSOObjSize)
-
-	// Capacity with long bit set (bit 0 = 1)
-	capacity := bufSize | 1
-	ssoData[0] = byte(capacity)
-	ssoData[1] = byte(capacity >> 8)
-	ssoData[2] = byte(capacity >> 16)
-	ssoData[3] = byte(capacity >> 24)
-	ssoData[4] = byte(capacity >> 32)
-	ssoData[5] = byte(capacity >> 40)
-	ssoData[6] = byte(capacity >> 48)
-	ssoData[7] = byte(capacity >> 56)
-
-	// Length
-	ssoData[8] = byte(strLen)
-	ssoData[9] = byte(strLen >> 8)
-	ssoData[10] = byte(strLen >> 16)
-	ssoData[11] = byte(strLen >> 24)
-	ssoData[12] = byte(strLen >> 32)
-	ssoData[13] = byte(strLen >> 40)
-	ssoData[14] = byte(strLen >> 48)
-	ssoData[15] = byte(strLen >> 56)
-
-	// Data pointer
-	ssoData[16] = byte(dataPtr)
-	ssoData[17] = byte(dataPtr >> 8)
-	ssoData[18] = byte(dataPtr >> 16)
-	ssoData[19] = byte(dataPtr >> 24)
-	ssoData[20] = byte(dataPtr >> 32)
-	ssoData[21] = byte(dataPtr >> 40)
-	ssoData[22] = byte(dataPtr >> 48)
-	ssoData[23] = byte(dataPtr >> 56)
-
+	binary.LittleEndian.PutUint64(ssoData[0:8], bufSize|1)
+	binary.LittleEndian.PutUint64(ssoData[8:16], uint64(len(str)))
+	binary.LittleEndian.PutUint64(ssoData[16:24], dataPtr)
 	return emu.MemWrite(addr, ssoData)
 }
 
@@ -314,120 +277,66 @@ func trackString(addr uint64, value string) {
 	}
 }
 
-// stubStringCtor implements std::string constructor from const char*.
-func stubStringCtor(emu *emulator.Emulator) bool {
-	thisPtr := emu.X(0)
-	srcPtr := emu.X(1)
-
-	str, _ := emu.MemReadString(srcPtr, 4096)
-	WriteSSOString(emu, thisPtr, str)
-	trackString(thisPtr, str)
-
-	truncated := str
-	if len(truncated) > 30 {
-		truncated = truncated[:30] + "..."
-	}
-	stubs.DefaultRegistry.Log("cxxabi", "string::ctor", "\""+truncated+"\"")
-
-	emu.SetX(0, thisPtr)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-// stubStringAssign implements std::string::assign(const char*).
-func stubStringAssign(emu *emulator.Emulator) bool {
-	thisPtr := emu.X(0)
-	srcPtr := emu.X(1)
-
-	str, _ := emu.MemReadString(srcPtr, 4096)
-	WriteSSOString(emu, thisPtr, str)
-	trackString(thisPtr, str)
-
-	truncated := str
-	if len(truncated) > 30 {
-		truncated = truncated[:30] + "..."
-	}
-	stubs.DefaultRegistry.Log("cxxabi", "string::assign", "\""+truncated+"\"")
-
-	emu.SetX(0, thisPtr)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-// stubStringCStr implements std::string::c_str() and data().
-func stubStringCStr(emu *emulator.Emulator) bool {
-	thisPtr := emu.X(0)
-	dataPtr := GetSSODataPtr(emu, thisPtr)
-
-	emu.SetX(0, dataPtr)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-// stubStringSize implements std::string::size() and length().
-func stubStringSize(emu *emulator.Emulator) bool {
-	thisPtr := emu.X(0)
-	length := GetSSOLength(emu, thisPtr)
-
-	emu.SetX(0, length)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-// stubStringEmpty implements std::string::empty().
-func stubStringEmpty(emu *emulator.Emulator) bool {
-	thisPtr := emu.X(0)
-	length := GetSSOLength(emu, thisPtr)
-
-	if length == 0 {
-		emu.SetX(0, 1) // true
-	} else {
-		emu.SetX(0, 0) // false
-	}
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-// stubStringClear implements std::string::clear().
-func stubStringClear(emu *emulator.Emulator) bool {
-	thisPtr := emu.X(0)
-	// Write empty string
-	WriteSSOString(emu, thisPtr, "")
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-// stubStringIndex implements std::string::operator[].
-func stubStringIndex(emu *emulator.Emulator) bool {
-	thisPtr := emu.X(0)
-	index := emu.X(1)
-
-	dataPtr := GetSSODataPtr(emu, thisPtr)
-	charPtr := dataPtr + index
-
-	emu.SetX(0, charPtr)
-	stubs.ReturnFromStub(emu)
-	return false
-}
+// __cxa_demangle status codes.
+const (
+	demangleSuccess         = 0
+	demangleInvalidName     = -2
+	demangleInvalidArgument = -3
+)
 
 // stubCxaDemangle implements __cxa_demangle.
+// char* __cxa_demangle(const char* mangled, char* buf, size_t* n, int* status)
+//
+// As in libc++abi, buf is a malloc'd buffer of *n bytes: the result is
+// written there if it fits, otherwise buf is grown as realloc would (here,
+// into a new heap buffer), and a NULL buf gets a new one. *n is set to the
+// size written, including the terminator. Bare types ("PKc") are accepted
+// as well as symbols.
 func stubCxaDemangle(emu *emulator.Emulator) bool {
 	mangledPtr := emu.X(0)
-	// output := emu.X(1)
-	// length := emu.X(2)
+	buf := emu.X(1)
+	lengthPtr := emu.X(2)
 	statusPtr := emu.X(3)
 
-	// Read mangled name
-	mangled, _ := emu.MemReadString(mangledPtr, 512)
-	stubs.DefaultRegistry.Log("cxxabi", "__cxa_demangle", mangled)
+	setStatus := func(status int32) {
+		if statusPtr != 0 {
+			emu.MemWriteU32(statusPtr, uint32(status))
+		}
+	}
 
-	// Just return the mangled name (no actual demangling)
-	result := emu.Malloc(uint64(len(mangled) + 1))
-	emu.MemWriteString(result, mangled)
+	if mangledPtr == 0 || (buf != 0 && lengthPtr == 0) {
+		setStatus(demangleInvalidArgument)
+		emu.SetX(0, 0)
+		stubs.ReturnFromStub(emu)
+		return false
+	}
 
-	if statusPtr != 0 {
-		emu.MemWriteU32(statusPtr, 0) // Success
+	mangled, _ := emu.MemReadString(mangledPtr, 1024)
+	demangled, err := emulator.Demangle(mangled)
+	if err == emulator.ErrNotMangled {
+		demangled, err = emulator.DemangleType(mangled)
+	}
+	if err != nil {
+		stubs.DefaultRegistry.Log("cxxabi", "__cxa_demangle", mangled+" (invalid)")
+		setStatus(demangleInvalidName)
+		emu.SetX(0, 0)
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+	stubs.DefaultRegistry.Log("cxxabi", "__cxa_demangle", demangled)
+
+	size := uint64(len(demangled) + 1)
+	result := buf
+	if buf == 0 {
+		result = emu.Malloc(size)
+	} else if capacity, _ := emu.MemReadU64(lengthPtr); capacity < size {
+		result = emu.Malloc(size)
+	}
+	emu.MemWriteString(result, demangled)
+	if lengthPtr != 0 {
+		emu.MemWriteU64(lengthPtr, size)
 	}
+	setStatus(demangleSuccess)
 
 	emu.SetX(0, result)
 	stubs.ReturnFromStub(emu)
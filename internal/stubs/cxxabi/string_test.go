@@ -0,0 +1,234 @@
+package cxxabi
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+// libc++ and libstdc++ (COW) spellings of the same calls.
+var stringSymbols = map[string][2]string{
+	"ctor":     {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEEC2IDnEEPKc", "_ZNSsC1EPKcRKSaIcE"},
+	"copy":     {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEEC1ERKS5_", "_ZNSsC1ERKSs"},
+	"move":     {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEEC1EOS5_", "_ZNSsC1EOSs"},
+	"+=":       {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEEpLEPKc", "_ZNSspLEPKc"},
+	"append":   {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE6appendEPKcm", "_ZNSs6appendEPKcm"},
+	"appendS":  {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE6appendERKS5_", "_ZNSs6appendERKSs"},
+	"insert":   {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE6insertEmPKc", "_ZNSs6insertEmPKc"},
+	"substr":   {"_ZNKSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE6substrEmm", "_ZNKSs6substrEmm"},
+	"find":     {"_ZNKSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE4findEPKcmm", "_ZNKSs4findEPKcmm"},
+	"compare":  {"_ZNKSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE7compareEPKc", "_ZNKSs7compareEPKc"},
+	"size":     {"_ZNKSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE4sizeEv", "_ZNKSs4sizeEv"},
+	"c_str":    {"_ZNKSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE5c_strEv", "_ZNKSs5c_strEv"},
+	"plus":     {"_ZNSt6__ndk1plIcNS_11char_traitsIcEENS_9allocatorIcEEEENS_12basic_stringIT_T0_T1_EERKS9_PKS6_", "_ZStplIcSt11char_traitsIcESaIcEESbIT_T0_T1_ERKS6_PKS3_"},
+	"__init":   {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE6__initEPKcm", ""},
+	"iterator": {"_ZNSt6__ndk112basic_stringIcNS_11char_traitsIcEENS_9allocatorIcEEE6insertENS_11__wrap_iterIPKcEEc", "_ZNSs6insertEN9__gnu_cxx17__normal_iteratorIPcSsEEc"},
+}
+
+func TestStringHooks(t *testing.T) {
+	for i, lib := range []string{"libc++", "libstdc++"} {
+		t.Run(lib, func(t *testing.T) {
+			emu, err := emulator.New()
+			if err != nil {
+				t.Fatalf("Failed to create emulator: %v", err)
+			}
+			defer emu.Close()
+
+			code := uint64(emulator.CodeBase)
+			symbols := make(map[string]uint64)
+			addrs := make(map[string]uint64)
+			next := code + 0x100
+			for op, names := range stringSymbols {
+				if names[i] == "" {
+					continue
+				}
+				symbols[names[i]] = next
+				addrs[op] = next
+				next += 4
+			}
+			// Iterator overloads are not modelled and must not be hooked
+			if got, want := InstallStringHooks(emu, symbols), len(symbols)-1; got != want {
+				t.Errorf("InstallStringHooks = %d, want %d", got, want)
+			}
+
+			layout := libcxxString
+			if lib == "libstdc++" {
+				layout = cowString
+			}
+			read := func(addr uint64) string {
+				s, ok := layout.read(emu, addr)
+				if !ok {
+					t.Fatalf("read string at %#x failed", addr)
+				}
+				return s
+			}
+			cstr := func(s string) uint64 { return testutil.CString(emu, s) }
+			call := func(op string, x8 uint64, args ...uint64) uint64 {
+				t.Helper()
+				emu.SetX(8, x8)
+				return testutil.Call(t, emu, addrs[op], args...)
+			}
+
+			// Assemble "xxtea-KEY:2f9a81c0d4e7b356" piece by piece
+			s := emu.Malloc(32)
+			call("ctor", 0, s, cstr("KEY"))
+			call("+=", 0, s, cstr(":2f9a"))
+			call("append", 0, s, cstr("81c0d4e7b356garbage"), 12)
+			call("insert", 0, s, 0, cstr("xxtea-"))
+			if got := read(s); got != "xxtea-KEY:2f9a81c0d4e7b356" {
+				t.Fatalf("assembled = %q", got)
+			}
+			if n := call("size", 0, s); n != 26 {
+				t.Errorf("size = %d, want 26", n)
+			}
+			if p, _ := emu.MemReadString(call("c_str", 0, s), 64); p != "xxtea-KEY:2f9a81c0d4e7b356" {
+				t.Errorf("c_str = %q", p)
+			}
+
+			// key = s.substr(s.find(":") + 1) + "!"
+			pos := call("find", 0, s, cstr(":"), 0, 1)
+			if pos != 9 {
+				t.Errorf("find = %d, want 9", pos)
+			}
+			sub := emu.Malloc(32)
+			call("substr", sub, s, pos+1, ^uint64(0))
+			key := emu.Malloc(32)
+			call("plus", key, sub, cstr("!"))
+			if got := read(key); got != "2f9a81c0d4e7b356!" {
+				t.Errorf("key = %q", got)
+			}
+			if r := int64(call("compare", 0, key, cstr("2f9a81c0d4e7b356!"))); r != 0 {
+				t.Errorf("compare = %d, want 0", r)
+			}
+
+			// Copy keeps the source, move empties it
+			cp := emu.Malloc(32)
+			call("copy", 0, cp, key)
+			call("appendS", 0, cp, sub)
+			mv := emu.Malloc(32)
+			call("move", 0, mv, key)
+			if got := read(cp); got != "2f9a81c0d4e7b356!2f9a81c0d4e7b356" {
+				t.Errorf("copy+append = %q", got)
+			}
+			if got, old := read(mv), read(key); got != "2f9a81c0d4e7b356!" || old != "" {
+				t.Errorf("move = %q, source %q", got, old)
+			}
+
+			if addrs["__init"] != 0 {
+				call("__init", 0, s, cstr("abcdef"), 3)
+				if got := read(s); got != "abc" {
+					t.Errorf("__init = %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestAssignReusesBuffer(t *testing.T) {
+	for _, layout := range []*stringLayout{libcxxString, cowString} {
+		t.Run(layout.name, func(t *testing.T) {
+			emu, err := emulator.New()
+			if err != nil {
+				t.Fatalf("Failed to create emulator: %v", err)
+			}
+			defer emu.Close()
+
+			s := emu.Malloc(SSOObjSize)
+			str := "a string too long for the short form"
+			layout.write(emu, s, str)
+			start := emu.HeapEnd()
+			for i := 0; i < 50000; i++ {
+				str += "x"
+				if err := layout.assign(emu, s, str); err != nil {
+					t.Fatalf("assign %d: %v", i, err)
+				}
+			}
+			if got, _ := layout.read(emu, s); got != str {
+				t.Fatalf("read %d bytes, want %d", len(got), len(str))
+			}
+			if used := emu.HeapEnd() - start; used > 256*1024 {
+				t.Errorf("50000 appends used %d bytes of heap", used)
+			}
+
+			// Shrinking keeps the buffer
+			data := layout.data(emu, s)
+			layout.assign(emu, s, str[:40])
+			if layout.data(emu, s) != data {
+				t.Errorf("shrink moved the buffer")
+			}
+			if got, _ := layout.read(emu, s); got != str[:40] {
+				t.Errorf("after shrink = %q", got)
+			}
+		})
+	}
+}
+
+func TestCxaDemangle(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	const want = "cocos2d::FileUtils::getInstance()"
+	mangled := testutil.CString(emu, "_ZN7cocos2d9FileUtils11getInstanceEv")
+	status := emu.Malloc(4)
+	length := emu.Malloc(8)
+	demangle := func(buf, n uint64) uint64 {
+		t.Helper()
+		emu.MemWriteU32(status, 0xffffffff)
+		emu.SetX(0, mangled)
+		emu.SetX(1, buf)
+		emu.SetX(2, n)
+		emu.SetX(3, status)
+		testutil.CallStub(t, emu, stubCxaDemangle)
+		return emu.X(0)
+	}
+	check := func(name string, p uint64) {
+		t.Helper()
+		if st, _ := emu.MemReadU32(status); st != demangleSuccess {
+			t.Fatalf("%s: status = %d", name, int32(st))
+		}
+		if got, _ := emu.MemReadString(p, 64); got != want {
+			t.Errorf("%s: demangled %q, want %q", name, got, want)
+		}
+		if n, _ := emu.MemReadU64(length); n != uint64(len(want)+1) {
+			t.Errorf("%s: *n = %d, want %d", name, n, len(want)+1)
+		}
+	}
+
+	// A NULL buffer gets a new one
+	emu.MemWriteU64(length, 0)
+	p := demangle(0, length)
+	check("NULL buffer", p)
+	if p == 0 {
+		t.Fatal("NULL buffer: no result")
+	}
+
+	// A buffer of *n bytes is reused when the name fits
+	buf := emu.Malloc(64)
+	emu.MemWriteU64(length, 64)
+	if p := demangle(buf, length); p != buf {
+		t.Errorf("large buffer: result %#x, want the caller's %#x", p, buf)
+	} else {
+		check("large buffer", p)
+	}
+
+	// A short buffer is grown into a new one
+	small := emu.Malloc(8)
+	emu.MemWriteU64(length, 8)
+	if p := demangle(small, length); p == small || p == 0 {
+		t.Errorf("short buffer: result %#x, want a new buffer", p)
+	} else {
+		check("short buffer", p)
+	}
+
+	// A buffer without its size is an invalid argument
+	if p := demangle(buf, 0); p != 0 {
+		t.Errorf("buffer without n: result %#x, want NULL", p)
+	}
+	if st, _ := emu.MemReadU32(status); int32(st) != demangleInvalidArgument {
+		t.Errorf("buffer without n: status = %d, want %d", int32(st), demangleInvalidArgument)
+	}
+}
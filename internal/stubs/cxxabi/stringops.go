@@ -0,0 +1,554 @@
+package cxxabi
+
+import (
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// The std::string hooks are matched on demangled names reduced to a method
+// and a parameter code, e.g. "append(pn)" for append(char const*, unsigned
+// long). Codes:
+//
+//	p  char const*         n  unsigned long (size_type)
+//	s  string const&       m  string&& (moved from)
+//	c  char                w  char* (output buffer)
+//
+// Allocator parameters are dropped. Every overload listed in stringOverloads
+// runs in Go against the layout of the library that defines it, so strings
+// built piece by piece never depend on code paths the emulator cannot run.
+
+const (
+	npos         = ^uint64(0)
+	maxCStrLen   = 4096
+	maxStringLen = 1 << 20
+)
+
+// stringLayout reads and writes one std::string representation. write
+// constructs a string in raw memory; assign changes an existing one and
+// reuses its buffer.
+type stringLayout struct {
+	name   string
+	read   func(emu *emulator.Emulator, addr uint64) (string, bool)
+	write  func(emu *emulator.Emulator, addr uint64, str string) error
+	assign func(emu *emulator.Emulator, addr uint64, str string) error
+	data   func(emu *emulator.Emulator, addr uint64) uint64
+}
+
+var (
+	libcxxString = &stringLayout{"libc++", ReadSSOString, WriteSSOString, AssignSSOString, GetSSODataPtr}
+	cowString    = &stringLayout{"libstdc++", ReadCOWString, WriteCOWString, AssignCOWString, GetCOWDataPtr}
+)
+
+// stringOp implements one std::string method for the given parameter codes.
+type stringOp func(c *stringCall, codes string)
+
+// stringOverloads lists the supported members by name and parameter codes.
+var stringOverloads = []struct {
+	names []string
+	codes []string
+	op    stringOp
+}{
+	{[]string{"basic_string"}, []string{"", "p", "pn", "s", "m", "sn", "snn", "nc"}, opAssign},
+	{[]string{"assign"}, []string{"p", "pn", "s", "m", "sn", "snn", "nc"}, opAssign},
+	{[]string{"operator="}, []string{"p", "s", "m", "c"}, opAssign},
+	{[]string{"__assign_external", "__init_copy_ctor_external"}, []string{"p", "pn"}, opAssign},
+	{[]string{"__init"}, []string{"pn", "pnn", "nc"}, opInit},
+	{[]string{"append"}, []string{"p", "pn", "s", "sn", "snn", "nc"}, opAppend},
+	{[]string{"operator+="}, []string{"p", "s", "c"}, opAppend},
+	{[]string{"push_back"}, []string{"c"}, opAppend},
+	{[]string{"insert"}, []string{"np", "npn", "ns", "nsnn", "nnc"}, opInsert},
+	{[]string{"replace"}, []string{"nnp", "nnpn", "nns", "nnsnn", "nnnc"}, opReplace},
+	{[]string{"erase"}, []string{"", "n", "nn"}, opErase},
+	{[]string{"resize"}, []string{"n", "nc"}, opResize},
+	{[]string{"clear"}, []string{""}, opClear},
+	{[]string{"swap"}, []string{"s"}, opSwap},
+	{[]string{"reserve"}, []string{"", "n"}, opNop},
+	{[]string{"shrink_to_fit", "~basic_string"}, []string{""}, opNop},
+	{[]string{"substr"}, []string{"", "n", "nn"}, opSubstr},
+	{[]string{"c_str", "data"}, []string{""}, opData},
+	{[]string{"size", "length", "capacity"}, []string{""}, opSize},
+	{[]string{"empty"}, []string{""}, opEmpty},
+	{[]string{"operator[]", "at"}, []string{"n"}, opIndex},
+	{[]string{"front", "back"}, []string{""}, opEnd},
+	{[]string{"find", "rfind"}, []string{"pn", "pnn", "sn", "cn"}, opFind},
+	{[]string{"compare"}, []string{"p", "s", "nnp", "nns", "nnpn", "nnsnn"}, opCompare},
+	{[]string{"copy"}, []string{"wn", "wnn"}, opCopy},
+}
+
+// stringOperators lists the supported non-member operators.
+var stringOperators = []struct {
+	name  string
+	codes []string
+	op    stringOp
+}{
+	{"operator+", []string{"ss", "sp", "ps", "sc", "cs", "ms", "sm", "mm", "mp", "pm", "mc", "cm"}, opConcat},
+	{"operator==", []string{"ss", "sp", "ps"}, opEqual},
+	{"operator!=", []string{"ss", "sp", "ps"}, opEqual},
+}
+
+// stringOps maps "method(codes)" to its implementation, with members
+// prefixed by "string::".
+var stringOps = func() map[string]stringOp {
+	ops := make(map[string]stringOp)
+	for _, o := range stringOverloads {
+		for _, name := range o.names {
+			for _, codes := range o.codes {
+				ops["string::"+name+"("+codes+")"] = o.op
+			}
+		}
+	}
+	for _, o := range stringOperators {
+		for _, codes := range o.codes {
+			ops[o.name+"("+codes+")"] = o.op
+		}
+	}
+	return ops
+}()
+
+// stringNames reduces demangled libc++ and libstdc++ spellings to
+// "string", in order of precedence.
+var stringNames = strings.NewReplacer(
+	"std::__ndk1::basic_string<char, std::__ndk1::char_traits<char>, std::__ndk1::allocator<char> >", "string",
+	"std::basic_string<char, std::char_traits<char>, std::allocator<char> >", "string",
+	"std::string", "string",
+	"<char, std::__ndk1::char_traits<char>, std::__ndk1::allocator<char> >", "",
+	"<char, std::char_traits<char>, std::allocator<char> >", "",
+	"std::__ndk1::allocator<char>", "allocator",
+	"std::allocator<char>", "allocator",
+	"std::__ndk1::", "",
+	"std::", "",
+)
+
+// paramCodes maps reduced parameter types to their codes. Allocators map
+// to "".
+var paramCodes = map[string]string{
+	"char const*":      "p",
+	"unsigned long":    "n",
+	"string const&":    "s",
+	"string&":          "s",
+	"string":           "s",
+	"string&&":         "m",
+	"char":             "c",
+	"char*":            "w",
+	"allocator const&": "",
+}
+
+// stringHook identifies the std::string function behind a symbol.
+type stringHook struct {
+	layout *stringLayout
+	member bool
+	method string
+	codes  string
+	op     stringOp
+}
+
+// lookupStringHook matches a mangled symbol against the supported
+// std::string functions. The C++11 ABI string (std::__cxx11) has a third
+// layout and is left alone.
+func lookupStringHook(name string) (stringHook, bool) {
+	var h stringHook
+	if strings.Contains(name, "__cxx11") {
+		return h, false
+	}
+	demangled, err := emulator.Demangle(name)
+	if err != nil {
+		return h, false
+	}
+	switch {
+	case strings.Contains(demangled, "std::__ndk1::basic_string<char,"):
+		h.layout = libcxxString
+	case strings.Contains(demangled, "std::basic_string<char,"), strings.Contains(demangled, "std::string"):
+		h.layout = cowString
+	default:
+		return h, false
+	}
+
+	sig := strings.TrimSuffix(stringNames.Replace(demangled), " const")
+	if !strings.HasSuffix(sig, ")") {
+		return h, false
+	}
+	open := strings.LastIndexByte(sig, '(')
+	if open < 0 {
+		return h, false
+	}
+	head, params := sig[:open], sig[open+1:len(sig)-1]
+
+	if rest, ok := strings.CutPrefix(head, "string::"); ok {
+		h.member = true
+		h.method = rest
+		// basic_string<std::nullptr_t>(char const*)
+		if i := strings.IndexByte(rest, '<'); i > 0 && rest[:i] == "basic_string" {
+			h.method = rest[:i]
+		}
+	} else if i := strings.LastIndexByte(head, ' '); i >= 0 && strings.HasPrefix(head[i+1:], "operator") {
+		h.method = head[i+1:]
+	} else {
+		return h, false
+	}
+
+	if params != "" {
+		for _, p := range strings.Split(params, ", ") {
+			code, ok := paramCodes[p]
+			if !ok {
+				return h, false
+			}
+			h.codes += code
+		}
+	}
+
+	key := h.method + "(" + h.codes + ")"
+	if h.member {
+		key = "string::" + key
+	}
+	h.op = stringOps[key]
+	return h, h.op != nil
+}
+
+// hook returns the address hook that runs the matched function.
+func (h stringHook) hook() emulator.AddressHookFunc {
+	return func(emu *emulator.Emulator) bool {
+		c := &stringCall{emu: emu, layout: h.layout, method: h.method}
+		if h.member {
+			c.this = c.arg()
+		}
+		h.op(c, h.codes)
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+}
+
+// stringCall is one intercepted std::string call. Arguments are consumed
+// from X0 up: this first for members.
+type stringCall struct {
+	emu    *emulator.Emulator
+	layout *stringLayout
+	method string
+	this   uint64
+	next   int
+}
+
+func (c *stringCall) arg() uint64 {
+	v := c.emu.X(c.next)
+	c.next++
+	return v
+}
+
+func (c *stringCall) cstr() string {
+	s, _ := c.emu.MemReadString(c.arg(), maxCStrLen)
+	return s
+}
+
+func (c *stringCall) bytes(p, n uint64) string {
+	if n == 0 || n > maxStringLen {
+		return ""
+	}
+	data, err := c.emu.MemRead(p, n)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func (c *stringCall) str() string {
+	s, _ := c.layout.read(c.emu, c.arg())
+	return s
+}
+
+// source reads the characters an overload takes from its remaining
+// arguments: a C string, a buffer and count, a string (moved-from strings
+// are left empty), a string from pos for n, n copies of a char, or a char.
+func (c *stringCall) source(codes string) string {
+	switch codes {
+	case "p":
+		return c.cstr()
+	case "pn":
+		p := c.arg()
+		return c.bytes(p, c.arg())
+	case "s":
+		return c.str()
+	case "m":
+		addr := c.arg()
+		s, _ := c.layout.read(c.emu, addr)
+		c.layout.write(c.emu, addr, "")
+		return s
+	case "sn":
+		s := c.str()
+		return substr(s, c.arg(), npos)
+	case "snn":
+		s := c.str()
+		pos := c.arg()
+		return substr(s, pos, c.arg())
+	case "nc":
+		n := c.arg()
+		ch := byte(c.arg())
+		if n > maxStringLen {
+			n = 0
+		}
+		return strings.Repeat(string([]byte{ch}), int(n))
+	case "c":
+		return string([]byte{byte(c.arg())})
+	}
+	return ""
+}
+
+// get returns the current value of this.
+func (c *stringCall) get() string {
+	s, _ := c.layout.read(c.emu, c.this)
+	return s
+}
+
+// set stores a new value in this, tracks it, and returns this.
+// Constructors get a new string; other members reuse its buffer.
+func (c *stringCall) set(s string) {
+	switch c.method {
+	case "basic_string", "__init", "__init_copy_ctor_external":
+		c.layout.write(c.emu, c.this, s)
+	default:
+		c.layout.assign(c.emu, c.this, s)
+	}
+	trackString(c.this, s)
+	logString(c.method, s)
+	c.emu.SetX(0, c.this)
+}
+
+// result stores a string returned by value in the X8 buffer.
+func (c *stringCall) result(s string) {
+	dest := c.emu.X(8)
+	c.layout.write(c.emu, dest, s)
+	trackString(dest, s)
+	logString(c.method, s)
+	c.emu.SetX(0, dest)
+}
+
+func logString(method, s string) {
+	if method == "basic_string" {
+		method = "ctor"
+	}
+	if len(s) > 30 {
+		s = s[:30] + "..."
+	}
+	stubs.DefaultRegistry.Log("cxxabi", "string::"+method, "\""+s+"\"")
+}
+
+// substr returns s[pos:pos+n], clamped to s.
+func substr(s string, pos, n uint64) string {
+	size := uint64(len(s))
+	if pos > size {
+		return ""
+	}
+	if n > size-pos {
+		n = size - pos
+	}
+	return s[pos : pos+n]
+}
+
+func opAssign(c *stringCall, codes string) {
+	c.set(c.source(codes))
+}
+
+// opInit implements libc++'s __init(s, sz[, reserve]) and __init(n, c).
+func opInit(c *stringCall, codes string) {
+	if codes == "pnn" {
+		codes = "pn"
+	}
+	c.set(c.source(codes))
+}
+
+func opAppend(c *stringCall, codes string) {
+	cur := c.get()
+	c.set(cur + c.source(codes))
+}
+
+func opInsert(c *stringCall, codes string) {
+	pos := c.arg()
+	src := c.source(codes[1:])
+	cur := c.get()
+	if pos > uint64(len(cur)) {
+		pos = uint64(len(cur))
+	}
+	c.set(cur[:pos] + src + cur[pos:])
+}
+
+func opReplace(c *stringCall, codes string) {
+	pos := c.arg()
+	n := c.arg()
+	src := c.source(codes[2:])
+	cur := c.get()
+	if pos > uint64(len(cur)) {
+		pos = uint64(len(cur))
+	}
+	end := pos + uint64(len(substr(cur, pos, n)))
+	c.set(cur[:pos] + src + cur[end:])
+}
+
+func opErase(c *stringCall, codes string) {
+	pos, n := uint64(0), npos
+	if len(codes) > 0 {
+		pos = c.arg()
+	}
+	if len(codes) > 1 {
+		n = c.arg()
+	}
+	cur := c.get()
+	if pos > uint64(len(cur)) {
+		pos = uint64(len(cur))
+	}
+	end := pos + uint64(len(substr(cur, pos, n)))
+	c.set(cur[:pos] + cur[end:])
+}
+
+func opResize(c *stringCall, codes string) {
+	n := c.arg()
+	var ch byte
+	if codes == "nc" {
+		ch = byte(c.arg())
+	}
+	if n > maxStringLen {
+		return
+	}
+	cur := c.get()
+	if n <= uint64(len(cur)) {
+		c.set(cur[:n])
+		return
+	}
+	c.set(cur + strings.Repeat(string([]byte{ch}), int(n)-len(cur)))
+}
+
+func opClear(c *stringCall, codes string) {
+	c.layout.write(c.emu, c.this, "")
+}
+
+func opSwap(c *stringCall, codes string) {
+	other := c.arg()
+	a := c.get()
+	b, _ := c.layout.read(c.emu, other)
+	c.layout.write(c.emu, c.this, b)
+	c.layout.write(c.emu, other, a)
+}
+
+func opNop(c *stringCall, codes string) {}
+
+func opSubstr(c *stringCall, codes string) {
+	pos, n := uint64(0), npos
+	if len(codes) > 0 {
+		pos = c.arg()
+	}
+	if len(codes) > 1 {
+		n = c.arg()
+	}
+	c.result(substr(c.get(), pos, n))
+}
+
+func opData(c *stringCall, codes string) {
+	c.emu.SetX(0, c.layout.data(c.emu, c.this))
+}
+
+func opSize(c *stringCall, codes string) {
+	c.emu.SetX(0, uint64(len(c.get())))
+}
+
+func opEmpty(c *stringCall, codes string) {
+	if c.get() == "" {
+		c.emu.SetX(0, 1)
+	} else {
+		c.emu.SetX(0, 0)
+	}
+}
+
+func opIndex(c *stringCall, codes string) {
+	c.emu.SetX(0, c.layout.data(c.emu, c.this)+c.arg())
+}
+
+// opEnd implements front() and back().
+func opEnd(c *stringCall, codes string) {
+	p := c.layout.data(c.emu, c.this)
+	if n := len(c.get()); c.method == "back" && n > 0 {
+		p += uint64(n - 1)
+	}
+	c.emu.SetX(0, p)
+}
+
+// opFind implements find and rfind. The search position comes after the
+// needle, except for (s, pos, n).
+func opFind(c *stringCall, codes string) {
+	var needle string
+	var pos uint64
+	if codes == "pnn" {
+		p := c.arg()
+		pos = c.arg()
+		needle = c.bytes(p, c.arg())
+	} else {
+		needle = c.source(codes[:1])
+		pos = c.arg()
+	}
+
+	cur := c.get()
+	idx := -1
+	if c.method == "rfind" {
+		end := uint64(len(cur))
+		if pos < end && pos+uint64(len(needle)) < end {
+			end = pos + uint64(len(needle))
+		}
+		idx = strings.LastIndex(cur[:end], needle)
+	} else if pos <= uint64(len(cur)) {
+		if idx = strings.Index(cur[pos:], needle); idx >= 0 {
+			idx += int(pos)
+		}
+	}
+
+	if idx < 0 {
+		c.emu.SetX(0, npos)
+	} else {
+		c.emu.SetX(0, uint64(idx))
+	}
+}
+
+func opCompare(c *stringCall, codes string) {
+	cur := c.get()
+	if strings.HasPrefix(codes, "nn") {
+		pos := c.arg()
+		cur = substr(cur, pos, c.arg())
+		codes = codes[2:]
+	}
+	c.emu.SetX(0, uint64(int64(strings.Compare(cur, c.source(codes)))))
+}
+
+// opCopy implements copy(dest, n, pos), which does not terminate dest.
+func opCopy(c *stringCall, codes string) {
+	dest := c.arg()
+	n := c.arg()
+	pos := uint64(0)
+	if codes == "wnn" {
+		pos = c.arg()
+	}
+	s := substr(c.get(), pos, n)
+	c.emu.MemWrite(dest, []byte(s))
+	c.emu.SetX(0, uint64(len(s)))
+}
+
+// operand reads one operator argument. Strings passed as rvalues are only
+// read.
+func (c *stringCall) operand(code byte) string {
+	if code == 'm' {
+		code = 's'
+	}
+	return c.source(string(code))
+}
+
+func opConcat(c *stringCall, codes string) {
+	a := c.operand(codes[0])
+	b := c.operand(codes[1])
+	c.result(a + b)
+}
+
+func opEqual(c *stringCall, codes string) {
+	a := c.operand(codes[0])
+	b := c.operand(codes[1])
+	if (a == b) == (c.method == "operator==") {
+		c.emu.SetX(0, 1)
+	} else {
+		c.emu.SetX(0, 0)
+	}
+}
@@ -0,0 +1,173 @@
+package stubs
+
+import (
+	"sort"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// ScoreFunc returns a detector's confidence in [0, 1] for a match.
+type ScoreFunc func(m *DetectorMatch) float64
+
+// FingerprintFunc identifies the engine and version behind a match,
+// e.g. "cocos2d-x 3.17 lua". Returns "" if unknown.
+type FingerprintFunc func(emu *emulator.Emulator, symbols map[string]uint64) string
+
+// maxMatchSymbols limits how many symbols are kept per pattern in a DetectorMatch.
+const maxMatchSymbols = 5
+
+// DetectorMatch describes how a detector matched a binary and whether it fired.
+type DetectorMatch struct {
+	Name        string
+	Description string
+	Matched     map[string][]string // Pattern -> sample of matching symbols
+	Count       int                 // Total number of matching symbols
+	Missing     []string            // Required patterns with no match
+	Excluded    []string            // Excluded patterns that matched
+	Confidence  float64
+	Fingerprint string
+	Activated   bool
+	Hooks       int // Hooks installed by Activate
+}
+
+// PatternScore returns a ScoreFunc giving the fraction of patterns that
+// matched. Detectors without a Score use it with their own Patterns.
+func PatternScore(patterns []string) ScoreFunc {
+	return func(m *DetectorMatch) float64 {
+		if len(patterns) == 0 {
+			return 0
+		}
+		n := 0
+		for _, p := range patterns {
+			if len(m.Matched[p]) > 0 {
+				n++
+			}
+		}
+		return float64(n) / float64(len(patterns))
+	}
+}
+
+// sortedNames returns the symbol names in sorted order so that the symbols
+// sampled into a DetectorMatch are stable across runs.
+func sortedNames(symbols map[string]uint64) []string {
+	names := make([]string, 0, len(symbols))
+	for name := range symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// evaluate matches the detector against symbols without activating it.
+// names must be the sorted keys of symbols.
+func (d *Detector) evaluate(emu *emulator.Emulator, names []string, symbols map[string]uint64) DetectorMatch {
+	m := DetectorMatch{
+		Name:        d.Name,
+		Description: d.Description,
+		Matched:     make(map[string][]string),
+	}
+
+	required := make(map[string]bool)
+	excluded := make(map[string]bool)
+
+	for _, name := range names {
+		hit := false
+		for _, pattern := range d.Patterns {
+			if matchPattern(name, pattern) {
+				hit = true
+				if len(m.Matched[pattern]) < maxMatchSymbols {
+					m.Matched[pattern] = append(m.Matched[pattern], name)
+				}
+			}
+		}
+		if hit {
+			m.Count++
+		}
+		for _, pattern := range d.Required {
+			if !required[pattern] && matchPattern(name, pattern) {
+				required[pattern] = true
+			}
+		}
+		for _, pattern := range d.Excluded {
+			if !excluded[pattern] && matchPattern(name, pattern) {
+				excluded[pattern] = true
+				m.Excluded = append(m.Excluded, pattern)
+			}
+		}
+	}
+
+	for _, pattern := range d.Required {
+		if !required[pattern] {
+			m.Missing = append(m.Missing, pattern)
+		}
+	}
+
+	if m.Count == 0 {
+		return m
+	}
+
+	// Missing required or matched excluded patterns veto the detector
+	if len(m.Missing) > 0 || len(m.Excluded) > 0 {
+		return m
+	}
+
+	score := d.Score
+	if score == nil {
+		score = PatternScore(d.Patterns)
+	}
+	m.Confidence = score(&m)
+	if d.Fingerprint != nil {
+		m.Fingerprint = d.Fingerprint(emu, symbols)
+	}
+	return m
+}
+
+// eligible reports whether the match satisfies the detector's activation rules.
+func (m *DetectorMatch) eligible(d *Detector) bool {
+	return m.Count > 0 &&
+		len(m.Missing) == 0 &&
+		len(m.Excluded) == 0 &&
+		m.Confidence > 0 &&
+		m.Confidence >= d.MinConfidence
+}
+
+// Detect evaluates all detectors against symbols without activating them.
+// Returns matches with at least one matching pattern, highest confidence first.
+func (r *Registry) Detect(emu *emulator.Emulator, symbols map[string]uint64) []DetectorMatch {
+	r.detectorsMu.RLock()
+	defer r.detectorsMu.RUnlock()
+
+	names := sortedNames(symbols)
+	var result []DetectorMatch
+	for _, det := range r.detectors {
+		m := det.evaluate(emu, names, symbols)
+		if m.Count == 0 {
+			continue
+		}
+		m.Activated = m.eligible(det)
+		result = append(result, m)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Confidence > result[j].Confidence
+	})
+	return result
+}
+
+// Report returns the detector results from the last Install.
+func (r *Registry) Report() []DetectorMatch {
+	r.detectorsMu.RLock()
+	defer r.detectorsMu.RUnlock()
+	result := make([]DetectorMatch, len(r.report))
+	copy(result, r.report)
+	return result
+}
+
+// Detect evaluates the default registry's detectors without activating them.
+func Detect(emu *emulator.Emulator, symbols map[string]uint64) []DetectorMatch {
+	return DefaultRegistry.Detect(emu, symbols)
+}
+
+// Report returns the default registry's detector results from the last Install.
+func Report() []DetectorMatch {
+	return DefaultRegistry.Report()
+}
@@ -0,0 +1,91 @@
+package stubs
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+func TestDetectorActivationRules(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	activated := make(map[string]bool)
+	activate := func(name string) DetectorFunc {
+		return func(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
+			activated[name] = true
+			return 1
+		}
+	}
+
+	r := NewRegistry()
+	r.RegisterDetector(Detector{Name: "any", Patterns: []string{"foo", "bar"}, Activate: activate("any")})
+	r.RegisterDetector(Detector{Name: "required", Patterns: []string{"foo"}, Required: []string{"missing"}, Activate: activate("required")})
+	r.RegisterDetector(Detector{Name: "excluded", Patterns: []string{"foo"}, Excluded: []string{"baz"}, Activate: activate("excluded")})
+	r.RegisterDetector(Detector{Name: "threshold", Patterns: []string{"foo", "bar", "qux"}, MinConfidence: 0.5, Activate: activate("threshold")})
+	r.RegisterDetector(Detector{
+		Name:        "fingerprint",
+		Patterns:    []string{"foo"},
+		Score:       func(m *DetectorMatch) float64 { return 0.9 },
+		Fingerprint: func(emu *emulator.Emulator, symbols map[string]uint64) string { return "engine 1.0" },
+		Activate:    activate("fingerprint"),
+	})
+	r.RegisterDetector(Detector{Name: "none", Patterns: []string{"nomatch"}, Activate: activate("none")})
+
+	symbols := map[string]uint64{"foo_init": 0x1000, "baz": 0x2000}
+	r.Install(emu, nil, symbols)
+
+	want := map[string]bool{"any": true, "fingerprint": true}
+	for _, name := range []string{"any", "required", "excluded", "threshold", "fingerprint", "none"} {
+		if activated[name] != want[name] {
+			t.Errorf("detector %s activated=%v, want %v", name, activated[name], want[name])
+		}
+	}
+
+	report := r.Report()
+	if len(report) != 5 {
+		t.Fatalf("report has %d entries, want 5", len(report))
+	}
+	for _, m := range report {
+		switch m.Name {
+		case "any":
+			if m.Confidence != 0.5 {
+				t.Errorf("any confidence = %v, want 0.5", m.Confidence)
+			}
+			if len(m.Matched["foo"]) != 1 || m.Matched["foo"][0] != "foo_init" {
+				t.Errorf("any matched = %v", m.Matched)
+			}
+		case "required":
+			if len(m.Missing) != 1 {
+				t.Errorf("required missing = %v", m.Missing)
+			}
+		case "excluded":
+			if len(m.Excluded) != 1 {
+				t.Errorf("excluded = %v", m.Excluded)
+			}
+		case "fingerprint":
+			if m.Fingerprint != "engine 1.0" || m.Confidence != 0.9 || m.Hooks != 1 {
+				t.Errorf("fingerprint match = %+v", m)
+			}
+		}
+	}
+
+	// Installing again keeps one result per detector
+	r.Install(emu, nil, symbols)
+	if report := r.Report(); len(report) != 5 {
+		t.Errorf("report after second Install has %d entries, want 5", len(report))
+	}
+
+	// Detect evaluates without activating
+	activated = make(map[string]bool)
+	matches := r.Detect(emu, symbols)
+	if len(activated) != 0 {
+		t.Errorf("Detect activated detectors: %v", activated)
+	}
+	if len(matches) == 0 || matches[0].Name != "fingerprint" {
+		t.Errorf("Detect should sort by confidence, got %+v", matches)
+	}
+}
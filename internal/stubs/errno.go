@@ -0,0 +1,33 @@
+package stubs
+
+// errno values returned by stubs (Linux asm-generic/errno-base.h and errno.h,
+// which bionic uses on arm64).
+const (
+	EPERM        = 1
+	ENOENT       = 2
+	EINTR        = 4
+	EIO          = 5
+	EBADF        = 9
+	EAGAIN       = 11
+	ENOMEM       = 12
+	EACCES       = 13
+	EFAULT       = 14
+	EEXIST       = 17
+	ENOTDIR      = 20
+	EISDIR       = 21
+	EINVAL       = 22
+	EMFILE       = 24
+	ENOSPC       = 28
+	ESPIPE       = 29
+	EROFS        = 30
+	ERANGE       = 34
+	ENOSYS       = 38
+	EOVERFLOW    = 75
+	ENOTSOCK     = 88
+	EAFNOSUPPORT = 97
+	ENETUNREACH  = 101
+	ECONNRESET   = 104
+	ENOTCONN     = 107
+	ETIMEDOUT    = 110
+	ECONNREFUSED = 111
+)
@@ -4,34 +4,52 @@
 package internal
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/zboralski/galago/internal/emulator"
 	"github.com/zboralski/galago/internal/stubs"
+	"github.com/zboralski/galago/internal/stubs/cxxabi"
 )
 
 func init() {
 	// Register internal function detector
+	// Mocking replaces real functions, so a lone Lua pattern is not enough
 	stubs.RegisterDetector(stubs.Detector{
-		Name: "internal-mock",
-		Patterns: []string{
-			"lua_",
-			"luaL_",
-			"tolua_",
-			"getInstance",
-			"LuaEngine",
-			"LuaStack",
-			"ResourcesDecode",
-		},
-		Activate:    activateInternalMock,
-		Description: "Internal function mocking for Lua/cocos2d",
+		Name:          "internal-mock",
+		Patterns:      internalMockPatterns,
+		Score:         internalMockScore,
+		MinConfidence: 0.25,
+		Activate:      activateInternalMock,
+		Description:   "Internal function mocking for Lua/cocos2d",
 	})
 }
 
+var internalMockPatterns = []string{
+	"lua_",
+	"luaL_",
+	"tolua_",
+	"getInstance",
+	"LuaEngine",
+	"LuaStack",
+	"ResourcesDecode",
+}
+
+// internalMockScore gives low confidence when getInstance is the only match,
+// since singleton accessors appear in most C++ codebases.
+func internalMockScore(m *stubs.DetectorMatch) float64 {
+	if len(m.Matched) == 1 && len(m.Matched["getInstance"]) > 0 {
+		return 0.1
+	}
+	return stubs.PatternScore(internalMockPatterns)(m)
+}
+
 // activateInternalMock installs hooks for internal functions that need mocking.
 func activateInternalMock(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
 	installed := 0
+	values := make(map[valueSlot]uint64)
 
 	for name, addr := range symbols {
 		if addr == 0 {
@@ -45,7 +63,7 @@ func activateInternalMock(emu *emulator.Emulator, imports, symbols map[string]ui
 
 		if shouldMockInternal(name) {
 			behavior := inferReturnBehavior(name)
-			emu.HookAddress(addr, makeMockHook(name, behavior))
+			emu.HookAddress(addr, makeMockHook(name, behavior, values))
 			installed++
 			// Debug log for RTTI functions
 			if stubs.Debug && strings.Contains(strings.ToLower(name), "__do_") {
@@ -310,11 +328,15 @@ func inferReturnBehavior(name string) string {
 	}
 
 	// VALUE_REF: cocos2d::Value& returning functions (map operators)
-	if (strings.Contains(lower, "_map_base") || strings.Contains(lower, "valuemap")) &&
-		strings.Contains(lower, "value") {
+	if strings.Contains(lower, "_map_base") && strings.Contains(lower, "value") {
 		return "value_ref"
 	}
 
+	// VALUE_MAP: getValueMap returns a cocos2d::ValueMap by value (use x8 convention)
+	if strings.Contains(lower, "getvaluemap") {
+		return "value_map"
+	}
+
 	// STRING: Functions that return std::string by value (use x8 convention)
 	stringPatterns := []string{
 		"getpath", "getstring", "getname", "tostring", "getwritable",
@@ -378,8 +400,45 @@ func inferReturnBehavior(name string) string {
 	return "object"
 }
 
-// makeMockHook creates a hook that mocks an internal function.
-func makeMockHook(name, behavior string) func(*emulator.Emulator) bool {
+// valueSlot is the key of one element returned by a mocked map operator[].
+type valueSlot struct {
+	this uint64
+	key  string
+}
+
+// keyReader returns the std::string reader for the library name was built
+// against: libc++ (__ndk1), libstdc++ C++11 ABI, or libstdc++ COW.
+func keyReader(name string) func(*emulator.Emulator, uint64) (string, bool) {
+	switch {
+	case strings.Contains(name, "__ndk1"):
+		return cxxabi.ReadSSOString
+	case strings.Contains(name, "cxx11"):
+		return cxxabi.ReadCXX11String
+	}
+	return cxxabi.ReadCOWString
+}
+
+// emptyValueMap returns an empty std::unordered_map for the library name
+// was built against. libstdc++ points its buckets at the single bucket
+// stored inline at +48.
+func emptyValueMap(name string, addr uint64) []byte {
+	if strings.Contains(name, "__ndk1") {
+		m := make([]byte, 40)
+		binary.LittleEndian.PutUint32(m[32:], math.Float32bits(1)) // max_load_factor
+		return m
+	}
+	m := make([]byte, 56)
+	binary.LittleEndian.PutUint64(m[0:], addr+48) // _M_buckets = &_M_single_bucket
+	binary.LittleEndian.PutUint64(m[8:], 1)       // _M_bucket_count
+	binary.LittleEndian.PutUint32(m[32:], math.Float32bits(1))
+	return m
+}
+
+// makeMockHook creates a hook that mocks an internal function. values
+// holds the Value slots handed out by map operators, shared by all hooks
+// of one activation.
+func makeMockHook(name, behavior string, values map[valueSlot]uint64) func(*emulator.Emulator) bool {
+	readKey := keyReader(name)
 	return func(emu *emulator.Emulator) bool {
 		if stubs.Debug && strings.Contains(strings.ToLower(name), "_map_base") {
 			stubs.DefaultRegistry.Log("internal", "map_base_HOOK", fmt.Sprintf("Hook fired for %s, behavior=%s, PC=0x%x, LR=0x%x", name, behavior, emu.PC(), emu.LR()))
@@ -392,19 +451,29 @@ func makeMockHook(name, behavior string) func(*emulator.Emulator) bool {
 			// Object getters return mock object pointer
 			emu.SetX(0, emu.GetMockObject())
 		case "value_ref":
-			// Value& returns pointer to mock value object
+			// Value& operator[](key) returns the map's element for the key
 			// cocos2d::Value layout (ARM64):
 			//   offset 0: union _field (8 bytes) - actual value data
 			//   offset 8: Type _type (4 bytes) - enum {NONE=0, BYTE, INT, UINT, FLOAT, DOUBLE, BOOLEAN, STRING=7, ...}
-			// We initialize type to NONE (0) to avoid RTTI paths in asString() etc.
-			valuePtr := emu.GetMockObject() + 0x100
-			// Initialize the entire Value struct to zeros (type=NONE, field=0)
-			emu.MemWrite(valuePtr, []byte{
-				0, 0, 0, 0, 0, 0, 0, 0, // _field union (8 bytes)
-				0, 0, 0, 0, // _type = NONE (0)
-				0, 0, 0, 0, // padding
-			})
+			// Each map and key gets its own slot, zeroed on first use (type=NONE)
+			// to avoid RTTI paths in asString() etc.
+			key, _ := readKey(emu, emu.X(1))
+			slot := valueSlot{emu.X(0), key}
+			valuePtr, ok := values[slot]
+			if !ok {
+				valuePtr = emu.Malloc(16)
+				emu.MemWrite(valuePtr, make([]byte, 16))
+				values[slot] = valuePtr
+			}
 			emu.SetX(0, valuePtr)
+		case "value_map":
+			// ValueMap-returning functions use x8 for the return value pointer
+			// Write an empty std::unordered_map there
+			x8 := emu.X(8)
+			if x8 > 0x1000 && x8 < 0x7000000000000000 {
+				emu.MemWrite(x8, emptyValueMap(name, x8))
+			}
+			emu.SetX(0, x8)
 		case "bool":
 			// Boolean functions return true (1)
 			emu.SetX(0, 1)
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+func TestInternalMockActivation(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	tests := []struct {
+		symbols []string
+		want    bool
+	}{
+		{[]string{"_ZN7cocos2d8Director11getInstanceEv", "_ZN3app6Config11getInstanceEv"}, false},
+		{[]string{"lua_pushnil"}, false},
+		{[]string{"lua_pushnil", "luaL_checkstack"}, true},
+		{[]string{"_ZN7cocos2d9LuaEngine11getInstanceEv"}, true},
+	}
+	for _, tt := range tests {
+		symbols := make(map[string]uint64)
+		for i, name := range tt.symbols {
+			symbols[name] = emulator.CodeBase + uint64(i)*0x100
+		}
+		activated := false
+		for _, m := range stubs.Detect(emu, symbols) {
+			if m.Name == "internal-mock" {
+				activated = m.Activated
+			}
+		}
+		if activated != tt.want {
+			t.Errorf("%v: internal-mock activated=%v, want %v", tt.symbols, activated, tt.want)
+		}
+	}
+}
+
+func TestValueMapMocks(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	const (
+		// cocos2d::Value& std::unordered_map<std::string, cocos2d::Value>::operator[](std::string const&)
+		mapBase = "_ZNSt8__detail9_Map_baseINSt7__cxx1112basic_stringIcSt11char_traitsIcESaIcEEESt4pairIKS6_N7cocos2d5ValueEESaISB_ENS_10_Select1stESt8equal_toIS6_ESt4hashIS6_ENS_18_Mod_range_hashingENS_20_Default_ranged_hashENS_20_Prime_rehash_policyENS_17_Hashtable_traitsILb1ELb0ELb1EEELb1EEixERS8_"
+		// cocos2d::ValueMap cocos2d::FileUtils::getValueMapFromFile(std::string const&)
+		getValueMap    = "_ZN7cocos2d9FileUtils19getValueMapFromFileERKNSt7__cxx1112basic_stringIcSt11char_traitsIcESaIcEEE"
+		getValueMapNDK = "_ZN7cocos2d9FileUtils19getValueMapFromFileERKNSt6__ndk112basic_stringIcNS1_11char_traitsIcEENS1_9allocatorIcEEEE"
+	)
+	for name, want := range map[string]string{mapBase: "value_ref", getValueMap: "value_map", getValueMapNDK: "value_map"} {
+		if got := inferReturnBehavior(name); got != want {
+			t.Errorf("inferReturnBehavior(%s) = %s, want %s", name, got, want)
+		}
+	}
+
+	// Each map and key gets its own Value
+	values := make(map[valueSlot]uint64)
+	hook := makeMockHook(mapBase, "value_ref", values)
+	key := func(s string) uint64 {
+		p := emu.Malloc(32)
+		data := emu.Malloc(16)
+		emu.MemWrite(data, []byte(s))
+		emu.MemWriteU64(p, data)
+		emu.MemWriteU64(p+8, uint64(len(s)))
+		return p
+	}
+	lookup := func(this, key uint64) uint64 {
+		emu.SetX(0, this)
+		emu.SetX(1, key)
+		hook(emu)
+		return emu.X(0)
+	}
+	m1, m2 := emu.Malloc(56), emu.Malloc(56)
+	a := lookup(m1, key("a"))
+	if b := lookup(m1, key("b")); b == a {
+		t.Errorf("keys a and b share Value 0x%x", a)
+	}
+	if again := lookup(m1, key("a")); again != a {
+		t.Errorf("key a = 0x%x, then 0x%x", a, again)
+	}
+	if other := lookup(m2, key("a")); other == a {
+		t.Errorf("two maps share Value 0x%x for key a", a)
+	}
+
+	tests := []struct {
+		name string
+		want []byte
+	}{
+		{getValueMapNDK, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x80, 0x3f, 0, 0, 0, 0}},
+		{getValueMap, nil},
+	}
+	for _, tt := range tests {
+		ret := emu.Malloc(64)
+		emu.SetX(8, ret)
+		makeMockHook(tt.name, "value_map", values)(emu)
+		if emu.X(0) != ret {
+			t.Errorf("%s returned 0x%x, want X8 0x%x", tt.name, emu.X(0), ret)
+		}
+		if tt.want == nil {
+			// libstdc++: _M_buckets = &_M_single_bucket, _M_bucket_count = 1
+			tt.want = make([]byte, 56)
+			binary.LittleEndian.PutUint64(tt.want, ret+48)
+			tt.want[8] = 1
+			tt.want[34], tt.want[35] = 0x80, 0x3f
+		}
+		got, _ := emu.MemRead(ret, uint64(len(tt.want)))
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s wrote %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
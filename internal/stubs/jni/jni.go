@@ -20,19 +20,33 @@ var (
 func init() {
 	// Register JNI as a detector - activates when JNI symbols are found
 	stubs.RegisterDetector(stubs.Detector{
-		Name: "jni",
-		Patterns: []string{
-			"JNI_OnLoad",
-			"_JNIEnv",
-			"JavaVM",
-			"GetEnv",
-			"AttachCurrentThread",
-		},
-		Activate:    activateJNI,
-		Description: "JNI/JavaVM mock implementation",
+		Name:          "jni",
+		Patterns:      jniPatterns,
+		Score:         jniScore,
+		MinConfidence: 0.5,
+		Activate:      activateJNI,
+		Description:   "JNI/JavaVM mock implementation",
 	})
 }
 
+var jniPatterns = []string{
+	"JNI_OnLoad",
+	"_JNIEnv",
+	"JavaVM",
+	"GetEnv",
+	"AttachCurrentThread",
+	"Java_*",
+}
+
+// jniScore is certain for a JNI entry point. Without one, GetEnv and
+// JavaVM also name unrelated functions, so half the patterns must match.
+func jniScore(m *stubs.DetectorMatch) float64 {
+	if len(m.Matched["JNI_OnLoad"]) > 0 || len(m.Matched["Java_*"]) > 0 {
+		return 1
+	}
+	return stubs.PatternScore(jniPatterns)(m)
+}
+
 // activateJNI sets up JNI vtables when JNI symbols are detected.
 func activateJNI(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
 	currentEnvMu.Lock()
@@ -128,6 +142,8 @@ const (
 	JNI_CallFloatMethod       = 55
 	JNI_CallDoubleMethod      = 58
 	JNI_CallVoidMethod        = 61
+	JNI_CallNonvirtualObjectMethod = 64
+	JNI_CallNonvirtualVoidMethod = 91
 	JNI_GetFieldID            = 94
 	JNI_GetObjectField        = 95
 	JNI_GetBooleanField       = 96
@@ -280,18 +296,36 @@ type Env struct {
 
 	// Class references
 	classRefs    map[string]uint64
+	classNames   map[uint64]string
 	classRefsMu  sync.RWMutex
 	nextClassRef uint64
 
 	// Method references
 	methodRefs   map[string]uint64
+	methodIDs    map[uint64]*memberRef
 	methodRefsMu sync.RWMutex
 	nextMethodRef uint64
 
 	// Field references
 	fieldRefs   map[string]uint64
+	fieldIDs    map[uint64]*memberRef
 	fieldRefsMu sync.RWMutex
 	nextFieldRef uint64
+
+	// Fields the guest set, over the model's values, which are shared
+	// between runs
+	fieldWrites   map[fieldKey]Value
+	fieldWritesMu sync.RWMutex
+
+	// Model object handles
+	objects       map[uint64]*Object
+	objectRefs    map[*Object]uint64
+	objectsMu     sync.RWMutex
+	nextObjectRef uint64
+
+	// RegisterNatives tables
+	natives   []NativeMethod
+	nativesMu sync.Mutex
 }
 
 // NewEnv creates a new JNI environment.
@@ -300,8 +334,14 @@ func NewEnv(emu *emulator.Emulator) *Env {
 		emu:           emu,
 		jniStrings:    make(map[uint64]string),
 		classRefs:     make(map[string]uint64),
+		classNames:    make(map[uint64]string),
 		methodRefs:    make(map[string]uint64),
+		methodIDs:     make(map[uint64]*memberRef),
 		fieldRefs:     make(map[string]uint64),
+		fieldIDs:      make(map[uint64]*memberRef),
+		fieldWrites:   make(map[fieldKey]Value),
+		objects:       make(map[uint64]*Object),
+		objectRefs:    make(map[*Object]uint64),
 		nextStringRef: 0x1000,
 		nextClassRef:  0x2000,
 		nextMethodRef: 0x3000,
@@ -350,6 +390,11 @@ func (e *Env) Install() (jniEnv, javaVM uint64) {
 }
 
 func (e *Env) installJNIHandler(index int, stubAddr uint64) {
+	if h := e.modelHandler(index); h != nil {
+		e.emu.HookAddress(stubAddr, h)
+		return
+	}
+
 	switch index {
 	case JNI_GetVersion:
 		e.emu.HookAddress(stubAddr, e.stubGetVersion)
@@ -371,24 +416,10 @@ func (e *Env) installJNIHandler(index int, stubAddr uint64) {
 		e.emu.HookAddress(stubAddr, e.stubGetStringUTFLength)
 	case JNI_GetJavaVM:
 		e.emu.HookAddress(stubAddr, e.stubGetJavaVM)
-	case JNI_CallObjectMethod, JNI_CallBooleanMethod, JNI_CallIntMethod, JNI_CallLongMethod:
-		e.emu.HookAddress(stubAddr, e.stubCallMethod)
-	case JNI_CallStaticObjectMethod, JNI_CallStaticBooleanMethod, JNI_CallStaticIntMethod, JNI_CallStaticLongMethod:
-		e.emu.HookAddress(stubAddr, e.stubCallStaticMethod)
-	case JNI_CallVoidMethod:
-		e.emu.HookAddress(stubAddr, e.stubCallVoidMethod)
-	case JNI_CallStaticVoidMethod:
-		e.emu.HookAddress(stubAddr, e.stubCallStaticVoidMethod)
 	case JNI_GetFieldID:
 		e.emu.HookAddress(stubAddr, e.stubGetFieldID)
 	case JNI_GetStaticFieldID:
 		e.emu.HookAddress(stubAddr, e.stubGetStaticFieldID)
-	case JNI_GetObjectField, JNI_GetIntField, JNI_GetLongField, JNI_GetBooleanField:
-		e.emu.HookAddress(stubAddr, e.stubGetField)
-	case JNI_GetStaticObjectField, JNI_GetStaticIntField, JNI_GetStaticLongField, JNI_GetStaticBooleanField:
-		e.emu.HookAddress(stubAddr, e.stubGetStaticField)
-	case JNI_SetObjectField, JNI_SetIntField, JNI_SetLongField, JNI_SetBooleanField:
-		e.emu.HookAddress(stubAddr, e.stubSetField)
 	case JNI_NewGlobalRef, JNI_NewLocalRef, JNI_NewWeakGlobalRef:
 		e.emu.HookAddress(stubAddr, e.stubNewRef)
 	case JNI_DeleteGlobalRef, JNI_DeleteLocalRef, JNI_DeleteWeakGlobalRef:
@@ -405,12 +436,6 @@ func (e *Env) installJNIHandler(index int, stubAddr uint64) {
 		e.emu.HookAddress(stubAddr, e.stubPopLocalFrame)
 	case JNI_EnsureLocalCapacity:
 		e.emu.HookAddress(stubAddr, e.stubEnsureLocalCapacity)
-	case JNI_NewByteArray:
-		e.emu.HookAddress(stubAddr, e.stubNewByteArray)
-	case JNI_GetByteArrayElements:
-		e.emu.HookAddress(stubAddr, e.stubGetByteArrayElements)
-	case JNI_ReleaseByteArrayElements:
-		e.emu.HookAddress(stubAddr, e.stubReleaseByteArrayElements)
 	case JNI_GetArrayLength:
 		e.emu.HookAddress(stubAddr, e.stubGetArrayLength)
 	case JNI_RegisterNatives:
@@ -470,14 +495,7 @@ func (e *Env) stubFindClass(emu *emulator.Emulator) bool {
 	namePtr := emu.X(1)
 	className, _ := emu.MemReadString(namePtr, 256)
 
-	e.classRefsMu.Lock()
-	ref, ok := e.classRefs[className]
-	if !ok {
-		ref = e.mockObjBase + e.nextClassRef
-		e.classRefs[className] = ref
-		e.nextClassRef += 8
-	}
-	e.classRefsMu.Unlock()
+	ref := e.classRef(className)
 
 	stubs.DefaultRegistry.Log("jni", "FindClass", className)
 	emu.SetX(0, ref)
@@ -491,14 +509,9 @@ func (e *Env) stubGetMethodID(emu *emulator.Emulator) bool {
 	methodName, _ := emu.MemReadString(namePtr, 256)
 	methodSig, _ := emu.MemReadString(sigPtr, 256)
 
-	key := methodName + methodSig
+	m := &memberRef{Class: e.className(emu.X(1)), Name: methodName, Sig: methodSig}
 	e.methodRefsMu.Lock()
-	ref, ok := e.methodRefs[key]
-	if !ok {
-		ref = e.mockObjBase + 0x10000 + e.nextMethodRef
-		e.methodRefs[key] = ref
-		e.nextMethodRef += 8
-	}
+	ref := e.memberID(e.methodRefs, e.methodIDs, &e.nextMethodRef, 0x10000, m)
 	e.methodRefsMu.Unlock()
 
 	stubs.DefaultRegistry.Log("jni", "GetMethodID", methodName+methodSig)
@@ -513,14 +526,9 @@ func (e *Env) stubGetStaticMethodID(emu *emulator.Emulator) bool {
 	methodName, _ := emu.MemReadString(namePtr, 256)
 	methodSig, _ := emu.MemReadString(sigPtr, 256)
 
-	key := "static:" + methodName + methodSig
+	m := &memberRef{Class: e.className(emu.X(1)), Name: methodName, Sig: methodSig, Static: true}
 	e.methodRefsMu.Lock()
-	ref, ok := e.methodRefs[key]
-	if !ok {
-		ref = e.mockObjBase + 0x20000 + e.nextMethodRef
-		e.methodRefs[key] = ref
-		e.nextMethodRef += 8
-	}
+	ref := e.memberID(e.methodRefs, e.methodIDs, &e.nextMethodRef, 0x20000, m)
 	e.methodRefsMu.Unlock()
 
 	stubs.DefaultRegistry.Log("jni", "GetStaticMethodID", methodName+methodSig)
@@ -530,7 +538,18 @@ func (e *Env) stubGetStaticMethodID(emu *emulator.Emulator) bool {
 }
 
 func (e *Env) stubGetObjectClass(emu *emulator.Emulator) bool {
+	obj := emu.X(1)
 	classRef := e.mockObjBase + 0x30000
+	if o := e.Object(obj); o != nil {
+		classRef = e.classRef(o.Class)
+	} else {
+		e.jniStringsMu.RLock()
+		_, isString := e.jniStrings[obj]
+		e.jniStringsMu.RUnlock()
+		if isString {
+			classRef = e.classRef("java/lang/String")
+		}
+	}
 	emu.SetX(0, classRef)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -540,11 +559,7 @@ func (e *Env) stubNewStringUTF(emu *emulator.Emulator) bool {
 	utfPtr := emu.X(1)
 	str, _ := emu.MemReadString(utfPtr, 4096)
 
-	e.jniStringsMu.Lock()
-	ref := e.mockObjBase + e.nextStringRef
-	e.jniStrings[ref] = str
-	e.nextStringRef += 8
-	e.jniStringsMu.Unlock()
+	ref := e.newString(str)
 
 	truncated := str
 	if len(truncated) > 40 {
@@ -602,44 +617,15 @@ func (e *Env) stubGetJavaVM(emu *emulator.Emulator) bool {
 	return false
 }
 
-func (e *Env) stubCallMethod(emu *emulator.Emulator) bool {
-	result := e.mockObjBase + 0x40000
-	emu.SetX(0, result)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-func (e *Env) stubCallStaticMethod(emu *emulator.Emulator) bool {
-	result := e.mockObjBase + 0x50000
-	emu.SetX(0, result)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-func (e *Env) stubCallVoidMethod(emu *emulator.Emulator) bool {
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-func (e *Env) stubCallStaticVoidMethod(emu *emulator.Emulator) bool {
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
 func (e *Env) stubGetFieldID(emu *emulator.Emulator) bool {
 	namePtr := emu.X(2)
 	sigPtr := emu.X(3)
 	fieldName, _ := emu.MemReadString(namePtr, 256)
 	fieldSig, _ := emu.MemReadString(sigPtr, 256)
 
-	key := fieldName + fieldSig
+	f := &memberRef{Class: e.className(emu.X(1)), Name: fieldName, Sig: fieldSig}
 	e.fieldRefsMu.Lock()
-	ref, ok := e.fieldRefs[key]
-	if !ok {
-		ref = e.mockObjBase + 0x60000 + e.nextFieldRef
-		e.fieldRefs[key] = ref
-		e.nextFieldRef += 8
-	}
+	ref := e.memberID(e.fieldRefs, e.fieldIDs, &e.nextFieldRef, 0x60000, f)
 	e.fieldRefsMu.Unlock()
 
 	stubs.DefaultRegistry.Log("jni", "GetFieldID", fieldName)
@@ -654,14 +640,9 @@ func (e *Env) stubGetStaticFieldID(emu *emulator.Emulator) bool {
 	fieldName, _ := emu.MemReadString(namePtr, 256)
 	fieldSig, _ := emu.MemReadString(sigPtr, 256)
 
-	key := "static:" + fieldName + fieldSig
+	f := &memberRef{Class: e.className(emu.X(1)), Name: fieldName, Sig: fieldSig, Static: true}
 	e.fieldRefsMu.Lock()
-	ref, ok := e.fieldRefs[key]
-	if !ok {
-		ref = e.mockObjBase + 0x70000 + e.nextFieldRef
-		e.fieldRefs[key] = ref
-		e.nextFieldRef += 8
-	}
+	ref := e.memberID(e.fieldRefs, e.fieldIDs, &e.nextFieldRef, 0x70000, f)
 	e.fieldRefsMu.Unlock()
 
 	stubs.DefaultRegistry.Log("jni", "GetStaticFieldID", fieldName)
@@ -670,23 +651,6 @@ func (e *Env) stubGetStaticFieldID(emu *emulator.Emulator) bool {
 	return false
 }
 
-func (e *Env) stubGetField(emu *emulator.Emulator) bool {
-	emu.SetX(0, 0)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-func (e *Env) stubGetStaticField(emu *emulator.Emulator) bool {
-	emu.SetX(0, 0)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-func (e *Env) stubSetField(emu *emulator.Emulator) bool {
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
 func (e *Env) stubNewRef(emu *emulator.Emulator) bool {
 	obj := emu.X(1)
 	emu.SetX(0, obj)
@@ -735,34 +699,6 @@ func (e *Env) stubEnsureLocalCapacity(emu *emulator.Emulator) bool {
 	return false
 }
 
-func (e *Env) stubNewByteArray(emu *emulator.Emulator) bool {
-	length := emu.X(1)
-	arr := emu.Malloc(length + 16) // Extra for array header
-	emu.MemWriteU64(arr, length)    // Store length at start
-	emu.SetX(0, arr)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-func (e *Env) stubGetByteArrayElements(emu *emulator.Emulator) bool {
-	arr := emu.X(1)
-	isCopyPtr := emu.X(2)
-
-	if isCopyPtr != 0 {
-		emu.MemWriteU8(isCopyPtr, 0)
-	}
-
-	// Return pointer past length header
-	emu.SetX(0, arr+8)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
-func (e *Env) stubReleaseByteArrayElements(emu *emulator.Emulator) bool {
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
 func (e *Env) stubGetArrayLength(emu *emulator.Emulator) bool {
 	arr := emu.X(1)
 	length, _ := emu.MemReadU64(arr)
@@ -771,13 +707,6 @@ func (e *Env) stubGetArrayLength(emu *emulator.Emulator) bool {
 	return false
 }
 
-func (e *Env) stubRegisterNatives(emu *emulator.Emulator) bool {
-	stubs.DefaultRegistry.Log("jni", "RegisterNatives", "")
-	emu.SetX(0, JNI_OK)
-	stubs.ReturnFromStub(emu)
-	return false
-}
-
 func (e *Env) stubMonitor(emu *emulator.Emulator) bool {
 	emu.SetX(0, JNI_OK)
 	stubs.ReturnFromStub(emu)
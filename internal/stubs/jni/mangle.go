@@ -0,0 +1,152 @@
+package jni
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Export is a native method bound by name rather than through
+// RegisterNatives: an exported Java_<class>_<method>[__<params>] function.
+// Signature holds only the parameter list, e.g. "([BI)", and only for
+// overloaded names; the return type is never part of the mangled name.
+type Export struct {
+	NativeMethod
+	Symbol string `json:"symbol"`
+}
+
+// Exports returns the Java_* functions among symbols, sorted by class and
+// method.
+func Exports(symbols map[string]uint64) []Export {
+	var out []Export
+	for sym, addr := range symbols {
+		if addr == 0 {
+			continue
+		}
+		class, name, params, err := DecodeExportName(sym)
+		if err != nil {
+			continue
+		}
+		out = append(out, Export{
+			NativeMethod: NativeMethod{Class: class, Name: name, Signature: params, Fn: addr},
+			Symbol:       sym,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Class != out[j].Class {
+			return out[i].Class < out[j].Class
+		}
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Signature < out[j].Signature
+	})
+	return out
+}
+
+// DecodeExportName reverses the JNI short and long name mangling:
+// Java_com_example_Native_decrypt___3BI becomes com/example/Native,
+// decrypt, and "([BI)". A bare _ separates package components, _1 is _,
+// _2 is ;, _3 is [, and _0xxxx is a UTF-16 code unit. params is empty
+// for short names.
+func DecodeExportName(sym string) (class, name, params string, err error) {
+	mangled, ok := strings.CutPrefix(sym, "Java_")
+	if !ok {
+		return "", "", "", fmt.Errorf("%s: not a Java_ export", sym)
+	}
+
+	// "__" starts the parameter list unless its second _ opens a _0, _1,
+	// or _2 escape, which no type descriptor starts with.
+	method, args, overloaded := mangled, "", false
+	for i := 0; i+1 < len(mangled); i++ {
+		if mangled[i] != '_' {
+			continue
+		}
+		next := mangled[i+1]
+		if next >= '0' && next <= '3' {
+			i++
+			continue
+		}
+		if next == '_' && (i+2 == len(mangled) || !strings.ContainsRune("012", rune(mangled[i+2]))) {
+			method, args, overloaded = mangled[:i], mangled[i+2:], true
+			break
+		}
+	}
+
+	parts, err := unmangle(method)
+	if err != nil {
+		return "", "", "", fmt.Errorf("%s: %w", sym, err)
+	}
+	if len(parts) < 2 {
+		return "", "", "", fmt.Errorf("%s: missing class or method", sym)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return "", "", "", fmt.Errorf("%s: empty name component", sym)
+		}
+	}
+	class = strings.Join(parts[:len(parts)-1], "/")
+	name = parts[len(parts)-1]
+
+	if overloaded {
+		types, err := unmangle(args)
+		if err != nil {
+			return "", "", "", fmt.Errorf("%s: %w", sym, err)
+		}
+		params = "(" + strings.Join(types, "/") + ")"
+		if _, _, err := ParseSignature(params + "V"); err != nil {
+			return "", "", "", fmt.Errorf("%s: %w", sym, err)
+		}
+	}
+	return class, name, params, nil
+}
+
+// unmangle decodes the escapes in a mangled name and splits it at each
+// bare _.
+func unmangle(s string) ([]string, error) {
+	var parts []string
+	var cur []uint16
+	flush := func() {
+		parts = append(parts, string(utf16.Decode(cur)))
+		cur = cur[:0]
+	}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' {
+			cur = append(cur, uint16(c))
+			continue
+		}
+		if i+1 == len(s) {
+			flush()
+			continue
+		}
+		switch s[i+1] {
+		case '0':
+			if i+6 > len(s) {
+				return nil, fmt.Errorf("short _0 escape at %q", s[i:])
+			}
+			u, err := strconv.ParseUint(s[i+2:i+6], 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("bad _0 escape %q", s[i:i+6])
+			}
+			cur = append(cur, uint16(u))
+			i += 5
+		case '1':
+			cur = append(cur, '_')
+			i++
+		case '2':
+			cur = append(cur, ';')
+			i++
+		case '3':
+			cur = append(cur, '[')
+			i++
+		default:
+			flush()
+		}
+	}
+	flush()
+	return parts, nil
+}
@@ -0,0 +1,605 @@
+package jni
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Java object model.
+//
+// Native code reaches into Java through JNI: it looks up a class, a method
+// or field ID by name and signature, then calls or reads it. The model lets
+// a user declare just the classes, methods and fields a target touches,
+// with the values they produce, in a YAML file:
+//
+//	objects:
+//	  pm:
+//	    class: android/content/pm/PackageManager
+//	  sig0:
+//	    class: android/content/pm/Signature
+//	    methods:
+//	      toByteArray()[B: base64:MIIB...
+//	classes:
+//	  android/content/Context:
+//	    methods:
+//	      - name: getPackageName
+//	        sig: ()Ljava/lang/String;
+//	        return: com.example.game
+//	      - name: getPackageManager
+//	        sig: ()Landroid/content/pm/PackageManager;
+//	        return: "@pm"
+//	  com/example/Config:
+//	    fields:
+//	      - name: KEY
+//	        sig: "[B"
+//	        static: true
+//	        value: hex:00112233
+//
+// Values are decoded according to the member's JNI signature: strings for
+// Ljava/lang/String;, byte arrays for [B (hex:, base64: or raw UTF-8, or a
+// list of ints), integers and booleans for primitives, and "@name" or an
+// inline {class, fields} mapping for other object types.
+
+// Value is a Java value held by the model. Concrete types are nil, bool,
+// int64, float64, string (java.lang.String), []byte (byte[]), *Array
+// (other primitive arrays), []Value (object arrays), *Object, and Handle.
+type Value interface{}
+
+// Handle is an opaque jobject the model does not know, kept as-is so it
+// can be handed back to native code unchanged.
+type Handle uint64
+
+// Array is a primitive array other than byte[]. Data holds the elements in
+// guest (little-endian) layout.
+type Array struct {
+	Elem byte // JNI type char: Z, C, S, I, J, F, D
+	Data []byte
+}
+
+// Len returns the number of elements.
+func (a *Array) Len() int {
+	return len(a.Data) / elemSize(a.Elem)
+}
+
+// Object is a Java object instance.
+type Object struct {
+	Class   string
+	Fields  map[string]Value // Instance field values by name
+	Methods map[string]Value // Per-instance results by name+sig, overriding the class
+}
+
+// Member is a method or field declaration with the value it produces.
+type Member struct {
+	Name   string
+	Sig    string
+	Static bool
+	Value  Value // Method return value or field value
+}
+
+// Class is a modelled Java class.
+type Class struct {
+	Name    string
+	Super   string
+	Methods map[string]*Member // Keyed by name+sig, e.g. "getPackageName()Ljava/lang/String;"
+	Fields  map[string]*Member // Keyed by name:sig, e.g. "KEY:[B"
+}
+
+// Model is a set of Java classes and named objects.
+type Model struct {
+	Classes map[string]*Class
+	Objects map[string]*Object
+}
+
+// NewModel returns an empty model.
+func NewModel() *Model {
+	return &Model{
+		Classes: make(map[string]*Class),
+		Objects: make(map[string]*Object),
+	}
+}
+
+// Class returns the named class, creating it if needed.
+func (m *Model) Class(name string) *Class {
+	c, ok := m.Classes[name]
+	if !ok {
+		c = &Class{
+			Name:    name,
+			Methods: make(map[string]*Member),
+			Fields:  make(map[string]*Member),
+		}
+		m.Classes[name] = c
+	}
+	return c
+}
+
+// AddMethod declares a method returning v.
+func (c *Class) AddMethod(name, sig string, static bool, v Value) *Member {
+	mb := &Member{Name: name, Sig: sig, Static: static, Value: v}
+	c.Methods[name+sig] = mb
+	return mb
+}
+
+// AddField declares a field holding v. For instance fields v is the
+// default for objects that do not set it.
+func (c *Class) AddField(name, sig string, static bool, v Value) *Member {
+	mb := &Member{Name: name, Sig: sig, Static: static, Value: v}
+	c.Fields[name+":"+sig] = mb
+	return mb
+}
+
+// NewObject creates an instance of class with the class's instance field
+// defaults.
+func (m *Model) NewObject(class string) *Object {
+	obj := &Object{Class: class, Fields: make(map[string]Value)}
+	for _, c := range m.lineage(class) {
+		for _, f := range c.Fields {
+			if _, set := obj.Fields[f.Name]; !set && !f.Static {
+				obj.Fields[f.Name] = f.Value
+			}
+		}
+	}
+	return obj
+}
+
+// lineage returns class followed by its modelled superclasses.
+func (m *Model) lineage(class string) []*Class {
+	var chain []*Class
+	seen := make(map[string]bool)
+	for c := m.Classes[class]; c != nil && !seen[c.Name]; c = m.Classes[c.Super] {
+		seen[c.Name] = true
+		chain = append(chain, c)
+	}
+	return chain
+}
+
+// FindMethod resolves a method on class or its superclasses. If class is
+// unknown or does not declare it, any class with a unique matching
+// name+sig is used; native code often calls methods on handles (thiz,
+// context) the model has no class for.
+func (m *Model) FindMethod(class, name, sig string, static bool) *Member {
+	return m.find(class, name+sig, static, func(c *Class) map[string]*Member { return c.Methods })
+}
+
+// FindField resolves a field the same way as FindMethod.
+func (m *Model) FindField(class, name, sig string, static bool) *Member {
+	return m.find(class, name+":"+sig, static, func(c *Class) map[string]*Member { return c.Fields })
+}
+
+func (m *Model) find(class, key string, static bool, members func(*Class) map[string]*Member) *Member {
+	for _, c := range m.lineage(class) {
+		if mb := members(c)[key]; mb != nil && mb.Static == static {
+			return mb
+		}
+	}
+
+	var found *Member
+	for _, c := range m.Classes {
+		if mb := members(c)[key]; mb != nil && mb.Static == static {
+			if found != nil {
+				return nil // Ambiguous
+			}
+			found = mb
+		}
+	}
+	return found
+}
+
+// Active model, shared by all JNI environments.
+var (
+	model   = NewModel()
+	modelMu sync.RWMutex
+)
+
+// SetModel replaces the active Java object model.
+func SetModel(m *Model) {
+	modelMu.Lock()
+	defer modelMu.Unlock()
+	if m == nil {
+		m = NewModel()
+	}
+	model = m
+}
+
+// CurrentModel returns the active Java object model.
+func CurrentModel() *Model {
+	modelMu.RLock()
+	defer modelMu.RUnlock()
+	return model
+}
+
+// LoadModel reads a YAML model file.
+func LoadModel(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// YAML schema
+
+type modelSpec struct {
+	Objects map[string]objectSpec `yaml:"objects"`
+	Classes map[string]classSpec  `yaml:"classes"`
+}
+
+type objectSpec struct {
+	Class   string               `yaml:"class"`
+	Fields  map[string]yaml.Node `yaml:"fields"`
+	Methods map[string]yaml.Node `yaml:"methods"` // Keyed by name+sig
+}
+
+type classSpec struct {
+	Super   string       `yaml:"super"`
+	Methods []memberSpec `yaml:"methods"`
+	Fields  []memberSpec `yaml:"fields"`
+}
+
+type memberSpec struct {
+	Name   string    `yaml:"name"`
+	Sig    string    `yaml:"sig"`
+	Static bool      `yaml:"static"`
+	Return yaml.Node `yaml:"return"`
+	Value  yaml.Node `yaml:"value"`
+}
+
+// ParseModel parses a YAML model.
+func ParseModel(data []byte) (*Model, error) {
+	var spec modelSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+
+	m := NewModel()
+
+	// Create named objects first so "@name" references resolve regardless
+	// of declaration order.
+	for name, ospec := range spec.Objects {
+		if ospec.Class == "" {
+			return nil, fmt.Errorf("object %s: missing class", name)
+		}
+		m.Objects[name] = &Object{Class: ospec.Class, Fields: make(map[string]Value)}
+	}
+
+	// Declarations, sorted for deterministic errors
+	for _, cname := range sortedKeys(spec.Classes) {
+		cs := spec.Classes[cname]
+		c := m.Class(cname)
+		c.Super = cs.Super
+		for _, ms := range cs.Methods {
+			ret := returnType(ms.Sig)
+			if ms.Name == "" || ret == "" {
+				return nil, fmt.Errorf("class %s: method %q: bad name or signature %q", cname, ms.Name, ms.Sig)
+			}
+			v, err := m.decodeValue(&ms.Return, ret)
+			if err != nil {
+				return nil, fmt.Errorf("class %s: method %s%s: %w", cname, ms.Name, ms.Sig, err)
+			}
+			c.AddMethod(ms.Name, ms.Sig, ms.Static, v)
+		}
+		for _, fs := range cs.Fields {
+			if fs.Name == "" || fs.Sig == "" {
+				return nil, fmt.Errorf("class %s: field %q: missing name or signature", cname, fs.Name)
+			}
+			v, err := m.decodeValue(&fs.Value, fs.Sig)
+			if err != nil {
+				return nil, fmt.Errorf("class %s: field %s: %w", cname, fs.Name, err)
+			}
+			c.AddField(fs.Name, fs.Sig, fs.Static, v)
+		}
+	}
+
+	// Named object fields, typed by the class's field declaration
+	for _, name := range sortedKeys(spec.Objects) {
+		obj := m.Objects[name]
+		if err := m.fillObject(obj, spec.Objects[name]); err != nil {
+			return nil, fmt.Errorf("object %s: %w", name, err)
+		}
+	}
+
+	return m, nil
+}
+
+// fillObject sets obj's class defaults and then the spec's field values
+// and method results.
+func (m *Model) fillObject(obj *Object, spec objectSpec) error {
+	obj.Fields = m.NewObject(obj.Class).Fields
+	for _, fname := range sortedKeys(spec.Fields) {
+		node := spec.Fields[fname]
+		v, err := m.decodeValue(&node, m.fieldSig(obj.Class, fname))
+		if err != nil {
+			return fmt.Errorf("field %s: %w", fname, err)
+		}
+		obj.Fields[fname] = v
+	}
+	for _, key := range sortedKeys(spec.Methods) {
+		var ret string
+		if i := strings.IndexByte(key, '('); i > 0 {
+			ret = returnType(key[i:])
+		}
+		if ret == "" {
+			return fmt.Errorf("method %q: want name+signature, e.g. toByteArray()[B", key)
+		}
+		node := spec.Methods[key]
+		v, err := m.decodeValue(&node, ret)
+		if err != nil {
+			return fmt.Errorf("method %s: %w", key, err)
+		}
+		if obj.Methods == nil {
+			obj.Methods = make(map[string]Value)
+		}
+		obj.Methods[key] = v
+	}
+	return nil
+}
+
+// fieldSig returns the declared signature of an instance field, or "" if
+// the class does not declare it.
+func (m *Model) fieldSig(class, field string) string {
+	for _, c := range m.lineage(class) {
+		for _, f := range c.Fields {
+			if f.Name == field && !f.Static {
+				return f.Sig
+			}
+		}
+	}
+	return ""
+}
+
+// decodeValue converts a YAML node to a Value of JNI type sig. An empty sig
+// infers the type from the node.
+func (m *Model) decodeValue(n *yaml.Node, sig string) (Value, error) {
+	if n.Kind == 0 || (n.Kind == yaml.ScalarNode && n.Tag == "!!null") {
+		return nil, nil
+	}
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+
+	if sig == "" {
+		sig = inferSig(n)
+	}
+
+	switch sig[0] {
+	case 'Z':
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			var i int64
+			if n.Decode(&i) != nil {
+				return nil, err
+			}
+			b = i != 0
+		}
+		return b, nil
+	case 'C':
+		var s string
+		if n.Decode(&s) == nil && len([]rune(s)) == 1 && n.Tag != "!!int" {
+			return int64([]rune(s)[0]), nil
+		}
+		fallthrough
+	case 'B', 'S', 'I', 'J':
+		var i int64
+		if err := n.Decode(&i); err != nil {
+			var u uint64
+			if n.Decode(&u) != nil {
+				return nil, err
+			}
+			i = int64(u)
+		}
+		return i, nil
+	case 'F', 'D':
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case '[':
+		return m.decodeArray(n, sig)
+	case 'L':
+		return m.decodeObject(n, sig)
+	}
+	return nil, fmt.Errorf("unsupported type %q", sig)
+}
+
+func (m *Model) decodeArray(n *yaml.Node, sig string) (Value, error) {
+	elem := sig[1:]
+	if elem == "" {
+		return nil, fmt.Errorf("bad array type %q", sig)
+	}
+
+	if elem == "B" {
+		if n.Kind == yaml.ScalarNode {
+			return ParseBytes(n.Value)
+		}
+	}
+	if n.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%s: expected a list", sig)
+	}
+
+	switch elem[0] {
+	case 'L', '[':
+		vals := make([]Value, len(n.Content))
+		for i, c := range n.Content {
+			v, err := m.decodeValue(c, elem)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			vals[i] = v
+		}
+		return vals, nil
+	}
+
+	size := elemSize(elem[0])
+	if size == 0 {
+		return nil, fmt.Errorf("bad array type %q", sig)
+	}
+	data := make([]byte, len(n.Content)*size)
+	for i, c := range n.Content {
+		v, err := m.decodeValue(c, elem)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		putElem(data[i*size:], elem[0], v)
+	}
+	if elem == "B" {
+		return data, nil
+	}
+	return &Array{Elem: elem[0], Data: data}, nil
+}
+
+func (m *Model) decodeObject(n *yaml.Node, sig string) (Value, error) {
+	class := strings.TrimSuffix(strings.TrimPrefix(sig, "L"), ";")
+
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if strings.HasPrefix(n.Value, "@") {
+			obj, ok := m.Objects[n.Value[1:]]
+			if !ok {
+				return nil, fmt.Errorf("unknown object %s", n.Value)
+			}
+			return obj, nil
+		}
+		if isStringClass(class) {
+			return n.Value, nil
+		}
+		return nil, fmt.Errorf("%s: expected @object or mapping, got %q", class, n.Value)
+
+	case yaml.MappingNode:
+		var ospec objectSpec
+		if err := n.Decode(&ospec); err != nil {
+			return nil, err
+		}
+		if ospec.Class == "" {
+			ospec.Class = class
+		}
+		obj := &Object{Class: ospec.Class}
+		if err := m.fillObject(obj, ospec); err != nil {
+			return nil, err
+		}
+		return obj, nil
+
+	case yaml.SequenceNode:
+		return nil, fmt.Errorf("%s: unexpected list", class)
+	}
+	return nil, fmt.Errorf("%s: unsupported value", class)
+}
+
+// ParseBytes decodes a byte array literal: "hex:..." or "base64:...", or
+// the string's own UTF-8 bytes otherwise.
+func ParseBytes(s string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(s, "hex:"):
+		h := strings.NewReplacer(" ", "", ":", "").Replace(s[4:])
+		return hex.DecodeString(h)
+	case strings.HasPrefix(s, "base64:"):
+		return base64.StdEncoding.DecodeString(s[7:])
+	}
+	return []byte(s), nil
+}
+
+// inferSig picks a JNI type for an untyped YAML value.
+func inferSig(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		switch n.Tag {
+		case "!!bool":
+			return "Z"
+		case "!!int":
+			return "J"
+		case "!!float":
+			return "D"
+		}
+		if strings.HasPrefix(n.Value, "hex:") || strings.HasPrefix(n.Value, "base64:") {
+			return "[B"
+		}
+		if strings.HasPrefix(n.Value, "@") {
+			return "Ljava/lang/Object;"
+		}
+		return "Ljava/lang/String;"
+	case yaml.SequenceNode:
+		return "[Ljava/lang/Object;"
+	}
+	return "Ljava/lang/Object;"
+}
+
+// returnType extracts the return type from a method signature.
+func returnType(sig string) string {
+	i := strings.LastIndexByte(sig, ')')
+	if !strings.HasPrefix(sig, "(") || i < 0 || i == len(sig)-1 {
+		return ""
+	}
+	return sig[i+1:]
+}
+
+func isStringClass(class string) bool {
+	switch class {
+	case "java/lang/String", "java/lang/CharSequence", "java/lang/Object":
+		return true
+	}
+	return false
+}
+
+// elemSize returns the size of a primitive array element.
+func elemSize(t byte) int {
+	switch t {
+	case 'Z', 'B':
+		return 1
+	case 'C', 'S':
+		return 2
+	case 'I', 'F':
+		return 4
+	case 'J', 'D':
+		return 8
+	}
+	return 0
+}
+
+func putElem(b []byte, t byte, v Value) {
+	var bits uint64
+	switch x := v.(type) {
+	case bool:
+		if x {
+			bits = 1
+		}
+	case int64:
+		bits = uint64(x)
+	case float64:
+		if t == 'F' {
+			bits = uint64(math.Float32bits(float32(x)))
+		} else {
+			bits = math.Float64bits(x)
+		}
+	}
+	switch elemSize(t) {
+	case 1:
+		b[0] = byte(bits)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(bits))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(bits))
+	case 8:
+		binary.LittleEndian.PutUint64(b, bits)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,213 @@
+package jni
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+const testModel = `
+objects:
+  pm:
+    class: android/content/pm/PackageManager
+    fields:
+      flags: 7
+classes:
+  android/content/Context:
+    methods:
+      - name: getPackageName
+        sig: ()Ljava/lang/String;
+        return: com.example.game
+      - name: getPackageManager
+        sig: ()Landroid/content/pm/PackageManager;
+        return: "@pm"
+  android/content/pm/PackageManager:
+    fields:
+      - name: flags
+        sig: I
+  com/example/Config:
+    methods:
+      - name: version
+        sig: ()I
+        static: true
+        return: 42
+    fields:
+      - name: KEY
+        sig: "[B"
+        static: true
+        value: hex:00112233
+`
+
+// jniCall calls JNI function index through the installed vtable with
+// JNIEnv* in X0 and returns X0.
+func jniCall(t *testing.T, emu *emulator.Emulator, env *Env, index int, args ...uint64) uint64 {
+	t.Helper()
+	fn, _ := emu.MemReadU64(env.jniVtableBase + uint64(index*8))
+	return testutil.Call(t, emu, fn, append([]uint64{env.GetJNIEnv()}, args...)...)
+}
+
+func TestObjectModel(t *testing.T) {
+	m, err := ParseModel([]byte(testModel))
+	if err != nil {
+		t.Fatalf("ParseModel: %v", err)
+	}
+	SetModel(m)
+	defer SetModel(nil)
+
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	env := NewEnv(emu)
+	env.Install()
+
+	str := emu.Malloc(64)
+	cstr := func(s string) uint64 { return testutil.CString(emu, s) }
+
+	// context.getPackageName() on a handle the model has no class for
+	context := emu.Malloc(8)
+	ctxClass := jniCall(t, emu, env, JNI_GetObjectClass, context)
+	mid := jniCall(t, emu, env, JNI_GetMethodID, ctxClass, cstr("getPackageName"), cstr("()Ljava/lang/String;"))
+	jstr := jniCall(t, emu, env, JNI_CallObjectMethod, context, mid)
+	chars := jniCall(t, emu, env, JNI_GetStringUTFChars, jstr, 0)
+	if s, _ := emu.MemReadString(chars, 64); s != "com.example.game" {
+		t.Errorf("getPackageName = %q, want com.example.game", s)
+	}
+
+	// Nested object: getPackageManager().flags, via GetObjectClass
+	mid = jniCall(t, emu, env, JNI_GetMethodID, ctxClass, cstr("getPackageManager"), cstr("()Landroid/content/pm/PackageManager;"))
+	pm := jniCall(t, emu, env, JNI_CallObjectMethod, context, mid)
+	if obj := env.Object(pm); obj != m.Objects["pm"] {
+		t.Fatalf("getPackageManager = %#x, want the pm object", pm)
+	}
+	pmClass := jniCall(t, emu, env, JNI_GetObjectClass, pm)
+	if want := jniCall(t, emu, env, JNI_FindClass, cstr("android/content/pm/PackageManager")); pmClass != want {
+		t.Errorf("GetObjectClass(pm) = %#x, want %#x", pmClass, want)
+	}
+	fid := jniCall(t, emu, env, JNI_GetFieldID, pmClass, cstr("flags"), cstr("I"))
+	if got := jniCall(t, emu, env, JNI_GetIntField, pm, fid); got != 7 {
+		t.Errorf("flags = %d, want 7", got)
+	}
+	jniCall(t, emu, env, JNI_SetIntField, pm, fid, 9)
+	if got := jniCall(t, emu, env, JNI_GetIntField, pm, fid); got != 9 {
+		t.Errorf("flags after set = %d, want 9", got)
+	}
+
+	// Static method and byte[] static field
+	cls := jniCall(t, emu, env, JNI_FindClass, cstr("com/example/Config"))
+	mid = jniCall(t, emu, env, JNI_GetStaticMethodID, cls, cstr("version"), cstr("()I"))
+	if got := jniCall(t, emu, env, JNI_CallStaticIntMethod, cls, mid); got != 42 {
+		t.Errorf("version() = %d, want 42", got)
+	}
+	fid = jniCall(t, emu, env, JNI_GetStaticFieldID, cls, cstr("KEY"), cstr("[B"))
+	arr := jniCall(t, emu, env, JNI_GetStaticObjectField, cls, fid)
+	if n := jniCall(t, emu, env, JNI_GetArrayLength, arr); n != 4 {
+		t.Errorf("KEY length = %d, want 4", n)
+	}
+	jniCall(t, emu, env, JNI_GetByteArrayRegion, arr, 0, 4, str)
+	if got, _ := emu.MemRead(str, 4); !bytes.Equal(got, []byte{0x00, 0x11, 0x22, 0x33}) {
+		t.Errorf("KEY = %x, want 00112233", got)
+	}
+
+	// Writes stay in this Env; the model is the same for the next run
+	jniCall(t, emu, env, JNI_SetStaticObjectField, cls, fid, 0)
+	if arr := jniCall(t, emu, env, JNI_GetStaticObjectField, cls, fid); arr != 0 {
+		t.Errorf("KEY after set = %#x, want NULL", arr)
+	}
+	if m.Objects["pm"].Fields["flags"] != int64(7) {
+		t.Errorf("model pm.flags = %v after SetIntField, want 7", m.Objects["pm"].Fields["flags"])
+	}
+	if mb := m.FindField("com/example/Config", "KEY", "[B", true); mb == nil || mb.Value == nil {
+		t.Errorf("model KEY was overwritten")
+	}
+
+	// Negative and huge lengths fail like an OutOfMemoryError
+	for _, n := range []uint64{0xffffffff, maxArrayLen + 1} {
+		if arr := jniCall(t, emu, env, JNI_NewByteArray, n); arr != 0 {
+			t.Errorf("NewByteArray(%d) = %#x, want NULL", int32(n), arr)
+		}
+		if arr := jniCall(t, emu, env, JNI_NewObjectArray, n, cls, 0); arr != 0 {
+			t.Errorf("NewObjectArray(%d) = %#x, want NULL", int32(n), arr)
+		}
+	}
+	if arr := jniCall(t, emu, env, JNI_NewIntArray, 3); jniCall(t, emu, env, JNI_GetArrayLength, arr) != 3 {
+		t.Errorf("NewIntArray(3) length != 3")
+	}
+
+	// Unmodelled methods keep returning typed defaults
+	mid = jniCall(t, emu, env, JNI_GetMethodID, ctxClass, cstr("hashCode"), cstr("()I"))
+	if got := jniCall(t, emu, env, JNI_CallIntMethod, context, mid); got != 0 {
+		t.Errorf("unmodelled int = %d, want 0", got)
+	}
+}
+
+func TestParseModelErrors(t *testing.T) {
+	for _, src := range []string{
+		"objects: {x: {}}",
+		"classes: {A: {methods: [{name: f, sig: I, return: 1}]}}",
+		"classes: {A: {fields: [{name: f, sig: Lfoo/Bar;, value: \"@missing\"}]}}",
+		"classes: {A: {fields: [{name: f, sig: \"[B\", value: \"hex:zz\"}]}}",
+	} {
+		if _, err := ParseModel([]byte(src)); err == nil {
+			t.Errorf("ParseModel(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestPackageChain(t *testing.T) {
+	cert := []byte{0x30, 0x82, 0x01, 0xff, 0x80}
+	m := NewModel()
+	AddPackage(m, Package{Name: "com.example.game", Certs: [][]byte{cert}})
+	SetModel(m)
+	defer SetModel(nil)
+
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	env := NewEnv(emu)
+	env.Install()
+
+	cstr := func(s string) uint64 { return testutil.CString(emu, s) }
+	call := func(obj uint64, class, name, sig string, index int, args ...uint64) uint64 {
+		cls := jniCall(t, emu, env, JNI_FindClass, cstr(class))
+		mid := jniCall(t, emu, env, JNI_GetMethodID, cls, cstr(name), cstr(sig))
+		return jniCall(t, emu, env, index, append([]uint64{obj, mid}, args...)...)
+	}
+
+	// getPackageManager().getPackageInfo(getPackageName(), GET_SIGNATURES)
+	thiz := emu.Malloc(8)
+	name := call(thiz, "android/app/Activity", "getPackageName", "()Ljava/lang/String;", JNI_CallObjectMethod)
+	pm := call(thiz, "android/app/Activity", "getPackageManager", "()Landroid/content/pm/PackageManager;", JNI_CallObjectMethod)
+	info := call(pm, "android/content/pm/PackageManager", "getPackageInfo", "(Ljava/lang/String;I)Landroid/content/pm/PackageInfo;", JNI_CallObjectMethod, name, 0x40)
+
+	// .signatures[0]
+	cls := jniCall(t, emu, env, JNI_GetObjectClass, info)
+	fid := jniCall(t, emu, env, JNI_GetFieldID, cls, cstr("signatures"), cstr("[Landroid/content/pm/Signature;"))
+	sigs := jniCall(t, emu, env, JNI_GetObjectField, info, fid)
+	if n := jniCall(t, emu, env, JNI_GetArrayLength, sigs); n != 1 {
+		t.Fatalf("signatures.length = %d, want 1", n)
+	}
+	sig := jniCall(t, emu, env, JNI_GetObjectArrayElement, sigs, 0)
+
+	// .toByteArray(), .toCharsString(), .hashCode()
+	arr := call(sig, "android/content/pm/Signature", "toByteArray", "()[B", JNI_CallObjectMethod)
+	elems := jniCall(t, emu, env, JNI_GetByteArrayElements, arr, 0)
+	if got, _ := emu.MemRead(elems, uint64(len(cert))); !bytes.Equal(got, cert) {
+		t.Errorf("toByteArray = %x, want %x", got, cert)
+	}
+	chars := call(sig, "android/content/pm/Signature", "toCharsString", "()Ljava/lang/String;", JNI_CallObjectMethod)
+	if v := env.Value(chars, "Ljava/lang/String;"); v != "308201ff80" {
+		t.Errorf("toCharsString = %v, want 308201ff80", v)
+	}
+	// Arrays.hashCode(new byte[]{0x30, 0x82, 0x01, 0xff, 0x80})
+	if got := int32(call(sig, "android/content/pm/Signature", "hashCode", "()I", JNI_CallIntMethod)); got != 69205295 {
+		t.Errorf("hashCode = %d, want 69205295", got)
+	}
+}
@@ -0,0 +1,237 @@
+package jni
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// Size of a JNINativeMethod entry: { const char* name; const char* signature; void* fnPtr; }
+const nativeMethodSize = 24
+
+// NativeMethod is a Java method bound to native code by RegisterNatives.
+type NativeMethod struct {
+	Class     string `json:"class"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Fn        uint64 `json:"fn"`
+}
+
+// String formats the method as Class.name(sig).
+func (n NativeMethod) String() string {
+	if n.Class == "" {
+		return n.Name + n.Signature
+	}
+	return n.Class + "." + n.Name + n.Signature
+}
+
+// stubRegisterNatives records the JNINativeMethod table.
+// jint RegisterNatives(JNIEnv*, jclass, const JNINativeMethod*, jint)
+func (e *Env) stubRegisterNatives(emu *emulator.Emulator) bool {
+	class := e.className(emu.X(1))
+	methods := emu.X(2)
+	count := int(int32(emu.X(3)))
+
+	for i := 0; i < count; i++ {
+		entry := methods + uint64(i*nativeMethodSize)
+		namePtr, err1 := emu.MemReadU64(entry)
+		sigPtr, err2 := emu.MemReadU64(entry + 8)
+		fn, err3 := emu.MemReadU64(entry + 16)
+		if err1 != nil || err2 != nil || err3 != nil {
+			break
+		}
+		name, _ := emu.MemReadString(namePtr, 256)
+		sig, _ := emu.MemReadString(sigPtr, 1024)
+
+		n := NativeMethod{Class: class, Name: name, Signature: sig, Fn: fn}
+		e.nativesMu.Lock()
+		e.natives = append(e.natives, n)
+		e.nativesMu.Unlock()
+		stubs.DefaultRegistry.Log("jni", "RegisterNatives", n.String()+" -> "+stubs.FormatHex(fn))
+	}
+
+	emu.SetX(0, JNI_OK)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+// Natives returns the methods registered so far, in registration order.
+func (e *Env) Natives() []NativeMethod {
+	e.nativesMu.Lock()
+	defer e.nativesMu.Unlock()
+	return append([]NativeMethod(nil), e.natives...)
+}
+
+// RegisteredNatives returns the natives registered in the active
+// environment.
+func RegisteredNatives() []NativeMethod {
+	env := GetCurrentEnv()
+	if env == nil {
+		return nil
+	}
+	return env.Natives()
+}
+
+// ParseSignature splits a method signature into parameter types and the
+// return type, e.g. "(Ljava/lang/String;[BI)V" into
+// ["Ljava/lang/String;", "[B", "I"] and "V".
+func ParseSignature(sig string) (params []string, ret string, err error) {
+	if !strings.HasPrefix(sig, "(") {
+		return nil, "", fmt.Errorf("signature %q: missing (", sig)
+	}
+	rest := sig[1:]
+	for !strings.HasPrefix(rest, ")") {
+		if rest == "" {
+			return nil, "", fmt.Errorf("signature %q: missing )", sig)
+		}
+		t, n := nextType(rest)
+		if n == 0 {
+			return nil, "", fmt.Errorf("signature %q: bad type at %q", sig, rest)
+		}
+		params = append(params, t)
+		rest = rest[n:]
+	}
+	ret, n := nextType(rest[1:])
+	if n == 0 || n != len(rest)-1 {
+		return nil, "", fmt.Errorf("signature %q: bad return type", sig)
+	}
+	return params, ret, nil
+}
+
+// nextType returns the first type descriptor in s and its length, or 0 if
+// s does not start with one.
+func nextType(s string) (string, int) {
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		i++
+	}
+	if i == len(s) {
+		return "", 0
+	}
+	switch s[i] {
+	case 'Z', 'B', 'C', 'S', 'I', 'J', 'F', 'D', 'V':
+		return s[:i+1], i + 1
+	case 'L':
+		end := strings.IndexByte(s[i:], ';')
+		if end < 0 {
+			return "", 0
+		}
+		return s[:i+end+1], i + end + 1
+	}
+	return "", 0
+}
+
+// ParseArg converts a command-line argument to a value of JNI type t:
+// integers (decimal or 0x hex) for primitives, true/false for booleans,
+// hex:/base64:/text for byte[], text for String, and "null" for any
+// reference type.
+func ParseArg(t, s string) (Value, error) {
+	if t[0] == 'L' || t[0] == '[' {
+		if s == "null" {
+			return nil, nil
+		}
+	}
+	switch t {
+	case "Z":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: want true or false", s)
+		}
+		return b, nil
+	case "B", "C", "S", "I", "J":
+		i, err := strconv.ParseInt(s, 0, 64)
+		if err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(s, 0, 64); err == nil {
+			return int64(u), nil
+		}
+		if t == "C" && len([]rune(s)) == 1 {
+			return int64([]rune(s)[0]), nil
+		}
+		return nil, fmt.Errorf("%s: want an integer", s)
+	case "F", "D":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: want a number", s)
+		}
+		return f, nil
+	case "[B":
+		return ParseBytes(s)
+	}
+	if t[0] == 'L' && isStringClass(strings.TrimSuffix(t[1:], ";")) {
+		return s, nil
+	}
+	return nil, fmt.Errorf("%s: cannot pass %s from the command line (use null)", s, t)
+}
+
+// SetArgs loads a native method call into emu's registers: JNIEnv* in X0,
+// this (a jobject or jclass) in X1, then args per the AAPCS64, with
+// integers and references in X2-X7 and floating point in D0-D7.
+func (e *Env) SetArgs(emu *emulator.Emulator, this uint64, params []string, args []Value) error {
+	if len(args) != len(params) {
+		return fmt.Errorf("want %d arguments, got %d", len(params), len(args))
+	}
+
+	emu.SetX(0, e.GetJNIEnv())
+	emu.SetX(1, this)
+	xr, dr := 2, 0
+	for i, t := range params {
+		switch t {
+		case "F", "D":
+			if dr > 7 {
+				return fmt.Errorf("too many floating point arguments")
+			}
+			f := toFloat(args[i])
+			if t == "F" {
+				emu.SetD(dr, uint64(math.Float32bits(float32(f))))
+			} else {
+				emu.SetD(dr, math.Float64bits(f))
+			}
+			dr++
+		default:
+			if xr > 7 {
+				return fmt.Errorf("too many arguments")
+			}
+			if t[0] == 'L' || t[0] == '[' {
+				emu.SetX(xr, e.NewRef(args[i]))
+			} else {
+				emu.SetX(xr, uint64(toInt(args[i])))
+			}
+			xr++
+		}
+	}
+	return nil
+}
+
+// ReturnValue reads a native method's return value of type ret.
+func (e *Env) ReturnValue(emu *emulator.Emulator, ret string) Value {
+	switch ret {
+	case "V":
+		return nil
+	case "Z":
+		return emu.X(0)&0xff != 0
+	case "F":
+		return float64(math.Float32frombits(uint32(emu.D(0))))
+	case "D":
+		return math.Float64frombits(emu.D(0))
+	case "B", "C", "S", "I", "J":
+		return e.argValue(emu, ret[0], 0, ret)
+	}
+	return e.Value(emu.X(0), ret)
+}
+
+// Describe formats a value for display: strings quoted, byte arrays in hex.
+func Describe(v Value) string {
+	switch x := v.(type) {
+	case string:
+		return strconv.Quote(x)
+	case []byte:
+		return fmt.Sprintf("byte[%d] %x", len(x), x)
+	}
+	return describe(v)
+}
@@ -0,0 +1,122 @@
+package jni
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+func TestRegisterNatives(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	env := NewEnv(emu)
+	env.Install()
+
+	cstr := func(s string) uint64 {
+		p := emu.Malloc(uint64(len(s) + 1))
+		emu.MemWriteString(p, s)
+		return p
+	}
+
+	// JNINativeMethod[2]
+	table := emu.Malloc(2 * nativeMethodSize)
+	emu.MemWriteU64(table, cstr("decrypt"))
+	emu.MemWriteU64(table+8, cstr("([BI)Ljava/lang/String;"))
+	emu.MemWriteU64(table+16, 0x401000)
+	emu.MemWriteU64(table+24, cstr("init"))
+	emu.MemWriteU64(table+32, cstr("()V"))
+	emu.MemWriteU64(table+40, 0x401100)
+
+	cls := jniCall(t, emu, env, JNI_FindClass, cstr("com/example/Native"))
+	if got := jniCall(t, emu, env, JNI_RegisterNatives, cls, table, 2); got != JNI_OK {
+		t.Fatalf("RegisterNatives = %d, want JNI_OK", got)
+	}
+
+	want := []NativeMethod{
+		{Class: "com/example/Native", Name: "decrypt", Signature: "([BI)Ljava/lang/String;", Fn: 0x401000},
+		{Class: "com/example/Native", Name: "init", Signature: "()V", Fn: 0x401100},
+	}
+	if got := env.Natives(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Natives = %v, want %v", got, want)
+	}
+
+	// Marshal decrypt(hex:cafe, 3) and read the arguments back
+	params, ret, err := ParseSignature(want[0].Signature)
+	if err != nil {
+		t.Fatalf("ParseSignature: %v", err)
+	}
+	if ret != "Ljava/lang/String;" {
+		t.Errorf("return type = %q", ret)
+	}
+	var args []Value
+	for i, s := range []string{"hex:cafe", "3"} {
+		v, err := ParseArg(params[i], s)
+		if err != nil {
+			t.Fatalf("ParseArg(%s, %s): %v", params[i], s, err)
+		}
+		args = append(args, v)
+	}
+	if err := env.SetArgs(emu, 0, params, args); err != nil {
+		t.Fatalf("SetArgs: %v", err)
+	}
+	if emu.X(0) != env.GetJNIEnv() || emu.X(3) != 3 {
+		t.Errorf("X0 = %#x, X3 = %d", emu.X(0), emu.X(3))
+	}
+	if v, ok := env.Value(emu.X(2), "[B").([]byte); !ok || !bytes.Equal(v, []byte{0xca, 0xfe}) {
+		t.Errorf("byte[] arg = %v, want cafe", env.Value(emu.X(2), "[B"))
+	}
+
+	emu.SetX(0, env.NewRef("plain"))
+	if got := env.ReturnValue(emu, ret); got != "plain" {
+		t.Errorf("ReturnValue = %v, want plain", got)
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	params, ret, err := ParseSignature("(Z[[ILjava/lang/String;DJ)[B")
+	if err != nil {
+		t.Fatalf("ParseSignature: %v", err)
+	}
+	if want := []string{"Z", "[[I", "Ljava/lang/String;", "D", "J"}; !reflect.DeepEqual(params, want) || ret != "[B" {
+		t.Errorf("got %v %s, want %v [B", params, ret, want)
+	}
+	for _, bad := range []string{"", "I", "(I", "(Q)V", "(Ljava/lang/String)V", "()", "()VV"} {
+		if _, _, err := ParseSignature(bad); err == nil {
+			t.Errorf("ParseSignature(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestDecodeExportName(t *testing.T) {
+	for _, tt := range []struct {
+		sym, class, name, params string
+	}{
+		{"Java_com_example_Native_init", "com/example/Native", "init", ""},
+		{"Java_com_example_Native_decrypt___3BI", "com/example/Native", "decrypt", "([BI)"},
+		{"Java_com_example_Native_load__Ljava_lang_String_2J", "com/example/Native", "load", "(Ljava/lang/String;J)"},
+		{"Java_com_example_Native_reset__", "com/example/Native", "reset", "()"},
+		{"Java_org_my_1app_Native_get_1key", "org/my_app/Native", "get_key", ""},
+		{"Java_org_app__1internal_N_f", "org/app/_internal/N", "f", ""},
+		{"Java_Main_caf_000e9", "Main", "café", ""},
+	} {
+		class, name, params, err := DecodeExportName(tt.sym)
+		if err != nil {
+			t.Errorf("DecodeExportName(%s): %v", tt.sym, err)
+			continue
+		}
+		if class != tt.class || name != tt.name || params != tt.params {
+			t.Errorf("DecodeExportName(%s) = %s %s %s, want %s %s %s", tt.sym, class, name, params, tt.class, tt.name, tt.params)
+		}
+	}
+	for _, bad := range []string{"JNI_OnLoad", "Java_", "Java_init", "Java_a__b_c", "Java_a_b__Q", "Java_a_b_0zz"} {
+		if _, _, _, err := DecodeExportName(bad); err == nil {
+			t.Errorf("DecodeExportName(%s) succeeded, want error", bad)
+		}
+	}
+}
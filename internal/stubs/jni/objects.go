@@ -0,0 +1,665 @@
+package jni
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// Handles for modelled objects, above the method and field ID ranges.
+const objectRefBase = 0x80000
+
+// Maximum element count of a guest array, created or read back.
+const maxArrayLen = 1 << 24
+
+// memberRef is what a jmethodID or jfieldID stands for.
+type memberRef struct {
+	Class  string
+	Name   string
+	Sig    string
+	Static bool
+}
+
+// key identifies the member across IDs.
+func (r *memberRef) key() string {
+	return r.Class + "." + r.Name + ":" + r.Sig
+}
+
+func (r *memberRef) String() string {
+	name := r.Name
+	if r.Class != "" {
+		name = shortClass(r.Class) + "." + name
+	}
+	return name
+}
+
+// How a Call*Method variant passes its receiver and method ID.
+const (
+	callVirtual    = iota // (env, obj, methodID, ...)
+	callNonvirtual        // (env, obj, clazz, methodID, ...)
+	callStatic            // (env, clazz, methodID, ...)
+)
+
+// JNI type chars in the order the Call*/Get*/Set* families are laid out.
+const (
+	callKinds  = "LZBCSIJFDV"
+	fieldKinds = "LZBCSIJFD"
+)
+
+// modelHandler returns the handler for the model-backed JNI functions:
+// method calls, field access, object creation and arrays. It returns nil
+// for other indices.
+func (e *Env) modelHandler(index int) emulator.AddressHookFunc {
+	switch {
+	case index >= JNI_CallObjectMethod && index <= JNI_CallVoidMethod+2:
+		return e.callHandler(callKinds[(index-JNI_CallObjectMethod)/3], callVirtual)
+	case index >= JNI_CallNonvirtualObjectMethod && index <= JNI_CallNonvirtualVoidMethod+2:
+		return e.callHandler(callKinds[(index-JNI_CallNonvirtualObjectMethod)/3], callNonvirtual)
+	case index >= JNI_CallStaticObjectMethod && index <= JNI_CallStaticVoidMethod+2:
+		return e.callHandler(callKinds[(index-JNI_CallStaticObjectMethod)/3], callStatic)
+	case index >= JNI_GetObjectField && index <= JNI_GetDoubleField:
+		return e.getFieldHandler(fieldKinds[index-JNI_GetObjectField])
+	case index >= JNI_SetObjectField && index <= JNI_SetDoubleField:
+		return e.setFieldHandler(fieldKinds[index-JNI_SetObjectField])
+	case index >= JNI_GetStaticObjectField && index <= JNI_GetStaticDoubleField:
+		return e.getFieldHandler(fieldKinds[index-JNI_GetStaticObjectField])
+	case index >= JNI_SetStaticObjectField && index <= JNI_SetStaticDoubleField:
+		return e.setFieldHandler(fieldKinds[index-JNI_SetStaticObjectField])
+	case index >= JNI_AllocObject && index <= JNI_NewObjectA:
+		return e.stubNewObject
+	case index >= JNI_NewBooleanArray && index <= JNI_NewDoubleArray:
+		return e.newArrayHandler(elemSize(fieldKinds[1+index-JNI_NewBooleanArray]))
+	case index >= JNI_GetBooleanArrayElements && index <= JNI_GetDoubleArrayElements:
+		return e.stubGetArrayElements
+	case index >= JNI_ReleaseBooleanArrayElements && index <= JNI_ReleaseDoubleArrayElements:
+		return e.stubReleaseArrayElements
+	case index >= JNI_GetBooleanArrayRegion && index <= JNI_GetDoubleArrayRegion:
+		return e.arrayRegionHandler(elemSize(fieldKinds[1+index-JNI_GetBooleanArrayRegion]), false)
+	case index >= JNI_SetBooleanArrayRegion && index <= JNI_SetDoubleArrayRegion:
+		return e.arrayRegionHandler(elemSize(fieldKinds[1+index-JNI_SetBooleanArrayRegion]), true)
+	}
+
+	switch index {
+	case JNI_NewObjectArray:
+		return e.stubNewObjectArray
+	case JNI_GetObjectArrayElement:
+		return e.stubGetObjectArrayElement
+	case JNI_SetObjectArrayElement:
+		return e.stubSetObjectArrayElement
+	case JNI_GetStringLength:
+		return e.stubGetStringLength
+	}
+	return nil
+}
+
+// Handles
+
+// classRef returns the jclass for a class name.
+func (e *Env) classRef(name string) uint64 {
+	e.classRefsMu.Lock()
+	defer e.classRefsMu.Unlock()
+	ref, ok := e.classRefs[name]
+	if !ok {
+		ref = e.mockObjBase + e.nextClassRef
+		e.classRefs[name] = ref
+		e.classNames[ref] = name
+		e.nextClassRef += 8
+	}
+	return ref
+}
+
+// className returns the class name for a jclass, or "" if unknown.
+func (e *Env) className(ref uint64) string {
+	e.classRefsMu.RLock()
+	defer e.classRefsMu.RUnlock()
+	return e.classNames[ref]
+}
+
+// memberID returns the jmethodID or jfieldID for a member, allocated in
+// the range at rangeBase.
+func (e *Env) memberID(refs map[string]uint64, ids map[uint64]*memberRef, next *uint64, rangeBase uint64, m *memberRef) uint64 {
+	key := m.Class + "." + m.Name + m.Sig
+	if m.Static {
+		key = "static:" + key
+	}
+	ref, ok := refs[key]
+	if !ok {
+		ref = e.mockObjBase + rangeBase + *next
+		refs[key] = ref
+		ids[ref] = m
+		*next += 8
+	}
+	return ref
+}
+
+func (e *Env) method(id uint64) *memberRef {
+	e.methodRefsMu.RLock()
+	defer e.methodRefsMu.RUnlock()
+	return e.methodIDs[id]
+}
+
+func (e *Env) field(id uint64) *memberRef {
+	e.fieldRefsMu.RLock()
+	defer e.fieldRefsMu.RUnlock()
+	return e.fieldIDs[id]
+}
+
+// newString creates a jstring.
+func (e *Env) newString(s string) uint64 {
+	e.jniStringsMu.Lock()
+	defer e.jniStringsMu.Unlock()
+	ref := e.mockObjBase + e.nextStringRef
+	e.jniStrings[ref] = s
+	e.nextStringRef += 8
+	return ref
+}
+
+// objectRef returns the stable jobject for a model object.
+func (e *Env) objectRef(obj *Object) uint64 {
+	e.objectsMu.Lock()
+	defer e.objectsMu.Unlock()
+	ref, ok := e.objectRefs[obj]
+	if !ok {
+		ref = e.mockObjBase + objectRefBase + e.nextObjectRef
+		e.objectRefs[obj] = ref
+		e.objects[ref] = obj
+		e.nextObjectRef += 8
+	}
+	return ref
+}
+
+// Object returns the model object behind a jobject, or nil.
+func (e *Env) Object(ref uint64) *Object {
+	e.objectsMu.RLock()
+	defer e.objectsMu.RUnlock()
+	return e.objects[ref]
+}
+
+// NewObjectRef returns a jobject for obj, for passing model objects to
+// native entry points.
+func (e *Env) NewObjectRef(obj *Object) uint64 {
+	return e.objectRef(obj)
+}
+
+// ClassRef returns the jclass for a class name, for passing to static
+// native entry points.
+func (e *Env) ClassRef(name string) uint64 {
+	return e.classRef(name)
+}
+
+// NewRef converts a model value to its JNI representation: a jstring,
+// array or jobject handle. Primitives and nil yield 0.
+func (e *Env) NewRef(v Value) uint64 {
+	switch x := v.(type) {
+	case Handle:
+		return uint64(x)
+	case string:
+		return e.newString(x)
+	case []byte:
+		return e.newArray(uint64(len(x)), x)
+	case *Array:
+		return e.newArray(uint64(x.Len()), x.Data)
+	case []Value:
+		data := make([]byte, 8*len(x))
+		for i, elem := range x {
+			binary.LittleEndian.PutUint64(data[8*i:], e.NewRef(elem))
+		}
+		return e.newArray(uint64(len(x)), data)
+	case *Object:
+		return e.objectRef(x)
+	}
+	return 0
+}
+
+// newArray allocates a guest array: a u64 element count followed by the
+// elements, the layout GetArrayLength and Get*ArrayElements expect.
+func (e *Env) newArray(count uint64, data []byte) uint64 {
+	arr := e.emu.Malloc(uint64(len(data)) + 16)
+	e.emu.MemWriteU64(arr, count)
+	if len(data) > 0 {
+		e.emu.MemWrite(arr+8, data)
+	}
+	return arr
+}
+
+// Value converts a JNI reference back to a model value, reading arrays
+// from guest memory according to sig. Unknown references come back as
+// Handle.
+func (e *Env) Value(ref uint64, sig string) Value {
+	if ref == 0 {
+		return nil
+	}
+
+	e.jniStringsMu.RLock()
+	s, ok := e.jniStrings[ref]
+	e.jniStringsMu.RUnlock()
+	if ok {
+		return s
+	}
+	if obj := e.Object(ref); obj != nil {
+		return obj
+	}
+
+	if len(sig) > 1 && sig[0] == '[' {
+		count, err := e.emu.MemReadU64(ref)
+		if err != nil || count > maxArrayLen {
+			return Handle(ref)
+		}
+		elem := sig[1:]
+		if elem[0] == 'L' || elem[0] == '[' {
+			vals := make([]Value, count)
+			for i := range vals {
+				h, _ := e.emu.MemReadU64(ref + 8 + uint64(8*i))
+				vals[i] = e.Value(h, elem)
+			}
+			return vals
+		}
+		size := elemSize(elem[0])
+		if size == 0 {
+			return Handle(ref)
+		}
+		data, err := e.emu.MemRead(ref+8, count*uint64(size))
+		if err != nil {
+			return Handle(ref)
+		}
+		if elem[0] == 'B' {
+			return data
+		}
+		return &Array{Elem: elem[0], Data: data}
+	}
+
+	return Handle(ref)
+}
+
+// setReturn places v in the return register for JNI type kind.
+func (e *Env) setReturn(emu *emulator.Emulator, kind byte, v Value) {
+	switch kind {
+	case 'V':
+	case 'L', '[':
+		emu.SetX(0, e.NewRef(v))
+	case 'F':
+		emu.SetD(0, uint64(math.Float32bits(float32(toFloat(v)))))
+	case 'D':
+		emu.SetD(0, math.Float64bits(toFloat(v)))
+	default:
+		emu.SetX(0, uint64(toInt(v)))
+	}
+}
+
+// argValue reads a Set*Field value argument from X reg (or D0 for
+// floating point) as a model value of type sig.
+func (e *Env) argValue(emu *emulator.Emulator, kind byte, reg int, sig string) Value {
+	switch kind {
+	case 'L':
+		return e.Value(emu.X(reg), sig)
+	case 'Z':
+		return emu.X(reg)&0xff != 0
+	case 'F':
+		return float64(math.Float32frombits(uint32(emu.D(0))))
+	case 'D':
+		return math.Float64frombits(emu.D(0))
+	case 'B':
+		return int64(int8(emu.X(reg)))
+	case 'C':
+		return int64(uint16(emu.X(reg)))
+	case 'S':
+		return int64(int16(emu.X(reg)))
+	case 'I':
+		return int64(int32(emu.X(reg)))
+	}
+	return int64(emu.X(reg))
+}
+
+func toInt(v Value) int64 {
+	switch x := v.(type) {
+	case bool:
+		if x {
+			return 1
+		}
+	case int64:
+		return x
+	case float64:
+		return int64(x)
+	case Handle:
+		return int64(x)
+	}
+	return 0
+}
+
+func toFloat(v Value) float64 {
+	switch x := v.(type) {
+	case int64:
+		return float64(x)
+	case float64:
+		return x
+	}
+	return 0
+}
+
+// describe formats a value for the trace.
+func describe(v Value) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if len(x) > 40 {
+			x = x[:40] + "..."
+		}
+		return "\"" + x + "\""
+	case []byte:
+		if len(x) > 16 {
+			return fmt.Sprintf("byte[%d]{%x...}", len(x), x[:16])
+		}
+		return fmt.Sprintf("byte[%d]{%x}", len(x), x)
+	case *Array:
+		return fmt.Sprintf("%c[%d]", x.Elem, x.Len())
+	case []Value:
+		return fmt.Sprintf("Object[%d]", len(x))
+	case *Object:
+		return shortClass(x.Class)
+	case Handle:
+		return stubs.FormatHex(uint64(x))
+	}
+	return fmt.Sprint(v)
+}
+
+// shortClass strips the package from a JNI class name.
+func shortClass(name string) string {
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
+
+// Method calls
+
+// callHandler returns a Call<Type>Method{,V,A} handler. The model's value
+// is returned if the method is declared; otherwise objects get a mock
+// handle and primitives get 0.
+func (e *Env) callHandler(kind byte, mode int) emulator.AddressHookFunc {
+	return func(emu *emulator.Emulator) bool {
+		midReg := 2
+		if mode == callNonvirtual {
+			midReg = 3
+		}
+
+		ref := e.method(emu.X(midReg))
+		if ref == nil {
+			ref = &memberRef{Static: mode == callStatic}
+		}
+
+		if v, ok := e.lookupMethod(ref, emu.X(1), mode); ok {
+			e.setReturn(emu, kind, v)
+			if kind != 'V' {
+				stubs.DefaultRegistry.Log("jni", "Call", ref.String()+" = "+describe(v))
+			} else {
+				stubs.DefaultRegistry.Log("jni", "Call", ref.String())
+			}
+		} else {
+			switch kind {
+			case 'V':
+			case 'L':
+				mock := e.mockObjBase + 0x40000
+				if mode == callStatic {
+					mock = e.mockObjBase + 0x50000
+				}
+				emu.SetX(0, mock)
+			default:
+				e.setReturn(emu, kind, nil)
+			}
+			if ref.Name != "" {
+				stubs.DefaultRegistry.Log("jni", "Call", ref.String()+" (unmodelled)")
+			}
+		}
+
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+}
+
+// lookupMethod returns the result of calling ref on obj, and whether the
+// model declares it. The receiver's own results and class take precedence
+// over the class the method ID was looked up on.
+func (e *Env) lookupMethod(ref *memberRef, obj uint64, mode int) (Value, bool) {
+	class := ref.Class
+	if mode != callStatic {
+		if o := e.Object(obj); o != nil {
+			if v, ok := o.Methods[ref.Name+ref.Sig]; ok {
+				return v, true
+			}
+			if mode == callVirtual {
+				class = o.Class
+			}
+		}
+	}
+	if mb := CurrentModel().FindMethod(class, ref.Name, ref.Sig, ref.Static); mb != nil {
+		return mb.Value, true
+	}
+	return nil, false
+}
+
+// Fields
+
+// lookupField returns the value of a field on obj (instance) or its class
+// (static), and whether the model declares it.
+func (e *Env) lookupField(ref *memberRef, obj uint64) (Value, bool) {
+	class := ref.Class
+	if ref.Static {
+		if v, ok := e.fieldWrite(fieldKey{nil, ref.key()}); ok {
+			return v, true
+		}
+	} else {
+		if o := e.Object(obj); o != nil {
+			if v, ok := e.fieldWrite(fieldKey{o, ref.Name}); ok {
+				return v, true
+			}
+			if v, ok := o.Fields[ref.Name]; ok {
+				return v, true
+			}
+			class = o.Class
+		}
+	}
+	if mb := CurrentModel().FindField(class, ref.Name, ref.Sig, ref.Static); mb != nil {
+		return mb.Value, true
+	}
+	return nil, false
+}
+
+// fieldKey names a field the guest set: a field of obj, or a static field
+// by class, name, and signature when obj is nil.
+type fieldKey struct {
+	obj  *Object
+	name string
+}
+
+func (e *Env) fieldWrite(k fieldKey) (Value, bool) {
+	e.fieldWritesMu.RLock()
+	defer e.fieldWritesMu.RUnlock()
+	v, ok := e.fieldWrites[k]
+	return v, ok
+}
+
+func (e *Env) setFieldWrite(k fieldKey, v Value) {
+	e.fieldWritesMu.Lock()
+	e.fieldWrites[k] = v
+	e.fieldWritesMu.Unlock()
+}
+
+// getFieldHandler returns a Get[Static]<Type>Field handler. X1 is the
+// object or, for static fields, the class; the field ID says which.
+func (e *Env) getFieldHandler(kind byte) emulator.AddressHookFunc {
+	return func(emu *emulator.Emulator) bool {
+		ref := e.field(emu.X(2))
+		if ref == nil {
+			e.setReturn(emu, kind, nil)
+			stubs.ReturnFromStub(emu)
+			return false
+		}
+
+		v, ok := e.lookupField(ref, emu.X(1))
+		e.setReturn(emu, kind, v)
+		if ok {
+			stubs.DefaultRegistry.Log("jni", "GetField", ref.String()+" = "+describe(v))
+		} else {
+			stubs.DefaultRegistry.Log("jni", "GetField", ref.String()+" (unmodelled)")
+		}
+
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+}
+
+// setFieldHandler returns a Set[Static]<Type>Field handler. Writes are kept
+// in the Env, so the shared model is the same for every run.
+func (e *Env) setFieldHandler(kind byte) emulator.AddressHookFunc {
+	return func(emu *emulator.Emulator) bool {
+		ref := e.field(emu.X(2))
+		if ref == nil {
+			stubs.ReturnFromStub(emu)
+			return false
+		}
+
+		v := e.argValue(emu, kind, 3, ref.Sig)
+		if ref.Static {
+			e.setFieldWrite(fieldKey{nil, ref.key()}, v)
+		} else if o := e.Object(emu.X(1)); o != nil {
+			e.setFieldWrite(fieldKey{o, ref.Name}, v)
+		}
+		stubs.DefaultRegistry.Log("jni", "SetField", ref.String()+" = "+describe(v))
+
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+}
+
+// Objects
+
+// stubNewObject handles AllocObject and NewObject{,V,A}: a fresh instance
+// with the class's field defaults. Constructor arguments are ignored.
+func (e *Env) stubNewObject(emu *emulator.Emulator) bool {
+	class := e.className(emu.X(1))
+	obj := CurrentModel().NewObject(class)
+	stubs.DefaultRegistry.Log("jni", "NewObject", class)
+	emu.SetX(0, e.objectRef(obj))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+// Arrays
+
+// arrayLength reads the jsize argument of a New*Array call. Negative and
+// oversized lengths fail the allocation, which returns NULL like ART does
+// when it throws OutOfMemoryError.
+func arrayLength(emu *emulator.Emulator, name string) (uint64, bool) {
+	length := int32(emu.X(1))
+	if length < 0 || length > maxArrayLen {
+		stubs.DefaultRegistry.Log("jni", name, fmt.Sprintf("length %d: OutOfMemoryError", length))
+		return 0, false
+	}
+	return uint64(length), true
+}
+
+func (e *Env) newArrayHandler(size int) emulator.AddressHookFunc {
+	return func(emu *emulator.Emulator) bool {
+		length, ok := arrayLength(emu, "NewArray")
+		if ok {
+			emu.SetX(0, e.newArray(length, make([]byte, length*uint64(size))))
+		} else {
+			emu.SetX(0, 0)
+		}
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+}
+
+func (e *Env) stubGetArrayElements(emu *emulator.Emulator) bool {
+	arr := emu.X(1)
+	isCopyPtr := emu.X(2)
+
+	if isCopyPtr != 0 {
+		emu.MemWriteU8(isCopyPtr, 0)
+	}
+
+	// Elements follow the length header
+	emu.SetX(0, arr+8)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func (e *Env) stubReleaseArrayElements(emu *emulator.Emulator) bool {
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+// arrayRegionHandler returns a Get/Set<Type>ArrayRegion handler:
+// (env, array, start, len, buf).
+func (e *Env) arrayRegionHandler(size int, set bool) emulator.AddressHookFunc {
+	return func(emu *emulator.Emulator) bool {
+		arr := emu.X(1)
+		start := emu.X(2) & 0xffffffff
+		n := emu.X(3) & 0xffffffff
+		buf := emu.X(4)
+
+		elems := arr + 8 + start*uint64(size)
+		src, dst := elems, buf
+		if set {
+			src, dst = buf, elems
+		}
+		if data, err := emu.MemRead(src, n*uint64(size)); err == nil {
+			emu.MemWrite(dst, data)
+		}
+
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+}
+
+func (e *Env) stubNewObjectArray(emu *emulator.Emulator) bool {
+	length, ok := arrayLength(emu, "NewObjectArray")
+	if !ok {
+		emu.SetX(0, 0)
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+	init := emu.X(3)
+
+	data := make([]byte, 8*length)
+	for i := uint64(0); i < length; i++ {
+		binary.LittleEndian.PutUint64(data[8*i:], init)
+	}
+	emu.SetX(0, e.newArray(length, data))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func (e *Env) stubGetObjectArrayElement(emu *emulator.Emulator) bool {
+	arr := emu.X(1)
+	index := emu.X(2) & 0xffffffff
+	elem, _ := emu.MemReadU64(arr + 8 + 8*index)
+	emu.SetX(0, elem)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func (e *Env) stubSetObjectArrayElement(emu *emulator.Emulator) bool {
+	arr := emu.X(1)
+	index := emu.X(2) & 0xffffffff
+	emu.MemWriteU64(arr+8+8*index, emu.X(3))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+// Strings
+
+func (e *Env) stubGetStringLength(emu *emulator.Emulator) bool {
+	e.jniStringsMu.RLock()
+	str := e.jniStrings[emu.X(1)]
+	e.jniStringsMu.RUnlock()
+
+	// Java string length is in UTF-16 code units
+	emu.SetX(0, uint64(len(utf16.Encode([]rune(str)))))
+	stubs.ReturnFromStub(emu)
+	return false
+}
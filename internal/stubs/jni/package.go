@@ -0,0 +1,153 @@
+package jni
+
+// Built-in model of the app's own package identity.
+//
+// Signature checks and key derivations commonly run
+//
+//	context.getPackageManager()
+//	       .getPackageInfo(context.getPackageName(), GET_SIGNATURES)
+//	       .signatures[0].toByteArray()
+//
+// through JNI and then hash the certificate. AddPackage declares that chain,
+// with SigningInfo for the GET_SIGNING_CERTIFICATES path, so the calls
+// return the real package name and certificate bytes.
+
+// Installer reported by getInstallerPackageName.
+const playStoreInstaller = "com.android.vending"
+
+// Package describes the app as seen by PackageManager.
+type Package struct {
+	Name        string
+	Certs       [][]byte // DER signing certificates, one per signer
+	VersionCode int64
+	VersionName string
+}
+
+// AddPackage adds the Context → PackageManager → PackageInfo → Signature
+// chain for pkg to m. Methods, fields and objects the model already
+// declares are kept, so a YAML model can override any link. pkg needs a
+// Name and at least one cert: guests rarely check for a null name or an
+// empty signatures array.
+func AddPackage(m *Model, pkg Package) {
+	sigs := make([]Value, len(pkg.Certs))
+	for i, cert := range pkg.Certs {
+		sigs[i] = signatureObject(cert)
+	}
+
+	var name Value
+	if pkg.Name != "" {
+		name = pkg.Name
+	}
+
+	signingInfo := object(m, "signingInfo", "android/content/pm/SigningInfo")
+	method(signingInfo, "getApkContentsSigners()[Landroid/content/pm/Signature;", sigs)
+	method(signingInfo, "getSigningCertificateHistory()[Landroid/content/pm/Signature;", sigs)
+	method(signingInfo, "hasMultipleSigners()Z", len(sigs) > 1)
+	method(signingInfo, "hasPastSigningCertificates()Z", false)
+
+	info := object(m, "packageInfo", "android/content/pm/PackageInfo")
+	field(info, "packageName", name)
+	field(info, "signatures", sigs)
+	field(info, "signingInfo", signingInfo)
+	field(info, "versionCode", pkg.VersionCode)
+	field(info, "versionName", nilIfEmpty(pkg.VersionName))
+
+	c := m.Class("android/content/pm/PackageInfo")
+	declareField(c, "packageName", "Ljava/lang/String;")
+	declareField(c, "signatures", "[Landroid/content/pm/Signature;")
+	declareField(c, "signingInfo", "Landroid/content/pm/SigningInfo;")
+	declareField(c, "versionCode", "I")
+	declareField(c, "versionName", "Ljava/lang/String;")
+
+	pm := object(m, "packageManager", "android/content/pm/PackageManager")
+	c = m.Class("android/content/pm/PackageManager")
+	declareMethod(c, "getPackageInfo", "(Ljava/lang/String;I)Landroid/content/pm/PackageInfo;", info)
+	declareMethod(c, "getPackageInfo", "(Ljava/lang/String;Landroid/content/pm/PackageManager$PackageInfoFlags;)Landroid/content/pm/PackageInfo;", info)
+	declareMethod(c, "getInstallerPackageName", "(Ljava/lang/String;)Ljava/lang/String;", playStoreInstaller)
+
+	context := object(m, "context", "android/content/Context")
+	c = m.Class("android/content/Context")
+	declareMethod(c, "getPackageName", "()Ljava/lang/String;", name)
+	declareMethod(c, "getPackageManager", "()Landroid/content/pm/PackageManager;", pm)
+	declareMethod(c, "getApplicationContext", "()Landroid/content/Context;", context)
+}
+
+// signatureObject returns an android.content.pm.Signature for a DER
+// certificate.
+func signatureObject(cert []byte) *Object {
+	return &Object{
+		Class:  "android/content/pm/Signature",
+		Fields: make(map[string]Value),
+		Methods: map[string]Value{
+			"toByteArray()[B":                   cert,
+			"toCharsString()Ljava/lang/String;": charsString(cert),
+			"hashCode()I":                       int64(arraysHashCode(cert)),
+		},
+	}
+}
+
+// charsString encodes bytes the way Signature.toCharsString does: two
+// lowercase hex digits per byte.
+func charsString(b []byte) string {
+	const digits = "0123456789abcdef"
+	out := make([]byte, 2*len(b))
+	for i, v := range b {
+		out[2*i] = digits[v>>4]
+		out[2*i+1] = digits[v&0xf]
+	}
+	return string(out)
+}
+
+// arraysHashCode is java.util.Arrays.hashCode(byte[]), which
+// Signature.hashCode returns.
+func arraysHashCode(b []byte) int32 {
+	h := int32(1)
+	for _, v := range b {
+		h = 31*h + int32(int8(v))
+	}
+	return h
+}
+
+// object returns the named model object, creating it if needed.
+func object(m *Model, name, class string) *Object {
+	if obj, ok := m.Objects[name]; ok {
+		return obj
+	}
+	obj := m.NewObject(class)
+	m.Objects[name] = obj
+	return obj
+}
+
+func method(obj *Object, key string, v Value) {
+	if obj.Methods == nil {
+		obj.Methods = make(map[string]Value)
+	}
+	if _, ok := obj.Methods[key]; !ok {
+		obj.Methods[key] = v
+	}
+}
+
+func field(obj *Object, name string, v Value) {
+	if _, ok := obj.Fields[name]; !ok {
+		obj.Fields[name] = v
+	}
+}
+
+func declareMethod(c *Class, name, sig string, v Value) {
+	if _, ok := c.Methods[name+sig]; !ok {
+		c.AddMethod(name, sig, false, v)
+	}
+}
+
+func declareField(c *Class, name, sig string) {
+	if _, ok := c.Fields[name+":"+sig]; !ok {
+		c.AddField(name, sig, false, nil)
+	}
+}
+
+func nilIfEmpty(s string) Value {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,18 @@
+package libc
+
+import (
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+func init() {
+	// bionic exports __errno; glibc-built code may reference __errno_location
+	stubs.RegisterFunc("libc", "__errno", stubErrno, "__errno_location")
+}
+
+func stubErrno(emu *emulator.Emulator) bool {
+	// int *__errno(void)
+	emu.SetX(0, emu.ErrnoAddr())
+	stubs.ReturnFromStub(emu)
+	return false
+}
@@ -0,0 +1,45 @@
+package libc
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+func TestErrnoLocation(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	testutil.CallStub(t, emu, stubErrno)
+	loc := emu.X(0)
+	if loc != emulator.TLSBase+emulator.TLSErrnoOffset {
+		t.Fatalf("__errno() = 0x%x, want TLS+0x%x", loc, emulator.TLSErrnoOffset)
+	}
+
+	// open(NULL) fails with EFAULT; the guest sees it through __errno()
+	emu.SetX(0, 0)
+	testutil.CallStub(t, emu, stubOpen)
+	if int64(emu.X(0)) != -1 {
+		t.Errorf("open(NULL) = %d, want -1", int64(emu.X(0)))
+	}
+	if v, _ := emu.MemReadU32(loc); v != stubs.EFAULT {
+		t.Errorf("errno = %d, want EFAULT", v)
+	}
+
+	// fopen of a file missing from the VFS returns NULL with ENOENT
+	path := emu.Malloc(32)
+	emu.MemWriteString(path, "/data/missing.cfg")
+	emu.SetX(0, path)
+	testutil.CallStub(t, emu, stubFopen)
+	if emu.X(0) != 0 {
+		t.Errorf("fopen = 0x%x, want NULL", emu.X(0))
+	}
+	if errno := emu.Errno(); errno != stubs.ENOENT {
+		t.Errorf("errno = %d, want ENOENT", errno)
+	}
+}
@@ -14,6 +14,11 @@ var (
 	fileFDMu     sync.Mutex
 	openFiles    = make(map[int]string) // fd -> path
 	filePosition = make(map[int]int64)  // fd -> current position
+
+	// SocketRead and SocketWrite serve read and write on the descriptors
+	// the network stubs own. They report false for any other descriptor.
+	SocketRead  func(emu *emulator.Emulator, fd int, buf, count uint64) (uint64, bool)
+	SocketWrite func(emu *emulator.Emulator, fd int, buf, count uint64) bool
 )
 
 func init() {
@@ -141,23 +146,72 @@ func allocFileFD(path string) int {
 	return fd
 }
 
+// IsFileFD reports whether fd is an open file or pipe descriptor.
+func IsFileFD(fd int) bool {
+	fileFDMu.Lock()
+	defer fileFDMu.Unlock()
+	_, ok := openFiles[fd]
+	return ok
+}
+
 func freeFileFD(fd int) {
 	fileFDMu.Lock()
 	delete(openFiles, fd)
 	delete(filePosition, fd)
+	delete(fileData, fd)
 	fileFDMu.Unlock()
 }
 
+// CloseFileFD releases a file or pipe descriptor, for close(2).
+// It reports whether fd was one.
+func CloseFileFD(fd int) bool {
+	if !IsFileFD(fd) {
+		return false
+	}
+	freeFileFD(fd)
+	return true
+}
+
+// readPath reads a pathname argument. It fails for NULL and empty paths,
+// which the kernel rejects with EFAULT and ENOENT.
+func readPath(emu *emulator.Emulator, ptr uint64) (string, bool) {
+	if ptr == 0 {
+		return "", false
+	}
+	path := readCString(emu, ptr, 4096)
+	return path, path != ""
+}
+
+// pathErrno returns the errno for a path readPath rejected.
+func pathErrno(ptr uint64) int {
+	if ptr == 0 {
+		return stubs.EFAULT
+	}
+	return stubs.ENOENT
+}
+
+// badFD reports whether fd can never be an open descriptor.
+func badFD(fd int) bool {
+	return fd < 0
+}
+
 func stubOpen(emu *emulator.Emulator) bool {
 	// int open(const char *pathname, int flags, mode_t mode)
 	pathPtr := emu.X(0)
 	// flags := emu.X(1)
 
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "open", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 
-	// Return a fake fd
-	fd := allocFileFD(path)
+	// Serve from the VFS if present, otherwise return a fake fd
+	fd := openVFSFile(path)
+	if fd < 0 {
+		fd = allocFileFD(path)
+	}
 	emu.SetX(0, uint64(fd))
 	stubs.ReturnFromStub(emu)
 	return false
@@ -168,10 +222,17 @@ func stubOpenat(emu *emulator.Emulator) bool {
 	// dirfd := emu.X(0)
 	pathPtr := emu.X(1)
 
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "openat", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 
-	fd := allocFileFD(path)
+	fd := openVFSFile(path)
+	if fd < 0 {
+		fd = allocFileFD(path)
+	}
 	emu.SetX(0, uint64(fd))
 	stubs.ReturnFromStub(emu)
 	return false
@@ -179,8 +240,12 @@ func stubOpenat(emu *emulator.Emulator) bool {
 
 func stubCreat(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(0)
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "creat", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 
 	fd := allocFileFD(path)
 	emu.SetX(0, uint64(fd))
@@ -190,15 +255,60 @@ func stubCreat(emu *emulator.Emulator) bool {
 
 func stubRead(emu *emulator.Emulator) bool {
 	// ssize_t read(int fd, void *buf, size_t count)
-	// Return 0 (EOF) for most reads
-	emu.SetX(0, 0)
+	fd := int(int32(emu.X(0)))
+	buf := emu.X(1)
+	count := emu.X(2)
+	if badFD(fd) {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
+
+	if SocketRead != nil {
+		if n, ok := SocketRead(emu, fd, buf, count); ok {
+			emu.SetX(0, n)
+			stubs.ReturnFromStub(emu)
+			return false
+		}
+	}
+
+	// Return 0 (EOF) for reads not backed by the VFS
+	n := uint64(0)
+	if data, pos, ok := vfsFile(fd); ok {
+		n = readVFS(emu, data, pos, buf, count)
+		vfsSeek(fd, pos+int64(n))
+	}
+	emu.SetX(0, n)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
+// readVFS copies up to count bytes of data starting at pos into guest memory.
+// Returns the number of bytes copied.
+func readVFS(emu *emulator.Emulator, data []byte, pos int64, buf, count uint64) uint64 {
+	if pos < 0 || pos >= int64(len(data)) || buf == 0 {
+		return 0
+	}
+	chunk := data[pos:]
+	if uint64(len(chunk)) > count {
+		chunk = chunk[:count]
+	}
+	if err := emu.MemWrite(buf, chunk); err != nil {
+		return 0
+	}
+	return uint64(len(chunk))
+}
+
 func stubWrite(emu *emulator.Emulator) bool {
 	// ssize_t write(int fd, const void *buf, size_t count)
+	fd := int(int32(emu.X(0)))
+	if badFD(fd) {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
 	count := emu.X(2)
+	if SocketWrite != nil {
+		SocketWrite(emu, fd, emu.X(1), count)
+	}
 	// Pretend we wrote everything
 	emu.SetX(0, count)
 	stubs.ReturnFromStub(emu)
@@ -206,7 +316,21 @@ func stubWrite(emu *emulator.Emulator) bool {
 }
 
 func stubPread(emu *emulator.Emulator) bool {
-	emu.SetX(0, 0) // EOF
+	// ssize_t pread(int fd, void *buf, size_t count, off_t offset)
+	fd := int(int32(emu.X(0)))
+	if badFD(fd) {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
+	if int64(emu.X(3)) < 0 {
+		stubs.ReturnError(emu, stubs.EINVAL)
+		return false
+	}
+	n := uint64(0) // EOF
+	if data, _, ok := vfsFile(fd); ok {
+		n = readVFS(emu, data, int64(emu.X(3)), emu.X(1), emu.X(2))
+	}
+	emu.SetX(0, n)
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -233,7 +357,34 @@ func stubWritev(emu *emulator.Emulator) bool {
 
 func stubLseek(emu *emulator.Emulator) bool {
 	// off_t lseek(int fd, off_t offset, int whence)
+	fd := int(int32(emu.X(0)))
 	offset := emu.X(1)
+	whence := emu.X(2)
+	if badFD(fd) {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
+
+	if data, pos, ok := vfsFile(fd); ok {
+		switch whence {
+		case 0: // SEEK_SET
+			pos = int64(offset)
+		case 1: // SEEK_CUR
+			pos += int64(offset)
+		case 2: // SEEK_END
+			pos = int64(len(data)) + int64(offset)
+		default:
+			stubs.ReturnError(emu, stubs.EINVAL)
+			return false
+		}
+		if pos < 0 {
+			stubs.ReturnError(emu, stubs.EINVAL)
+			return false
+		}
+		vfsSeek(fd, pos)
+		offset = uint64(pos)
+	}
+
 	// Return the offset
 	emu.SetX(0, offset)
 	stubs.ReturnFromStub(emu)
@@ -245,42 +396,64 @@ func stubStat(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(0)
 	statPtr := emu.X(1)
 
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "stat", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
+	if statPtr == 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
+	}
 
-	// Fill in a minimal stat structure (zeros mostly)
-	if statPtr != 0 {
-		// struct stat is large (144 bytes on arm64)
-		// Just zero it out and set st_mode to regular file
-		for i := uint64(0); i < 144; i += 8 {
-			emu.MemWriteU64(statPtr+i, 0)
-		}
-		// st_mode at offset 16 (0100644 = regular file, rw-r--r--)
-		emu.MemWriteU32(statPtr+16, 0100644)
-		// st_size at offset 48
-		emu.MemWriteU64(statPtr+48, 0)
+	size := int64(0)
+	if data, ok := LookupFile(path); ok {
+		size = int64(len(data))
 	}
+	writeStat(emu, statPtr, size)
 
 	emu.SetX(0, 0) // Success
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
+// writeStat fills in a minimal struct stat for a regular file of the given size.
+func writeStat(emu *emulator.Emulator, statPtr uint64, size int64) {
+	if statPtr == 0 {
+		return
+	}
+	// struct stat is large (144 bytes on arm64)
+	// Just zero it out and set st_mode to regular file
+	for i := uint64(0); i < 144; i += 8 {
+		emu.MemWriteU64(statPtr+i, 0)
+	}
+	// st_mode at offset 16 (0100644 = regular file, rw-r--r--)
+	emu.MemWriteU32(statPtr+16, 0100644)
+	// st_size at offset 48
+	emu.MemWriteU64(statPtr+48, uint64(size))
+}
+
 func stubLstat(emu *emulator.Emulator) bool {
 	return stubStat(emu)
 }
 
 func stubFstat(emu *emulator.Emulator) bool {
 	// int fstat(int fd, struct stat *statbuf)
+	fd := int(int32(emu.X(0)))
 	statPtr := emu.X(1)
-
-	if statPtr != 0 {
-		for i := uint64(0); i < 144; i += 8 {
-			emu.MemWriteU64(statPtr+i, 0)
-		}
-		emu.MemWriteU32(statPtr+16, 0100644)
+	if badFD(fd) {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
+	if statPtr == 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
 	}
 
+	data, _, _ := vfsFile(fd)
+	writeStat(emu, statPtr, int64(len(data)))
+
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -291,15 +464,22 @@ func stubFstatat(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(1)
 	statPtr := emu.X(2)
 
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "fstatat", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
+	if statPtr == 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
+	}
 
-	if statPtr != 0 {
-		for i := uint64(0); i < 144; i += 8 {
-			emu.MemWriteU64(statPtr+i, 0)
-		}
-		emu.MemWriteU32(statPtr+16, 0100644)
+	size := int64(0)
+	if data, ok := LookupFile(path); ok {
+		size = int64(len(data))
 	}
+	writeStat(emu, statPtr, size)
 
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
@@ -309,8 +489,12 @@ func stubFstatat(emu *emulator.Emulator) bool {
 func stubAccess(emu *emulator.Emulator) bool {
 	// int access(const char *pathname, int mode)
 	pathPtr := emu.X(0)
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "access", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 
 	emu.SetX(0, 0) // Success (file exists and is accessible)
 	stubs.ReturnFromStub(emu)
@@ -319,8 +503,12 @@ func stubAccess(emu *emulator.Emulator) bool {
 
 func stubFaccessat(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(1)
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "faccessat", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
@@ -328,7 +516,11 @@ func stubFaccessat(emu *emulator.Emulator) bool {
 }
 
 func stubDup(emu *emulator.Emulator) bool {
-	oldfd := int(emu.X(0))
+	oldfd := int(int32(emu.X(0)))
+	if badFD(oldfd) {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
 	fileFDMu.Lock()
 	path := openFiles[oldfd]
 	fileFDMu.Unlock()
@@ -341,6 +533,10 @@ func stubDup(emu *emulator.Emulator) bool {
 
 func stubDup2(emu *emulator.Emulator) bool {
 	// int dup2(int oldfd, int newfd)
+	if badFD(int(int32(emu.X(0)))) || badFD(int(int32(emu.X(1)))) {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
 	newfd := emu.X(1)
 	emu.SetX(0, newfd)
 	stubs.ReturnFromStub(emu)
@@ -348,6 +544,15 @@ func stubDup2(emu *emulator.Emulator) bool {
 }
 
 func stubDup3(emu *emulator.Emulator) bool {
+	// int dup3(int oldfd, int newfd, int flags)
+	if badFD(int(int32(emu.X(0)))) || badFD(int(int32(emu.X(1)))) {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
+	if emu.X(0) == emu.X(1) {
+		stubs.ReturnError(emu, stubs.EINVAL)
+		return false
+	}
 	newfd := emu.X(1)
 	emu.SetX(0, newfd)
 	stubs.ReturnFromStub(emu)
@@ -357,12 +562,14 @@ func stubDup3(emu *emulator.Emulator) bool {
 func stubPipe(emu *emulator.Emulator) bool {
 	// int pipe(int pipefd[2])
 	pipePtr := emu.X(0)
-	if pipePtr != 0 {
-		fd1 := allocFileFD("pipe[0]")
-		fd2 := allocFileFD("pipe[1]")
-		emu.MemWriteU32(pipePtr, uint32(fd1))
-		emu.MemWriteU32(pipePtr+4, uint32(fd2))
+	if pipePtr == 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
 	}
+	fd1 := allocFileFD("pipe[0]")
+	fd2 := allocFileFD("pipe[1]")
+	emu.MemWriteU32(pipePtr, uint32(fd1))
+	emu.MemWriteU32(pipePtr+4, uint32(fd2))
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -375,9 +582,20 @@ func stubPipe2(emu *emulator.Emulator) bool {
 func stubMmap(emu *emulator.Emulator) bool {
 	// void *mmap(void *addr, size_t length, int prot, int flags, int fd, off_t offset)
 	length := emu.X(1)
+	fd := int(int32(emu.X(4)))
+	offset := int64(emu.X(5))
+	if length == 0 {
+		stubs.ReturnError(emu, stubs.EINVAL) // MAP_FAILED
+		return false
+	}
 
 	// Allocate memory and return pointer
 	ptr := emu.Malloc(length)
+
+	// File-backed mappings of VFS descriptors get the file contents
+	if data, _, ok := vfsFile(fd); ok {
+		readVFS(emu, data, offset, ptr, length)
+	}
 	stubs.DefaultRegistry.Log("libc", "mmap", stubs.FormatPtrPair("ptr", ptr, "size", length))
 	emu.SetX(0, ptr)
 	stubs.ReturnFromStub(emu)
@@ -411,8 +629,12 @@ func stubMadvise(emu *emulator.Emulator) bool {
 
 func stubMkdir(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(0)
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "mkdir", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -420,8 +642,12 @@ func stubMkdir(emu *emulator.Emulator) bool {
 
 func stubMkdirat(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(1)
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "mkdirat", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -436,9 +662,17 @@ func stubRmdir(emu *emulator.Emulator) bool {
 func stubGetcwd(emu *emulator.Emulator) bool {
 	// char *getcwd(char *buf, size_t size)
 	buf := emu.X(0)
-	// size := emu.X(1)
+	size := emu.X(1)
 
 	cwd := "/data/data/com.app"
+	if buf != 0 && size == 0 {
+		stubs.ReturnNull(emu, stubs.EINVAL)
+		return false
+	}
+	if buf != 0 && size < uint64(len(cwd)+1) {
+		stubs.ReturnNull(emu, stubs.ERANGE)
+		return false
+	}
 	if buf != 0 {
 		emu.MemWriteString(buf, cwd)
 		emu.SetX(0, buf)
@@ -453,8 +687,12 @@ func stubGetcwd(emu *emulator.Emulator) bool {
 
 func stubChdir(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(0)
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "chdir", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -468,8 +706,12 @@ func stubFchdir(emu *emulator.Emulator) bool {
 
 func stubOpendir(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(0)
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "opendir", path)
+	if !ok {
+		stubs.ReturnNull(emu, pathErrno(pathPtr))
+		return false
+	}
 
 	// Return a fake DIR pointer
 	dir := emu.Malloc(64)
@@ -528,8 +770,12 @@ func stubRenameat(emu *emulator.Emulator) bool {
 
 func stubUnlink(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(0)
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "unlink", path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -574,16 +820,17 @@ func stubSymlinkat(emu *emulator.Emulator) bool {
 func stubReadlink(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(0)
 	buf := emu.X(1)
-	// bufSize := emu.X(2)
+	bufSize := emu.X(2)
 
-	path, _ := emu.MemReadString(pathPtr, 512)
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "readlink", path)
-
-	// Return the path itself as the link target
-	if buf != 0 {
-		emu.MemWriteString(buf, path)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
 	}
-	emu.SetX(0, uint64(len(path)))
+
+	// Return the path itself as the link target (truncated, unterminated)
+	emu.SetX(0, writeLink(emu, buf, bufSize, path))
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -591,16 +838,30 @@ func stubReadlink(emu *emulator.Emulator) bool {
 func stubReadlinkat(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(1)
 	buf := emu.X(2)
+	bufSize := emu.X(3)
 
-	path, _ := emu.MemReadString(pathPtr, 512)
-	if buf != 0 {
-		emu.MemWriteString(buf, path)
+	path, ok := readPath(emu, pathPtr)
+	if !ok {
+		stubs.ReturnError(emu, pathErrno(pathPtr))
+		return false
 	}
-	emu.SetX(0, uint64(len(path)))
+	emu.SetX(0, writeLink(emu, buf, bufSize, path))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
+// writeLink stores a readlink result, which is neither terminated nor
+// longer than bufSize. Returns the number of bytes stored.
+func writeLink(emu *emulator.Emulator, buf, bufSize uint64, target string) uint64 {
+	if uint64(len(target)) > bufSize {
+		target = target[:bufSize]
+	}
+	if buf != 0 {
+		emu.MemWrite(buf, []byte(target))
+	}
+	return uint64(len(target))
+}
+
 func stubChmod(emu *emulator.Emulator) bool {
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
@@ -742,8 +1003,16 @@ func stubRealpath(emu *emulator.Emulator) bool {
 	pathPtr := emu.X(0)
 	resolved := emu.X(1)
 
-	path, _ := emu.MemReadString(pathPtr, 512)
+	if pathPtr == 0 {
+		stubs.ReturnNull(emu, stubs.EINVAL)
+		return false
+	}
+	path, ok := readPath(emu, pathPtr)
 	stubs.DefaultRegistry.Log("libc", "realpath", path)
+	if !ok {
+		stubs.ReturnNull(emu, stubs.ENOENT)
+		return false
+	}
 
 	// Return the path as-is (simplified)
 	if resolved != 0 {
@@ -0,0 +1,663 @@
+package libc
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// The printf family is implemented by a C99 format engine that reads its
+// arguments the way AAPCS64 passes them. Integers and pointers occupy the next
+// free register of X0-X7 and doubles the next free register of V0-V7; once a
+// class runs out, arguments continue on the stack in 8-byte slots (16 bytes,
+// 16-byte aligned, for long double).
+//
+// The v* functions receive a va_list, which on AArch64 is a structure rather
+// than a pointer into the stack:
+//
+//	typedef struct {
+//		void *__stack;   // next stacked argument
+//		void *__gr_top;  // end of the saved X register area
+//		void *__vr_top;  // end of the saved V register area
+//		int   __gr_offs; // offset from __gr_top of the next X slot (< 0 while registers remain)
+//		int   __vr_offs; // offset from __vr_top of the next V slot (16-byte slots)
+//	} va_list;
+
+// maxFormatLen bounds how much of a format string or %s argument is read,
+// and the field width and precision of a conversion.
+const maxFormatLen = 64 << 10
+
+// varArgs supplies printf arguments in call order.
+type varArgs interface {
+	nextInt() uint64                 // next integer or pointer argument
+	nextFloat() uint64               // next double, as IEEE-754 bits
+	nextLongDouble() (lo, hi uint64) // next long double, as IEEE-754 binary128 halves
+}
+
+// regArgs reads variadic arguments from registers and the caller's stack.
+type regArgs struct {
+	emu   *emulator.Emulator
+	gr    int    // next X register
+	vr    int    // next V register
+	stack uint64 // next stacked argument
+}
+
+// newRegArgs returns the variadic arguments of a function whose first
+// variadic argument is passed in X[first]. It must be called on entry,
+// while SP still points at the caller's outgoing arguments.
+func newRegArgs(emu *emulator.Emulator, first int) *regArgs {
+	return &regArgs{emu: emu, gr: first, stack: emu.SP()}
+}
+
+func (a *regArgs) nextInt() uint64 {
+	if a.gr < 8 {
+		v := a.emu.X(a.gr)
+		a.gr++
+		return v
+	}
+	v, _ := a.emu.MemReadU64(a.stack)
+	a.stack += 8
+	return v
+}
+
+func (a *regArgs) nextFloat() uint64 {
+	if a.vr < 8 {
+		v := a.emu.D(a.vr)
+		a.vr++
+		return v
+	}
+	v, _ := a.emu.MemReadU64(a.stack)
+	a.stack += 8
+	return v
+}
+
+// nextLongDouble reads a binary128 argument from Q0-Q7 or the stack.
+func (a *regArgs) nextLongDouble() (lo, hi uint64) {
+	if a.vr < 8 {
+		lo, hi = a.emu.Q(a.vr)
+		a.vr++
+		return lo, hi
+	}
+	a.stack = (a.stack + 15) &^ 15
+	lo, _ = a.emu.MemReadU64(a.stack)
+	hi, _ = a.emu.MemReadU64(a.stack + 8)
+	a.stack += 16
+	return lo, hi
+}
+
+// vaListArgs reads arguments through an AAPCS64 va_list.
+type vaListArgs struct {
+	emu    *emulator.Emulator
+	stack  uint64
+	grTop  uint64
+	vrTop  uint64
+	grOffs int32
+	vrOffs int32
+}
+
+// newVaListArgs reads the va_list at ap. The guest's va_list is not modified.
+func newVaListArgs(emu *emulator.Emulator, ap uint64) *vaListArgs {
+	a := &vaListArgs{emu: emu}
+	a.stack, _ = emu.MemReadU64(ap)
+	a.grTop, _ = emu.MemReadU64(ap + 8)
+	a.vrTop, _ = emu.MemReadU64(ap + 16)
+	grOffs, _ := emu.MemReadU32(ap + 24)
+	vrOffs, _ := emu.MemReadU32(ap + 28)
+	a.grOffs = int32(grOffs)
+	a.vrOffs = int32(vrOffs)
+	return a
+}
+
+func (a *vaListArgs) nextInt() uint64 {
+	if a.grOffs < 0 {
+		v, _ := a.emu.MemReadU64(a.grTop + uint64(int64(a.grOffs)))
+		a.grOffs += 8
+		return v
+	}
+	v, _ := a.emu.MemReadU64(a.stack)
+	a.stack += 8
+	return v
+}
+
+func (a *vaListArgs) nextFloat() uint64 {
+	if a.vrOffs < 0 {
+		v, _ := a.emu.MemReadU64(a.vrTop + uint64(int64(a.vrOffs)))
+		a.vrOffs += 16
+		return v
+	}
+	v, _ := a.emu.MemReadU64(a.stack)
+	a.stack += 8
+	return v
+}
+
+func (a *vaListArgs) nextLongDouble() (lo, hi uint64) {
+	addr := a.vrTop + uint64(int64(a.vrOffs))
+	if a.vrOffs < 0 {
+		a.vrOffs += 16
+	} else {
+		a.stack = (a.stack + 15) &^ 15
+		addr = a.stack
+		a.stack += 16
+	}
+	lo, _ = a.emu.MemReadU64(addr)
+	hi, _ = a.emu.MemReadU64(addr + 8)
+	return lo, hi
+}
+
+// fmtSpec is a parsed conversion specification.
+type fmtSpec struct {
+	minus, plus, space, alt, zero bool
+
+	width  int
+	prec   int    // -1 if not given
+	length string // "", "hh", "h", "l", "ll", "j", "z", "t", "L"
+	verb   byte
+}
+
+// formatPrintf expands a printf format string, reading arguments from args.
+// Output follows bionic: %p prints as %#lx ("0x0" for NULL), a NULL %s
+// prints "(null)", and the '0' flag also pads %s and %c.
+func formatPrintf(emu *emulator.Emulator, format string, args varArgs) string {
+	var out strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			out.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(format) {
+			break
+		}
+
+		spec := fmtSpec{prec: -1}
+
+		// Flags
+	flags:
+		for ; i < len(format); i++ {
+			switch format[i] {
+			case '-':
+				spec.minus = true
+			case '+':
+				spec.plus = true
+			case ' ':
+				spec.space = true
+			case '#':
+				spec.alt = true
+			case '0':
+				spec.zero = true
+			case '\'':
+				// Thousands grouping is a no-op in the C locale
+			default:
+				break flags
+			}
+		}
+
+		// Field width
+		if i < len(format) && format[i] == '*' {
+			w := int64(int32(args.nextInt()))
+			if w < 0 {
+				spec.minus = true
+				w = -w
+			}
+			spec.width = int(clampField(w))
+			i++
+		} else {
+			for ; i < len(format) && isDigit(format[i]); i++ {
+				spec.width = int(clampField(int64(spec.width)*10 + int64(format[i]-'0')))
+			}
+		}
+
+		// Precision
+		if i < len(format) && format[i] == '.' {
+			i++
+			spec.prec = 0
+			if i < len(format) && format[i] == '*' {
+				if p := int32(args.nextInt()); p >= 0 {
+					spec.prec = int(clampField(int64(p)))
+				} else {
+					spec.prec = -1
+				}
+				i++
+			} else {
+				for ; i < len(format) && isDigit(format[i]); i++ {
+					spec.prec = int(clampField(int64(spec.prec)*10 + int64(format[i]-'0')))
+				}
+			}
+		}
+
+		// Length modifier
+		if i < len(format) {
+			switch format[i] {
+			case 'h', 'l':
+				spec.length = format[i : i+1]
+				if i+1 < len(format) && format[i+1] == format[i] {
+					spec.length += spec.length
+					i++
+				}
+				i++
+			case 'q':
+				spec.length = "ll"
+				i++
+			case 'j', 'z', 't', 'L':
+				spec.length = format[i : i+1]
+				i++
+			}
+		}
+		if i >= len(format) {
+			break
+		}
+		spec.verb = format[i]
+
+		switch spec.verb {
+		case 'd', 'i':
+			out.WriteString(formatSigned(spec, args.nextInt()))
+		case 'u', 'o', 'x', 'X':
+			out.WriteString(formatUnsigned(spec, args.nextInt()))
+		case 'p':
+			spec.alt = true
+			spec.length = "l"
+			spec.verb = 'x'
+			out.WriteString(pad(spec, "0x", formatDigits(spec, args.nextInt(), 16)))
+		case 'c', 'C':
+			var s string
+			if spec.length == "l" || spec.verb == 'C' {
+				s = string(rune(uint32(args.nextInt())))
+			} else {
+				s = string([]byte{byte(args.nextInt())})
+			}
+			out.WriteString(pad(spec, "", s))
+		case 's', 'S':
+			ptr := args.nextInt()
+			var s string
+			if spec.length == "l" || spec.verb == 'S' {
+				s = readWideString(emu, ptr, spec.prec)
+			} else {
+				s = readFormatString(emu, ptr, spec.prec)
+			}
+			out.WriteString(pad(spec, "", s))
+		case 'f', 'F', 'e', 'E', 'g', 'G', 'a', 'A':
+			var v float64
+			if spec.length == "L" {
+				v = quadToFloat64(args.nextLongDouble())
+			} else {
+				v = math.Float64frombits(args.nextFloat())
+			}
+			out.WriteString(formatFloat(spec, v))
+		case 'n':
+			writeCount(emu, spec.length, args.nextInt(), out.Len())
+		default:
+			// "%%" and unknown conversions print the conversion character
+			out.WriteString(pad(spec, "", string(spec.verb)))
+		}
+	}
+
+	return out.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// truncateInt narrows a raw argument to the size given by the length modifier.
+// Without a modifier the argument is an int, so the upper 32 bits are ignored.
+func truncateInt(length string, v uint64, signed bool) uint64 {
+	var bits uint
+	switch length {
+	case "hh":
+		bits = 8
+	case "h":
+		bits = 16
+	case "":
+		bits = 32
+	default:
+		return v
+	}
+	v &= 1<<bits - 1
+	if signed && v&(1<<(bits-1)) != 0 {
+		v |= ^uint64(0) << bits
+	}
+	return v
+}
+
+// formatSigned formats %d and %i.
+func formatSigned(spec fmtSpec, raw uint64) string {
+	v := int64(truncateInt(spec.length, raw, true))
+	sign := ""
+	mag := uint64(v)
+	switch {
+	case v < 0:
+		sign = "-"
+		mag = uint64(-v)
+	case spec.plus:
+		sign = "+"
+	case spec.space:
+		sign = " "
+	}
+	return pad(spec, sign, formatDigits(spec, mag, 10))
+}
+
+// formatUnsigned formats %u, %o, %x, and %X.
+func formatUnsigned(spec fmtSpec, raw uint64) string {
+	v := truncateInt(spec.length, raw, false)
+	base := 10
+	switch spec.verb {
+	case 'o':
+		base = 8
+	case 'x', 'X':
+		base = 16
+	}
+
+	digits := formatDigits(spec, v, base)
+	prefix := ""
+	if spec.alt {
+		switch {
+		case base == 8 && !strings.HasPrefix(digits, "0"):
+			digits = "0" + digits
+		case base == 16 && v != 0:
+			prefix = "0" + string(spec.verb)
+		}
+	}
+	return pad(spec, prefix, digits)
+}
+
+// clampField limits a field width or precision to maxFormatLen.
+func clampField(n int64) int64 {
+	if n > maxFormatLen {
+		return maxFormatLen
+	}
+	return n
+}
+
+// formatDigits converts an integer magnitude, applying the precision as a
+// minimum digit count. A zero value with zero precision produces no digits.
+func formatDigits(spec fmtSpec, v uint64, base int) string {
+	if v == 0 && spec.prec == 0 {
+		return ""
+	}
+	digits := strconv.FormatUint(v, base)
+	if spec.verb == 'X' {
+		digits = strings.ToUpper(digits)
+	}
+	if spec.prec > len(digits) {
+		digits = strings.Repeat("0", spec.prec-len(digits)) + digits
+	}
+	return digits
+}
+
+// pad applies the field width. Zero padding goes between the sign or radix
+// prefix and the digits, and is ignored for integers with a precision.
+func pad(spec fmtSpec, prefix, body string) string {
+	n := spec.width - len(prefix) - len(body)
+	if n <= 0 {
+		return prefix + body
+	}
+	switch {
+	case spec.minus:
+		return prefix + body + strings.Repeat(" ", n)
+	case spec.zero && !(spec.prec >= 0 && isIntVerb(spec.verb)):
+		return prefix + strings.Repeat("0", n) + body
+	default:
+		return strings.Repeat(" ", n) + prefix + body
+	}
+}
+
+func isIntVerb(c byte) bool {
+	return strings.IndexByte("diouxXp", c) >= 0
+}
+
+// formatFloat formats %f, %e, %g, and %a and their uppercase forms.
+func formatFloat(spec fmtSpec, v float64) string {
+	upper := spec.verb >= 'A' && spec.verb <= 'Z'
+	verb := spec.verb | 0x20
+
+	sign := ""
+	switch {
+	case math.Signbit(v) && !math.IsNaN(v):
+		sign = "-"
+	case spec.plus && !math.IsNaN(v):
+		sign = "+"
+	case spec.space && !math.IsNaN(v):
+		sign = " "
+	}
+	v = math.Abs(v)
+
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		s := "inf"
+		if math.IsNaN(v) {
+			s = "nan"
+		}
+		if upper {
+			s = strings.ToUpper(s)
+		}
+		spec.zero = false
+		return pad(spec, sign, s)
+	}
+
+	prec := spec.prec
+	if prec < 0 && verb != 'a' {
+		prec = 6
+	}
+
+	var body string
+	switch verb {
+	case 'f':
+		body = strconv.FormatFloat(v, 'f', prec, 64)
+		if spec.alt && prec == 0 {
+			body += "."
+		}
+	case 'e':
+		body = formatExp(v, prec, spec.alt)
+	case 'g':
+		body = formatGeneral(v, prec, spec.alt)
+	case 'a':
+		body = formatHexFloat(v, prec, spec.alt)
+		sign += body[:2]
+		body = body[2:]
+	}
+
+	if upper {
+		sign = strings.ToUpper(sign)
+		body = strings.ToUpper(body)
+	}
+	return pad(spec, sign, body)
+}
+
+// formatExp formats v as d.ddde±dd.
+func formatExp(v float64, prec int, alt bool) string {
+	s := strconv.FormatFloat(v, 'e', prec, 64)
+	if alt && prec == 0 {
+		e := strings.IndexByte(s, 'e')
+		s = s[:e] + "." + s[e:]
+	}
+	return s
+}
+
+// formatGeneral implements %g: style e is used if the exponent is less than
+// -4 or at least the precision, and trailing zeros are removed unless '#'.
+func formatGeneral(v float64, prec int, alt bool) string {
+	if prec == 0 {
+		prec = 1
+	}
+
+	// The exponent is taken after rounding to prec significant digits
+	e := strconv.FormatFloat(v, 'e', prec-1, 64)
+	exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+
+	var s string
+	if exp < -4 || exp >= prec {
+		s = e
+	} else {
+		s = strconv.FormatFloat(v, 'f', prec-1-exp, 64)
+	}
+
+	if alt {
+		if !strings.Contains(s, ".") {
+			if i := strings.IndexByte(s, 'e'); i >= 0 {
+				s = s[:i] + "." + s[i:]
+			} else {
+				s += "."
+			}
+		}
+		return s
+	}
+
+	mant, exps := s, ""
+	if i := strings.IndexByte(s, 'e'); i >= 0 {
+		mant, exps = s[:i], s[i:]
+	}
+	if strings.Contains(mant, ".") {
+		mant = strings.TrimRight(mant, "0")
+		mant = strings.TrimSuffix(mant, ".")
+	}
+	return mant + exps
+}
+
+// formatHexFloat formats v as 0xh.hhhp±d. Without a precision the shortest
+// exact representation is used.
+func formatHexFloat(v float64, prec int, alt bool) string {
+	s := strconv.FormatFloat(v, 'x', prec, 64)
+
+	// Go always prints at least two exponent digits; C prints the minimum
+	p := strings.IndexByte(s, 'p')
+	exp := strings.TrimLeft(s[p+2:], "0")
+	if exp == "" {
+		exp = "0"
+	}
+	mant := s[:p]
+	if alt && !strings.Contains(mant, ".") {
+		mant += "."
+	}
+	return mant + s[p:p+2] + exp
+}
+
+// quadToFloat64 converts an IEEE-754 binary128 value to the nearest lower
+// double. Values outside the double range become zero or infinity.
+func quadToFloat64(lo, hi uint64) float64 {
+	sign := hi >> 63
+	exp := int(hi >> 48 & 0x7fff)
+	mant := (hi&(1<<48-1))<<4 | lo>>60
+
+	var f float64
+	switch {
+	case exp == 0x7fff && (mant != 0 || lo<<4 != 0):
+		f = math.NaN()
+	case exp == 0x7fff:
+		f = math.Inf(1)
+	case exp == 0:
+		f = 0
+	default:
+		f = math.Ldexp(1+float64(mant)/(1<<52), exp-16383)
+	}
+	if sign != 0 {
+		f = -f
+	}
+	return f
+}
+
+// readFormatString reads a %s argument. With a precision, at most prec
+// bytes are read, so the string need not be terminated.
+func readFormatString(emu *emulator.Emulator, ptr uint64, prec int) string {
+	if ptr == 0 {
+		if prec >= 0 && prec < len("(null)") {
+			return "(null)"[:prec]
+		}
+		return "(null)"
+	}
+	limit := maxFormatLen
+	if prec >= 0 && prec < limit {
+		limit = prec
+	}
+	return readCString(emu, ptr, limit)
+}
+
+// readCString reads a NUL-terminated string of at most limit bytes in
+// chunks, so strings ending near the end of a mapping are still read.
+func readCString(emu *emulator.Emulator, ptr uint64, limit int) string {
+	var buf []byte
+	for len(buf) < limit {
+		n := 256 - int(ptr%256)
+		if n > limit-len(buf) {
+			n = limit - len(buf)
+		}
+		chunk, err := emu.MemRead(ptr, uint64(n))
+		if err != nil {
+			break
+		}
+		for i, b := range chunk {
+			if b == 0 {
+				return string(append(buf, chunk[:i]...))
+			}
+		}
+		buf = append(buf, chunk...)
+		ptr += uint64(n)
+	}
+	return string(buf)
+}
+
+// readWideString reads a %ls argument (32-bit wchar_t) and encodes it as
+// UTF-8. The precision limits output bytes without splitting a character.
+func readWideString(emu *emulator.Emulator, ptr uint64, prec int) string {
+	if ptr == 0 {
+		return "(null)"
+	}
+	var out []byte
+	for len(out) < maxFormatLen {
+		c, err := emu.MemReadU32(ptr)
+		if err != nil || c == 0 {
+			break
+		}
+		r := rune(c)
+		if prec >= 0 && len(out)+utf8.RuneLen(r) > prec {
+			break
+		}
+		out = utf8.AppendRune(out, r)
+		ptr += 4
+	}
+	return string(out)
+}
+
+// writeCount implements %n, storing the number of bytes written so far.
+func writeCount(emu *emulator.Emulator, length string, ptr uint64, n int) {
+	if ptr == 0 {
+		return
+	}
+	switch length {
+	case "hh":
+		emu.MemWriteU8(ptr, uint8(n))
+	case "h":
+		emu.MemWriteU16(ptr, uint16(n))
+	case "":
+		emu.MemWriteU32(ptr, uint32(n))
+	default:
+		emu.MemWriteU64(ptr, uint64(n))
+	}
+}
+
+// sprintfRegs formats the string at fmtPtr with variadic arguments starting at X[first].
+func sprintfRegs(emu *emulator.Emulator, fmtPtr uint64, first int) string {
+	format := readCString(emu, fmtPtr, maxFormatLen)
+	return formatPrintf(emu, format, newRegArgs(emu, first))
+}
+
+// sprintfVaList formats the string at fmtPtr with arguments from the va_list at ap.
+func sprintfVaList(emu *emulator.Emulator, fmtPtr, ap uint64) string {
+	format := readCString(emu, fmtPtr, maxFormatLen)
+	return formatPrintf(emu, format, newVaListArgs(emu, ap))
+}
+
+// writeBounded stores s at dest with snprintf semantics: at most n-1 bytes
+// followed by a NUL terminator, and nothing if n is 0.
+func writeBounded(emu *emulator.Emulator, dest, n uint64, s string) {
+	if n == 0 || dest == 0 {
+		return
+	}
+	if uint64(len(s)) >= n {
+		s = s[:n-1]
+	}
+	emu.MemWriteString(dest, s)
+}
@@ -10,6 +10,8 @@ func init() {
 	stubs.RegisterFunc("libc", "fprintf", stubFprintf)
 	stubs.RegisterFunc("libc", "vprintf", stubVprintf)
 	stubs.RegisterFunc("libc", "vfprintf", stubVfprintf)
+	stubs.RegisterFunc("libc", "dprintf", stubDprintf)
+	stubs.RegisterFunc("libc", "vdprintf", stubVdprintf)
 	stubs.RegisterFunc("libc", "sprintf", stubSprintf)
 	stubs.RegisterFunc("libc", "snprintf", stubSnprintf)
 	stubs.RegisterFunc("libc", "vsprintf", stubVsprintf)
@@ -21,8 +23,10 @@ func init() {
 	stubs.RegisterFunc("libc", "__vsnprintf_chk", stubVsnprintfChk)
 	stubs.RegisterFunc("libc", "__snprintf_chk", stubSnprintfChk)
 	stubs.RegisterFunc("libc", "__sprintf_chk", stubSprintfChk)
+	stubs.RegisterFunc("libc", "__vsprintf_chk", stubVsprintfChk)
 	stubs.RegisterFunc("libc", "__printf_chk", stubPrintfChk)
 	stubs.RegisterFunc("libc", "__fprintf_chk", stubFprintfChk)
+	stubs.RegisterFunc("libc", "__vfprintf_chk", stubVfprintfChk)
 
 	stubs.RegisterFunc("libc", "puts", stubPuts)
 	stubs.RegisterFunc("libc", "fputs", stubFputs)
@@ -48,79 +52,98 @@ func init() {
 }
 
 func stubPrintf(emu *emulator.Emulator) bool {
-	fmtPtr := emu.X(0)
-	format, _ := emu.MemReadString(fmtPtr, 256)
-	stubs.DefaultRegistry.Log("libc", "printf", format)
-	emu.SetX(0, uint64(len(format)))
+	out := sprintfRegs(emu, emu.X(0), 1)
+	stubs.DefaultRegistry.Log("libc", "printf", out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubFprintf(emu *emulator.Emulator) bool {
-	// stream := emu.X(0)
-	fmtPtr := emu.X(1)
-	format, _ := emu.MemReadString(fmtPtr, 256)
-	stubs.DefaultRegistry.Log("libc", "fprintf", format)
-	emu.SetX(0, uint64(len(format)))
+	// int fprintf(FILE *stream, const char *format, ...)
+	out := sprintfRegs(emu, emu.X(1), 2)
+	stubs.DefaultRegistry.Log("libc", "fprintf", out)
+	emu.SetX(0, uint64(len(out)))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubDprintf(emu *emulator.Emulator) bool {
+	// int dprintf(int fd, const char *format, ...)
+	out := sprintfRegs(emu, emu.X(1), 2)
+	stubs.DefaultRegistry.Log("libc", "dprintf", out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubVprintf(emu *emulator.Emulator) bool {
-	fmtPtr := emu.X(0)
-	format, _ := emu.MemReadString(fmtPtr, 256)
-	stubs.DefaultRegistry.Log("libc", "vprintf", format)
-	emu.SetX(0, uint64(len(format)))
+	// int vprintf(const char *format, va_list ap)
+	out := sprintfVaList(emu, emu.X(0), emu.X(1))
+	stubs.DefaultRegistry.Log("libc", "vprintf", out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubVfprintf(emu *emulator.Emulator) bool {
-	fmtPtr := emu.X(1)
-	format, _ := emu.MemReadString(fmtPtr, 256)
-	stubs.DefaultRegistry.Log("libc", "vfprintf", format)
-	emu.SetX(0, uint64(len(format)))
+	// int vfprintf(FILE *stream, const char *format, va_list ap)
+	out := sprintfVaList(emu, emu.X(1), emu.X(2))
+	stubs.DefaultRegistry.Log("libc", "vfprintf", out)
+	emu.SetX(0, uint64(len(out)))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubVdprintf(emu *emulator.Emulator) bool {
+	// int vdprintf(int fd, const char *format, va_list ap)
+	out := sprintfVaList(emu, emu.X(1), emu.X(2))
+	stubs.DefaultRegistry.Log("libc", "vdprintf", out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubSprintf(emu *emulator.Emulator) bool {
+	// int sprintf(char *s, const char *format, ...)
 	dest := emu.X(0)
-	fmtPtr := emu.X(1)
-	format, _ := emu.MemReadString(fmtPtr, 256)
-
-	// Write format string directly (no actual formatting)
-	emu.MemWriteString(dest, format)
-
-	emu.SetX(0, uint64(len(format)))
+	out := sprintfRegs(emu, emu.X(1), 2)
+	emu.MemWriteString(dest, out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubSnprintf(emu *emulator.Emulator) bool {
+	// int snprintf(char *s, size_t n, const char *format, ...)
 	dest := emu.X(0)
 	n := emu.X(1)
-	fmtPtr := emu.X(2)
-	format, _ := emu.MemReadString(fmtPtr, int(n))
-
-	if n > 0 {
-		if uint64(len(format)) >= n {
-			format = format[:n-1]
-		}
-		emu.MemWriteString(dest, format)
-	}
-
-	emu.SetX(0, uint64(len(format)))
+	out := sprintfRegs(emu, emu.X(2), 3)
+	writeBounded(emu, dest, n, out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubVsprintf(emu *emulator.Emulator) bool {
-	return stubSprintf(emu)
+	// int vsprintf(char *s, const char *format, va_list ap)
+	dest := emu.X(0)
+	out := sprintfVaList(emu, emu.X(1), emu.X(2))
+	emu.MemWriteString(dest, out)
+	emu.SetX(0, uint64(len(out)))
+	stubs.ReturnFromStub(emu)
+	return false
 }
 
 func stubVsnprintf(emu *emulator.Emulator) bool {
-	return stubSnprintf(emu)
+	// int vsnprintf(char *s, size_t n, const char *format, va_list ap)
+	dest := emu.X(0)
+	n := emu.X(1)
+	out := sprintfVaList(emu, emu.X(2), emu.X(3))
+	writeBounded(emu, dest, n, out)
+	emu.SetX(0, uint64(len(out)))
+	stubs.ReturnFromStub(emu)
+	return false
 }
 
 // Fortified variants - __*_chk functions add buffer overflow checking
@@ -130,19 +153,9 @@ func stubVsnprintfChk(emu *emulator.Emulator) bool {
 	// int __vsnprintf_chk(char *s, size_t maxlen, int flag, size_t slen, const char *format, va_list ap)
 	dest := emu.X(0)
 	n := emu.X(1)
-	// flag := emu.X(2)
-	// slen := emu.X(3)
-	fmtPtr := emu.X(4)
-	format, _ := emu.MemReadString(fmtPtr, int(n))
-
-	if n > 0 {
-		if uint64(len(format)) >= n {
-			format = format[:n-1]
-		}
-		emu.MemWriteString(dest, format)
-	}
-
-	emu.SetX(0, uint64(len(format)))
+	out := sprintfVaList(emu, emu.X(4), emu.X(5))
+	writeBounded(emu, dest, n, out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -151,19 +164,9 @@ func stubSnprintfChk(emu *emulator.Emulator) bool {
 	// int __snprintf_chk(char *s, size_t maxlen, int flag, size_t slen, const char *format, ...)
 	dest := emu.X(0)
 	n := emu.X(1)
-	// flag := emu.X(2)
-	// slen := emu.X(3)
-	fmtPtr := emu.X(4)
-	format, _ := emu.MemReadString(fmtPtr, int(n))
-
-	if n > 0 {
-		if uint64(len(format)) >= n {
-			format = format[:n-1]
-		}
-		emu.MemWriteString(dest, format)
-	}
-
-	emu.SetX(0, uint64(len(format)))
+	out := sprintfRegs(emu, emu.X(4), 5)
+	writeBounded(emu, dest, n, out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -171,57 +174,75 @@ func stubSnprintfChk(emu *emulator.Emulator) bool {
 func stubSprintfChk(emu *emulator.Emulator) bool {
 	// int __sprintf_chk(char *s, int flag, size_t slen, const char *format, ...)
 	dest := emu.X(0)
-	// flag := emu.X(1)
-	// slen := emu.X(2)
-	fmtPtr := emu.X(3)
-	format, _ := emu.MemReadString(fmtPtr, 256)
+	out := sprintfRegs(emu, emu.X(3), 4)
+	emu.MemWriteString(dest, out)
+	emu.SetX(0, uint64(len(out)))
+	stubs.ReturnFromStub(emu)
+	return false
+}
 
-	emu.MemWriteString(dest, format)
-	emu.SetX(0, uint64(len(format)))
+func stubVsprintfChk(emu *emulator.Emulator) bool {
+	// int __vsprintf_chk(char *s, int flag, size_t slen, const char *format, va_list ap)
+	dest := emu.X(0)
+	out := sprintfVaList(emu, emu.X(3), emu.X(4))
+	emu.MemWriteString(dest, out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubPrintfChk(emu *emulator.Emulator) bool {
 	// int __printf_chk(int flag, const char *format, ...)
-	// flag := emu.X(0)
-	fmtPtr := emu.X(1)
-	format, _ := emu.MemReadString(fmtPtr, 256)
-	stubs.DefaultRegistry.Log("libc", "__printf_chk", format)
-	emu.SetX(0, uint64(len(format)))
+	out := sprintfRegs(emu, emu.X(1), 2)
+	stubs.DefaultRegistry.Log("libc", "__printf_chk", out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubFprintfChk(emu *emulator.Emulator) bool {
 	// int __fprintf_chk(FILE *stream, int flag, const char *format, ...)
-	// stream := emu.X(0)
-	// flag := emu.X(1)
-	fmtPtr := emu.X(2)
-	format, _ := emu.MemReadString(fmtPtr, 256)
-	stubs.DefaultRegistry.Log("libc", "__fprintf_chk", format)
-	emu.SetX(0, uint64(len(format)))
+	out := sprintfRegs(emu, emu.X(2), 3)
+	stubs.DefaultRegistry.Log("libc", "__fprintf_chk", out)
+	emu.SetX(0, uint64(len(out)))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubVfprintfChk(emu *emulator.Emulator) bool {
+	// int __vfprintf_chk(FILE *stream, int flag, const char *format, va_list ap)
+	out := sprintfVaList(emu, emu.X(2), emu.X(3))
+	stubs.DefaultRegistry.Log("libc", "__vfprintf_chk", out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubAsprintf(emu *emulator.Emulator) bool {
+	// int asprintf(char **strp, const char *format, ...)
 	retPtr := emu.X(0)
-	fmtPtr := emu.X(1)
-	format, _ := emu.MemReadString(fmtPtr, 256)
-
-	// Allocate buffer and write
-	buf := emu.Malloc(uint64(len(format) + 1))
-	emu.MemWriteString(buf, format)
-	emu.MemWriteU64(retPtr, buf)
-
-	emu.SetX(0, uint64(len(format)))
+	out := sprintfRegs(emu, emu.X(1), 2)
+	storeAllocated(emu, retPtr, out)
+	emu.SetX(0, uint64(len(out)))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubVasprintf(emu *emulator.Emulator) bool {
-	return stubAsprintf(emu)
+	// int vasprintf(char **strp, const char *format, va_list ap)
+	retPtr := emu.X(0)
+	out := sprintfVaList(emu, emu.X(1), emu.X(2))
+	storeAllocated(emu, retPtr, out)
+	emu.SetX(0, uint64(len(out)))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+// storeAllocated copies s into a new heap buffer and stores its address at retPtr.
+func storeAllocated(emu *emulator.Emulator, retPtr uint64, s string) {
+	buf := emu.Malloc(uint64(len(s) + 1))
+	emu.MemWriteString(buf, s)
+	emu.MemWriteU64(retPtr, buf)
 }
 
 func stubPuts(emu *emulator.Emulator) bool {
@@ -269,8 +290,29 @@ func stubFwrite(emu *emulator.Emulator) bool {
 }
 
 func stubFread(emu *emulator.Emulator) bool {
-	// Return 0 items read
-	emu.SetX(0, 0)
+	// size_t fread(void *ptr, size_t size, size_t nmemb, FILE *stream)
+	ptr := emu.X(0)
+	size := emu.X(1)
+	nmemb := emu.X(2)
+
+	// bionic fails a size*nmemb that overflows with EOVERFLOW
+	if size != 0 && nmemb > ^uint64(0)/size {
+		emu.SetErrno(stubs.EOVERFLOW)
+		emu.SetX(0, 0)
+		stubs.ReturnFromStub(emu)
+		return false
+	}
+
+	// Return 0 items read for streams not backed by the VFS
+	items := uint64(0)
+	if fd, ok := streamFD(emu.X(3)); ok && size > 0 {
+		if data, pos, ok := vfsFile(fd); ok {
+			n := readVFS(emu, data, pos, ptr, size*nmemb)
+			vfsSeek(fd, pos+int64(n))
+			items = n / size
+		}
+	}
+	emu.SetX(0, items)
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -282,37 +324,78 @@ func stubFflush(emu *emulator.Emulator) bool {
 }
 
 func stubFclose(emu *emulator.Emulator) bool {
+	if fd, ok := streamFD(emu.X(0)); ok {
+		closeStream(emu.X(0))
+		freeFileFD(fd)
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubFopen(emu *emulator.Emulator) bool {
-	// Return NULL (file not found)
-	emu.SetX(0, 0)
+	// FILE *fopen(const char *pathname, const char *mode)
+	path, _ := emu.MemReadString(emu.X(0), 512)
+	stubs.DefaultRegistry.Log("libc", "fopen", path)
+
+	// Fail with ENOENT unless the file is in the VFS
+	fd := openVFSFile(path)
+	if fd < 0 {
+		stubs.ReturnNull(emu, stubs.ENOENT)
+		return false
+	}
+	emu.SetX(0, openStream(emu, fd))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubFseek(emu *emulator.Emulator) bool {
+	// int fseek(FILE *stream, long offset, int whence)
+	if fd, ok := streamFD(emu.X(0)); ok {
+		if data, pos, ok := vfsFile(fd); ok {
+			offset := int64(emu.X(1))
+			switch emu.X(2) {
+			case 1: // SEEK_CUR
+				pos += offset
+			case 2: // SEEK_END
+				pos = int64(len(data)) + offset
+			default: // SEEK_SET
+				pos = offset
+			}
+			vfsSeek(fd, pos)
+		}
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubFtell(emu *emulator.Emulator) bool {
-	emu.SetX(0, 0)
+	pos := int64(0)
+	if fd, ok := streamFD(emu.X(0)); ok {
+		_, pos, _ = vfsFile(fd)
+	}
+	emu.SetX(0, uint64(pos))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubRewind(emu *emulator.Emulator) bool {
+	if fd, ok := streamFD(emu.X(0)); ok {
+		vfsSeek(fd, 0)
+	}
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubFeof(emu *emulator.Emulator) bool {
-	emu.SetX(0, 1) // Return EOF
+	eof := uint64(1) // Return EOF
+	if fd, ok := streamFD(emu.X(0)); ok {
+		if data, pos, ok := vfsFile(fd); ok && pos < int64(len(data)) {
+			eof = 0
+		}
+	}
+	emu.SetX(0, eof)
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -329,7 +412,11 @@ func stubClearerr(emu *emulator.Emulator) bool {
 }
 
 func stubFileno(emu *emulator.Emulator) bool {
-	emu.SetX(0, 1) // Return stdout fd
+	fd := 1 // Return stdout fd
+	if vfd, ok := streamFD(emu.X(0)); ok {
+		fd = vfd
+	}
+	emu.SetX(0, uint64(fd))
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -0,0 +1,315 @@
+package libc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+// printfArg is a variadic argument: an integer/pointer, a double, or a long
+// double whose binary128 high half is hi.
+type printfArg struct {
+	bits    uint64
+	hi      uint64
+	isFloat bool
+	isLong  bool
+}
+
+func intArg(v int64) printfArg     { return printfArg{bits: uint64(v)} }
+func floatArg(v float64) printfArg { return printfArg{bits: math.Float64bits(v), isFloat: true} }
+
+// longArg is v as a long double. v must be normal or zero.
+func longArg(v float64) printfArg {
+	b := math.Float64bits(v)
+	sign, exp, frac := b>>63, b>>52&0x7ff, b&(1<<52-1)
+	if exp != 0 {
+		exp += 16383 - 1023
+	}
+	return printfArg{bits: frac << 60, hi: sign<<63 | exp<<48 | frac>>4, isFloat: true, isLong: true}
+}
+
+// strArg is a string argument, written to guest memory by the test.
+type strArg string
+
+// printfTests expect the C library's output. Every case matches glibc except
+// where bionic's BSD-derived stdio differs, marked "bionic": there the
+// bionic output is expected.
+var printfTests = []struct {
+	format string
+	args   []any
+	want   string
+}{
+	{"%s%d%02x", []any{strArg("key"), intArg(42), intArg(7)}, "key4207"},
+	{"%d", []any{intArg(-17)}, "-17"},
+	{"%5d|%-5d|%05d", []any{intArg(42), intArg(42), intArg(-42)}, "   42|42   |-0042"},
+	{"%+d % d %+d", []any{intArg(5), intArg(5), intArg(-5)}, "+5  5 -5"},
+	{"%.3d|%8.3d|%08.3d", []any{intArg(7), intArg(-7), intArg(7)}, "007|    -007|     007"},
+	{"%.0d|%.0x|%#.0o", []any{intArg(0), intArg(0), intArg(0)}, "||0"},
+	{"%u", []any{intArg(-1)}, "4294967295"},
+	{"%d", []any{intArg(0x1_0000_0005)}, "5"},
+	{"%hhd %hhu %hd %hu", []any{intArg(0x1ff), intArg(0x1ff), intArg(0x18000), intArg(0x18000)}, "-1 255 -32768 32768"},
+	{"%ld %lld %lu", []any{intArg(-1), intArg(math.MinInt64), intArg(-1)}, "-1 -9223372036854775808 18446744073709551615"},
+	{"%zu %jd %td %qd", []any{intArg(123), intArg(-5), intArg(-6), intArg(-7)}, "123 -5 -6 -7"},
+	{"%x %X %#x %#X %#o %o", []any{intArg(255), intArg(255), intArg(255), intArg(255), intArg(8), intArg(8)}, "ff FF 0xff 0XFF 010 10"},
+	{"%#x", []any{intArg(0)}, "0"},
+	{"%08x|%#010x|%-#10x|", []any{intArg(0xbeef), intArg(0xbeef), intArg(0xbeef)}, "0000beef|0x0000beef|0xbeef    |"},
+	{"%*d|%-*d|%.*d", []any{intArg(6), intArg(1), intArg(6), intArg(2), intArg(4), intArg(3)}, "     1|2     |0003"},
+	{"%*d", []any{intArg(-6), intArg(1)}, "1     "},
+	{"%.*s|", []any{intArg(-1), strArg("abc")}, "abc|"},
+	{"%p %p", []any{intArg(0x1234), intArg(0)}, "0x1234 0x0"}, // bionic: glibc prints (nil)
+	{"%s|%.3s", []any{intArg(0), intArg(0)}, "(null)|(nu"},    // bionic: glibc prints nothing for a NULL %.3s
+	{"%c%c%c", []any{intArg('a'), intArg('b'), intArg('c')}, "abc"},
+	{"%3c|%-3c|", []any{intArg('x'), intArg('y')}, "  x|y  |"},
+	{"%.2s|%5s|%-5s|%5.1s", []any{strArg("hello"), strArg("ab"), strArg("ab"), strArg("xyz")}, "he|   ab|ab   |    x"},
+	{"%05s", []any{strArg("ab")}, "000ab"}, // bionic: glibc pads %s with spaces
+	{"%f %f %f", []any{floatArg(1.5), floatArg(math.Copysign(0, -1)), floatArg(3.14159265)}, "1.500000 -0.000000 3.141593"},
+	{"%.0f %.0f %.0f %#.0f", []any{floatArg(0.5), floatArg(1.5), floatArg(2.5), floatArg(3)}, "0 2 2 3."},
+	{"%.2f %10.3f %-10.1f| %+f % f", []any{floatArg(2.675), floatArg(3.14159), floatArg(-2.5), floatArg(1), floatArg(1)}, "2.67      3.142 -2.5      | +1.000000  1.000000"},
+	{"%010.2f %010.2f", []any{floatArg(3.14159), floatArg(-3.14159)}, "0000003.14 -000003.14"},
+	{"%e %E %.2e %.0e %#.0e", []any{floatArg(12345.678), floatArg(0.000123), floatArg(1e100), floatArg(5e-300), floatArg(1)}, "1.234568e+04 1.230000E-04 1.00e+100 5e-300 1.e+00"},
+	{"%g %g %g %g %g %g", []any{floatArg(100000), floatArg(1000000), floatArg(0.0001), floatArg(0.00001), floatArg(1.5), floatArg(0)}, "100000 1e+06 0.0001 1e-05 1.5 0"},
+	{"%G %.3g %.10g %#g %#.3g %g", []any{floatArg(1e-10), floatArg(3.14159), floatArg(1.0 / 3), floatArg(1), floatArg(100), floatArg(123456789)}, "1E-10 3.14 0.3333333333 1.00000 100. 1.23457e+08"},
+	{"%.0g %.1g %g", []any{floatArg(0.5), floatArg(15), floatArg(1e15)}, "0.5 2e+01 1e+15"},
+	{"%a %a %A %.2a %a", []any{floatArg(1), floatArg(1.5), floatArg(-0.1), floatArg(1.999), floatArg(0)}, "0x1p+0 0x1.8p+0 -0X1.999999999999AP-4 0x1.00p+1 0x0p+0"}, // bionic: glibc rounds %.2a of 1.999 to 0x2.00p+0
+	{"%#.0a %13a|%-13a|%013a", []any{floatArg(1), floatArg(1), floatArg(1), floatArg(1)}, "0x1.p+0        0x1p+0|0x1p+0       |0x00000001p+0"},
+	{"%f %F %e %g %5.1f|%-6f|%+f|%05f", []any{floatArg(math.Inf(1)), floatArg(math.Inf(1)), floatArg(math.Inf(-1)), floatArg(math.Inf(1)), floatArg(math.Inf(1)), floatArg(math.Inf(-1)), floatArg(math.Inf(1)), floatArg(math.NaN())}, "inf INF -inf inf   inf|-inf  |+inf|  nan"},
+	{"%d %f %d %f %d %f %d %f %d %f %d %f %d %f %d %f %d %f",
+		[]any{intArg(1), floatArg(1), intArg(2), floatArg(2), intArg(3), floatArg(3), intArg(4), floatArg(4), intArg(5), floatArg(5), intArg(6), floatArg(6), intArg(7), floatArg(7), intArg(8), floatArg(8), intArg(9), floatArg(9)},
+		"1 1.000000 2 2.000000 3 3.000000 4 4.000000 5 5.000000 6 6.000000 7 7.000000 8 8.000000 9 9.000000"},
+	{"%s-%s-%s-%s-%s-%s-%s", []any{strArg("a"), strArg("b"), strArg("c"), strArg("d"), strArg("e"), strArg("f"), strArg("g")}, "a-b-c-d-e-f-g"},
+	{"%Lf %Le %Lg %.2Lf", []any{longArg(1), longArg(-2.5), longArg(1e10), longArg(0)}, "1.000000 -2.500000e+00 1e+10 0.00"},
+	{"%d %.1Lf %.1f %.1Lf", []any{intArg(1), longArg(0.5), floatArg(0.25), longArg(4)}, "1 0.5 0.2 4.0"},
+	{"%.0Lf %.0Lf %.0Lf %.0Lf %.0Lf %.0Lf %.0Lf %.0Lf %.0Lf %.0Lf",
+		[]any{longArg(1), longArg(2), longArg(3), longArg(4), longArg(5), longArg(6), longArg(7), longArg(8), longArg(9), longArg(10)},
+		"1 2 3 4 5 6 7 8 9 10"},
+	{"100%%", nil, "100%"},
+	{"%lc", []any{intArg(0x263a)}, "☺"},
+}
+
+// layoutArgs places variadic arguments as a caller would. Integers fill the
+// grFree registers after the named arguments and floating-point values fill
+// V0-V7; the rest go to the stack in order, long doubles 16-byte aligned.
+func layoutArgs(t *testing.T, emu *emulator.Emulator, args []any, grFree int) (gr []uint64, vr []printfArg, stack []uint64) {
+	for _, a := range args {
+		var arg printfArg
+		switch v := a.(type) {
+		case printfArg:
+			arg = v
+		case strArg:
+			p := emu.Malloc(uint64(len(v) + 1))
+			emu.MemWriteString(p, string(v))
+			arg = printfArg{bits: p}
+		default:
+			t.Fatalf("bad argument %T", a)
+		}
+
+		switch {
+		case arg.isFloat && len(vr) < 8:
+			vr = append(vr, arg)
+		case !arg.isFloat && len(gr) < grFree:
+			gr = append(gr, arg.bits)
+		case arg.isLong:
+			if len(stack)%2 != 0 {
+				stack = append(stack, 0)
+			}
+			stack = append(stack, arg.bits, arg.hi)
+		default:
+			stack = append(stack, arg.bits)
+		}
+	}
+	return gr, vr, stack
+}
+
+// pushStack writes stacked arguments below the current SP and moves SP.
+func pushStack(emu *emulator.Emulator, stack []uint64) {
+	sp := (emu.SP() - uint64(len(stack))*8 - 64) &^ 15
+	for n, v := range stack {
+		emu.MemWriteU64(sp+uint64(n)*8, v)
+	}
+	emu.SetSP(sp)
+}
+
+func TestSnprintf(t *testing.T) {
+	for _, tt := range printfTests {
+		t.Run(tt.format, func(t *testing.T) {
+			emu, err := emulator.New()
+			if err != nil {
+				t.Fatalf("Failed to create emulator: %v", err)
+			}
+			defer emu.Close()
+
+			// snprintf(buf, 256, format, ...): variadic arguments start at X3
+			buf := emu.Malloc(256)
+			fmtPtr := emu.Malloc(uint64(len(tt.format) + 1))
+			emu.MemWriteString(fmtPtr, tt.format)
+
+			gr, vr, stack := layoutArgs(t, emu, tt.args, 5)
+			emu.SetX(0, buf)
+			emu.SetX(1, 256)
+			emu.SetX(2, fmtPtr)
+			for n, v := range gr {
+				emu.SetX(3+n, v)
+			}
+			for n, v := range vr {
+				if v.isLong {
+					emu.SetQ(n, v.bits, v.hi)
+				} else {
+					emu.SetD(n, v.bits)
+				}
+			}
+			pushStack(emu, stack)
+
+			testutil.CallStub(t, emu, stubSnprintf)
+
+			got, _ := emu.MemReadString(buf, 256)
+			if got != tt.want {
+				t.Errorf("snprintf(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+			if int(emu.X(0)) != len(tt.want) {
+				t.Errorf("snprintf(%q) returned %d, want %d", tt.format, emu.X(0), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestVsnprintf(t *testing.T) {
+	for _, tt := range printfTests {
+		t.Run(tt.format, func(t *testing.T) {
+			emu, err := emulator.New()
+			if err != nil {
+				t.Fatalf("Failed to create emulator: %v", err)
+			}
+			defer emu.Close()
+
+			buf := emu.Malloc(256)
+			fmtPtr := emu.Malloc(uint64(len(tt.format) + 1))
+			emu.MemWriteString(fmtPtr, tt.format)
+
+			// Build the va_list a variadic caller with three named
+			// arguments would have: five saved X slots and eight V slots
+			gr, vr, stack := layoutArgs(t, emu, tt.args, 5)
+			grArea := emu.Malloc(5 * 8)
+			vrArea := emu.Malloc(8 * 16)
+			for n, v := range gr {
+				emu.MemWriteU64(grArea+uint64(n)*8, v)
+			}
+			for n, v := range vr {
+				emu.MemWriteU64(vrArea+uint64(n)*16, v.bits)
+				emu.MemWriteU64(vrArea+uint64(n)*16+8, v.hi)
+			}
+			stackArea := emu.Malloc(uint64(len(stack))*8 + 8)
+			for n, v := range stack {
+				emu.MemWriteU64(stackArea+uint64(n)*8, v)
+			}
+
+			ap := emu.Malloc(32)
+			emu.MemWriteU64(ap, stackArea)
+			emu.MemWriteU64(ap+8, grArea+5*8)
+			emu.MemWriteU64(ap+16, vrArea+8*16)
+			emu.MemWriteU32(ap+24, uint32(-5*8&0xffffffff))
+			emu.MemWriteU32(ap+28, uint32(-8*16&0xffffffff))
+
+			emu.SetX(0, buf)
+			emu.SetX(1, 256)
+			emu.SetX(2, fmtPtr)
+			emu.SetX(3, ap)
+
+			testutil.CallStub(t, emu, stubVsnprintf)
+
+			got, _ := emu.MemReadString(buf, 256)
+			if got != tt.want {
+				t.Errorf("vsnprintf(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnprintfTruncation(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	buf := emu.Malloc(16)
+	emu.MemWriteString(buf, "xxxxxxxxxxxxxxx")
+	fmtPtr := emu.Malloc(16)
+	emu.MemWriteString(fmtPtr, "%s=%08x")
+	key := emu.Malloc(16)
+	emu.MemWriteString(key, "seed")
+
+	emu.SetX(0, buf)
+	emu.SetX(1, 8)
+	emu.SetX(2, fmtPtr)
+	emu.SetX(3, key)
+	emu.SetX(4, 0xdeadbeef)
+	testutil.CallStub(t, emu, stubSnprintf)
+
+	if got, _ := emu.MemReadString(buf, 16); got != "seed=de" {
+		t.Errorf("buffer = %q, want %q", got, "seed=de")
+	}
+	if emu.X(0) != uint64(len("seed=deadbeef")) {
+		t.Errorf("returned %d, want %d", emu.X(0), len("seed=deadbeef"))
+	}
+}
+
+func TestSnprintfHugeWidth(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	buf := emu.Malloc(16)
+	tests := []struct {
+		format string
+		args   []uint64
+	}{
+		{"%*d", []uint64{0x7fffffff, 1}},
+		{"%*d", []uint64{0x80000000, 1}}, // INT_MIN: left-justified
+		{"%.*d", []uint64{0x7fffffff, 1}},
+		{"%99999999999999999999d", []uint64{1}},
+		{"%.99999999999999999999d", []uint64{1}},
+	}
+	for _, tt := range tests {
+		emu.SetX(0, buf)
+		emu.SetX(1, 16)
+		emu.SetX(2, testutil.CString(emu, tt.format))
+		for i, a := range tt.args {
+			emu.SetX(3+i, a)
+		}
+		testutil.CallStub(t, emu, stubSnprintf)
+		if r := emu.X(0); r != maxFormatLen {
+			t.Errorf("%s: returned %d, want the width clamped to %d", tt.format, r, maxFormatLen)
+		}
+	}
+}
+
+func TestPrintfCount(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	buf := emu.Malloc(32)
+	count := emu.Malloc(8)
+	emu.MemWriteU64(count, ^uint64(0))
+	fmtPtr := emu.Malloc(16)
+	emu.MemWriteString(fmtPtr, "abc%hn%d")
+
+	emu.SetX(0, buf)
+	emu.SetX(1, fmtPtr)
+	emu.SetX(2, count)
+	emu.SetX(3, 12)
+	testutil.CallStub(t, emu, stubSprintf)
+
+	if got, _ := emu.MemReadString(buf, 32); got != "abc12" {
+		t.Errorf("buffer = %q, want %q", got, "abc12")
+	}
+	if v, _ := emu.MemReadU64(count); v != 0xffffffffffff0003 {
+		t.Errorf("%%hn stored 0x%x, want 0xffffffffffff0003", v)
+	}
+}
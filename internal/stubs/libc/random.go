@@ -0,0 +1,214 @@
+package libc
+
+import (
+	"encoding/binary"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// Session randomness. Every guest-visible random source derives from Seed
+// so runs are reproducible and can be swept:
+//   - rand and random use bionic's generator (the BSD additive feedback
+//     generator, TYPE_3). Until the guest seeds it, it behaves as if
+//     srandom(Seed) had been called; with the default Seed of 1 that is
+//     the real unseeded sequence.
+//   - arc4random, getrandom, getentropy, and /dev/urandom draw bytes from
+//     a PCG stream seeded with Seed.
+var (
+	Seed = uint64(1)
+
+	randomGen  bsdRandom
+	entropyGen *rand.Rand
+	randMu     sync.Mutex
+)
+
+// entropyStream separates the byte stream from other PCG users of Seed.
+const entropyStream = 0x67616c61676f // "galago"
+
+func init() {
+	stubs.RegisterFunc("libc", "rand", stubRandom, "random")
+	stubs.RegisterFunc("libc", "srand", stubSrandom, "srandom")
+	stubs.RegisterFunc("libc", "rand_r", stubRandR)
+	stubs.RegisterFunc("libc", "arc4random", stubArc4random)
+	stubs.RegisterFunc("libc", "arc4random_uniform", stubArc4randomUniform)
+	stubs.RegisterFunc("libc", "arc4random_buf", stubArc4randomBuf)
+	stubs.RegisterFunc("libc", "getrandom", stubGetrandom)
+	stubs.RegisterFunc("libc", "getentropy", stubGetentropy)
+
+	AddDevice("/dev/urandom", RandomBytes)
+	AddDevice("/dev/random", RandomBytes)
+	SetSeed(Seed)
+}
+
+// SetSeed reseeds every session random source.
+func SetSeed(seed uint64) {
+	randMu.Lock()
+	Seed = seed
+	randomGen.seed(uint32(seed))
+	entropyGen = rand.New(rand.NewPCG(seed, entropyStream))
+	randMu.Unlock()
+}
+
+// RandomBytes returns n bytes from the session entropy stream.
+func RandomBytes(n int) []byte {
+	randMu.Lock()
+	defer randMu.Unlock()
+	buf := make([]byte, (n+7)&^7)
+	for i := 0; i < len(buf); i += 8 {
+		binary.LittleEndian.PutUint64(buf[i:], entropyGen.Uint64())
+	}
+	return buf[:n]
+}
+
+// randomUint32 returns the next value from the session entropy stream.
+func randomUint32() uint32 {
+	randMu.Lock()
+	defer randMu.Unlock()
+	return entropyGen.Uint32()
+}
+
+// bsdRandom is the BSD random(3) additive feedback generator with a
+// 31-word state (TYPE_3): x[i] = x[i-3] + x[i-31], output x[i] >> 1.
+type bsdRandom struct {
+	state [31]uint32
+	front int // x[i-3]
+	rear  int // x[i-31]
+}
+
+// seed initializes the state as srandom does: a Park-Miller sequence from
+// seed, then 310 discarded outputs.
+func (r *bsdRandom) seed(seed uint32) {
+	r.state[0] = seed
+	for i := 1; i < len(r.state); i++ {
+		// 16807 * x mod (2^31 - 1) without overflow (Schrage's method)
+		x := int32(r.state[i-1])
+		hi, lo := x/127773, x%127773
+		x = 16807*lo - 2836*hi
+		if x <= 0 {
+			x += 0x7fffffff
+		}
+		r.state[i] = uint32(x)
+	}
+	r.front, r.rear = 3, 0
+	for i := 0; i < 10*len(r.state); i++ {
+		r.next()
+	}
+}
+
+func (r *bsdRandom) next() uint32 {
+	r.state[r.front] += r.state[r.rear]
+	v := r.state[r.front] >> 1
+	r.front = (r.front + 1) % len(r.state)
+	r.rear = (r.rear + 1) % len(r.state)
+	return v
+}
+
+func stubRandom(emu *emulator.Emulator) bool {
+	// int rand(void), long random(void)
+	randMu.Lock()
+	v := randomGen.next()
+	randMu.Unlock()
+	emu.SetX(0, uint64(v))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubSrandom(emu *emulator.Emulator) bool {
+	// void srand(unsigned int seed)
+	seed := uint32(emu.X(0))
+	stubs.DefaultRegistry.Log("libc", "srand", stubs.FormatHex(uint64(seed)))
+	randMu.Lock()
+	randomGen.seed(seed)
+	randMu.Unlock()
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubRandR(emu *emulator.Emulator) bool {
+	// int rand_r(unsigned int *seedp): the POSIX sample LCG, as in bionic
+	seedp := emu.X(0)
+	if seedp == 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
+	}
+	seed, _ := emu.MemReadU32(seedp)
+	seed = seed*1103515245 + 12345
+	emu.MemWriteU32(seedp, seed)
+	emu.SetX(0, uint64((seed>>16)&0x7fff))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubArc4random(emu *emulator.Emulator) bool {
+	// uint32_t arc4random(void)
+	emu.SetX(0, uint64(randomUint32()))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubArc4randomUniform(emu *emulator.Emulator) bool {
+	// uint32_t arc4random_uniform(uint32_t upper_bound)
+	bound := uint32(emu.X(0))
+	v := uint32(0)
+	if bound >= 2 {
+		// Reject values below 2^32 % bound to avoid modulo bias
+		limit := -bound % bound
+		for v = randomUint32(); v < limit; v = randomUint32() {
+		}
+		v %= bound
+	}
+	emu.SetX(0, uint64(v))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubArc4randomBuf(emu *emulator.Emulator) bool {
+	// void arc4random_buf(void *buf, size_t n)
+	buf, n := emu.X(0), emu.X(1)
+	if buf != 0 && n > 0 && n <= maxFormatLen {
+		emu.MemWrite(buf, RandomBytes(int(n)))
+	}
+	stubs.DefaultRegistry.Log("libc", "arc4random_buf", stubs.FormatPtrPair("buf", buf, "n", n))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubGetrandom(emu *emulator.Emulator) bool {
+	// ssize_t getrandom(void *buf, size_t buflen, unsigned int flags)
+	buf, n := emu.X(0), emu.X(1)
+	if buf == 0 && n > 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
+	}
+	// The kernel returns at most 32MB per call; cap large requests lower
+	n = min(n, maxFormatLen)
+	if n > 0 {
+		emu.MemWrite(buf, RandomBytes(int(n)))
+	}
+	stubs.DefaultRegistry.Log("libc", "getrandom", stubs.FormatPtrPair("buf", buf, "n", n))
+	emu.SetX(0, n)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubGetentropy(emu *emulator.Emulator) bool {
+	// int getentropy(void *buffer, size_t length)
+	buf, n := emu.X(0), emu.X(1)
+	if n > 256 {
+		stubs.ReturnError(emu, stubs.EIO)
+		return false
+	}
+	if buf == 0 && n > 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
+	}
+	if n > 0 {
+		emu.MemWrite(buf, RandomBytes(int(n)))
+	}
+	emu.SetX(0, 0)
+	stubs.ReturnFromStub(emu)
+	return false
+}
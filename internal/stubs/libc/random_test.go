@@ -0,0 +1,93 @@
+package libc
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+// TestBSDRandom checks random() against glibc, which uses the same TYPE_3
+// generator as bionic.
+func TestBSDRandom(t *testing.T) {
+	tests := []struct {
+		seed uint32
+		want []uint32
+	}{
+		{1, []uint32{1804289383, 846930886, 1681692777}},
+		{42, []uint32{71876166, 708592740, 1483128881}},
+		{0x90000000, []uint32{1969289435, 1995287969, 327766557}},
+	}
+	for _, tt := range tests {
+		var r bsdRandom
+		r.seed(tt.seed)
+		for i, want := range tt.want {
+			if got := r.next(); got != want {
+				t.Errorf("srandom(%d): random() #%d = %d, want %d", tt.seed, i, got, want)
+			}
+		}
+	}
+}
+
+func TestSessionSeed(t *testing.T) {
+	defer SetSeed(1)
+
+	SetSeed(42)
+	a := RandomBytes(32)
+	SetSeed(42)
+	b := RandomBytes(32)
+	SetSeed(43)
+	c := RandomBytes(32)
+	if !bytes.Equal(a, b) {
+		t.Errorf("same seed gave %x and %x", a, b)
+	}
+	if bytes.Equal(a, c) {
+		t.Errorf("seeds 42 and 43 gave the same bytes")
+	}
+
+	// /dev/urandom reads the same stream
+	SetSeed(42)
+	fd := openVFSFile("/dev/urandom")
+	if fd < 0 {
+		t.Fatal("/dev/urandom not in VFS")
+	}
+	defer freeFileFD(fd)
+	data, _, _ := vfsFile(fd)
+	if !bytes.Equal(data[:32], a) {
+		t.Errorf("/dev/urandom = %x, want %x", data[:32], a)
+	}
+}
+
+func TestSessionClock(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	defer SetTime(time.Unix(1704067200, 0))
+
+	SetTime(time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC))
+	testutil.CallStub(t, emu, stubTime)
+	if got := int64(emu.X(0)); got != 1906545600 {
+		t.Errorf("time() = %d, want 1906545600", got)
+	}
+
+	// nanosleep advances the clock instead of sleeping
+	ts := emu.Malloc(16)
+	emu.MemWriteU64(ts, 90)
+	emu.MemWriteU64(ts+8, 500000000)
+	emu.SetX(0, ts)
+	emu.SetX(1, 0)
+	testutil.CallStub(t, emu, stubNanosleep)
+
+	emu.SetX(0, clockRealtime)
+	emu.SetX(1, ts)
+	testutil.CallStub(t, emu, stubClockGettime)
+	sec, _ := emu.MemReadU64(ts)
+	nsec, _ := emu.MemReadU64(ts + 8)
+	if sec != 1906545600+90 || nsec < 500000000 || nsec > 500100000 {
+		t.Errorf("clock_gettime = %d.%09d, want 1906545690.5", sec, nsec)
+	}
+}
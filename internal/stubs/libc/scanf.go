@@ -0,0 +1,378 @@
+package libc
+
+import (
+	"math"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+func init() {
+	stubs.RegisterFunc("libc", "sscanf", stubSscanf)
+	stubs.RegisterFunc("libc", "vsscanf", stubVsscanf)
+	stubs.RegisterFunc("libc", "fscanf", stubFscanf)
+	stubs.RegisterFunc("libc", "vfscanf", stubVfscanf)
+	stubs.RegisterFunc("libc", "scanf", stubScanf)
+	stubs.RegisterFunc("libc", "vscanf", stubVscanf)
+}
+
+// scanEOF is the scanf result for an input failure before the first conversion.
+const scanEOF = ^uint64(0) // -1
+
+func stubSscanf(emu *emulator.Emulator) bool {
+	// int sscanf(const char *str, const char *format, ...)
+	input := readCString(emu, emu.X(0), maxFormatLen)
+	format := readCString(emu, emu.X(1), maxFormatLen)
+	n, _ := scanFormat(emu, input, format, newRegArgs(emu, 2))
+	stubs.DefaultRegistry.Log("libc", "sscanf", format+" <- "+input)
+	emu.SetX(0, n)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubVsscanf(emu *emulator.Emulator) bool {
+	// int vsscanf(const char *str, const char *format, va_list ap)
+	input := readCString(emu, emu.X(0), maxFormatLen)
+	format := readCString(emu, emu.X(1), maxFormatLen)
+	n, _ := scanFormat(emu, input, format, newVaListArgs(emu, emu.X(2)))
+	stubs.DefaultRegistry.Log("libc", "vsscanf", format+" <- "+input)
+	emu.SetX(0, n)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubFscanf(emu *emulator.Emulator) bool {
+	// int fscanf(FILE *stream, const char *format, ...)
+	emu.SetX(0, scanStream(emu, emu.X(0), emu.X(1), newRegArgs(emu, 2)))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubVfscanf(emu *emulator.Emulator) bool {
+	// int vfscanf(FILE *stream, const char *format, va_list ap)
+	emu.SetX(0, scanStream(emu, emu.X(0), emu.X(1), newVaListArgs(emu, emu.X(2))))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubScanf(emu *emulator.Emulator) bool {
+	// int scanf(const char *format, ...): stdin is always at end of file
+	format := readCString(emu, emu.X(0), maxFormatLen)
+	stubs.DefaultRegistry.Log("libc", "scanf", format)
+	emu.SetX(0, scanEOF)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubVscanf(emu *emulator.Emulator) bool {
+	// int vscanf(const char *format, va_list ap)
+	format := readCString(emu, emu.X(0), maxFormatLen)
+	stubs.DefaultRegistry.Log("libc", "vscanf", format)
+	emu.SetX(0, scanEOF)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+// scanStream scans a FILE opened through the VFS and advances its position
+// past the consumed input. Other streams are at end of file.
+func scanStream(emu *emulator.Emulator, stream, fmtPtr uint64, args varArgs) uint64 {
+	format := readCString(emu, fmtPtr, maxFormatLen)
+	stubs.DefaultRegistry.Log("libc", "fscanf", format)
+
+	fd, ok := streamFD(stream)
+	if !ok {
+		return scanEOF
+	}
+	data, pos, ok := vfsFile(fd)
+	if !ok || pos >= int64(len(data)) {
+		return scanEOF
+	}
+	n, consumed := scanFormat(emu, string(data[pos:]), format, args)
+	vfsSeek(fd, pos+int64(consumed))
+	return n
+}
+
+// scanFormat implements the scanf conversions over input, storing results
+// through the pointer arguments in args. It returns the number of assigned
+// conversions (or EOF if input ran out before the first conversion) and the
+// number of input bytes consumed.
+func scanFormat(emu *emulator.Emulator, input, format string, args varArgs) (uint64, int) {
+	pos := 0
+	assigned := uint64(0)
+	converted := false
+
+	// inputFailure is the result when input runs out
+	inputFailure := func() (uint64, int) {
+		if !converted {
+			return scanEOF, pos
+		}
+		return assigned, pos
+	}
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if isSpace(c) {
+			pos = skipSpace(input, pos)
+			continue
+		}
+		if c != '%' {
+			if pos >= len(input) {
+				return inputFailure()
+			}
+			if input[pos] != c {
+				return assigned, pos
+			}
+			pos++
+			continue
+		}
+
+		i++
+		if i >= len(format) {
+			break
+		}
+
+		// Assignment suppression, field width, and length modifier
+		suppress := false
+		if format[i] == '*' {
+			suppress = true
+			i++
+		}
+		width := 0
+		for ; i < len(format) && isDigit(format[i]); i++ {
+			width = width*10 + int(format[i]-'0')
+		}
+		length := ""
+		if i < len(format) {
+			switch format[i] {
+			case 'h', 'l':
+				length = format[i : i+1]
+				if i+1 < len(format) && format[i+1] == format[i] {
+					length += length
+					i++
+				}
+				i++
+			case 'q':
+				length = "ll"
+				i++
+			case 'j', 'z', 't', 'L':
+				length = format[i : i+1]
+				i++
+			}
+		}
+		if i >= len(format) {
+			break
+		}
+		verb := format[i]
+
+		// Conversions other than %c, %[, and %n skip leading whitespace
+		if verb != 'c' && verb != '[' && verb != 'n' {
+			pos = skipSpace(input, pos)
+		}
+		if verb == 'n' {
+			if !suppress {
+				writeCount(emu, length, args.nextInt(), pos)
+			}
+			continue
+		}
+		if pos >= len(input) {
+			return inputFailure()
+		}
+
+		end := len(input)
+		if width > 0 && pos+width < end {
+			end = pos + width
+		}
+		field := input[pos:end]
+
+		switch verb {
+		case '%':
+			if input[pos] != '%' {
+				return assigned, pos
+			}
+			pos++
+			continue
+
+		case 'd', 'i', 'o', 'u', 'x', 'X', 'p':
+			base := 10
+			switch verb {
+			case 'i':
+				base = 0
+			case 'o':
+				base = 8
+			case 'x', 'X', 'p':
+				base = 16
+			}
+			v, n, _ := parseInt(field, base, verb == 'd' || verb == 'i')
+			if n == 0 {
+				return assigned, pos
+			}
+			pos += n
+			if !suppress {
+				if verb == 'p' {
+					length = "l"
+				}
+				storeScanned(emu, args.nextInt(), intSize(length), v)
+			}
+
+		case 'f', 'F', 'e', 'E', 'g', 'G', 'a', 'A':
+			n := scanFloatPrefix(field, 0, len(field))
+			if n == 0 {
+				return assigned, pos
+			}
+			pos += n
+			if !suppress {
+				bitSize := 32
+				if length == "l" || length == "L" {
+					bitSize = 64
+				}
+				v, _, _ := convertFloat(field[:n], bitSize, n)
+				ptr := args.nextInt()
+				switch length {
+				case "l":
+					emu.MemWriteU64(ptr, math.Float64bits(v))
+				case "L":
+					lo, hi := float64ToQuad(v)
+					emu.MemWriteU64(ptr, lo)
+					emu.MemWriteU64(ptr+8, hi)
+				default:
+					emu.MemWriteU32(ptr, math.Float32bits(float32(v)))
+				}
+			}
+
+		case 's':
+			n := 0
+			for n < len(field) && !isSpace(field[n]) {
+				n++
+			}
+			pos += n
+			if !suppress {
+				storeScannedString(emu, args.nextInt(), field[:n], length == "l", true)
+			}
+
+		case 'c':
+			if width == 0 {
+				width = 1
+			}
+			if len(input)-pos < width {
+				return inputFailure()
+			}
+			pos += width
+			if !suppress {
+				storeScannedString(emu, args.nextInt(), input[pos-width:pos], length == "l", false)
+			}
+
+		case '[':
+			set, next, ok := parseScanset(format, i+1)
+			if !ok {
+				return assigned, pos
+			}
+			i = next
+			n := 0
+			for n < len(field) && set[field[n]] {
+				n++
+			}
+			if n == 0 {
+				return assigned, pos
+			}
+			pos += n
+			if !suppress {
+				storeScannedString(emu, args.nextInt(), field[:n], length == "l", true)
+			}
+
+		default:
+			return assigned, pos
+		}
+
+		converted = true
+		if !suppress {
+			assigned++
+		}
+	}
+
+	return assigned, pos
+}
+
+// intSize returns the size in bytes of an integer conversion's target.
+func intSize(length string) int {
+	switch length {
+	case "hh":
+		return 1
+	case "h":
+		return 2
+	case "":
+		return 4
+	}
+	return 8
+}
+
+// storeScanned writes an integer of the given size.
+func storeScanned(emu *emulator.Emulator, ptr uint64, size int, v uint64) {
+	switch size {
+	case 1:
+		emu.MemWriteU8(ptr, uint8(v))
+	case 2:
+		emu.MemWriteU16(ptr, uint16(v))
+	case 4:
+		emu.MemWriteU32(ptr, uint32(v))
+	default:
+		emu.MemWriteU64(ptr, v)
+	}
+}
+
+// storeScannedString writes the bytes of %s, %c, or %[. The l modifier
+// stores 32-bit wchar_t characters; %c stores no terminator.
+func storeScannedString(emu *emulator.Emulator, ptr uint64, s string, wide, terminate bool) {
+	if !wide {
+		data := []byte(s)
+		if terminate {
+			data = append(data, 0)
+		}
+		emu.MemWrite(ptr, data)
+		return
+	}
+	for _, r := range s {
+		emu.MemWriteU32(ptr, uint32(r))
+		ptr += 4
+	}
+	if terminate {
+		emu.MemWriteU32(ptr, 0)
+	}
+}
+
+// parseScanset parses the set of a %[ conversion starting at format[i],
+// just after the '['. A leading '^' negates the set, a ']' immediately
+// after '[' or '^' is a member, and a '-' between two characters is a
+// range. It returns the set and the index of the closing ']'.
+func parseScanset(format string, i int) (*[256]bool, int, bool) {
+	var set [256]bool
+	negate := false
+	if i < len(format) && format[i] == '^' {
+		negate = true
+		i++
+	}
+	start := i
+	for ; i < len(format); i++ {
+		c := format[i]
+		if c == ']' && i > start {
+			break
+		}
+		if c == '-' && i > start && i+1 < len(format) && format[i+1] != ']' {
+			lo, hi := format[i-1], format[i+1]
+			for ch := int(lo); ch <= int(hi); ch++ {
+				set[ch] = true
+			}
+			i++
+			continue
+		}
+		set[c] = true
+	}
+	if i >= len(format) {
+		return nil, i, false
+	}
+	if negate {
+		for c := range set {
+			set[c] = !set[c]
+		}
+	}
+	return &set, i, true
+}
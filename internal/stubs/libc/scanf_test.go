@@ -0,0 +1,193 @@
+package libc
+
+import (
+	"math"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+func TestParseInt(t *testing.T) {
+	tests := []struct {
+		s      string
+		base   int
+		signed bool
+		want   uint64
+		n      int
+		errno  int
+	}{
+		{"42", 10, true, 42, 2, 0},
+		{"  -17xyz", 10, true, uint64(^uint64(16)), 5, 0},
+		{"+0x1F", 0, true, 31, 5, 0},
+		{"0x1F", 16, false, 31, 4, 0},
+		{"0xg", 16, false, 0, 1, 0},
+		{"0755", 0, true, 0755, 4, 0},
+		{"zz", 36, false, 35*36 + 35, 2, 0},
+		{"abc", 10, true, 0, 0, 0},
+		{"-", 10, true, 0, 0, 0},
+		{"9223372036854775807", 10, true, math.MaxInt64, 19, 0},
+		{"9223372036854775808", 10, true, math.MaxInt64, 19, stubs.ERANGE},
+		{"-9223372036854775808", 10, true, 1 << 63, 20, 0},
+		{"-9223372036854775809", 10, true, 1 << 63, 20, stubs.ERANGE},
+		{"18446744073709551615", 10, false, math.MaxUint64, 20, 0},
+		{"18446744073709551616", 10, false, math.MaxUint64, 20, stubs.ERANGE},
+		{"-1", 10, false, math.MaxUint64, 2, 0},
+	}
+	for _, tt := range tests {
+		v, n, errno := parseInt(tt.s, tt.base, tt.signed)
+		if v != tt.want || n != tt.n || errno != tt.errno {
+			t.Errorf("parseInt(%q, %d, %v) = %d, %d, %d; want %d, %d, %d",
+				tt.s, tt.base, tt.signed, v, n, errno, tt.want, tt.n, tt.errno)
+		}
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  float64
+		n     int
+		errno int
+	}{
+		{"3.25", 3.25, 4, 0},
+		{" -1.5e3x", -1500, 7, 0},
+		{"1e", 1, 1, 0},
+		{"1e+", 1, 1, 0},
+		{".5", 0.5, 2, 0},
+		{"5.", 5, 2, 0},
+		{".", 0, 0, 0},
+		{"0x1.8p1", 3, 7, 0},
+		{"0x1.8", 1.5, 5, 0},
+		{"0xg", 0, 1, 0},
+		{"INFINITY", math.Inf(1), 8, 0},
+		{"-infx", math.Inf(-1), 4, 0},
+		{"1e400", math.Inf(1), 5, stubs.ERANGE},
+		{"1e-400", 0, 6, stubs.ERANGE},
+		{"0.0", 0, 3, 0},
+	}
+	for _, tt := range tests {
+		v, n, errno := parseFloat(tt.s, 64)
+		if v != tt.want || n != tt.n || errno != tt.errno {
+			t.Errorf("parseFloat(%q) = %g, %d, %d; want %g, %d, %d",
+				tt.s, v, n, errno, tt.want, tt.n, tt.errno)
+		}
+	}
+
+	if v, n, _ := parseFloat("nan(123)", 64); !math.IsNaN(v) || n != 8 {
+		t.Errorf("parseFloat(nan(123)) = %g, %d", v, n)
+	}
+}
+
+// TestSscanfHexKey runs the common key-derivation loop body
+// sscanf(hex + 2*i, "%2hhx", &key[i]) and a mixed conversion list.
+func TestSscanfHexKey(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	hex := emu.Malloc(64)
+	emu.MemWriteString(hex, "a1b2c3d4")
+	format := emu.Malloc(16)
+	emu.MemWriteString(format, "%2hhx")
+	key := emu.Malloc(16)
+
+	for n := uint64(0); n < 4; n++ {
+		emu.SetX(0, hex+2*n)
+		emu.SetX(1, format)
+		emu.SetX(2, key+n)
+		testutil.CallStub(t, emu, stubSscanf)
+		if emu.X(0) != 1 {
+			t.Fatalf("sscanf returned %d, want 1", emu.X(0))
+		}
+	}
+	got, _ := emu.MemRead(key, 4)
+	if string(got) != "\xa1\xb2\xc3\xd4" {
+		t.Errorf("key = %x, want a1b2c3d4", got)
+	}
+
+	// "id=%d name=%7s %[^,],%lf%n" on "id=-12 name=galago  x-y,2.5 rest"
+	emu.MemWriteString(hex, "id=-12 name=galago  x-y,2.5 rest")
+	emu.MemWriteString(format, "id=%d name=%7s %[^,],%lf%n")
+	id := emu.Malloc(8)
+	name := emu.Malloc(16)
+	set := emu.Malloc(16)
+	dbl := emu.Malloc(8)
+	count := emu.Malloc(8)
+	emu.SetX(0, hex)
+	emu.SetX(1, format)
+	emu.SetX(2, id)
+	emu.SetX(3, name)
+	emu.SetX(4, set)
+	emu.SetX(5, dbl)
+	emu.SetX(6, count)
+	testutil.CallStub(t, emu, stubSscanf)
+
+	if emu.X(0) != 4 {
+		t.Errorf("sscanf returned %d, want 4", emu.X(0))
+	}
+	if v, _ := emu.MemReadU32(id); int32(v) != -12 {
+		t.Errorf("id = %d, want -12", int32(v))
+	}
+	if s, _ := emu.MemReadString(name, 16); s != "galago" {
+		t.Errorf("name = %q, want galago", s)
+	}
+	if s, _ := emu.MemReadString(set, 16); s != "x-y" {
+		t.Errorf("set = %q, want x-y", s)
+	}
+	if v, _ := emu.MemReadU64(dbl); math.Float64frombits(v) != 2.5 {
+		t.Errorf("double = %g, want 2.5", math.Float64frombits(v))
+	}
+	if v, _ := emu.MemReadU32(count); v != 27 {
+		t.Errorf("%%n = %d, want 27", v)
+	}
+
+	// An empty input is an input failure before the first conversion
+	emu.MemWriteString(hex, "   ")
+	emu.MemWriteString(format, " %d")
+	emu.SetX(0, hex)
+	emu.SetX(1, format)
+	testutil.CallStub(t, emu, stubSscanf)
+	if emu.X(0) != scanEOF {
+		t.Errorf("sscanf on empty input returned %d, want EOF", int64(emu.X(0)))
+	}
+}
+
+func TestStrtoulEndptr(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	str := emu.Malloc(32)
+	emu.MemWriteString(str, "ffffffffffffffffff;")
+	end := emu.Malloc(8)
+
+	emu.SetX(0, str)
+	emu.SetX(1, end)
+	emu.SetX(2, 16)
+	testutil.CallStub(t, emu, stubStrtoul)
+
+	if emu.X(0) != math.MaxUint64 {
+		t.Errorf("strtoul = 0x%x, want ULONG_MAX", emu.X(0))
+	}
+	if p, _ := emu.MemReadU64(end); p != str+18 {
+		t.Errorf("endptr = str+%d, want str+18", p-str)
+	}
+	if errno := emu.Errno(); errno != stubs.ERANGE {
+		t.Errorf("errno = %d, want ERANGE", errno)
+	}
+
+	// strtod returns in D0
+	emu.MemWriteString(str, "-0x1p-2")
+	emu.SetX(0, str)
+	emu.SetX(1, 0)
+	testutil.CallStub(t, emu, stubStrtod)
+	if v := math.Float64frombits(emu.D(0)); v != -0.25 {
+		t.Errorf("strtod = %g, want -0.25", v)
+	}
+}
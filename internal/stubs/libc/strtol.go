@@ -0,0 +1,391 @@
+package libc
+
+import (
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+func init() {
+	// Integer parsing (long and long long are both 64-bit on arm64)
+	stubs.RegisterFunc("libc", "strtol", stubStrtol, "strtoll", "strtoimax", "strtoq", "strtol_l", "strtoll_l")
+	stubs.RegisterFunc("libc", "strtoul", stubStrtoul, "strtoull", "strtoumax", "strtouq", "strtoul_l", "strtoull_l")
+	stubs.RegisterFunc("libc", "atoi", stubAtoi)
+	stubs.RegisterFunc("libc", "atol", stubAtol, "atoll")
+
+	// Floating-point parsing
+	stubs.RegisterFunc("libc", "strtod", stubStrtod, "strtod_l")
+	stubs.RegisterFunc("libc", "strtof", stubStrtof, "strtof_l")
+	stubs.RegisterFunc("libc", "strtold", stubStrtold, "strtold_l")
+	stubs.RegisterFunc("libc", "atof", stubAtof)
+}
+
+// maxNumberLen bounds how much of a numeric string is read.
+const maxNumberLen = 4096
+
+func stubStrtol(emu *emulator.Emulator) bool {
+	// long strtol(const char *nptr, char **endptr, int base)
+	v := strtoGuest(emu, true)
+	emu.SetX(0, v)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubStrtoul(emu *emulator.Emulator) bool {
+	// unsigned long strtoul(const char *nptr, char **endptr, int base)
+	v := strtoGuest(emu, false)
+	emu.SetX(0, v)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubAtoi(emu *emulator.Emulator) bool {
+	// int atoi(const char *nptr) is (int)strtol(nptr, NULL, 10)
+	s := readCString(emu, emu.X(0), maxNumberLen)
+	v, _, _ := parseInt(s, 10, true)
+	emu.SetX(0, uint64(int64(int32(v))))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubAtol(emu *emulator.Emulator) bool {
+	// long atol(const char *nptr) is strtol(nptr, NULL, 10)
+	s := readCString(emu, emu.X(0), maxNumberLen)
+	v, _, _ := parseInt(s, 10, true)
+	emu.SetX(0, v)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+// strtoGuest implements strtol and strtoul: it parses X0 in base X2, stores
+// the end pointer through X1, sets errno, and returns the result.
+func strtoGuest(emu *emulator.Emulator, signed bool) uint64 {
+	nptr := emu.X(0)
+	endptr := emu.X(1)
+	base := int(int32(emu.X(2)))
+
+	if base < 0 || base == 1 || base > 36 {
+		emu.SetErrno(stubs.EINVAL)
+		if endptr != 0 {
+			emu.MemWriteU64(endptr, nptr)
+		}
+		return 0
+	}
+
+	s := readCString(emu, nptr, maxNumberLen)
+	v, n, errno := parseInt(s, base, signed)
+	if errno != 0 {
+		emu.SetErrno(errno)
+	}
+	if endptr != 0 {
+		emu.MemWriteU64(endptr, nptr+uint64(n))
+	}
+	return v
+}
+
+// parseInt parses an integer prefix of s as strtol (signed) or strtoul
+// does. It returns the 64-bit result, the number of bytes consumed (0 if
+// no conversion was performed), and ERANGE on overflow, in which case the
+// result is clamped. Base 0 selects 16 for a "0x" prefix, 8 for a leading
+// "0", and 10 otherwise.
+func parseInt(s string, base int, signed bool) (uint64, int, int) {
+	i := skipSpace(s, 0)
+	neg := false
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		neg = s[i] == '-'
+		i++
+	}
+
+	// A "0x" prefix only counts if a hex digit follows it
+	if (base == 0 || base == 16) && i+2 < len(s) && s[i] == '0' && (s[i+1]|0x20) == 'x' && digitValue(s[i+2]) < 16 {
+		i += 2
+		base = 16
+	}
+	if base == 0 {
+		base = 10
+		if i < len(s) && s[i] == '0' {
+			base = 8
+		}
+	}
+
+	var mag uint64
+	overflow := false
+	start := i
+	for ; i < len(s); i++ {
+		d := digitValue(s[i])
+		if d >= base {
+			break
+		}
+		hi, lo := bits.Mul64(mag, uint64(base))
+		lo, carry := bits.Add64(lo, uint64(d), 0)
+		if hi != 0 || carry != 0 {
+			overflow = true
+		}
+		mag = lo
+	}
+	if i == start {
+		return 0, 0, 0
+	}
+
+	if signed {
+		switch {
+		case !neg && (overflow || mag > math.MaxInt64):
+			return math.MaxInt64, i, stubs.ERANGE
+		case neg && (overflow || mag > 1<<63):
+			return 1 << 63, i, stubs.ERANGE
+		}
+	} else if overflow {
+		return math.MaxUint64, i, stubs.ERANGE
+	}
+	if neg {
+		mag = -mag
+	}
+	return mag, i, 0
+}
+
+// digitValue returns the value of an alphanumeric digit, or 36 otherwise.
+func digitValue(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	}
+	return 36
+}
+
+// isSpace matches the C locale isspace.
+func isSpace(c byte) bool {
+	return c == ' ' || (c >= '\t' && c <= '\r')
+}
+
+// skipSpace returns the index of the first non-space byte at or after i.
+func skipSpace(s string, i int) int {
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	return i
+}
+
+func stubStrtod(emu *emulator.Emulator) bool {
+	// double strtod(const char *nptr, char **endptr)
+	v := strtodGuest(emu, 64)
+	emu.SetD(0, math.Float64bits(v))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubStrtof(emu *emulator.Emulator) bool {
+	// float strtof(const char *nptr, char **endptr)
+	v := strtodGuest(emu, 32)
+	emu.SetD(0, uint64(math.Float32bits(float32(v))))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubStrtold(emu *emulator.Emulator) bool {
+	// long double strtold(const char *nptr, char **endptr)
+	v := strtodGuest(emu, 64)
+	lo, hi := float64ToQuad(v)
+	emu.SetQ(0, lo, hi)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubAtof(emu *emulator.Emulator) bool {
+	// double atof(const char *nptr) is strtod(nptr, NULL)
+	s := readCString(emu, emu.X(0), maxNumberLen)
+	v, _, errno := parseFloat(s, 64)
+	if errno != 0 {
+		emu.SetErrno(errno)
+	}
+	emu.SetD(0, math.Float64bits(v))
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+// strtodGuest implements strtod and strtof: it parses X0, stores the end
+// pointer through X1, sets errno, and returns the result.
+func strtodGuest(emu *emulator.Emulator, bitSize int) float64 {
+	nptr := emu.X(0)
+	endptr := emu.X(1)
+
+	s := readCString(emu, nptr, maxNumberLen)
+	v, n, errno := parseFloat(s, bitSize)
+	if errno != 0 {
+		emu.SetErrno(errno)
+	}
+	if endptr != 0 {
+		emu.MemWriteU64(endptr, nptr+uint64(n))
+	}
+	return v
+}
+
+// parseFloat parses a floating-point prefix of s as strtod does: decimal
+// and hexadecimal forms, "inf", "infinity", and "nan(...)". It returns the
+// value rounded to bitSize, the number of bytes consumed, and ERANGE on
+// overflow or underflow.
+func parseFloat(s string, bitSize int) (float64, int, int) {
+	n := scanFloatPrefix(s, 0, len(s))
+	if n == 0 {
+		return 0, 0, 0
+	}
+	return convertFloat(s[skipSpace(s, 0):n], bitSize, n)
+}
+
+// convertFloat converts a prefix matched by scanFloatPrefix.
+func convertFloat(text string, bitSize, n int) (float64, int, int) {
+	neg := strings.HasPrefix(text, "-")
+	body := strings.TrimLeft(text, "+-")
+
+	if len(body) >= 3 && strings.EqualFold(body[:3], "nan") {
+		v := math.NaN()
+		if neg {
+			v = math.Copysign(v, -1)
+		}
+		return v, n, 0
+	}
+
+	// strconv requires an exponent on hexadecimal floats
+	if len(body) > 1 && (body[1]|0x20) == 'x' && !strings.ContainsAny(body, "pP") {
+		text += "p0"
+	}
+
+	v, err := strconv.ParseFloat(text, bitSize)
+	if err != nil {
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange {
+			return v, n, stubs.ERANGE
+		}
+		return 0, n, 0
+	}
+
+	// Results that flush to zero or lose precision as subnormals underflow
+	smallest := 0x1p-1022
+	if bitSize == 32 {
+		smallest = 0x1p-126
+	}
+	if !math.IsInf(v, 0) && math.Abs(v) < smallest && hasNonzeroDigit(body) {
+		return v, n, stubs.ERANGE
+	}
+	return v, n, 0
+}
+
+// scanFloatPrefix returns the end of the longest floating-point prefix of
+// s[i:limit], including leading whitespace, or 0 if there is none.
+func scanFloatPrefix(s string, i, limit int) int {
+	if limit > len(s) {
+		limit = len(s)
+	}
+	i = skipSpace(s[:limit], i)
+	if i < limit && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	rest := s[i:limit]
+
+	switch {
+	case hasPrefixFold(rest, "infinity"):
+		return i + 8
+	case hasPrefixFold(rest, "inf"):
+		return i + 3
+	case hasPrefixFold(rest, "nan"):
+		i += 3
+		// Optional (n-char-sequence)
+		if j := i; j < limit && s[j] == '(' {
+			for j++; j < limit && (isAlnum(s[j]) || s[j] == '_'); j++ {
+			}
+			if j < limit && s[j] == ')' {
+				i = j + 1
+			}
+		}
+		return i
+	}
+
+	base, expChar := 10, byte('e')
+	if len(rest) > 2 && rest[0] == '0' && (rest[1]|0x20) == 'x' &&
+		(digitValue(rest[2]) < 16 || (rest[2] == '.' && len(rest) > 3 && digitValue(rest[3]) < 16)) {
+		base, expChar = 16, 'p'
+		i += 2
+	}
+
+	digits := 0
+	for ; i < limit && digitValue(s[i]) < base; i++ {
+		digits++
+	}
+	if i < limit && s[i] == '.' {
+		j := i + 1
+		for ; j < limit && digitValue(s[j]) < base; j++ {
+			digits++
+		}
+		if digits > 0 {
+			i = j
+		}
+	}
+	if digits == 0 {
+		return 0
+	}
+
+	// The exponent only counts if at least one digit follows it
+	if i < limit && (s[i]|0x20) == expChar {
+		j := i + 1
+		if j < limit && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if j < limit && isDigit(s[j]) {
+			for j < limit && isDigit(s[j]) {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func isAlnum(c byte) bool {
+	return digitValue(c) < 36
+}
+
+// hasNonzeroDigit reports whether a number's mantissa has a nonzero digit.
+func hasNonzeroDigit(body string) bool {
+	if len(body) > 1 && (body[1]|0x20) == 'x' {
+		body = body[2:]
+		if i := strings.IndexAny(body, "pP"); i >= 0 {
+			body = body[:i]
+		}
+	} else if i := strings.IndexAny(body, "eE"); i >= 0 {
+		body = body[:i]
+	}
+	return strings.ContainsAny(body, "123456789abcdefABCDEF")
+}
+
+// float64ToQuad converts a double to IEEE-754 binary128, the AArch64 long double.
+func float64ToQuad(f float64) (lo, hi uint64) {
+	b := math.Float64bits(f)
+	sign := b >> 63 << 63
+	exp := int(b >> 52 & 0x7ff)
+	mant := b & (1<<52 - 1)
+
+	switch {
+	case exp == 0x7ff:
+		exp = 0x7fff
+	case exp == 0 && mant == 0:
+		// Zero
+	case exp == 0:
+		// Subnormal doubles are normal in binary128
+		shift := bits.LeadingZeros64(mant) - 11
+		mant = mant << shift & (1<<52 - 1)
+		exp = 1 - 1023 - shift + 16383
+	default:
+		exp += 16383 - 1023
+	}
+	return mant << 60, sign | uint64(exp)<<48 | mant>>4
+}
@@ -0,0 +1,98 @@
+package libc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// svc runs a single SVC #0 with the syscall number in X8.
+func svc(t *testing.T, emu *emulator.Emulator, nr uint64, args ...uint64) uint64 {
+	t.Helper()
+	for n, v := range args {
+		emu.SetX(n, v)
+	}
+	emu.SetX(8, nr)
+	code := uint64(emulator.CodeBase)
+	emu.MemWrite(code, []byte{0x01, 0x00, 0x00, 0xd4}) // SVC #0
+	if err := emu.Run(code, code+4); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return emu.X(0)
+}
+
+func TestSyscalls(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	if err := stubs.DefaultRegistry.InstallSyscalls(emu); err != nil {
+		t.Fatalf("InstallSyscalls: %v", err)
+	}
+
+	var logged []string
+	stubs.DefaultRegistry.OnCall = func(category, name, detail string) {
+		logged = append(logged, category+" "+name+" "+detail)
+	}
+	defer func() { stubs.DefaultRegistry.OnCall = nil }()
+
+	ClearFiles()
+	defer ClearFiles()
+	AddFile("/data/local/tmp/cfg.txt", []byte("key=0123456789abcdef"))
+
+	emu.SetLR(0x1234)
+	emu.SetErrno(7)
+
+	if pid := svc(t, emu, 172); pid != MockPID {
+		t.Errorf("getpid = %d, want %d", pid, MockPID)
+	}
+
+	// openat + read are served from the VFS
+	path := emu.Malloc(64)
+	emu.MemWriteString(path, "/data/local/tmp/cfg.txt")
+	fd := svc(t, emu, 56, ^uint64(99), path, 0) // AT_FDCWD
+	if int64(fd) < 0 {
+		t.Fatalf("openat = %d", int64(fd))
+	}
+	buf := emu.Malloc(64)
+	if n := svc(t, emu, 63, fd, buf, 64); n != 20 {
+		t.Errorf("read = %d, want 20", n)
+	}
+	if s, _ := emu.MemReadString(buf, 20); s != "key=0123456789abcdef" {
+		t.Errorf("read data = %q", s)
+	}
+
+	// Failures return -errno and leave errno alone
+	if ret := svc(t, emu, 56, ^uint64(99), 0, 0); int64(ret) != -stubs.EFAULT {
+		t.Errorf("openat(NULL) = %d, want -EFAULT", int64(ret))
+	}
+	if ret := svc(t, emu, 999, 1, 2, 3); int64(ret) != -stubs.ENOSYS {
+		t.Errorf("sys_999 = %d, want -ENOSYS", int64(ret))
+	}
+	if emu.Errno() != 7 {
+		t.Errorf("errno = %d, want 7", emu.Errno())
+	}
+	if emu.LR() != 0x1234 {
+		t.Errorf("LR = 0x%x, want 0x1234", emu.LR())
+	}
+
+	found := false
+	for _, l := range logged {
+		if strings.HasPrefix(l, "syscall sys_999 unimplemented nr=999 args=[0x1 0x2 0x3") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("unimplemented syscall not traced: %q", logged)
+	}
+
+	// Other exceptions still fail the run
+	code := uint64(emulator.CodeBase)
+	emu.MemWrite(code, []byte{0x00, 0x00, 0x00, 0x00}) // UDF #0
+	if err := emu.Run(code, code+4); err == nil || !strings.Contains(err.Error(), "UC_ERR_EXCEPTION") {
+		t.Errorf("UDF: run = %v, want UC_ERR_EXCEPTION", err)
+	}
+}
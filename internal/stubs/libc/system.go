@@ -12,8 +12,23 @@ func init() {
 	stubs.RegisterFunc("libc", "_Exit", stubExit)
 	stubs.RegisterFunc("libc", "atexit", stubAtexit)
 	// __cxa_atexit is registered in cxxabi package
+
+	// Process identity
+	stubs.RegisterFunc("libc", "getpid", stubGetpid)
+	stubs.RegisterFunc("libc", "getppid", stubGetppid)
+	stubs.RegisterFunc("libc", "gettid", stubGetpid) // single-threaded: tid == pid
+	stubs.RegisterFunc("libc", "getuid", stubGetuid, "geteuid")
+	stubs.RegisterFunc("libc", "getgid", stubGetuid, "getegid") // app gid == uid
 }
 
+// Mocked process identity: an app process forked from zygote, running as
+// the app's own uid (AID_APP_START + 123).
+var (
+	MockPID  = uint64(12345)
+	MockPPID = uint64(600) // zygote64
+	MockUID  = uint64(10123)
+)
+
 func stubAbort(emu *emulator.Emulator) bool {
 	stubs.DefaultRegistry.Log("libc", "abort", "program aborted")
 	// Stop emulation - abort() should terminate
@@ -34,3 +49,21 @@ func stubAtexit(emu *emulator.Emulator) bool {
 	stubs.ReturnFromStub(emu)
 	return false
 }
+
+func stubGetpid(emu *emulator.Emulator) bool {
+	emu.SetX(0, MockPID)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubGetppid(emu *emulator.Emulator) bool {
+	emu.SetX(0, MockPPID)
+	stubs.ReturnFromStub(emu)
+	return false
+}
+
+func stubGetuid(emu *emulator.Emulator) bool {
+	emu.SetX(0, MockUID)
+	stubs.ReturnFromStub(emu)
+	return false
+}
@@ -1,17 +1,50 @@
 package libc
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/zboralski/galago/internal/emulator"
 	"github.com/zboralski/galago/internal/stubs"
 )
 
-// Mocked time for deterministic execution.
+// Mocked time for deterministic execution. MockTime* is the wall clock at
+// the start of the session; it advances only when the guest sleeps, plus
+// clockTick per read so consecutive timestamps are strictly increasing.
 var (
 	MockTimeSec  = int64(1704067200) // 2024-01-01 00:00:00 UTC
 	MockTimeUSec = int64(0)
 	MockTimeNSec = int64(0)
+
+	// MockUptime is CLOCK_MONOTONIC at the start of the session.
+	MockUptime = 3 * time.Hour
+
+	clockElapsed time.Duration // Slept or ticked since the session started
+	clockMu      sync.Mutex
 )
 
+// clockTick is how far each clock read advances the session clock.
+const clockTick = time.Microsecond
+
+// clockids for clock_gettime (linux/time.h)
+const (
+	clockRealtime        = 0
+	clockMonotonic       = 1
+	clockProcessCPUTime  = 2
+	clockThreadCPUTime   = 3
+	clockMonotonicRaw    = 4
+	clockRealtimeCoarse  = 5
+	clockMonotonicCoarse = 6
+	clockBoottime        = 7
+	clockRealtimeAlarm   = 8
+	clockBoottimeAlarm   = 9
+	clockTAI             = 11
+)
+
+// cpuTime is the process and thread CPU time the guest sees.
+const cpuTime = time.Second
+
 func init() {
 	stubs.RegisterFunc("libc", "gettimeofday", stubGettimeofday)
 	stubs.RegisterFunc("libc", "clock_gettime", stubClockGettime)
@@ -22,72 +55,157 @@ func init() {
 	stubs.RegisterFunc("libc", "sleep", stubSleep)
 }
 
+// SetTime sets the session wall clock and restarts it.
+func SetTime(t time.Time) {
+	clockMu.Lock()
+	MockTimeSec = t.Unix()
+	MockTimeNSec = int64(t.Nanosecond())
+	MockTimeUSec = MockTimeNSec / 1000
+	clockElapsed = 0
+	clockMu.Unlock()
+}
+
+// ResetClock restarts the session clock at MockTime*.
+func ResetClock() {
+	clockMu.Lock()
+	clockElapsed = 0
+	clockMu.Unlock()
+}
+
+// Now returns the current session wall-clock time.
+func Now() time.Time {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	return time.Unix(MockTimeSec, MockTimeNSec).Add(clockElapsed)
+}
+
+// readClock returns the time of clockid and advances the clock by one tick.
+func readClock(clockid uint64) (time.Duration, bool) {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	clockElapsed += clockTick
+
+	switch clockid {
+	case clockRealtime, clockRealtimeCoarse, clockRealtimeAlarm, clockTAI:
+		return time.Duration(MockTimeSec)*time.Second + time.Duration(MockTimeNSec) + clockElapsed, true
+	case clockMonotonic, clockMonotonicRaw, clockMonotonicCoarse, clockBoottime, clockBoottimeAlarm:
+		return MockUptime + clockElapsed, true
+	case clockProcessCPUTime, clockThreadCPUTime:
+		return cpuTime, true
+	}
+	return 0, false
+}
+
+// advanceClock moves the session clock forward, as a sleep would.
+func advanceClock(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	clockMu.Lock()
+	clockElapsed += d
+	clockMu.Unlock()
+}
+
 func stubGettimeofday(emu *emulator.Emulator) bool {
+	// int gettimeofday(struct timeval *tv, struct timezone *tz)
 	tv := emu.X(0)
+	now, _ := readClock(clockRealtime)
+	sec := uint64(now / time.Second)
 
 	if tv != 0 {
 		// struct timeval { time_t tv_sec; suseconds_t tv_usec; }
-		emu.MemWriteU64(tv, uint64(MockTimeSec))
-		emu.MemWriteU64(tv+8, uint64(MockTimeUSec))
+		emu.MemWriteU64(tv, sec)
+		emu.MemWriteU64(tv+8, uint64(now%time.Second/time.Microsecond))
+	}
+	if tz := emu.X(1); tz != 0 {
+		// struct timezone { int tz_minuteswest; int tz_dsttime; } (UTC)
+		emu.MemWriteU64(tz, 0)
 	}
 
-	stubs.DefaultRegistry.Log("libc", "gettimeofday", stubs.FormatPtrPair("tv", tv, "sec", uint64(MockTimeSec)))
+	stubs.DefaultRegistry.Log("libc", "gettimeofday", stubs.FormatPtrPair("tv", tv, "sec", sec))
 	emu.SetX(0, 0) // success
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubClockGettime(emu *emulator.Emulator) bool {
-	_ = emu.X(0) // clockid (ignored)
+	// int clock_gettime(clockid_t clockid, struct timespec *tp)
+	clockid := emu.X(0)
 	tp := emu.X(1)
 
+	now, ok := readClock(clockid)
+	if !ok {
+		stubs.ReturnError(emu, stubs.EINVAL)
+		return false
+	}
 	if tp != 0 {
 		// struct timespec { time_t tv_sec; long tv_nsec; }
-		emu.MemWriteU64(tp, uint64(MockTimeSec))
-		emu.MemWriteU64(tp+8, uint64(MockTimeNSec))
+		emu.MemWriteU64(tp, uint64(now/time.Second))
+		emu.MemWriteU64(tp+8, uint64(now%time.Second))
 	}
 
-	stubs.DefaultRegistry.Log("libc", "clock_gettime", stubs.FormatPtrPair("tp", tp, "sec", uint64(MockTimeSec)))
+	stubs.DefaultRegistry.Log("libc", "clock_gettime",
+		fmt.Sprintf("clock=%d tp=%s sec=%d", clockid, stubs.FormatHex(tp), now/time.Second))
 	emu.SetX(0, 0) // success
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubTime(emu *emulator.Emulator) bool {
+	// time_t time(time_t *tloc)
 	tloc := emu.X(0)
+	now, _ := readClock(clockRealtime)
+	sec := uint64(now / time.Second)
 
 	if tloc != 0 {
-		emu.MemWriteU64(tloc, uint64(MockTimeSec))
+		emu.MemWriteU64(tloc, sec)
 	}
 
-	stubs.DefaultRegistry.Log("libc", "time", stubs.FormatPtr("sec", uint64(MockTimeSec)))
-	emu.SetX(0, uint64(MockTimeSec))
+	stubs.DefaultRegistry.Log("libc", "time", stubs.FormatPtr("sec", sec))
+	emu.SetX(0, sec)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubClock(emu *emulator.Emulator) bool {
-	// Return a fixed clock value (in ticks)
-	emu.SetX(0, 1000000)
+	// clock_t clock(void): CPU time in CLOCKS_PER_SEC (1000000) ticks
+	emu.SetX(0, uint64(cpuTime/time.Microsecond))
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubNanosleep(emu *emulator.Emulator) bool {
-	// Just return success without sleeping
+	// int nanosleep(const struct timespec *req, struct timespec *rem)
+	req := emu.X(0)
+	if req == 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
+	}
+	sec, _ := emu.MemReadU64(req)
+	nsec, _ := emu.MemReadU64(req + 8)
+	if int64(sec) < 0 || nsec >= uint64(time.Second) {
+		stubs.ReturnError(emu, stubs.EINVAL)
+		return false
+	}
+	// Don't sleep; advance the session clock instead
+	advanceClock(time.Duration(sec)*time.Second + time.Duration(nsec))
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubUsleep(emu *emulator.Emulator) bool {
+	// int usleep(useconds_t usec)
+	advanceClock(time.Duration(uint32(emu.X(0))) * time.Microsecond)
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubSleep(emu *emulator.Emulator) bool {
-	emu.SetX(0, 0)
+	// unsigned int sleep(unsigned int seconds)
+	advanceClock(time.Duration(uint32(emu.X(0))) * time.Second)
+	emu.SetX(0, 0) // Slept the full interval
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -0,0 +1,147 @@
+package libc
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// The virtual filesystem lets a session provide file contents to guest code.
+// Paths registered with a leading "/" must match exactly; relative paths match
+// any guest path ending in "/"+path, so "Metadata/global-metadata.dat" serves
+// the file regardless of which data directory the guest resolves.
+var (
+	vfsFiles = make(map[string][]byte) // path -> contents
+	vfsMu    sync.RWMutex
+
+	// fileData holds the contents of open descriptors backed by the VFS
+	fileData = make(map[int][]byte) // fd -> contents
+
+	// vfsDevices generate the contents of character devices such as
+	// /dev/urandom. They survive ClearFiles.
+	vfsDevices = make(map[string]func(n int) []byte)
+)
+
+// deviceChunk is how many bytes a device provides per open.
+const deviceChunk = 64 << 10
+
+// AddDevice registers a character device whose contents are generated
+// by gen each time it is opened.
+func AddDevice(path string, gen func(n int) []byte) {
+	vfsMu.Lock()
+	vfsDevices[path] = gen
+	vfsMu.Unlock()
+}
+
+// AddFile registers a file in the virtual filesystem.
+func AddFile(path string, data []byte) {
+	vfsMu.Lock()
+	vfsFiles[path] = data
+	vfsMu.Unlock()
+}
+
+// AddHostFile reads a host file and registers it in the virtual filesystem.
+func AddHostFile(path, hostPath string) error {
+	data, err := os.ReadFile(hostPath)
+	if err != nil {
+		return err
+	}
+	AddFile(path, data)
+	return nil
+}
+
+// ClearFiles removes all files from the virtual filesystem, along with
+// the contents and FILE* streams of descriptors opened on them.
+func ClearFiles() {
+	vfsMu.Lock()
+	vfsFiles = make(map[string][]byte)
+	vfsMu.Unlock()
+
+	fileFDMu.Lock()
+	fileData = make(map[int][]byte)
+	streams = make(map[uint64]int)
+	fileFDMu.Unlock()
+}
+
+// LookupFile returns the contents of a virtual file for a guest path.
+func LookupFile(path string) ([]byte, bool) {
+	vfsMu.RLock()
+	defer vfsMu.RUnlock()
+
+	if data, ok := vfsFiles[path]; ok {
+		return data, true
+	}
+	for name, data := range vfsFiles {
+		if !strings.HasPrefix(name, "/") && strings.HasSuffix(path, "/"+name) {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// openVFSFile allocates a descriptor backed by VFS contents.
+// Devices get deviceChunk freshly generated bytes.
+// Returns -1 if the path is not in the VFS.
+func openVFSFile(path string) int {
+	data, ok := LookupFile(path)
+	if !ok {
+		vfsMu.RLock()
+		gen, isDevice := vfsDevices[path]
+		vfsMu.RUnlock()
+		if !isDevice {
+			return -1
+		}
+		data = gen(deviceChunk)
+	}
+	fd := allocFileFD(path)
+	fileFDMu.Lock()
+	fileData[fd] = data
+	fileFDMu.Unlock()
+	return fd
+}
+
+// vfsFile returns the contents and position of a VFS-backed descriptor.
+func vfsFile(fd int) ([]byte, int64, bool) {
+	fileFDMu.Lock()
+	defer fileFDMu.Unlock()
+	data, ok := fileData[fd]
+	return data, filePosition[fd], ok
+}
+
+// vfsSeek sets the position of a VFS-backed descriptor.
+func vfsSeek(fd int, pos int64) {
+	fileFDMu.Lock()
+	filePosition[fd] = pos
+	fileFDMu.Unlock()
+}
+
+// streams maps FILE* pointers returned by fopen to VFS-backed descriptors.
+var streams = make(map[uint64]int) // FILE* -> fd
+
+// openStream allocates a FILE object for a descriptor.
+func openStream(emu *emulator.Emulator, fd int) uint64 {
+	stream := emu.Malloc(256)
+	// FILE._file (bionic __sFILE offset 18) holds the descriptor
+	emu.MemWriteU16(stream+18, uint16(fd))
+	fileFDMu.Lock()
+	streams[stream] = fd
+	fileFDMu.Unlock()
+	return stream
+}
+
+// streamFD returns the descriptor behind a FILE* opened by fopen.
+func streamFD(stream uint64) (int, bool) {
+	fileFDMu.Lock()
+	defer fileFDMu.Unlock()
+	fd, ok := streams[stream]
+	return fd, ok
+}
+
+// closeStream forgets a FILE* opened by fopen.
+func closeStream(stream uint64) {
+	fileFDMu.Lock()
+	delete(streams, stream)
+	fileFDMu.Unlock()
+}
@@ -0,0 +1,133 @@
+package libc
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+func TestVFSReadSeek(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	ClearFiles()
+	defer ClearFiles()
+	AddFile("Metadata/global-metadata.dat", []byte("0123456789abcdef"))
+
+	// Relative paths match any data directory
+	emu.SetX(0, testutil.CString(emu, "/data/app/files/Metadata/global-metadata.dat"))
+	testutil.CallStub(t, emu, stubOpen)
+	fd := emu.X(0)
+	if _, _, ok := vfsFile(int(fd)); !ok {
+		t.Fatalf("open = %d, not a VFS file", int64(fd))
+	}
+
+	buf := emu.Malloc(32)
+	read := func(stub func(*emulator.Emulator) bool, count uint64, args ...uint64) string {
+		t.Helper()
+		emu.SetX(0, fd)
+		emu.SetX(1, buf)
+		emu.SetX(2, count)
+		for i, a := range args {
+			emu.SetX(3+i, a)
+		}
+		testutil.CallStub(t, emu, stub)
+		data, _ := emu.MemRead(buf, emu.X(0))
+		return string(data)
+	}
+	seek := func(offset int64, whence uint64) int64 {
+		t.Helper()
+		emu.SetX(0, fd)
+		emu.SetX(1, uint64(offset))
+		emu.SetX(2, whence)
+		testutil.CallStub(t, emu, stubLseek)
+		return int64(emu.X(0))
+	}
+
+	if got := read(stubRead, 4); got != "0123" {
+		t.Errorf("read = %q, want %q", got, "0123")
+	}
+	if got := read(stubRead, 4); got != "4567" {
+		t.Errorf("second read = %q, want %q", got, "4567")
+	}
+	if pos := seek(-4, 2); pos != 12 { // SEEK_END
+		t.Errorf("lseek(-4, SEEK_END) = %d, want 12", pos)
+	}
+	if got := read(stubRead, 32); got != "cdef" {
+		t.Errorf("read at end = %q, want %q", got, "cdef")
+	}
+	if got := read(stubRead, 4); got != "" {
+		t.Errorf("read past end = %q, want EOF", got)
+	}
+	if pos := seek(-2, 1); pos != 14 { // SEEK_CUR
+		t.Errorf("lseek(-2, SEEK_CUR) = %d, want 14", pos)
+	}
+	if pos := seek(-1, 0); pos != -1 || emu.Errno() != stubs.EINVAL {
+		t.Errorf("lseek(-1, SEEK_SET) = %d errno %d, want -1 EINVAL", pos, emu.Errno())
+	}
+
+	// pread leaves the position alone
+	if got := read(stubPread, 3, 8); got != "89a" {
+		t.Errorf("pread = %q, want %q", got, "89a")
+	}
+	if got := read(stubRead, 4); got != "ef" {
+		t.Errorf("read after pread = %q, want %q", got, "ef")
+	}
+}
+
+func TestFreadStreams(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	ClearFiles()
+	defer ClearFiles()
+	AddFile("/data/key.bin", []byte("0123456789abcdef"))
+
+	emu.SetX(0, testutil.CString(emu, "/data/key.bin"))
+	emu.SetX(1, testutil.CString(emu, "rb"))
+	testutil.CallStub(t, emu, stubFopen)
+	stream := emu.X(0)
+	if _, ok := streamFD(stream); !ok {
+		t.Fatalf("fopen = %#x, not a VFS stream", stream)
+	}
+
+	buf := emu.Malloc(32)
+	fread := func(size, nmemb uint64) uint64 {
+		t.Helper()
+		emu.SetX(0, buf)
+		emu.SetX(1, size)
+		emu.SetX(2, nmemb)
+		emu.SetX(3, stream)
+		testutil.CallStub(t, emu, stubFread)
+		return emu.X(0)
+	}
+	if n := fread(4, 2); n != 2 {
+		t.Errorf("fread(4, 2) = %d, want 2", n)
+	}
+	// size*nmemb wraps to 8: rejected, nothing read
+	if n := fread(1<<63+4, 2); n != 0 || emu.Errno() != stubs.EOVERFLOW {
+		t.Errorf("overflowing fread = %d errno %d, want 0 EOVERFLOW", n, emu.Errno())
+	}
+	if n := fread(8, 1); n != 1 {
+		t.Errorf("fread after overflow = %d, want 1", n)
+	} else if got, _ := emu.MemRead(buf, 8); string(got) != "89abcdef" {
+		t.Errorf("fread after overflow read %q, want %q", got, "89abcdef")
+	}
+
+	// Streams and descriptor contents go with the files
+	ClearFiles()
+	if _, ok := streamFD(stream); ok {
+		t.Error("stream survived ClearFiles")
+	}
+	if n := fread(1, 4); n != 0 {
+		t.Errorf("fread after ClearFiles = %d, want 0", n)
+	}
+}
@@ -157,9 +157,12 @@ func stubGethostbyaddr(emu *emulator.Emulator) bool {
 }
 
 func stubGetpeername(emu *emulator.Emulator) bool {
-	// fd := emu.X(0)
+	// int getpeername(int sockfd, struct sockaddr *addr, socklen_t *addrlen)
 	addrPtr := emu.X(1)
 	lenPtr := emu.X(2)
+	if !checkSocket(emu) {
+		return false
+	}
 
 	if addrPtr != 0 {
 		// Fill with fake address
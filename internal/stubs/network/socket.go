@@ -8,6 +8,7 @@ import (
 
 	"github.com/zboralski/galago/internal/emulator"
 	"github.com/zboralski/galago/internal/stubs"
+	"github.com/zboralski/galago/internal/stubs/libc"
 )
 
 var (
@@ -113,6 +114,32 @@ func init() {
 	stubs.RegisterFunc("network", "epoll_create1", stubEpollCreate)
 	stubs.RegisterFunc("network", "epoll_ctl", stubEpollCtl)
 	stubs.RegisterFunc("network", "epoll_wait", stubEpollWait)
+
+	libc.SocketRead = socketRead
+	libc.SocketWrite = socketWrite
+}
+
+// isSocket reports whether fd was returned by socket, accept, or epoll_create.
+func isSocket(fd int) bool {
+	fdMu.Lock()
+	defer fdMu.Unlock()
+	return socketFD[fd]
+}
+
+// checkSocket fails the current call with EBADF for a negative first
+// argument and ENOTSOCK for a file or pipe. Descriptors the stubs never
+// returned may be sockets made by code that did not run, so they pass.
+func checkSocket(emu *emulator.Emulator) bool {
+	fd := int(int32(emu.X(0)))
+	switch {
+	case fd < 0:
+		stubs.ReturnError(emu, stubs.EBADF)
+	case !isSocket(fd) && libc.IsFileFD(fd):
+		stubs.ReturnError(emu, stubs.ENOTSOCK)
+	default:
+		return true
+	}
+	return false
 }
 
 func allocFD() int {
@@ -126,6 +153,12 @@ func allocFD() int {
 
 func stubSocket(emu *emulator.Emulator) bool {
 	// int socket(int domain, int type, int protocol)
+	switch emu.X(0) {
+	case 1, 2, 10, 16: // AF_UNIX, AF_INET, AF_INET6, AF_NETLINK
+	default:
+		stubs.ReturnError(emu, stubs.EAFNOSUPPORT)
+		return false
+	}
 	fd := allocFD()
 	stubs.DefaultRegistry.Log("network", "socket", stubs.FormatPtr("fd", uint64(fd)))
 	emu.SetX(0, uint64(fd))
@@ -136,10 +169,18 @@ func stubSocket(emu *emulator.Emulator) bool {
 func stubConnect(emu *emulator.Emulator) bool {
 	// int connect(int sockfd, const struct sockaddr *addr, socklen_t addrlen)
 	addrPtr := emu.X(1)
+	if !checkSocket(emu) {
+		return false
+	}
+	if addrPtr == 0 {
+		stubs.ReturnError(emu, stubs.EFAULT)
+		return false
+	}
 
 	// Parse and capture the connection target
 	if ip, port, ok := parseSockaddrIn(emu, addrPtr); ok {
 		captureHost(ip, port, "", "connect")
+		connectStream(int(int32(emu.X(0))), fmt.Sprintf("%s:%d", ip, port))
 		stubs.DefaultRegistry.Log("network", "connect", fmt.Sprintf("%s:%d", ip, port))
 	}
 
@@ -152,6 +193,9 @@ func stubConnect(emu *emulator.Emulator) bool {
 func stubBind(emu *emulator.Emulator) bool {
 	// int bind(int sockfd, const struct sockaddr *addr, socklen_t addrlen)
 	addrPtr := emu.X(1)
+	if !checkSocket(emu) {
+		return false
+	}
 
 	if ip, port, ok := parseSockaddrIn(emu, addrPtr); ok {
 		stubs.DefaultRegistry.Log("network", "bind", fmt.Sprintf("%s:%d", ip, port))
@@ -163,12 +207,18 @@ func stubBind(emu *emulator.Emulator) bool {
 }
 
 func stubListen(emu *emulator.Emulator) bool {
+	if !checkSocket(emu) {
+		return false
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubAccept(emu *emulator.Emulator) bool {
+	if !checkSocket(emu) {
+		return false
+	}
 	// Return new fake fd
 	fd := allocFD()
 	emu.SetX(0, uint64(fd))
@@ -178,8 +228,11 @@ func stubAccept(emu *emulator.Emulator) bool {
 
 func stubSend(emu *emulator.Emulator) bool {
 	// ssize_t send(int sockfd, const void *buf, size_t len, int flags)
+	if !checkSocket(emu) {
+		return false
+	}
 	length := emu.X(2)
-	// Pretend we sent all the data
+	sendBuffer(emu, "send", int(int32(emu.X(0))), emu.X(1), length)
 	emu.SetX(0, length)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -187,8 +240,13 @@ func stubSend(emu *emulator.Emulator) bool {
 
 func stubRecv(emu *emulator.Emulator) bool {
 	// ssize_t recv(int sockfd, void *buf, size_t len, int flags)
-	// Return 0 (connection closed) or -1 with EAGAIN
-	emu.SetX(0, 0)
+	if !checkSocket(emu) {
+		return false
+	}
+	// With nothing to receive, return 0 (connection closed); -1 with
+	// EAGAIN would make pollers spin
+	n := recvBuffer(emu, "recv", int(int32(emu.X(0))), emu.X(1), emu.X(2))
+	emu.SetX(0, n)
 	stubs.ReturnFromStub(emu)
 	return false
 }
@@ -198,11 +256,15 @@ func stubSendto(emu *emulator.Emulator) bool {
 	//                const struct sockaddr *dest_addr, socklen_t addrlen)
 	length := emu.X(2)
 	destAddrPtr := emu.X(4)
+	if !checkSocket(emu) {
+		return false
+	}
 
 	if ip, port, ok := parseSockaddrIn(emu, destAddrPtr); ok {
 		captureHost(ip, port, "", "sendto")
-		stubs.DefaultRegistry.Log("network", "sendto", fmt.Sprintf("%s:%d", ip, port))
+		connectStream(int(int32(emu.X(0))), fmt.Sprintf("%s:%d", ip, port))
 	}
+	sendBuffer(emu, "sendto", int(int32(emu.X(0))), emu.X(1), length)
 
 	emu.SetX(0, length)
 	stubs.ReturnFromStub(emu)
@@ -210,34 +272,59 @@ func stubSendto(emu *emulator.Emulator) bool {
 }
 
 func stubRecvfrom(emu *emulator.Emulator) bool {
-	emu.SetX(0, 0)
+	// ssize_t recvfrom(int sockfd, void *buf, size_t len, int flags,
+	//                  struct sockaddr *src_addr, socklen_t *addrlen)
+	if !checkSocket(emu) {
+		return false
+	}
+	n := recvBuffer(emu, "recvfrom", int(int32(emu.X(0))), emu.X(1), emu.X(2))
+	emu.SetX(0, n)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubClose(emu *emulator.Emulator) bool {
-	fd := int(emu.X(0))
+	fd := int(int32(emu.X(0)))
+	if fd < 0 {
+		stubs.ReturnError(emu, stubs.EBADF)
+		return false
+	}
+	if libc.CloseFileFD(fd) {
+		emu.SetX(0, 0)
+		stubs.ReturnFromStub(emu)
+		return false
+	}
 	fdMu.Lock()
 	delete(socketFD, fd)
 	fdMu.Unlock()
+	closeStream(fd)
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubShutdown(emu *emulator.Emulator) bool {
+	if !checkSocket(emu) {
+		return false
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubSetsockopt(emu *emulator.Emulator) bool {
+	if !checkSocket(emu) {
+		return false
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
 }
 
 func stubGetsockopt(emu *emulator.Emulator) bool {
+	if !checkSocket(emu) {
+		return false
+	}
 	emu.SetX(0, 0)
 	stubs.ReturnFromStub(emu)
 	return false
@@ -288,3 +375,20 @@ func stubEpollWait(emu *emulator.Emulator) bool {
 	stubs.ReturnFromStub(emu)
 	return false
 }
+
+// socketRead serves read(2) on socket descriptors for libc.
+func socketRead(emu *emulator.Emulator, fd int, buf, count uint64) (uint64, bool) {
+	if !isSocket(fd) {
+		return 0, false
+	}
+	return recvBuffer(emu, "read", fd, buf, count), true
+}
+
+// socketWrite serves write(2) on socket descriptors for libc.
+func socketWrite(emu *emulator.Emulator, fd int, buf, count uint64) bool {
+	if !isSocket(fd) {
+		return false
+	}
+	sendBuffer(emu, "write", fd, buf, count)
+	return true
+}
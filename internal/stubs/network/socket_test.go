@@ -0,0 +1,55 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/stubs"
+	"github.com/zboralski/galago/internal/stubs/libc"
+)
+
+func TestCheckSocket(t *testing.T) {
+	emu := newTrafficEmulator(t)
+	const sysPipe2, sysListen = 59, 201
+
+	fds := emu.Malloc(8)
+	if r := svc(t, emu, sysPipe2, fds, 0); r != 0 {
+		t.Fatalf("pipe2 = %d", int64(r))
+	}
+	pipe, _ := emu.MemReadU32(fds)
+
+	tests := []struct {
+		name  string
+		fd    uint64
+		errno int // 0 for success
+	}{
+		{"socket", svc(t, emu, sysSocket, 2, 1, 0), 0},
+		{"unknown", 7777, 0}, // Possibly a socket made by code that did not run
+		{"pipe", uint64(pipe), stubs.ENOTSOCK},
+		{"negative", ^uint64(0), stubs.EBADF},
+	}
+	// The syscall returns -errno
+	for _, tt := range tests {
+		if r := svc(t, emu, sysListen, tt.fd, 1); int64(r) != -int64(tt.errno) {
+			t.Errorf("%s: listen = %d, want %d", tt.name, int64(r), -tt.errno)
+		}
+	}
+}
+
+func TestCloseFileFD(t *testing.T) {
+	emu := newTrafficEmulator(t)
+	const sysPipe2, sysClose = 59, 57
+
+	fds := emu.Malloc(8)
+	if r := svc(t, emu, sysPipe2, fds, 0); r != 0 {
+		t.Fatalf("pipe2 = %d", int64(r))
+	}
+	for _, off := range []uint64{0, 4} {
+		fd, _ := emu.MemReadU32(fds + off)
+		if r := svc(t, emu, sysClose, uint64(fd)); r != 0 {
+			t.Errorf("close(%d) = %d", fd, int64(r))
+		}
+		if libc.IsFileFD(int(fd)) {
+			t.Errorf("close(%d) left the descriptor open in libc", fd)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// Stream is the traffic of one guest socket.
+type Stream struct {
+	FD       int
+	Remote   string // "ip:port" from connect or sendto
+	Sent     []byte
+	Received []byte
+}
+
+// HTTPRequest is a plain HTTP request decoded from a stream.
+type HTTPRequest struct {
+	FD     int
+	Method string
+	Host   string
+	Target string // Request target as sent, e.g. "/v1/config?id=1"
+	Header http.Header
+	Body   []byte
+}
+
+// Responder opens the remote end of a guest connection. remote is the
+// address the guest connected to, or "" if it never called connect.
+type Responder interface {
+	Open(remote string) (io.ReadWriteCloser, error)
+}
+
+// conn is an open guest socket and its peer, opened on first use.
+type conn struct {
+	stream *Stream
+	peer   io.ReadWriteCloser
+	failed bool // The responder refused the connection
+}
+
+var (
+	streams   []*Stream
+	conns     = make(map[int]*conn)
+	responder Responder
+	trafficMu sync.Mutex
+)
+
+// SetResponder sets what answers guest connections. With none, every
+// receive reports the connection closed.
+func SetResponder(r Responder) {
+	trafficMu.Lock()
+	responder = r
+	trafficMu.Unlock()
+}
+
+// GetStreams returns the traffic of every socket that connected or sent,
+// in the order they did.
+func GetStreams() []Stream {
+	trafficMu.Lock()
+	defer trafficMu.Unlock()
+	result := make([]Stream, len(streams))
+	for i, s := range streams {
+		result[i] = *s
+		result[i].Sent = bytes.Clone(s.Sent)
+		result[i].Received = bytes.Clone(s.Received)
+	}
+	return result
+}
+
+// GetHTTPRequests decodes the HTTP requests the guest sent.
+func GetHTTPRequests() []HTTPRequest {
+	var reqs []HTTPRequest
+	for _, s := range GetStreams() {
+		data := s.Sent
+		for {
+			req, n, ok := parseHTTPRequest(data)
+			if !ok {
+				break
+			}
+			req.FD = s.FD
+			reqs = append(reqs, *req)
+			data = data[n:]
+		}
+	}
+	return reqs
+}
+
+// ClearTraffic forgets all streams and closes their peers.
+func ClearTraffic() {
+	trafficMu.Lock()
+	for _, c := range conns {
+		if c.peer != nil {
+			c.peer.Close()
+		}
+	}
+	streams = nil
+	conns = make(map[int]*conn)
+	trafficMu.Unlock()
+}
+
+// getConn returns the connection state of fd, creating it if needed.
+// Callers hold trafficMu.
+func getConn(fd int) *conn {
+	c := conns[fd]
+	if c == nil {
+		c = &conn{stream: &Stream{FD: fd}}
+		conns[fd] = c
+		streams = append(streams, c.stream)
+	}
+	return c
+}
+
+// openPeer connects c to the responder. Callers hold trafficMu.
+func (c *conn) openPeer() io.ReadWriteCloser {
+	if c.peer == nil && !c.failed && responder != nil {
+		peer, err := responder.Open(c.stream.Remote)
+		if err != nil {
+			stubs.DefaultRegistry.Log("network", "responder", err.Error())
+			c.failed = true
+			return nil
+		}
+		c.peer = peer
+	}
+	return c.peer
+}
+
+// connectStream records the remote address of fd.
+func connectStream(fd int, remote string) {
+	trafficMu.Lock()
+	getConn(fd).stream.Remote = remote
+	trafficMu.Unlock()
+}
+
+// closeStream closes the peer of fd; its stream is kept.
+func closeStream(fd int) {
+	trafficMu.Lock()
+	if c := conns[fd]; c != nil {
+		if c.peer != nil {
+			c.peer.Close()
+		}
+		delete(conns, fd)
+	}
+	trafficMu.Unlock()
+}
+
+// sendStream records data sent on fd and passes it to the peer. It
+// returns the remote address of fd.
+func sendStream(fd int, data []byte) string {
+	trafficMu.Lock()
+	defer trafficMu.Unlock()
+	c := getConn(fd)
+	c.stream.Sent = append(c.stream.Sent, data...)
+	if peer := c.openPeer(); peer != nil {
+		if _, err := peer.Write(data); err != nil {
+			stubs.DefaultRegistry.Log("network", "responder", err.Error())
+		}
+	}
+	return c.stream.Remote
+}
+
+// recvStream reads up to max bytes from the peer of fd. It returns nil
+// when the peer has nothing more to say.
+func recvStream(fd int, max uint64) []byte {
+	trafficMu.Lock()
+	c := getConn(fd)
+	peer := c.openPeer()
+	trafficMu.Unlock()
+	if peer == nil || max == 0 {
+		return nil
+	}
+
+	// A forwarded receive can wait; don't hold the lock for it
+	buf := make([]byte, min(max, 64*1024))
+	n, _ := peer.Read(buf)
+	trafficMu.Lock()
+	c.stream.Received = append(c.stream.Received, buf[:n]...)
+	trafficMu.Unlock()
+	return buf[:n]
+}
+
+// sendBuffer records count bytes at buf as sent on fd and logs them.
+func sendBuffer(emu *emulator.Emulator, name string, fd int, buf, count uint64) {
+	data, err := emu.MemRead(buf, min(count, 1<<20))
+	if err != nil {
+		return
+	}
+	remote := sendStream(fd, data)
+
+	detail := fmt.Sprintf("fd=%d len=%d", fd, len(data))
+	if remote != "" {
+		detail += " " + remote
+	}
+	if line, _, ok := bytes.Cut(data, []byte("\r\n")); ok && isRequestLine(string(line)) {
+		detail += " " + string(line)
+	}
+	stubs.DefaultRegistry.Log("network", name, detail)
+}
+
+// recvBuffer fills up to count bytes at buf from the peer of fd and
+// returns how many it wrote.
+func recvBuffer(emu *emulator.Emulator, name string, fd int, buf, count uint64) uint64 {
+	data := recvStream(fd, count)
+	if len(data) == 0 || emu.MemWrite(buf, data) != nil {
+		return 0
+	}
+	detail := fmt.Sprintf("fd=%d len=%d", fd, len(data))
+	if line, _, ok := bytes.Cut(data, []byte("\r\n")); ok && strings.HasPrefix(string(line), "HTTP/") {
+		detail += " " + string(line)
+	}
+	stubs.DefaultRegistry.Log("network", name, detail)
+	return uint64(len(data))
+}
+
+// isRequestLine reports whether line looks like "GET /path HTTP/1.1".
+func isRequestLine(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) == 3 && strings.HasPrefix(fields[2], "HTTP/")
+}
+
+// parseHTTPRequest decodes the HTTP request at the start of data. It
+// returns the number of bytes the request took, and false if data does
+// not start with a complete request.
+func parseHTTPRequest(data []byte) (*HTTPRequest, int, bool) {
+	if line, _, ok := bytes.Cut(data, []byte("\r\n")); !ok || !isRequestLine(string(line)) {
+		return nil, 0, false
+	}
+	r := bytes.NewReader(data)
+	br := bufio.NewReader(r)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, 0, false
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, 0, false
+	}
+	return &HTTPRequest{
+		Method: req.Method,
+		Host:   req.Host,
+		Target: req.RequestURI,
+		Header: req.Header,
+		Body:   body,
+	}, len(data) - r.Len() - br.Buffered(), true
+}
+
+// Dir answers HTTP requests from canned responses stored as
+// <dir>/<host>/<path>, where host is the Host header without its port
+// and a path ending in / reads "index". The query string is ignored. A
+// file starting with "HTTP/" is sent as is; anything else is the body of
+// a 200 response. Missing files get a 404.
+type Dir string
+
+// Open returns a peer that answers each complete request it is sent.
+func (d Dir) Open(remote string) (io.ReadWriteCloser, error) {
+	return &cannedPeer{dir: string(d), remote: remote}, nil
+}
+
+type cannedPeer struct {
+	dir    string
+	remote string
+	in     bytes.Buffer // Sent but not yet a complete request
+	out    bytes.Buffer // Responses not yet received
+}
+
+func (p *cannedPeer) Write(b []byte) (int, error) {
+	p.in.Write(b)
+	for {
+		req, n, ok := parseHTTPRequest(p.in.Bytes())
+		if !ok {
+			break
+		}
+		p.in.Next(n)
+		p.out.Write(p.respond(req))
+	}
+	return len(b), nil
+}
+
+func (p *cannedPeer) Read(b []byte) (int, error) {
+	if p.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return p.out.Read(b)
+}
+
+func (p *cannedPeer) Close() error {
+	return nil
+}
+
+// respond returns the canned response for req.
+func (p *cannedPeer) respond(req *HTTPRequest) []byte {
+	host := req.Host
+	if host == "" {
+		host = p.remote
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	// The Host header comes from the guest and must not leave the directory
+	if host == "" || host == "." || strings.Contains(host, "..") || strings.ContainsAny(host, `/\`) {
+		stubs.DefaultRegistry.Log("network", "respond", fmt.Sprintf("%s %q: bad host", req.Method, host))
+		return httpResponse("400 Bad Request", nil)
+	}
+	// Absolute-form targets, as sent to proxies, carry the host too
+	target, _, _ := strings.Cut(req.Target, "?")
+	if u, err := url.ParseRequestURI(req.Target); err == nil {
+		target = u.Path
+	}
+	name := path.Clean("/" + target)
+	if strings.HasSuffix(target, "/") {
+		name = path.Join(name, "index")
+	}
+
+	file := filepath.Clean(filepath.Join(p.dir, host, filepath.FromSlash(name)))
+	if rel, err := filepath.Rel(filepath.Clean(p.dir), file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		stubs.DefaultRegistry.Log("network", "respond", fmt.Sprintf("%s %s%s: outside %s", req.Method, host, name, p.dir))
+		return httpResponse("404 Not Found", nil)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		stubs.DefaultRegistry.Log("network", "respond", fmt.Sprintf("%s %s%s: 404", req.Method, host, name))
+		return httpResponse("404 Not Found", nil)
+	}
+	stubs.DefaultRegistry.Log("network", "respond", fmt.Sprintf("%s %s%s: %s", req.Method, host, name, file))
+	if bytes.HasPrefix(data, []byte("HTTP/")) {
+		return data
+	}
+	return httpResponse("200 OK", data)
+}
+
+// httpResponse wraps body in a response that closes the connection.
+func httpResponse(status string, body []byte) []byte {
+	head := fmt.Sprintf("HTTP/1.1 %s\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", status, len(body))
+	return append([]byte(head), body...)
+}
+
+// forwardTimeout bounds dialing the forward address and each receive.
+const forwardTimeout = 5 * time.Second
+
+// Forward relays every guest connection to a local TCP address such as
+// "127.0.0.1:8080", whatever the guest connected to.
+type Forward string
+
+// Open dials the forward address.
+func (f Forward) Open(remote string) (io.ReadWriteCloser, error) {
+	c, err := net.DialTimeout("tcp", string(f), forwardTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("forward %s: %w", remote, err)
+	}
+	return forwardPeer{c}, nil
+}
+
+// forwardPeer gives up on a receive that waits longer than forwardTimeout.
+type forwardPeer struct {
+	net.Conn
+}
+
+func (p forwardPeer) Read(b []byte) (int, error) {
+	p.SetReadDeadline(time.Now().Add(forwardTimeout))
+	return p.Conn.Read(b)
+}
@@ -0,0 +1,164 @@
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// svc runs a single SVC #0 with the syscall number in X8.
+func svc(t *testing.T, emu *emulator.Emulator, nr uint64, args ...uint64) uint64 {
+	t.Helper()
+	for n, v := range args {
+		emu.SetX(n, v)
+	}
+	emu.SetX(8, nr)
+	code := uint64(emulator.CodeBase)
+	emu.MemWrite(code, []byte{0x01, 0x00, 0x00, 0xd4}) // SVC #0
+	if err := emu.Run(code, code+4); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return emu.X(0)
+}
+
+const (
+	sysWrite    = 64
+	sysSocket   = 198
+	sysConnect  = 203
+	sysSendto   = 206
+	sysRecvfrom = 207
+)
+
+// dial opens a TCP socket to 10.0.0.1:80 and returns its descriptor.
+func dial(t *testing.T, emu *emulator.Emulator) uint64 {
+	t.Helper()
+	fd := svc(t, emu, sysSocket, 2, 1, 0)
+	addr := emu.Malloc(16)
+	emu.MemWrite(addr, []byte{2, 0, 0, 80, 10, 0, 0, 1})
+	if r := svc(t, emu, sysConnect, fd, addr, 16); r != 0 {
+		t.Fatalf("connect = %d", int64(r))
+	}
+	return fd
+}
+
+func send(t *testing.T, emu *emulator.Emulator, nr, fd uint64, data string) {
+	t.Helper()
+	buf := emu.Malloc(uint64(len(data)))
+	emu.MemWriteString(buf, data)
+	if n := svc(t, emu, nr, fd, buf, uint64(len(data)), 0, 0, 0); n != uint64(len(data)) {
+		t.Fatalf("send = %d, want %d", n, len(data))
+	}
+}
+
+func recv(t *testing.T, emu *emulator.Emulator, fd uint64) string {
+	t.Helper()
+	buf := emu.Malloc(4096)
+	n := svc(t, emu, sysRecvfrom, fd, buf, 4096, 0, 0, 0)
+	data, _ := emu.MemRead(buf, n)
+	return string(data)
+}
+
+func newTrafficEmulator(t *testing.T) *emulator.Emulator {
+	t.Helper()
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	t.Cleanup(func() { emu.Close() })
+	if err := stubs.DefaultRegistry.InstallSyscalls(emu); err != nil {
+		t.Fatalf("InstallSyscalls: %v", err)
+	}
+	ClearTraffic()
+	t.Cleanup(func() {
+		SetResponder(nil)
+		ClearTraffic()
+	})
+	return emu
+}
+
+func TestCannedResponses(t *testing.T) {
+	emu := newTrafficEmulator(t)
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "api.example.com", "cfg"), 0755)
+	os.WriteFile(filepath.Join(dir, "api.example.com", "cfg", "key.json"), []byte(`{"key":"2f9a81c0"}`), 0644)
+	SetResponder(Dir(dir))
+
+	// The request arrives in two writes; only a complete one is answered
+	fd := dial(t, emu)
+	send(t, emu, sysWrite, fd, "GET /cfg/key.json?v=2 HTTP/1.1\r\nHost: api.example.com\r\n")
+	send(t, emu, sysWrite, fd, "User-Agent: game/1.0\r\n\r\n")
+	resp := recv(t, emu, fd)
+	if !strings.HasPrefix(resp, "HTTP/1.1 200 OK\r\n") || !strings.HasSuffix(resp, `{"key":"2f9a81c0"}`) {
+		t.Errorf("response = %q", resp)
+	}
+	if more := recv(t, emu, fd); more != "" {
+		t.Errorf("second recv = %q, want EOF", more)
+	}
+
+	fd2 := dial(t, emu)
+	send(t, emu, sysSendto, fd2, "POST /login HTTP/1.1\r\nHost: api.example.com:8080\r\nContent-Length: 5\r\n\r\nhello")
+	if resp := recv(t, emu, fd2); !strings.HasPrefix(resp, "HTTP/1.1 404 Not Found\r\n") {
+		t.Errorf("missing response = %q", resp)
+	}
+
+	reqs := GetHTTPRequests()
+	if len(reqs) != 2 {
+		t.Fatalf("requests = %+v", reqs)
+	}
+	if r := reqs[0]; r.Method != "GET" || r.Host != "api.example.com" || r.Target != "/cfg/key.json?v=2" ||
+		r.Header.Get("User-Agent") != "game/1.0" || r.FD != int(fd) {
+		t.Errorf("request 0 = %+v", r)
+	}
+	if r := reqs[1]; r.Method != "POST" || string(r.Body) != "hello" {
+		t.Errorf("request 1 = %+v", r)
+	}
+
+	streams := GetStreams()
+	if len(streams) != 2 || streams[0].Remote != "10.0.0.1:80" || !strings.HasSuffix(string(streams[0].Received), "}") {
+		t.Errorf("streams = %+v", streams)
+	}
+
+	// The Host header cannot reach files outside the directory
+	os.WriteFile(filepath.Join(dir, "api.example.com", "secret"), []byte("secret"), 0644)
+	SetResponder(Dir(filepath.Join(dir, "api.example.com", "cfg")))
+	for _, host := range []string{"..", "../api.example.com", `..\x`} {
+		fd := dial(t, emu)
+		send(t, emu, sysWrite, fd, "GET /secret HTTP/1.1\r\nHost: "+host+"\r\n\r\n")
+		if resp := recv(t, emu, fd); strings.Contains(resp, "secret") || strings.Contains(resp, "200 OK") {
+			t.Errorf("Host %q: response = %q", host, resp)
+		}
+	}
+}
+
+func TestForward(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, 64)
+		n, _ := c.Read(buf)
+		c.Write([]byte("pong:" + string(buf[:n])))
+	}()
+
+	emu := newTrafficEmulator(t)
+	SetResponder(Forward(ln.Addr().String()))
+
+	fd := dial(t, emu)
+	send(t, emu, sysSendto, fd, "ping")
+	if got := recv(t, emu, fd); got != "pong:ping" {
+		t.Errorf("recv = %q, want %q", got, "pong:ping")
+	}
+}
@@ -36,11 +36,19 @@ type DetectorFunc func(emu *emulator.Emulator, imports, symbols map[string]uint6
 
 // Detector defines a pattern-based activation system.
 // Detectors are triggered when certain symbols/patterns are found in symbols.
+// A detector activates when at least one pattern matches, every Required
+// pattern matches, no Excluded pattern matches, and its confidence reaches
+// MinConfidence.
 type Detector struct {
-	Name        string       // Detector name (e.g., "cocos2dx", "unity-il2cpp", "jni")
-	Patterns    []string     // Symbol patterns to match (any match triggers)
-	Activate    DetectorFunc // Called when pattern matches
-	Description string       // Human-readable description
+	Name          string          // Detector name (e.g., "cocos2dx", "unity-il2cpp", "jni")
+	Patterns      []string        // Symbol patterns to match (any match triggers)
+	Required      []string        // Symbol patterns that must all match
+	Excluded      []string        // Symbol patterns that prevent activation
+	Score         ScoreFunc       // Confidence in [0, 1]; nil uses PatternScore
+	MinConfidence float64         // Minimum confidence to activate (0 = any match)
+	Fingerprint   FingerprintFunc // Engine/version identification (optional)
+	Activate      DetectorFunc    // Called when pattern matches
+	Description   string          // Human-readable description
 }
 
 // Registry holds all registered stub definitions.
@@ -52,6 +60,7 @@ type Registry struct {
 	detectorsMu sync.RWMutex
 	detectors   []*Detector
 	activated   map[string]bool // Track which detectors have been activated
+	report      []DetectorMatch // Detector results from the last Install
 
 	// Callbacks
 	OnCall func(category, name, detail string)
@@ -115,11 +124,13 @@ func (r *Registry) RegisterDetector(d Detector) {
 }
 
 // checkDetectors runs pattern matching against symbols and activates matching detectors.
+// Results for every detector with at least one matching pattern are kept for Report.
 func (r *Registry) checkDetectors(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
 	r.detectorsMu.Lock()
 	defer r.detectorsMu.Unlock()
 
 	installed := 0
+	names := sortedNames(symbols)
 
 	for _, det := range r.detectors {
 		// Skip already activated detectors
@@ -127,35 +138,46 @@ func (r *Registry) checkDetectors(emu *emulator.Emulator, imports, symbols map[s
 			continue
 		}
 
-		// Check if any pattern matches in symbols (includes both internal and imports)
-		matched := false
-		for symName := range symbols {
-			for _, pattern := range det.Patterns {
-				if matchPattern(symName, pattern) {
-					matched = true
-					break
-				}
-			}
-			if matched {
-				break
-			}
+		m := det.evaluate(emu, names, symbols)
+		if m.Count == 0 {
+			continue
 		}
 
-		if matched {
+		if m.eligible(det) {
 			if Debug && glog.L != nil {
 				glog.L.DetectorActivate(det.Name, det.Description)
 			}
 			r.activated[det.Name] = true
-			installed += det.Activate(emu, imports, symbols)
+			m.Activated = true
+			m.Hooks = det.Activate(emu, imports, symbols)
+			installed += m.Hooks
 		}
+		r.addReport(m)
 	}
 
 	return installed
 }
 
+// addReport records a detector result, replacing the one from an earlier
+// Install on the same emulator. Callers hold detectorsMu.
+func (r *Registry) addReport(m DetectorMatch) {
+	for i := range r.report {
+		if r.report[i].Name == m.Name {
+			r.report[i] = m
+			return
+		}
+	}
+	r.report = append(r.report, m)
+}
+
 // matchPattern checks if a symbol name matches a pattern.
 // Patterns can use * for wildcard and can be substring matches.
+// Patterns containing "::" match the demangled name, so a detector can
+// target "cocos2d::FileUtils::setXXTeaKey" instead of its mangled form.
 func matchPattern(name, pattern string) bool {
+	if strings.Contains(pattern, "::") {
+		name = emulator.DemangleName(name)
+	}
 	// Simple substring match for now
 	if strings.Contains(pattern, "*") {
 		// Convert glob to simple prefix/suffix matching
@@ -188,7 +210,12 @@ func (r *Registry) Install(emu *emulator.Emulator, imports map[string]uint64, sy
 	if r.emu != emu {
 		r.detectorsMu.Lock()
 		r.activated = make(map[string]bool)
+		r.report = nil
 		r.detectorsMu.Unlock()
+
+		if err := r.InstallSyscalls(emu); err != nil && glog.L != nil {
+			glog.L.Warn("syscall hook", zap.Error(err))
+		}
 	}
 	r.emu = emu
 	r.mu.Unlock()
@@ -378,6 +405,22 @@ func ReturnFromStub(emu *emulator.Emulator) {
 	emu.SetPC(emu.LR())
 }
 
+// ReturnError returns -1 from the current function with errno set,
+// the failure convention of most libc and syscall wrappers.
+func ReturnError(emu *emulator.Emulator, errno int) {
+	emu.SetErrno(errno)
+	emu.SetX(0, ^uint64(0))
+	ReturnFromStub(emu)
+}
+
+// ReturnNull returns NULL from the current function with errno set,
+// the failure convention of pointer-returning functions such as fopen.
+func ReturnNull(emu *emulator.Emulator, errno int) {
+	emu.SetErrno(errno)
+	emu.SetX(0, 0)
+	ReturnFromStub(emu)
+}
+
 // FormatHex formats a value as hex string.
 func FormatHex(v uint64) string {
 	if v == 0 {
@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/fingerprint"
 	"github.com/zboralski/galago/internal/stubs"
 )
 
@@ -31,30 +32,45 @@ var (
 
 func init() {
 	// Register Cocos2d-x detector
+	// Its key setter patterns (ZipUtils, setEncryptKey, aes_key) are common
+	// names, so a lone cocos2d or ZipUtils symbol is not enough
 	stubs.RegisterDetector(stubs.Detector{
-		Name: "cocos2dx",
-		Patterns: []string{
-			"cocos2d",
-			"setXXTeaKey",
-			"ZipUtils",
-			"ccDecrypt",
-			"jsb_set",
-		},
-		Activate:    activateCocos2dx,
-		Description: "Cocos2d-x XXTEA key extraction",
+		Name:          "cocos2dx",
+		Patterns:      cocosPatterns,
+		Score:         cocosScore,
+		MinConfidence: 0.4,
+		Fingerprint:   cocosFingerprint,
+		Activate:      activateCocos2dx,
+		Description:   "Cocos2d-x XXTEA key extraction",
 	})
+}
 
-	// Register Unity IL2CPP detector
-	stubs.RegisterDetector(stubs.Detector{
-		Name: "unity-il2cpp",
-		Patterns: []string{
-			"il2cpp",
-			"Il2Cpp",
-			"mono_",
-		},
-		Activate:    activateUnityIL2CPP,
-		Description: "Unity IL2CPP key extraction",
-	})
+var cocosPatterns = []string{
+	"cocos2d",
+	"setXXTeaKey",
+	"ZipUtils",
+	"ccDecrypt",
+	"jsb_set",
+}
+
+// cocosScore is certain for the XXTEA key setters and decryptors, which
+// only Cocos defines. Otherwise two patterns must match, as cocos2d::ZipUtils
+// does in every Cocos2d-x build.
+func cocosScore(m *stubs.DetectorMatch) float64 {
+	if len(m.Matched["setXXTeaKey"]) > 0 || len(m.Matched["ccDecrypt"]) > 0 || len(m.Matched["jsb_set"]) > 0 {
+		return 1
+	}
+	return stubs.PatternScore(cocosPatterns)(m)
+}
+
+// cocosFingerprint identifies the Cocos flavor, version, and scripting layer.
+func cocosFingerprint(emu *emulator.Emulator, symbols map[string]uint64) string {
+	if img := emu.Image(); img != nil {
+		if e, ok := fingerprint.Cocos(img); ok {
+			return e.String()
+		}
+	}
+	return "cocos2d-x"
 }
 
 // GetCapturedKeys returns all captured keys.
@@ -110,6 +126,21 @@ func CaptureKeyDirect(value, source string, address uint64) {
 	})
 }
 
+// hookReturn runs fn when the current function returns to its caller.
+// It must be called from a hook at function entry, while LR holds the return address.
+// The callee runs normally; fn sees its return value in X0.
+func hookReturn(emu *emulator.Emulator, fn func(*emulator.Emulator)) {
+	retAddr := emu.LR()
+	if retAddr == 0 {
+		return
+	}
+	emu.HookAddress(retAddr, func(emu *emulator.Emulator) bool {
+		emu.RemoveAddressHook(retAddr)
+		fn(emu)
+		return false
+	})
+}
+
 // isPrintableASCII checks if all characters in the string are printable ASCII.
 func isPrintableASCII(s string) bool {
 	for _, c := range s {
@@ -138,29 +169,33 @@ func activateCocos2dx(emu *emulator.Emulator, imports, symbols map[string]uint64
 				stubs.DefaultRegistry.Log("setter", "xxtea-hook",
 					fmt.Sprintf("%s @ 0x%x", name, addr))
 			}
-			emu.HookAddress(addr, makeXXTeaKeyHook(name))
-			installed++
+			if emu.TryHookAddress(addr, makeXXTeaKeyHook(name)) {
+				installed++
+			}
 			continue
 		}
 
 		// jsb::setXXTeaKey
 		if strings.Contains(name, "jsb") && strings.Contains(name, "XTea") {
-			emu.HookAddress(addr, makeXXTeaKeyHook(name))
-			installed++
+			if emu.TryHookAddress(addr, makeXXTeaKeyHook(name)) {
+				installed++
+			}
 			continue
 		}
 
 		// ZipUtils encryption key
 		if strings.Contains(name, "ZipUtils") && strings.Contains(name, "Key") {
-			emu.HookAddress(addr, makeXXTeaKeyHook(name))
-			installed++
+			if emu.TryHookAddress(addr, makeXXTeaKeyHook(name)) {
+				installed++
+			}
 			continue
 		}
 
 		// cc::Application::setXXTeaKey
 		if strings.Contains(name, "Application") && strings.Contains(name, "XTea") {
-			emu.HookAddress(addr, makeXXTeaKeyHook(name))
-			installed++
+			if emu.TryHookAddress(addr, makeXXTeaKeyHook(name)) {
+				installed++
+			}
 			continue
 		}
 
@@ -173,8 +208,9 @@ func activateCocos2dx(emu *emulator.Emulator, imports, symbols map[string]uint64
 				stubs.DefaultRegistry.Log("setter", "crypto-hook",
 					fmt.Sprintf("%s @ 0x%x", name, addr))
 			}
-			emu.HookAddress(addr, makeStdStringSetterHook(name))
-			installed++
+			if emu.TryHookAddress(addr, makeStdStringSetterHook(name)) {
+				installed++
+			}
 			continue
 		}
 
@@ -182,53 +218,15 @@ func activateCocos2dx(emu *emulator.Emulator, imports, symbols map[string]uint64
 		if strings.Contains(name, "setAESKey") ||
 			strings.Contains(name, "AES_set_key") ||
 			strings.Contains(name, "aes_key") {
-			emu.HookAddress(addr, makeGenericKeyHook(name, "aes"))
-			installed++
-			continue
-		}
-	}
-
-	if installed > 0 {
-		stubs.DefaultRegistry.Log("setter", "cocos2dx", "key setters installed")
-	}
-	return installed
-}
-
-// activateUnityIL2CPP installs Unity IL2CPP hooks for key extraction.
-func activateUnityIL2CPP(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
-	installed := 0
-
-	// Search in symbols (includes both internal functions and PLT imports)
-	for name, addr := range symbols {
-		if addr == 0 {
-			continue
-		}
-
-		// Skip Cocos2d-x patterns - those are handled by cocos2dx detector
-		if strings.Contains(name, "setCryptoKey") || strings.Contains(name, "setXXTeaKey") ||
-			strings.Contains(name, "cocos2d") {
-			continue
-		}
-
-		// Common Unity encryption patterns
-		if strings.Contains(name, "Encrypt") || strings.Contains(name, "Decrypt") {
-			if strings.Contains(name, "Key") || strings.Contains(name, "key") {
-				emu.HookAddress(addr, makeGenericKeyHook(name, "custom"))
+			if emu.TryHookAddress(addr, makeGenericKeyHook(name, "aes")) {
 				installed++
-				continue
 			}
-		}
-
-		// Unity Crypto utilities
-		if strings.Contains(name, "Crypto") && strings.Contains(name, "Key") {
-			emu.HookAddress(addr, makeGenericKeyHook(name, "custom"))
-			installed++
 			continue
 		}
 	}
 
 	if installed > 0 {
-		stubs.DefaultRegistry.Log("setter", "unity-il2cpp", "key setters installed")
+		stubs.DefaultRegistry.Log("setter", "cocos2dx", "key setters installed")
 	}
 	return installed
 }
@@ -0,0 +1,42 @@
+package setters
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+func TestCocosDetector(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	tests := []struct {
+		name    string
+		symbols []string
+		want    bool
+	}{
+		{"ZipUtils alone", []string{"_ZN3app8ZipUtils6setKeyEPKc"}, false},
+		{"cocos2d alone", []string{"Java_org_cocos2dx_lib_Cocos2dxHelper_nativeSetApkPath"}, false},
+		{"cocos2d::ZipUtils", []string{"_ZN7cocos2d8ZipUtils18setPvrEncryptionKeyEjjjj"}, true},
+		{"XXTEA key setter", []string{"_ZN7LuaStack18setXXTeaKeyAndSignEPKciS1_i"}, true},
+	}
+	for _, tt := range tests {
+		symbols := make(map[string]uint64)
+		for i, name := range tt.symbols {
+			symbols[name] = uint64(emulator.CodeBase) + uint64(i)*4
+		}
+		got := false
+		for _, m := range stubs.Detect(emu, symbols) {
+			if m.Name == "cocos2dx" {
+				got = m.Activated
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s: activated = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package setters
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs/cxxabi"
+)
+
+// Guest readers for the libc++ (NDK) container layouts keys end up in,
+// and the libstdc++ ones where they differ. All addresses are guest
+// addresses; every reader bounds what it walks so that garbage or
+// uninitialized memory fails instead of looping.
+//
+// std::vector<T>         { T* begin; T* end; T* end_cap; }
+// std::shared_ptr<T>     { T* ptr; __shared_weak_count* ctrl; }
+// std::map<K, V>         { node* begin; node* root; size_t size; }
+//   node                 { node* left; node* right; node* parent; bool black; pair<const K, V> }
+// std::unordered_map<K, V> { node** buckets; size_t bucket_count; node* first; size_t size; float mlf; }
+//   node                 { node* next; size_t hash; pair<const K, V> }
+//
+// libstdc++ vectors and shared_ptrs match; its maps and hash nodes do not:
+//
+// std::map<K, V>         { less; int color; node* root; node* leftmost; node* rightmost; size_t size; }
+//   node                 { int color; node* parent; node* left; node* right; pair<const K, V> }
+// std::unordered_map<K, V> { node** buckets; size_t bucket_count; node* first; size_t size; float mlf; ... }
+//   node                 { node* next; pair<const K, V>; size_t hash; }
+
+const (
+	maxContainerBytes = 1 << 20
+	maxContainerLen   = 4096
+
+	stdStringSize = cxxabi.SSOObjSize
+
+	treeNodeValue = 32 // offset of the pair in a __tree node
+	hashNodeValue = 16 // offset of the pair in a __hash_table node
+	hashFirstNode = 16 // offset of __first_node_.__next_ in the table
+	hashSize      = 24 // offset of the element count in the table
+
+	cocosValueSize = 16 // union + Type
+)
+
+// stdLib is the layout of a C++ standard library's strings and maps.
+type stdLib struct {
+	name       string
+	stringSize uint64
+	readString func(emu *emulator.Emulator, addr uint64) (string, bool)
+
+	treeRoot, treeSize  uint64 // Offsets in the map
+	nodeLeft, nodeRight uint64 // Offsets in a tree node
+	hashValue           uint64 // Offset of the pair in a hash node
+}
+
+var (
+	libcxx = &stdLib{
+		name:       "libc++",
+		stringSize: stdStringSize,
+		readString: cxxabi.ReadSSOString,
+		treeRoot:   8,
+		treeSize:   16,
+		nodeLeft:   0,
+		nodeRight:  8,
+		hashValue:  hashNodeValue,
+	}
+	// libstdc++ with the C++11 ABI std::__cxx11::string
+	libstdcxx = &stdLib{
+		name:       "libstdc++",
+		stringSize: cxxabi.CXX11ObjSize,
+		readString: cxxabi.ReadCXX11String,
+		treeRoot:   16,
+		treeSize:   40,
+		nodeLeft:   16,
+		nodeRight:  24,
+		hashValue:  8,
+	}
+	// libstdc++ before the C++11 ABI, with the COW std::string
+	libstdcxxCOW = &stdLib{
+		name:       "libstdc++ COW",
+		stringSize: cxxabi.COWObjSize,
+		readString: cxxabi.ReadCOWString,
+		treeRoot:   16,
+		treeSize:   40,
+		nodeLeft:   16,
+		nodeRight:  24,
+		hashValue:  8,
+	}
+)
+
+// stdLibOf returns the library a demangled symbol was built against:
+// libc++ unless it names libstdc++ types.
+func stdLibOf(demangled string) *stdLib {
+	switch {
+	case strings.Contains(demangled, "std::__ndk1::"):
+		return libcxx
+	case strings.Contains(demangled, "std::__cxx11::"):
+		return libstdcxx
+	case strings.Contains(demangled, "std::"):
+		return libstdcxxCOW
+	}
+	return libcxx
+}
+
+// MapEntry is one element of a guest map: the addresses of its key and
+// value.
+type MapEntry struct {
+	Key   uint64
+	Value uint64
+}
+
+// ReadVectorBytes returns the element storage of a std::vector.
+func ReadVectorBytes(emu *emulator.Emulator, addr uint64) ([]byte, bool) {
+	data, err := emu.MemRead(addr, 16)
+	if err != nil {
+		return nil, false
+	}
+	begin := binary.LittleEndian.Uint64(data[0:8])
+	end := binary.LittleEndian.Uint64(data[8:16])
+	if begin == end {
+		return nil, true
+	}
+	if begin == 0 || end < begin || end-begin > maxContainerBytes {
+		return nil, false
+	}
+	elems, err := emu.MemRead(begin, end-begin)
+	if err != nil {
+		return nil, false
+	}
+	return elems, true
+}
+
+// ReadVector returns the addresses of the elements of a std::vector whose
+// elements are elemSize bytes.
+func ReadVector(emu *emulator.Emulator, addr, elemSize uint64) ([]uint64, bool) {
+	begin, err1 := emu.MemReadU64(addr)
+	end, err2 := emu.MemReadU64(addr + 8)
+	if err1 != nil || err2 != nil || end < begin || (end-begin)%elemSize != 0 {
+		return nil, false
+	}
+	n := (end - begin) / elemSize
+	if n > maxContainerLen {
+		return nil, false
+	}
+	elems := make([]uint64, n)
+	for i := range elems {
+		elems[i] = begin + uint64(i)*elemSize
+	}
+	return elems, true
+}
+
+// ReadSharedPtr returns the object a std::shared_ptr points to.
+func ReadSharedPtr(emu *emulator.Emulator, addr uint64) (uint64, bool) {
+	ptr, err := emu.MemReadU64(addr)
+	if err != nil || ptr == 0 {
+		return 0, false
+	}
+	return ptr, true
+}
+
+// ReadMap returns the entries of a libc++ std::map in key order. keySize
+// is the size of the key, which the value follows (padded to 8).
+func ReadMap(emu *emulator.Emulator, addr, keySize uint64) ([]MapEntry, bool) {
+	return libcxx.readMap(emu, addr, keySize)
+}
+
+func (l *stdLib) readMap(emu *emulator.Emulator, addr, keySize uint64) ([]MapEntry, bool) {
+	root, err1 := emu.MemReadU64(addr + l.treeRoot)
+	size, err2 := emu.MemReadU64(addr + l.treeSize)
+	if err1 != nil || err2 != nil || size > maxContainerLen {
+		return nil, false
+	}
+
+	entries := make([]MapEntry, 0, size)
+	valueOff := treeNodeValue + align8(keySize)
+	var walk func(node uint64, depth int) bool
+	walk = func(node uint64, depth int) bool {
+		if node == 0 {
+			return true
+		}
+		// A red-black tree of maxContainerLen nodes is far shallower than this
+		if depth > 64 || uint64(len(entries)) >= size {
+			return false
+		}
+		left, err1 := emu.MemReadU64(node + l.nodeLeft)
+		right, err2 := emu.MemReadU64(node + l.nodeRight)
+		if err1 != nil || err2 != nil || !walk(left, depth+1) {
+			return false
+		}
+		entries = append(entries, MapEntry{Key: node + treeNodeValue, Value: node + valueOff})
+		return walk(right, depth+1)
+	}
+	if !walk(root, 0) || uint64(len(entries)) != size {
+		return nil, false
+	}
+	return entries, true
+}
+
+// ReadUnorderedMap returns the entries of a libc++ std::unordered_map in
+// iteration order. keySize is as for ReadMap.
+func ReadUnorderedMap(emu *emulator.Emulator, addr, keySize uint64) ([]MapEntry, bool) {
+	return libcxx.readUnorderedMap(emu, addr, keySize)
+}
+
+func (l *stdLib) readUnorderedMap(emu *emulator.Emulator, addr, keySize uint64) ([]MapEntry, bool) {
+	node, err1 := emu.MemReadU64(addr + hashFirstNode)
+	size, err2 := emu.MemReadU64(addr + hashSize)
+	if err1 != nil || err2 != nil || size > maxContainerLen {
+		return nil, false
+	}
+
+	entries := make([]MapEntry, 0, size)
+	valueOff := l.hashValue + align8(keySize)
+	for node != 0 {
+		if uint64(len(entries)) >= size {
+			return nil, false
+		}
+		entries = append(entries, MapEntry{Key: node + l.hashValue, Value: node + valueOff})
+		next, err := emu.MemReadU64(node)
+		if err != nil {
+			return nil, false
+		}
+		node = next
+	}
+	if uint64(len(entries)) != size {
+		return nil, false
+	}
+	return entries, true
+}
+
+// CocosValueType is cocos2d::Value::Type (cocos2d-x 3.x and 4.x).
+type CocosValueType uint32
+
+const (
+	CocosNone CocosValueType = iota
+	CocosByte
+	CocosInteger
+	CocosUnsigned
+	CocosFloat
+	CocosDouble
+	CocosBoolean
+	CocosString
+	CocosVector
+	CocosMap
+	CocosIntKeyMap
+)
+
+// ReadCocosValue formats a cocos2d::Value built against libc++: numbers
+// and strings as is, ValueVector as [a, b], and ValueMap/ValueMapIntKey
+// as {k: v}.
+//
+// cocos2d::Value { union { ...; double; std::string*; ValueVector*; ValueMap*; } _field; Type _type; }
+func ReadCocosValue(emu *emulator.Emulator, addr uint64) (string, bool) {
+	return libcxx.readCocosValue(emu, addr, 0)
+}
+
+func (l *stdLib) readCocosValue(emu *emulator.Emulator, addr uint64, depth int) (string, bool) {
+	data, err := emu.MemRead(addr, cocosValueSize)
+	if err != nil || depth > 8 {
+		return "", false
+	}
+	field := binary.LittleEndian.Uint64(data[0:8])
+	typ := CocosValueType(binary.LittleEndian.Uint32(data[8:12]))
+
+	switch typ {
+	case CocosNone:
+		return "", true
+	case CocosByte:
+		return strconv.Itoa(int(uint8(field))), true
+	case CocosInteger:
+		return strconv.Itoa(int(int32(field))), true
+	case CocosUnsigned:
+		return strconv.FormatUint(uint64(uint32(field)), 10), true
+	case CocosFloat:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(field))), 'g', -1, 32), true
+	case CocosDouble:
+		return strconv.FormatFloat(math.Float64frombits(field), 'g', -1, 64), true
+	case CocosBoolean:
+		return strconv.FormatBool(uint8(field) != 0), true
+	case CocosString:
+		return l.readString(emu, field)
+	case CocosVector:
+		elems, ok := ReadVector(emu, field, cocosValueSize)
+		if !ok {
+			return "", false
+		}
+		parts := make([]string, len(elems))
+		for i, e := range elems {
+			parts[i], _ = l.readCocosValue(emu, e, depth+1)
+		}
+		return "[" + strings.Join(parts, ", ") + "]", true
+	case CocosMap, CocosIntKeyMap:
+		isIntKey := typ == CocosIntKeyMap
+		keySize := l.stringSize
+		if isIntKey {
+			keySize = 4
+		}
+		entries, ok := l.readUnorderedMap(emu, field, keySize)
+		if !ok {
+			return "", false
+		}
+		parts := make([]string, len(entries))
+		for i, e := range entries {
+			var k string
+			if isIntKey {
+				n, _ := emu.MemReadU32(e.Key)
+				k = strconv.Itoa(int(int32(n)))
+			} else {
+				k, _ = l.readString(emu, e.Key)
+			}
+			v, _ := l.readCocosValue(emu, e.Value, depth+1)
+			parts[i] = k + ": " + v
+		}
+		return "{" + strings.Join(parts, ", ") + "}", true
+	}
+	return "", false
+}
+
+// ReadValueMap returns the entries of a libc++ cocos2d::ValueMap
+// (std::unordered_map<std::string, cocos2d::Value>) as key and formatted
+// value, in iteration order.
+func ReadValueMap(emu *emulator.Emulator, addr uint64) ([][2]string, bool) {
+	return libcxx.readValueMap(emu, addr)
+}
+
+func (l *stdLib) readValueMap(emu *emulator.Emulator, addr uint64) ([][2]string, bool) {
+	entries, ok := l.readUnorderedMap(emu, addr, l.stringSize)
+	if !ok {
+		return nil, false
+	}
+	out := make([][2]string, 0, len(entries))
+	for _, e := range entries {
+		k, ok1 := l.readString(emu, e.Key)
+		v, ok2 := l.readCocosValue(emu, e.Value, 0)
+		if !ok1 || !ok2 {
+			return nil, false
+		}
+		out = append(out, [2]string{k, v})
+	}
+	return out, true
+}
+
+// formatBytes shows printable data as text and anything else as hex.
+func formatBytes(data []byte) string {
+	if isPrintable(string(data)) {
+		return string(data)
+	}
+	return fmt.Sprintf("%x", data)
+}
+
+func align8(n uint64) uint64 {
+	return (n + 7) &^ 7
+}
@@ -0,0 +1,321 @@
+package setters
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// maxPlaintext bounds how much of a plaintext buffer is captured.
+const maxPlaintext = 4096
+
+// cryptoAPI is a crypto library function whose arguments carry secrets.
+type cryptoAPI struct {
+	capture func(emu *emulator.Emulator, name string)
+	ret     func(emu *emulator.Emulator) uint64 // Result when the function is an import and does not run; nil returns 0
+	output  bool                                // capture reads what the function writes, which imports do not
+}
+
+// returns is an import result of v.
+func returns(v uint64) func(*emulator.Emulator) uint64 {
+	return func(*emulator.Emulator) uint64 { return v }
+}
+
+// returnsArg is an import result of the argument in register reg, for
+// writes that report everything sent.
+func returnsArg(reg int) func(*emulator.Emulator) uint64 {
+	return func(emu *emulator.Emulator) uint64 { return emu.X(reg) }
+}
+
+// returnsUpdated is the import result of an EVP update: 1, with *out_len
+// set to the in_len in register inLenReg, or to 0 if inLenReg is -1, so
+// that callers never read an uninitialized length.
+func returnsUpdated(inLenReg int) func(*emulator.Emulator) uint64 {
+	return func(emu *emulator.Emulator) uint64 {
+		n := uint32(0)
+		if inLenReg >= 0 {
+			n = uint32(emu.X(inLenReg))
+		}
+		if outLen := emu.X(2); outLen != 0 {
+			emu.MemWriteU32(outLen, n)
+		}
+		return 1
+	}
+}
+
+// cryptoAPIs are the OpenSSL/BoringSSL and mbedTLS setup and I/O calls.
+var cryptoAPIs = map[string]cryptoAPI{
+	// int AES_set_encrypt_key(const uint8_t *key, unsigned bits, AES_KEY *aeskey)
+	"AES_set_encrypt_key":    {capture: captureAESKey(0, 1)},
+	"AES_set_decrypt_key":    {capture: captureAESKey(0, 1)},
+	"aes_hw_set_encrypt_key": {capture: captureAESKey(0, 1)},
+	"aes_hw_set_decrypt_key": {capture: captureAESKey(0, 1)},
+	"aes_v8_set_encrypt_key": {capture: captureAESKey(0, 1)},
+	"aes_v8_set_decrypt_key": {capture: captureAESKey(0, 1)},
+
+	// int EVP_EncryptInit_ex(EVP_CIPHER_CTX *ctx, const EVP_CIPHER *cipher,
+	//                        ENGINE *impl, const uint8_t *key, const uint8_t *iv)
+	"EVP_EncryptInit_ex":  {capture: captureEVPInit(1, 3, 4), ret: returns(1)},
+	"EVP_DecryptInit_ex":  {capture: captureEVPInit(1, 3, 4), ret: returns(1)},
+	"EVP_CipherInit_ex":   {capture: captureEVPInit(1, 3, 4), ret: returns(1)},
+	"EVP_EncryptInit_ex2": {capture: captureEVPInit(1, 2, 3), ret: returns(1)},
+	"EVP_DecryptInit_ex2": {capture: captureEVPInit(1, 2, 3), ret: returns(1)},
+	"EVP_CipherInit_ex2":  {capture: captureEVPInit(1, 2, 3), ret: returns(1)},
+	"EVP_EncryptInit":     {capture: captureEVPInit(1, 2, 3), ret: returns(1)},
+	"EVP_DecryptInit":     {capture: captureEVPInit(1, 2, 3), ret: returns(1)},
+
+	// int EVP_EncryptUpdate(EVP_CIPHER_CTX *ctx, uint8_t *out, int *out_len,
+	//                       const uint8_t *in, int in_len)
+	"EVP_EncryptUpdate": {capture: capturePlaintext(3, 4), ret: returnsUpdated(4)},
+	"EVP_DecryptUpdate": {capture: captureDecrypted, ret: returnsUpdated(-1), output: true},
+
+	// int HMAC_Init_ex(HMAC_CTX *ctx, const void *key, size_t key_len,
+	//                  const EVP_MD *md, ENGINE *impl)
+	"HMAC_Init_ex": {capture: captureHMACKey, ret: returns(1)},
+
+	// int SSL_write(SSL *ssl, const void *buf, int num)
+	"SSL_write": {capture: capturePlaintext(1, 2), ret: returnsArg(2)},
+	"SSL_read":  {capture: captureSSLRead, output: true},
+
+	// int mbedtls_aes_setkey_enc(mbedtls_aes_context *ctx, const unsigned char *key,
+	//                            unsigned int keybits)
+	"mbedtls_aes_setkey_enc": {capture: captureAESKey(1, 2)},
+	"mbedtls_aes_setkey_dec": {capture: captureAESKey(1, 2)},
+	// int mbedtls_gcm_setkey(mbedtls_gcm_context *ctx, mbedtls_cipher_id_t cipher,
+	//                        const unsigned char *key, unsigned int keybits)
+	"mbedtls_gcm_setkey": {capture: captureAESKey(2, 3)},
+	// int mbedtls_md_hmac_starts(mbedtls_md_context_t *ctx, const unsigned char *key,
+	//                            size_t keylen)
+	"mbedtls_md_hmac_starts": {capture: captureBufferKey(1, 2, "hmac")},
+	// int mbedtls_ssl_write(mbedtls_ssl_context *ssl, const unsigned char *buf, size_t len)
+	"mbedtls_ssl_write": {capture: capturePlaintext(1, 2), ret: returnsArg(2)},
+}
+
+func init() {
+	patterns := make([]string, 0, len(cryptoAPIs))
+	for name := range cryptoAPIs {
+		patterns = append(patterns, name)
+	}
+	sort.Strings(patterns)
+	stubs.RegisterDetector(stubs.Detector{
+		Name:        "crypto-libs",
+		Patterns:    patterns,
+		Activate:    activateCryptoLibs,
+		Description: "OpenSSL/BoringSSL/mbedTLS keys, IVs, and plaintext",
+	})
+}
+
+// activateCryptoLibs hooks the crypto library functions present, by
+// symbol or by the names FindCryptoFunctions synthesized. Defined
+// functions run normally; imports return success.
+func activateCryptoLibs(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
+	installed := 0
+	for name, api := range cryptoAPIs {
+		addr := symbols[name]
+		if addr == 0 {
+			continue
+		}
+		if stubs.Debug {
+			stubs.DefaultRegistry.Log("setter", "crypto-hook", fmt.Sprintf("%s @ 0x%x", name, addr))
+		}
+		_, isImport := imports[name]
+		if !emu.TryHookAddress(addr, makeCryptoHook(name, api, isImport)) {
+			continue // Another detector hooked it first
+		}
+		installed++
+	}
+
+	if installed > 0 {
+		stubs.DefaultRegistry.Log("setter", "crypto-libs", "crypto library hooks installed")
+	}
+	return installed
+}
+
+func makeCryptoHook(name string, api cryptoAPI, isImport bool) func(*emulator.Emulator) bool {
+	return func(emu *emulator.Emulator) bool {
+		if !isImport || !api.output {
+			api.capture(emu, name)
+		}
+		if isImport {
+			ret := uint64(0)
+			if api.ret != nil {
+				ret = api.ret(emu)
+			}
+			emu.SetX(0, ret)
+			stubs.ReturnFromStub(emu)
+		}
+		return false
+	}
+}
+
+// captureBytes captures n bytes at ptr.
+func captureBytes(emu *emulator.Emulator, ptr, n uint64, source, keyType, risk string) {
+	if ptr == 0 || n == 0 {
+		return
+	}
+	data, err := emu.MemRead(ptr, min(n, maxPlaintext))
+	if err != nil {
+		return
+	}
+	captureKey(CapturedKey{
+		Value:     formatBytes(data),
+		Source:    source,
+		Address:   emu.PC(),
+		KeyType:   keyType,
+		RiskLevel: risk,
+	})
+}
+
+// captureAESKey captures an AES key from its pointer and bit length
+// arguments.
+func captureAESKey(keyReg, bitsReg int) func(*emulator.Emulator, string) {
+	return func(emu *emulator.Emulator, name string) {
+		bits := uint32(emu.X(bitsReg))
+		if bits != 128 && bits != 192 && bits != 256 {
+			return
+		}
+		captureBytes(emu, emu.X(keyReg), uint64(bits/8), name, fmt.Sprintf("aes%d", bits), "critical")
+	}
+}
+
+// captureBufferKey captures a key from its pointer and byte length
+// arguments.
+func captureBufferKey(keyReg, lenReg int, keyType string) func(*emulator.Emulator, string) {
+	return func(emu *emulator.Emulator, name string) {
+		if n := emu.X(lenReg); n <= 1024 {
+			captureBytes(emu, emu.X(keyReg), n, name, keyType, "critical")
+		}
+	}
+}
+
+// capturePlaintext captures the data about to be encrypted or sent.
+func capturePlaintext(bufReg, lenReg int) func(*emulator.Emulator, string) {
+	return func(emu *emulator.Emulator, name string) {
+		if n := int32(emu.X(lenReg)); n > 0 {
+			captureBytes(emu, emu.X(bufReg), uint64(n), name+"[plaintext]", "plaintext", "medium")
+		}
+	}
+}
+
+// captureDecrypted captures EVP_DecryptUpdate's output when it returns.
+func captureDecrypted(emu *emulator.Emulator, name string) {
+	out, outLen := emu.X(1), emu.X(2)
+	hookReturn(emu, func(emu *emulator.Emulator) {
+		if uint32(emu.X(0)) != 1 {
+			return
+		}
+		if n, err := emu.MemReadU32(outLen); err == nil && int32(n) > 0 {
+			captureBytes(emu, out, uint64(n), name+"[plaintext]", "plaintext", "medium")
+		}
+	})
+}
+
+// captureSSLRead captures the data SSL_read received when it returns.
+func captureSSLRead(emu *emulator.Emulator, name string) {
+	buf := emu.X(1)
+	hookReturn(emu, func(emu *emulator.Emulator) {
+		if n := int32(emu.X(0)); n > 0 {
+			captureBytes(emu, buf, uint64(n), name+"[plaintext]", "plaintext", "medium")
+		}
+	})
+}
+
+// EVP_CIPHER and EVP_MD start with the same fields in OpenSSL 1.1, 3.x,
+// and BoringSSL: { int nid; int block_size; int key_len; int iv_len; ... }
+// for ciphers and { int type; ... } for digests. EVP_CIPHER_CTX starts
+// with its cipher.
+
+// captureEVPInit captures the key and IV passed to an EVP cipher init,
+// typed by the cipher. A NULL cipher reuses the one already in ctx.
+func captureEVPInit(cipherReg, keyReg, ivReg int) func(*emulator.Emulator, string) {
+	return func(emu *emulator.Emulator, name string) {
+		cipher := emu.X(cipherReg)
+		if cipher == 0 {
+			cipher, _ = emu.MemReadU64(emu.X(0))
+		}
+		if cipher == 0 {
+			return
+		}
+		fields, err := emu.MemRead(cipher, 16)
+		if err != nil {
+			return
+		}
+		nid := int(int32(binary.LittleEndian.Uint32(fields[0:])))
+		keyLen := uint64(binary.LittleEndian.Uint32(fields[8:]))
+		ivLen := uint64(binary.LittleEndian.Uint32(fields[12:]))
+		if keyLen > 64 || ivLen > 64 {
+			return
+		}
+
+		captureBytes(emu, emu.X(keyReg), keyLen, name, cipherName(nid, keyLen), "critical")
+		captureBytes(emu, emu.X(ivReg), ivLen, name+"[iv]", "iv", "high")
+	}
+}
+
+// captureHMACKey captures the key of HMAC_Init_ex, typed by the digest.
+// A NULL key reuses the previous one.
+func captureHMACKey(emu *emulator.Emulator, name string) {
+	keyType := "hmac"
+	if md := emu.X(3); md != 0 {
+		if nid, err := emu.MemReadU32(md); err == nil {
+			keyType = "hmac-" + digestName(int(int32(nid)))
+		}
+	}
+	if n := emu.X(2); n <= 1024 {
+		captureBytes(emu, emu.X(1), n, name, keyType, "critical")
+	}
+}
+
+// cipherNIDs names the common OpenSSL cipher NIDs.
+var cipherNIDs = map[int]string{
+	5:    "rc4",
+	31:   "des-cbc",
+	44:   "des-ede3-cbc",
+	91:   "bf-cbc",
+	418:  "aes-128-ecb",
+	419:  "aes-128-cbc",
+	420:  "aes-128-ofb",
+	421:  "aes-128-cfb",
+	422:  "aes-192-ecb",
+	423:  "aes-192-cbc",
+	426:  "aes-256-ecb",
+	427:  "aes-256-cbc",
+	428:  "aes-256-ofb",
+	429:  "aes-256-cfb",
+	895:  "aes-128-gcm",
+	898:  "aes-192-gcm",
+	901:  "aes-256-gcm",
+	904:  "aes-128-ctr",
+	905:  "aes-192-ctr",
+	906:  "aes-256-ctr",
+	1018: "chacha20-poly1305",
+	1019: "chacha20",
+}
+
+func cipherName(nid int, keyLen uint64) string {
+	if name, ok := cipherNIDs[nid]; ok {
+		return name
+	}
+	return fmt.Sprintf("cipher-%d-%d", nid, keyLen*8)
+}
+
+// digestNIDs names the common OpenSSL digest NIDs.
+var digestNIDs = map[int]string{
+	4:   "md5",
+	64:  "sha1",
+	114: "md5-sha1",
+	672: "sha256",
+	673: "sha384",
+	674: "sha512",
+	675: "sha224",
+}
+
+func digestName(nid int) string {
+	if name, ok := digestNIDs[nid]; ok {
+		return name
+	}
+	return fmt.Sprintf("md%d", nid)
+}
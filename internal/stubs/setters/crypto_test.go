@@ -0,0 +1,199 @@
+package setters
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+func TestCryptoHooks(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	code := uint64(emulator.CodeBase)
+	symbols := map[string]uint64{
+		"AES_set_encrypt_key": code + 0x100, // Defined: runs, returns
+		"EVP_EncryptInit_ex":  code + 0x110, // Imported: stubbed
+		"HMAC_Init_ex":        code + 0x120,
+		"SSL_write":           code + 0x130,
+		"SSL_read":            code + 0x140,
+		"EVP_EncryptUpdate":   code + 0x150,
+		"EVP_DecryptUpdate":   code + 0x160,
+	}
+	imports := map[string]uint64{
+		"EVP_EncryptInit_ex": symbols["EVP_EncryptInit_ex"],
+		"HMAC_Init_ex":       symbols["HMAC_Init_ex"],
+		"SSL_write":          symbols["SSL_write"],
+		"SSL_read":           symbols["SSL_read"],
+		"EVP_EncryptUpdate":  symbols["EVP_EncryptUpdate"],
+		"EVP_DecryptUpdate":  symbols["EVP_DecryptUpdate"],
+	}
+	emu.MemWrite(symbols["AES_set_encrypt_key"], []byte{0x00, 0x00, 0x80, 0x52, 0xc0, 0x03, 0x5f, 0xd6}) // MOV W0, #0; RET
+	if got := activateCryptoLibs(emu, imports, symbols); got != len(symbols) {
+		t.Errorf("activateCryptoLibs = %d, want %d", got, len(symbols))
+	}
+
+	call := func(name string, args ...uint64) uint64 {
+		t.Helper()
+		return testutil.Call(t, emu, symbols[name], args...)
+	}
+	buf := func(data string) uint64 { return testutil.CString(emu, data) }
+	u32s := func(vals ...uint32) uint64 {
+		p := emu.Malloc(uint64(4 * len(vals)))
+		for i, v := range vals {
+			emu.MemWriteU32(p+uint64(4*i), v)
+		}
+		return p
+	}
+
+	if r := call("AES_set_encrypt_key", buf("0123456789abcdef"), 128, emu.Malloc(256)); r != 0 {
+		t.Errorf("AES_set_encrypt_key = %d", r)
+	}
+	call("AES_set_encrypt_key", buf("0123456789abcdef"), 100, 0) // Bad length: not a key
+
+	aes256cbc := u32s(427, 16, 32, 16)
+	key := emu.Malloc(32)
+	emu.MemWrite(key, []byte{0: 0xff, 31: 0x01})
+	if r := call("EVP_EncryptInit_ex", emu.Malloc(64), aes256cbc, 0, key, buf("IV-IV-IV-IV-IV-!")); r != 1 {
+		t.Errorf("EVP_EncryptInit_ex = %d, want 1", r)
+	}
+
+	// Imported updates report their output length
+	outLen := u32s(0xdeadbeef)
+	if r := call("EVP_EncryptUpdate", emu.Malloc(64), emu.Malloc(32), outLen, buf("secret payload"), 14); r != 1 {
+		t.Errorf("EVP_EncryptUpdate = %d, want 1", r)
+	}
+	if n, _ := emu.MemReadU32(outLen); n != 14 {
+		t.Errorf("EVP_EncryptUpdate out_len = %d, want 14", n)
+	}
+	emu.MemWriteU32(outLen, 0xdeadbeef)
+	if r := call("EVP_DecryptUpdate", emu.Malloc(64), emu.Malloc(32), outLen, buf("ciphertext"), 10); r != 1 {
+		t.Errorf("EVP_DecryptUpdate = %d, want 1", r)
+	}
+	if n, _ := emu.MemReadU32(outLen); n != 0 {
+		t.Errorf("EVP_DecryptUpdate out_len = %d, want 0", n)
+	}
+
+	sha256 := u32s(672)
+	call("HMAC_Init_ex", emu.Malloc(64), buf("hmac-secret"), 11, sha256, 0)
+
+	if n := call("SSL_write", 1, buf(`{"token":"abc"}`), 15); n != 15 {
+		t.Errorf("SSL_write = %d, want 15", n)
+	}
+	if n := call("SSL_read", 1, emu.Malloc(64), 64); n != 0 {
+		t.Errorf("SSL_read = %d, want 0", n)
+	}
+
+	want := []CapturedKey{
+		{Value: "0123456789abcdef", Source: "AES_set_encrypt_key", KeyType: "aes128", RiskLevel: "critical"},
+		{Value: "ff00000000000000000000000000000000000000000000000000000000000001", Source: "EVP_EncryptInit_ex", KeyType: "aes-256-cbc", RiskLevel: "critical"},
+		{Value: "IV-IV-IV-IV-IV-!", Source: "EVP_EncryptInit_ex[iv]", KeyType: "iv", RiskLevel: "high"},
+		{Value: "secret payload", Source: "EVP_EncryptUpdate[plaintext]", KeyType: "plaintext", RiskLevel: "medium"},
+		{Value: "hmac-secret", Source: "HMAC_Init_ex", KeyType: "hmac-sha256", RiskLevel: "critical"},
+		{Value: `{"token":"abc"}`, Source: "SSL_write[plaintext]", KeyType: "plaintext", RiskLevel: "medium"},
+	}
+	keys := GetCapturedKeys()
+	if len(keys) != len(want) {
+		t.Fatalf("captured %d keys, want %d: %+v", len(keys), len(want), keys)
+	}
+	for i, k := range keys {
+		k.Address = 0
+		if k != want[i] {
+			t.Errorf("key %d = %+v, want %+v", i, k, want[i])
+		}
+	}
+}
+
+func TestFindCryptoFunctions(t *testing.T) {
+	const (
+		text uint64 = 0x400000
+		data uint64 = 0x500000
+	)
+	var code []byte
+	emit := func(insns ...uint32) {
+		for _, insn := range insns {
+			code = binary.LittleEndian.AppendUint32(code, insn)
+		}
+	}
+	adrp := func(rd uint32, target uint64) uint32 {
+		pc := text + uint64(len(code))
+		imm := uint32((target>>12 - pc>>12) & 0x1fffff)
+		return 0x90000000 | (imm&3)<<29 | (imm>>2)<<5 | rd
+	}
+	addImm := func(rd uint32, imm uint64) uint32 {
+		return 0x91000000 | uint32(imm&0xfff)<<10 | rd<<5 | rd
+	}
+
+	rcon := data + 0x230
+	emit(0xd503201f, 0xd65f03c0, 0xd503201f) // NOP; RET; NOP
+	start := text + uint64(len(code))
+	emit(0xd503233f, 0xa9bf7bfd, 0x910003fd) // PACIASP; STP X29, X30, [SP, #-16]!; MOV X29, SP
+	emit(0x7102003f)                         // CMP W1, #128
+	emit(adrp(3, rcon), 0xaa0003e4, addImm(3, rcon&0xfff))
+	emit(0xa8c17bfd, 0xd65f03c0) // LDP X29, X30, [SP], #16; RET
+
+	rodata := make([]byte, 0x400)
+	copy(rodata[0x230:], cryptoSignatures[0].Table)
+
+	info := &emulator.ELFInfo{
+		Symbols: map[string]uint64{},
+		Segments: []emulator.Segment{
+			{VAddr: text, Data: code, Flags: elf.PF_R | elf.PF_X},
+			{VAddr: data, Data: rodata, Flags: elf.PF_R},
+		},
+	}
+	found := FindCryptoFunctions(info)
+	if got := found["aes_hw_set_encrypt_key"]; got != start || len(found) != 1 {
+		t.Errorf("found %#v, want aes_hw_set_encrypt_key at %#x", found, start)
+	}
+
+	// .eh_frame_hdr starts take precedence over the prologue walk
+	info.FuncStarts = []uint64{text, text + 4}
+	if got := FindCryptoFunctions(info)["aes_hw_set_encrypt_key"]; got != text+4 {
+		t.Errorf("with FuncStarts = %#x, want %#x", got, text+4)
+	}
+
+	// A named function is not looked for
+	info.Symbols["aes_hw_set_encrypt_key"] = text
+	if found := FindCryptoFunctions(info); len(found) != 0 {
+		t.Errorf("named function found again: %#v", found)
+	}
+}
+
+func TestCryptoHookSharedAddress(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	saved := append([]SetterRule(nil), setterRules...)
+	defer func() { setterRules = saved }()
+	RegisterSetterRule(SetterRule{Method: "AES_set_encrypt_key", Args: []ArgType{ArgCString}, KeyType: "app", Risk: "high"})
+
+	addr := uint64(emulator.CodeBase) + 0x100
+	emu.MemWrite(addr, []byte{0xc0, 0x03, 0x5f, 0xd6}) // RET
+	symbols := map[string]uint64{"AES_set_encrypt_key": addr}
+	if got := activateSetterRules(emu, nil, symbols); got != 1 {
+		t.Fatalf("activateSetterRules = %d, want 1", got)
+	}
+	if got := activateCryptoLibs(emu, nil, symbols); got != 0 {
+		t.Errorf("activateCryptoLibs = %d on an address already hooked, want 0", got)
+	}
+
+	testutil.Call(t, emu, addr, testutil.CString(emu, "0123456789abcdef"), 128, emu.Malloc(256))
+	keys := GetCapturedKeys()
+	if len(keys) != 1 || keys[0].KeyType != "app" {
+		t.Errorf("captured %+v, want one key from the setter rule", keys)
+	}
+}
@@ -0,0 +1,95 @@
+package setters
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// Stripped builds of OpenSSL, BoringSSL, and mbedTLS keep their AES round
+// constant tables, and only the key schedule references them. A key
+// setter is found by locating the table, the ADR or ADRP+ADD that loads
+// it, and the start of the function around that load: from .eh_frame_hdr
+// when the binary has one, or by walking back to the prologue.
+
+// cryptoSignature names the function that loads a constant table.
+type cryptoSignature struct {
+	Name  string
+	Table []byte
+}
+
+var cryptoSignatures = []cryptoSignature{
+	// aesv8-armx.pl .Lrcon (OpenSSL aes_v8_*, BoringSSL aes_hw_*)
+	{Name: "aes_hw_set_encrypt_key", Table: u32Table(
+		0x01, 0x01, 0x01, 0x01,
+		0x0c0f0e0d, 0x0c0f0e0d, 0x0c0f0e0d, 0x0c0f0e0d,
+		0x1b, 0x1b, 0x1b, 0x1b)},
+	// aes_core.c rcon
+	{Name: "AES_set_encrypt_key", Table: u32Table(
+		0x01000000, 0x02000000, 0x04000000, 0x08000000, 0x10000000,
+		0x20000000, 0x40000000, 0x80000000, 0x1B000000, 0x36000000)},
+	// aes.c RCON with MBEDTLS_AES_ROM_TABLES
+	{Name: "mbedtls_aes_setkey_enc", Table: u32Table(
+		0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x1b, 0x36)},
+}
+
+func u32Table(vals ...uint32) []byte {
+	b := make([]byte, 4*len(vals))
+	for i, v := range vals {
+		binary.LittleEndian.PutUint32(b[4*i:], v)
+	}
+	return b
+}
+
+// FindCryptoFunctions locates crypto key setters by signature and returns
+// their synthesized symbols. Functions already named in info.Symbols are
+// left out.
+func FindCryptoFunctions(info *emulator.ELFInfo) map[string]uint64 {
+	tables := make(map[uint64]string)
+	for _, sig := range cryptoSignatures {
+		if info.FindSymbol(sig.Name) != 0 {
+			continue
+		}
+		for _, seg := range info.Segments {
+			for off := 0; ; {
+				i := bytes.Index(seg.Data[off:], sig.Table)
+				if i < 0 {
+					break
+				}
+				tables[seg.VAddr+uint64(off+i)] = sig.Name
+				off += i + 4
+			}
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	found := make(map[string]uint64)
+	for _, seg := range info.Segments {
+		if seg.Flags&elf.PF_X == 0 {
+			continue
+		}
+		code := seg.Data
+		for off := 0; off+4 <= len(code); off += 4 {
+			pc := seg.VAddr + uint64(off)
+			target, ok := emulator.LoadedAddress(code, off, pc)
+			if !ok {
+				continue
+			}
+			name, ok := tables[target]
+			if !ok {
+				continue
+			}
+			if _, dup := found[name]; dup {
+				continue
+			}
+			if start, ok := info.ContainingFunction(pc); ok {
+				found[name] = start
+			}
+		}
+	}
+	return found
+}
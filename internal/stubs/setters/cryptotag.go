@@ -0,0 +1,246 @@
+package setters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/zboralski/galago/internal/callstack"
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/fingerprint"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// CryptoTagger recognizes crypto routines as they run: functions the
+// static scan tied to a constant, functions that read a constant table,
+// and code that builds a crypto immediate in a register. Unpacked or
+// computed constants the static scan misses are caught this way. Each
+// routine is tagged once in the trace; for XXTEA, AES, and RC4 the
+// arguments it was called with are captured as candidate keys.
+type CryptoTagger struct {
+	info   *emulator.ELFInfo
+	names  map[uint64]string // Function start -> symbol
+	algs   map[uint64]string // Function start -> algorithm
+	tables []fingerprint.CryptoConstant
+	insns  map[uint64]insnClass
+	stack  callstack.Stack // Calls in progress, with the arguments to capture
+	call   bool            // The last instruction was a call
+	reg    int             // Register a constant was just built in, or -1
+	tagged map[uint64]bool
+	seen   map[string]bool
+}
+
+// maxCryptoFrames bounds the shadow call stack.
+const maxCryptoFrames = 1024
+
+// insnClass is what the tagger needs to know about an instruction: its
+// kind in the high bits and a destination register in the low five.
+type insnClass uint8
+
+const (
+	insnOther insnClass = iota << 5
+	insnCall
+	insnConst // MOVK #imm16, LSL #16 or LDR (literal): check Rd after it
+)
+
+func classify(insn uint32) insnClass {
+	switch op := callstack.Decode(insn); {
+	case op == callstack.OpCall, op == callstack.OpCallReg:
+		return insnCall
+	case insn&0x7fe00000 == 0x72a00000, insn&0xbf000000 == 0x18000000: // MOVK LSL #16, LDR literal
+		return insnConst | insnClass(insn&0x1f)
+	}
+	return insnOther
+}
+
+// NewCryptoTagger prepares a tagger from the static scan of a binary.
+func NewCryptoTagger(info *emulator.ELFInfo, consts []fingerprint.CryptoConstant) *CryptoTagger {
+	t := &CryptoTagger{
+		info:   info,
+		names:  info.AddrNames(),
+		algs:   make(map[uint64]string),
+		insns:  make(map[uint64]insnClass),
+		stack:  callstack.Stack{Max: maxCryptoFrames},
+		reg:    -1,
+		tagged: make(map[uint64]bool),
+		seen:   make(map[string]bool),
+	}
+	for _, c := range consts {
+		for _, fn := range c.Funcs {
+			t.algs[fn] = c.Algorithm
+		}
+		if !c.Code {
+			t.tables = append(t.tables, c)
+		}
+	}
+	return t
+}
+
+// Install hooks every instruction and reads of the constant tables.
+func (t *CryptoTagger) Install(emu *emulator.Emulator) error {
+	for _, c := range t.tables {
+		alg, name := c.Algorithm, c.Name
+		err := emu.HookMemRead(c.Addr, c.Addr+c.Size-1, func(e *emulator.Emulator, addr uint64, size int) {
+			t.touch(e, alg, name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	emu.HookCode(t.step)
+	return nil
+}
+
+func (t *CryptoTagger) step(emu *emulator.Emulator, addr uint64, size uint32) {
+	if t.reg >= 0 {
+		if c, ok := fingerprint.CryptoImmediates[uint32(emu.X(t.reg))]; ok {
+			t.touch(emu, c.Algorithm, c.Name)
+		}
+		t.reg = -1
+	}
+	if t.call {
+		t.call = false
+		t.enter(emu, addr)
+	} else if f := t.stack.Top(); f != nil && f.Ret == addr {
+		t.stack.Leave(addr, emu.SP())
+	}
+
+	class, ok := t.insns[addr]
+	if !ok {
+		if code, err := emu.MemRead(addr, 4); err == nil {
+			class = classify(binary.LittleEndian.Uint32(code))
+		}
+		t.insns[addr] = class
+	}
+	switch class &^ 0x1f {
+	case insnCall:
+		t.call = true
+	case insnConst:
+		if r := int(class & 0x1f); r != 31 {
+			t.reg = r
+		}
+	}
+}
+
+// enter records a call and captures the arguments of known routines.
+// Calls return at their return address with the stack pointer restored,
+// through RET or a stub.
+func (t *CryptoTagger) enter(emu *emulator.Emulator, addr uint64) {
+	sp := emu.SP()
+	t.stack.Unwind(sp)
+	f := callstack.Frame{Entry: addr, Ret: emu.LR(), SP: sp}
+	for i := range f.Args {
+		f.Args[i] = emu.X(i)
+	}
+	t.stack.Push(f)
+
+	if alg, ok := t.algs[addr]; ok {
+		t.tag(addr, alg, "call")
+		t.capture(emu, f, alg)
+	}
+}
+
+// touch tags the running function as using a constant of alg.
+func (t *CryptoTagger) touch(emu *emulator.Emulator, alg, name string) {
+	var fn uint64
+	frame := t.stack.Top()
+	if frame != nil {
+		fn = frame.Entry
+	} else if start, ok := t.info.ContainingFunction(emu.PC()); ok {
+		fn = start
+	} else {
+		return
+	}
+	if t.tagged[fn] {
+		return
+	}
+	t.algs[fn] = alg
+	t.tag(fn, alg, name)
+	if frame != nil {
+		t.capture(emu, *frame, alg)
+	}
+}
+
+// tag logs the first sighting of a crypto routine.
+func (t *CryptoTagger) tag(fn uint64, alg, what string) {
+	if t.tagged[fn] {
+		return
+	}
+	t.tagged[fn] = true
+	stubs.DefaultRegistry.Log("crypto", alg, fmt.Sprintf("%s %s", t.funcName(fn), what))
+}
+
+func (t *CryptoTagger) funcName(fn uint64) string {
+	return nameOf(t.names, fn)
+}
+
+// nameOf names a function by its symbol, or sub_<addr> when it has none.
+func nameOf(names map[uint64]string, fn uint64) string {
+	if name, ok := names[fn]; ok {
+		return name
+	}
+	return fmt.Sprintf("sub_%x", fn)
+}
+
+// capture saves the key arguments of a recognized routine. XXTEA takes
+// the key third (btea, xxtea_decrypt), AES a key followed by its size in
+// bits or bytes, and RC4 a key and its length in either order.
+func (t *CryptoTagger) capture(emu *emulator.Emulator, f callstack.Frame, alg string) {
+	a := f.Args
+	save := func(i int, n uint64, keyType string) bool {
+		if a[i] < 0x1000 {
+			return false
+		}
+		data, err := emu.MemRead(a[i], n)
+		if err != nil {
+			return false
+		}
+		if trimmed := bytes.TrimRight(data, "\x00"); len(trimmed) > 0 && isPrintable(string(trimmed)) {
+			data = trimmed
+		}
+		key := CapturedKey{
+			Value:     formatBytes(data),
+			Source:    fmt.Sprintf("%s[arg%d]", t.funcName(f.Entry), i),
+			Address:   f.Entry,
+			KeyType:   keyType,
+			RiskLevel: "medium",
+		}
+		if id := key.Source + "=" + key.Value; !t.seen[id] {
+			t.seen[id] = true
+			captureKey(key)
+		}
+		return true
+	}
+
+	switch alg {
+	case "xxtea":
+		n := uint64(16)
+		if a[3] > 0 && a[3] <= 64 {
+			n = a[3]
+		}
+		save(2, n, "xxtea")
+	case "aes":
+		for i := 0; i+1 < len(a); i++ {
+			n := a[i+1]
+			switch n {
+			case 128, 192, 256:
+				n /= 8
+			case 16, 24, 32:
+			default:
+				continue
+			}
+			if save(i, n, fmt.Sprintf("aes%d", n*8)) {
+				return
+			}
+		}
+	case "rc4":
+		for i := 1; i+1 < len(a); i++ {
+			if a[i+1] > 0 && a[i+1] <= 256 && save(i, a[i+1], "rc4") {
+				return
+			}
+			if a[i] > 0 && a[i] <= 256 && save(i+1, a[i], "rc4") {
+				return
+			}
+		}
+	}
+}
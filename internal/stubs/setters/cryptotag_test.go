@@ -0,0 +1,82 @@
+package setters
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/fingerprint"
+	"github.com/zboralski/galago/internal/stubs"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+func TestCryptoTagger(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	var tags []string
+	stubs.DefaultRegistry.OnCall = func(category, name, detail string) {
+		if category == "crypto" {
+			tags = append(tags, name+" "+detail)
+		}
+	}
+	defer func() { stubs.DefaultRegistry.OnCall = nil }()
+
+	code := uint64(emulator.CodeBase)
+	btea, aes, rc4 := code+0x100, code+0x200, code+0x300
+	table := code + 0x800
+	emu.MemWrite(btea, []byte{
+		0x29, 0x37, 0x8f, 0x52, // MOV W9, #0x79b9
+		0xe9, 0xc6, 0xb3, 0x72, // MOVK W9, #0x9e37, LSL #16
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+	})
+	emu.MemWrite(aes, []byte{
+		0x2a, 0x01, 0x40, 0x39, // LDRB W10, [X9]
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+	})
+	emu.MemWrite(rc4, []byte{0xc0, 0x03, 0x5f, 0xd6}) // RET
+
+	info := &emulator.ELFInfo{Symbols: map[string]uint64{"btea": btea}}
+	tagger := NewCryptoTagger(info, []fingerprint.CryptoConstant{
+		{Algorithm: "aes", Name: "sbox", Addr: table, Size: 256},
+		{Algorithm: "rc4", Name: "KSA", Addr: rc4 + 0x10, Code: true, Funcs: []uint64{rc4}},
+	})
+	if err := tagger.Install(emu); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(fn uint64, args ...uint64) {
+		t.Helper()
+		emu.SetX(9, table)
+		testutil.Call(t, emu, fn, args...)
+	}
+	buf := func(data string) uint64 { return testutil.CString(emu, data) }
+
+	xxteaKey := buf("2dxLua\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	call(btea, buf("ciphertext"), 3, xxteaKey)
+	call(btea, buf("ciphertext"), 3, xxteaKey) // Same key again: not captured twice
+	call(aes, buf("aes-key-16-bytes"), 128, emu.Malloc(240))
+	call(rc4, emu.Malloc(258), 5, buf("rc4k!"))
+
+	want := []CapturedKey{
+		{Value: "2dxLua", Source: "btea[arg2]", Address: btea, KeyType: "xxtea", RiskLevel: "medium"},
+		{Value: "aes-key-16-bytes", Source: "sub_10200[arg0]", Address: aes, KeyType: "aes128", RiskLevel: "medium"},
+		{Value: "rc4k!", Source: "sub_10300[arg2]", Address: rc4, KeyType: "rc4", RiskLevel: "medium"},
+	}
+	keys := GetCapturedKeys()
+	if len(keys) != len(want) {
+		t.Fatalf("captured %+v, want %d keys", keys, len(want))
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("key %d = %+v, want %+v", i, keys[i], want[i])
+		}
+	}
+	if len(tags) != 3 || tags[0] != "xxtea btea delta" || tags[1] != "aes sub_10200 sbox" || tags[2] != "rc4 sub_10300 call" {
+		t.Errorf("tags = %q", tags)
+	}
+}
@@ -0,0 +1,352 @@
+package setters
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// Harvester finds secrets no setter hook saw. It snapshots the heap, the
+// stack, and the writable segments (.data and .bss) once the binary is
+// set up, then diffs them against the snapshot for new printable strings
+// and high-entropy 16, 24, and 32 byte blobs. Guest stores and stub
+// writes to those regions are tracked so each finding names the code that
+// last wrote it. Findings are ranked and filed as low-risk keys, apart
+// from what the setters confirm.
+type Harvester struct {
+	info     *emulator.ELFInfo
+	names    map[uint64]string
+	regions  []harvestRegion
+	writers  map[uint64]memWriter // 8-byte granule -> last writer
+	seq      uint64
+	at       map[uint64]bool
+	literals map[string]bool // Strings already in the binary
+	seen     map[string]bool
+}
+
+// harvestRegion is a diffed memory range and its contents at load.
+type harvestRegion struct {
+	name       string
+	start, end uint64 // end is 0 for the heap, which grows
+	base       []byte
+}
+
+// memWriter is the code behind a write: a guest store, or a stub called
+// from pc.
+type memWriter struct {
+	pc   uint64
+	stub uint64
+	seq  uint64
+}
+
+// harvestFinding is a candidate secret before ranking.
+type harvestFinding struct {
+	region string
+	addr   uint64
+	data   []byte
+	kind   string
+	score  float64
+}
+
+const (
+	minHarvestString = 6
+	maxHarvestString = 256
+	maxHarvestKeys   = 32 // Filed per harvest, best first
+)
+
+// NewHarvester prepares a harvester for a loaded binary.
+func NewHarvester(info *emulator.ELFInfo) *Harvester {
+	return &Harvester{
+		info:    info,
+		names:   info.AddrNames(),
+		writers: make(map[uint64]memWriter),
+		seen:    make(map[string]bool),
+	}
+}
+
+// Install snapshots memory and starts tracking writes. Execution reaching
+// any address in at harvests on the spot.
+func (h *Harvester) Install(emu *emulator.Emulator, at []uint64) error {
+	h.regions = []harvestRegion{
+		{name: "heap", start: emulator.HeapBase},
+		{name: "stack", start: emulator.StackBase, end: emulator.StackBase + emulator.StackSize},
+	}
+	for _, seg := range h.info.Segments {
+		if seg.IsWritable() && seg.MemSz > 0 {
+			h.regions = append(h.regions, harvestRegion{name: "data", start: seg.VAddr, end: seg.VAddr + seg.MemSz})
+		}
+	}
+	for i := range h.regions {
+		r := &h.regions[i]
+		r.base = h.read(emu, *r)
+		end := r.end
+		if end == 0 {
+			end = emulator.HeapBase + emulator.HeapSize
+		}
+		err := emu.HookMemWrite(r.start, end-1, func(e *emulator.Emulator, addr uint64, size int) {
+			h.wrote(addr, size, memWriter{pc: e.PC()})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Stubs write from Go; blame the call
+	emu.HookHostWrite(func(e *emulator.Emulator, addr uint64, size int) {
+		if h.tracked(addr) {
+			var pc uint64
+			if lr := e.LR(); lr >= 4 {
+				pc = lr - 4
+			}
+			h.wrote(addr, size, memWriter{pc: pc, stub: e.PC()})
+		}
+	})
+
+	if len(at) > 0 {
+		h.at = make(map[uint64]bool, len(at))
+		for _, addr := range at {
+			h.at[addr] = true
+		}
+		emu.HookCode(func(e *emulator.Emulator, addr uint64, size uint32) {
+			if h.at[addr] {
+				h.Harvest(e)
+			}
+		})
+	}
+	return nil
+}
+
+func (h *Harvester) read(emu *emulator.Emulator, r harvestRegion) []byte {
+	end := r.end
+	if end == 0 {
+		end = emu.HeapEnd()
+	}
+	data, err := emu.MemRead(r.start, end-r.start)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (h *Harvester) tracked(addr uint64) bool {
+	if addr >= emulator.HeapBase && addr < emulator.HeapBase+emulator.HeapSize {
+		return true
+	}
+	for _, r := range h.regions {
+		if addr >= r.start && addr < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Harvester) wrote(addr uint64, size int, w memWriter) {
+	if size <= 0 {
+		return
+	}
+	h.seq++
+	w.seq = h.seq
+	for g := addr >> 3; g <= (addr+uint64(size)-1)>>3; g++ {
+		h.writers[g] = w
+	}
+}
+
+// lastWriter returns the most recent writer of any byte in [addr, addr+n).
+func (h *Harvester) lastWriter(addr uint64, n int) memWriter {
+	var last memWriter
+	for g := addr >> 3; g <= (addr+uint64(n)-1)>>3; g++ {
+		if w := h.writers[g]; w.seq > last.seq {
+			last = w
+		}
+	}
+	return last
+}
+
+// Harvest diffs memory against the snapshot and files the best new
+// findings. It returns how many were filed.
+func (h *Harvester) Harvest(emu *emulator.Emulator) int {
+	if h.literals == nil {
+		h.literals = binaryStrings(h.info)
+	}
+	var found []harvestFinding
+	for _, r := range h.regions {
+		cur := h.read(emu, r)
+		found = append(found, harvestStrings(r, cur)...)
+		found = append(found, harvestBlobs(r, cur)...)
+	}
+	for i := range found {
+		if found[i].kind == "string" && h.literals[string(found[i].data)] {
+			found[i].score -= 3 // Copied from the binary, not computed
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].score > found[j].score })
+
+	filed := 0
+	for _, f := range found {
+		if filed == maxHarvestKeys {
+			break
+		}
+		value := formatBytes(f.data)
+		if h.seen[value] {
+			continue
+		}
+		h.seen[value] = true
+		w := h.lastWriter(f.addr, len(f.data))
+		captureKey(CapturedKey{
+			Value:     value,
+			Source:    fmt.Sprintf("harvest[%s] %s", f.region, h.describe(w)),
+			Address:   w.pc,
+			KeyType:   f.kind,
+			RiskLevel: "low",
+		})
+		filed++
+	}
+	return filed
+}
+
+// describe names a writer as symbol+offset, and the stub for host writes.
+func (h *Harvester) describe(w memWriter) string {
+	if w.seq == 0 {
+		return "unknown"
+	}
+	at := fmt.Sprintf("0x%x", w.pc)
+	if start, ok := h.info.ContainingFunction(w.pc); ok {
+		at = fmt.Sprintf("%s+0x%x", nameOf(h.names, start), w.pc-start)
+	}
+	if w.stub != 0 {
+		return fmt.Sprintf("%s via %s", at, nameOf(h.names, w.stub))
+	}
+	return at
+}
+
+// changed reports whether any of cur[i:i+n] differs from the snapshot.
+// Bytes past the snapshot are new heap.
+func (r harvestRegion) changed(cur []byte, i, n int) bool {
+	for j := i; j < i+n; j++ {
+		if j >= len(r.base) || cur[j] != r.base[j] {
+			return true
+		}
+	}
+	return false
+}
+
+// harvestStrings finds changed NUL-terminated runs of printable bytes.
+// The terminator keeps stray printable bytes in binary data out.
+func harvestStrings(r harvestRegion, cur []byte) []harvestFinding {
+	var found []harvestFinding
+	for i := 0; i < len(cur); {
+		if !isPrintableByte(cur[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(cur) && isPrintableByte(cur[j]) {
+			j++
+		}
+		s := cur[i:j]
+		if j < len(cur) && cur[j] == 0 && len(s) >= minHarvestString && len(s) <= maxHarvestString &&
+			distinctBytes(s) >= 4 && r.changed(cur, i, len(s)) {
+			score := entropy(s)
+			if len(s) >= 8 && len(s) <= 64 && !strings.ContainsAny(string(s), " /%") {
+				score++ // Shaped like a key rather than a message or path
+			}
+			found = append(found, harvestFinding{r.name, r.start + uint64(i), s, "string", score})
+		}
+		i = j
+	}
+	return found
+}
+
+// harvestBlobs finds 16, 24, and 32 byte runs of changed words between
+// zeros, small integers, and pointers, whose bytes look random.
+func harvestBlobs(r harvestRegion, cur []byte) []harvestFinding {
+	var found []harvestFinding
+	opaque := func(i int) bool {
+		if !r.changed(cur, i, 8) {
+			return false
+		}
+		v := binary.LittleEndian.Uint64(cur[i:])
+		return v>>40 != 0 && v>>40 != 0xffffff
+	}
+	for i := int(-r.start & 7); i+8 <= len(cur); {
+		if !opaque(i) {
+			i += 8
+			continue
+		}
+		j := i
+		for j+8 <= len(cur) && opaque(j) {
+			j += 8
+		}
+		if b := cur[i:j]; len(b) >= 16 && len(b) <= 32 && !isPrintable(string(b)) {
+			if e := entropy(b); e >= 0.85*math.Log2(float64(len(b))) {
+				found = append(found, harvestFinding{r.name, r.start + uint64(i), b, fmt.Sprintf("blob%d", len(b)), e + 1})
+			}
+		}
+		i = j
+	}
+	return found
+}
+
+// binaryStrings collects the printable strings in the read-only segments.
+func binaryStrings(info *emulator.ELFInfo) map[string]bool {
+	found := make(map[string]bool)
+	for _, seg := range info.Segments {
+		if seg.IsWritable() {
+			continue
+		}
+		data := seg.Data
+		for i := 0; i < len(data); {
+			j := i
+			for j < len(data) && isPrintableByte(data[j]) {
+				j++
+			}
+			if j-i >= minHarvestString {
+				found[string(data[i:j])] = true
+			}
+			i = j + 1
+		}
+	}
+	return found
+}
+
+func isPrintableByte(c byte) bool {
+	return c >= 0x20 && c <= 0x7e
+}
+
+func distinctBytes(b []byte) int {
+	var seen [256]bool
+	n := 0
+	for _, c := range b {
+		if !seen[c] {
+			seen[c] = true
+			n++
+		}
+	}
+	return n
+}
+
+// entropy is the Shannon entropy of b in bits per byte.
+func entropy(b []byte) float64 {
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+	var e float64
+	for _, n := range counts {
+		if n > 0 {
+			p := float64(n) / float64(len(b))
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// Harvested reports whether a key came from a harvest rather than a
+// setter.
+func (k CapturedKey) Harvested() bool {
+	return strings.HasPrefix(k.Source, "harvest[")
+}
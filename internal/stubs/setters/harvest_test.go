@@ -0,0 +1,84 @@
+package setters
+
+import (
+	"debug/elf"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+func TestHarvester(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	code := uint64(emulator.CodeBase)
+	keygen, token := code+0x100, code+0x200
+	image := make([]byte, 0x300)
+	copy(image, []byte{0x00, 0x02, 0x3f, 0xd6}) // BLR X16
+	copy(image[0x100:], []byte{
+		0xfd, 0x7b, 0xbf, 0xa9, // STP X29, X30, [SP, #-16]!
+		0x01, 0x08, 0x00, 0xa9, // STP X1, X2, [X0]
+		0xfd, 0x7b, 0xc1, 0xa8, // LDP X29, X30, [SP], #16
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+	})
+	emu.MemWrite(code, image)
+	emu.HookAddress(token, func(e *emulator.Emulator) bool {
+		e.MemWriteString(e.X(0), "s3cr3t-Token!")
+		e.MemWriteString(e.X(0)+16, "aaaaaaaa") // Too plain to report
+		stubs.ReturnFromStub(e)
+		return false
+	})
+
+	info := &emulator.ELFInfo{
+		Symbols:  map[string]uint64{"keygen": keygen, "make_token": token},
+		Segments: []emulator.Segment{{VAddr: code, Data: image, Flags: elf.PF_R | elf.PF_X}},
+	}
+	keyBuf, tokenBuf := emu.Malloc(32), emu.Malloc(32)
+	h := NewHarvester(info)
+	if err := h.Install(emu, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	call := func(fn uint64, args ...uint64) {
+		t.Helper()
+		emu.SetX(16, fn)
+		for i, a := range args {
+			emu.SetX(i, a)
+		}
+		if err := emu.Run(code, code+4); err != nil {
+			t.Fatalf("run %#x: %v", fn, err)
+		}
+	}
+	call(keygen, keyBuf, 0x8f1e2d3c4b5a6978, 0xf0e1d2c3b4a59687)
+	call(token, tokenBuf)
+
+	if n := h.Harvest(emu); n != 2 {
+		t.Errorf("Harvest filed %d keys, want 2", n)
+	}
+	if n := h.Harvest(emu); n != 0 {
+		t.Errorf("second Harvest filed %d keys, want 0", n)
+	}
+
+	want := []CapturedKey{
+		{Value: "78695a4b3c2d1e8f8796a5b4c3d2e1f0", Source: "harvest[heap] keygen+0x4", Address: keygen + 4, KeyType: "blob16", RiskLevel: "low"},
+		{Value: "s3cr3t-Token!", Source: "harvest[heap] 0x10000 via make_token", Address: code, KeyType: "string", RiskLevel: "low"},
+	}
+	keys := GetCapturedKeys()
+	if len(keys) != len(want) {
+		t.Fatalf("captured %+v, want %d keys", keys, len(want))
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("key %d = %+v, want %+v", i, keys[i], want[i])
+		}
+		if !keys[i].Harvested() {
+			t.Errorf("key %d not marked harvested", i)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package setters
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/fingerprint"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// IL2CPPMetadataMagic is the sanity value at the start of a valid global-metadata.dat.
+const IL2CPPMetadataMagic = 0xFAB11BAF
+
+// maxMetadataSize bounds the size computed from a metadata header.
+const maxMetadataSize = 256 << 20
+
+// MetadataDump is a global-metadata.dat image captured from guest memory.
+type MetadataDump struct {
+	Source    string // Function that returned the buffer
+	Address   uint64 // Guest address of the buffer
+	Version   uint32 // Metadata version from the header
+	Data      []byte // Metadata contents
+	Decrypted bool   // True if the original file did not start with the magic
+}
+
+var (
+	metadataDumps   []MetadataDump
+	metadataDumpsMu sync.Mutex
+
+	// rawMetadata is the global-metadata.dat provided to the VFS for this session
+	rawMetadata []byte
+)
+
+func init() {
+	// Register Unity IL2CPP detector
+	stubs.RegisterDetector(stubs.Detector{
+		Name: "unity-il2cpp",
+		Patterns: []string{
+			"il2cpp_init",
+			"MetadataLoader",
+		},
+		Fingerprint: il2cppFingerprint,
+		Activate:    activateUnityIL2CPP,
+		Description: "Unity IL2CPP global-metadata.dat decryption",
+	})
+}
+
+// il2cppFingerprint identifies Unity IL2CPP builds and their Unity version if embedded.
+func il2cppFingerprint(emu *emulator.Emulator, symbols map[string]uint64) string {
+	if img := emu.Image(); img != nil {
+		if e, ok := fingerprint.Unity(img); ok {
+			return e.String()
+		}
+	}
+	return "unity il2cpp"
+}
+
+// SetIL2CPPMetadata records the global-metadata.dat served through the VFS.
+// It is compared against the loader's result to detect decryption and derive key material.
+func SetIL2CPPMetadata(data []byte) {
+	metadataDumpsMu.Lock()
+	rawMetadata = data
+	metadataDumpsMu.Unlock()
+}
+
+// GetMetadataDumps returns all captured metadata images.
+func GetMetadataDumps() []MetadataDump {
+	metadataDumpsMu.Lock()
+	defer metadataDumpsMu.Unlock()
+	result := make([]MetadataDump, len(metadataDumps))
+	copy(result, metadataDumps)
+	return result
+}
+
+// ClearMetadataDumps clears the captured metadata images and the metadata
+// set by SetIL2CPPMetadata.
+func ClearMetadataDumps() {
+	metadataDumpsMu.Lock()
+	metadataDumps = nil
+	rawMetadata = nil
+	metadataDumpsMu.Unlock()
+}
+
+// activateUnityIL2CPP hooks the IL2CPP metadata loader.
+//
+// il2cpp_init loads global-metadata.dat through
+// il2cpp::vm::MetadataLoader::LoadMetadataFile(const char*), which returns a
+// pointer to the mapped file. Protected games decrypt the file inside this
+// function (or a replacement for it), so its return buffer holds the plain
+// metadata regardless of the scheme used.
+func activateUnityIL2CPP(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
+	installed := 0
+
+	for name, addr := range symbols {
+		if addr == 0 {
+			continue
+		}
+		if _, isImport := imports[name]; isImport {
+			continue
+		}
+
+		if strings.Contains(name, "MetadataLoader") && strings.Contains(name, "LoadMetadataFile") {
+			if stubs.Debug {
+				stubs.DefaultRegistry.Log("setter", "il2cpp-hook",
+					fmt.Sprintf("%s @ 0x%x", name, addr))
+			}
+			emu.HookAddress(addr, makeMetadataLoaderHook(name))
+			installed++
+		}
+	}
+
+	if installed > 0 {
+		stubs.DefaultRegistry.Log("setter", "unity-il2cpp", "metadata loader hooks installed")
+	}
+	return installed
+}
+
+// makeMetadataLoaderHook creates a hook that inspects the buffer returned by the loader.
+func makeMetadataLoaderHook(funcName string) func(*emulator.Emulator) bool {
+	return func(emu *emulator.Emulator) bool {
+		fileName, _ := emu.MemReadString(emu.X(0), 256)
+		stubs.DefaultRegistry.Log("setter", funcName, fileName)
+
+		hookReturn(emu, func(emu *emulator.Emulator) {
+			captureMetadata(emu, funcName, emu.X(0))
+		})
+		return false
+	}
+}
+
+// captureMetadata validates and records a metadata buffer returned by the loader.
+func captureMetadata(emu *emulator.Emulator, funcName string, ptr uint64) {
+	if ptr == 0 {
+		stubs.DefaultRegistry.Log("setter", funcName, "returned NULL")
+		return
+	}
+
+	header, err := emu.MemRead(ptr, 8)
+	if err != nil {
+		return
+	}
+	magic := binary.LittleEndian.Uint32(header[0:4])
+	if magic != IL2CPPMetadataMagic {
+		stubs.DefaultRegistry.Log("setter", funcName,
+			fmt.Sprintf("bad magic 0x%08x @ 0x%x", magic, ptr))
+		return
+	}
+	version := binary.LittleEndian.Uint32(header[4:8])
+
+	metadataDumpsMu.Lock()
+	raw := rawMetadata
+	metadataDumpsMu.Unlock()
+
+	size := metadataSize(emu, ptr)
+	if size == 0 {
+		size = uint64(len(raw))
+	}
+	data, err := emu.MemRead(ptr, size)
+	if err != nil {
+		return
+	}
+
+	decrypted := len(raw) >= 4 && binary.LittleEndian.Uint32(raw[0:4]) != IL2CPPMetadataMagic
+
+	metadataDumpsMu.Lock()
+	metadataDumps = append(metadataDumps, MetadataDump{
+		Source:    funcName,
+		Address:   ptr,
+		Version:   version,
+		Data:      data,
+		Decrypted: decrypted,
+	})
+	metadataDumpsMu.Unlock()
+
+	stubs.DefaultRegistry.Log("setter", funcName,
+		fmt.Sprintf("metadata v%d size=%d decrypted=%v", version, len(data), decrypted))
+
+	if decrypted {
+		if key := deriveXORKey(raw, data); key != nil {
+			captureKey(CapturedKey{
+				Value:     hex.EncodeToString(key),
+				Source:    funcName,
+				Address:   ptr,
+				KeyType:   "xor",
+				RiskLevel: "critical",
+			})
+		}
+	}
+}
+
+// metadataSize computes the metadata size from its header.
+// The header is the magic and version followed by (offset, size) int32 pairs;
+// the first offset is the header size itself.
+func metadataSize(emu *emulator.Emulator, ptr uint64) uint64 {
+	first, err := emu.MemReadU32(ptr + 8)
+	if err != nil || first < 16 || first > 0x1000 {
+		return 0
+	}
+	header, err := emu.MemRead(ptr, uint64(first))
+	if err != nil {
+		return 0
+	}
+
+	end := uint64(first)
+	for off := 8; off+8 <= len(header); off += 8 {
+		secOff := uint64(binary.LittleEndian.Uint32(header[off:]))
+		secSize := uint64(binary.LittleEndian.Uint32(header[off+4:]))
+		if secOff+secSize > maxMetadataSize {
+			return 0
+		}
+		if secOff+secSize > end {
+			end = secOff + secSize
+		}
+	}
+	return end
+}
+
+// deriveXORKey recovers a repeating XOR key from the encrypted and decrypted metadata.
+// Returns nil if the difference is not a repeating pattern of at most 256 bytes.
+func deriveXORKey(raw, plain []byte) []byte {
+	n := min(len(raw), len(plain), 4096)
+	if n < 16 {
+		return nil
+	}
+	diff := make([]byte, n)
+	for i := range diff {
+		diff[i] = raw[i] ^ plain[i]
+	}
+
+	for period := 1; period <= 256 && period*2 <= n; period++ {
+		repeats := true
+		for i := period; i < n; i++ {
+			if diff[i] != diff[i-period] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return diff[:period]
+		}
+	}
+	return nil
+}
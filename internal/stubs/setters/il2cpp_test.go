@@ -0,0 +1,87 @@
+package setters
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+func TestDeriveXORKey(t *testing.T) {
+	plain := make([]byte, 64)
+	for i := range plain {
+		plain[i] = byte(i * 7)
+	}
+	xor := func(key []byte) []byte {
+		raw := make([]byte, len(plain))
+		for i := range raw {
+			raw[i] = plain[i] ^ key[i%len(key)]
+		}
+		return raw
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+		want []byte
+	}{
+		{"single byte", xor([]byte{0x5a}), []byte{0x5a}},
+		{"four bytes", xor([]byte{1, 2, 3, 4}), []byte{1, 2, 3, 4}},
+		{"no pattern", append(xor([]byte{1, 2, 3, 4})[:63], 0xff), nil},
+		{"too short", xor([]byte{0x5a})[:8], nil},
+	}
+	for _, tt := range tests {
+		if got := deriveXORKey(tt.raw, plain); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: deriveXORKey = %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMetadataSize(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	// header writes magic, version, then (offset, size) pairs
+	header := func(pairs ...uint32) uint64 {
+		buf := binary.LittleEndian.AppendUint32(nil, IL2CPPMetadataMagic)
+		buf = binary.LittleEndian.AppendUint32(buf, 24)
+		for _, v := range pairs {
+			buf = binary.LittleEndian.AppendUint32(buf, v)
+		}
+		ptr := emu.Malloc(uint64(len(buf)))
+		emu.MemWrite(ptr, buf)
+		return ptr
+	}
+
+	tests := []struct {
+		name  string
+		pairs []uint32
+		want  uint64
+	}{
+		{"last section", []uint32{32, 0x100, 0x120, 0x40, 0x200, 0x10}, 0x210},
+		{"largest end first", []uint32{32, 0x1000, 0x120, 0x40, 0x200, 0x10}, 0x1020},
+		{"empty sections", []uint32{16, 0, 16, 0}, 16},
+		{"header too small", []uint32{8, 0x100}, 0},
+		{"section too large", []uint32{16, maxMetadataSize}, 0},
+	}
+	for _, tt := range tests {
+		if got := metadataSize(emu, header(tt.pairs...)); got != tt.want {
+			t.Errorf("%s: metadataSize = %#x, want %#x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClearMetadataDumps(t *testing.T) {
+	SetIL2CPPMetadata([]byte{1, 2, 3, 4})
+	ClearMetadataDumps()
+	metadataDumpsMu.Lock()
+	raw := rawMetadata
+	metadataDumpsMu.Unlock()
+	if raw != nil {
+		t.Errorf("metadata survived ClearMetadataDumps: %x", raw)
+	}
+}
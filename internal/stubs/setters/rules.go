@@ -0,0 +1,393 @@
+package setters
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// ArgType says how a setter argument register is decoded.
+type ArgType string
+
+const (
+	ArgSkip          ArgType = "skip"   // this, flags, lengths, ...
+	ArgCString       ArgType = "char*"  // NUL-terminated
+	ArgBuffer        ArgType = "buffer" // pointer, with the length in the next register
+	ArgString        ArgType = "std::string"
+	ArgByteVector    ArgType = "std::vector<uint8_t>"
+	ArgStringVector  ArgType = "std::vector<std::string>"
+	ArgStringMap     ArgType = "std::map<std::string, std::string>"
+	ArgStringHashMap ArgType = "std::unordered_map<std::string, std::string>"
+	ArgSharedString  ArgType = "std::shared_ptr<std::string>"
+	ArgSharedBytes   ArgType = "std::shared_ptr<std::vector<uint8_t>>"
+	ArgValue         ArgType = "cocos2d::Value"
+	ArgValueMap      ArgType = "cocos2d::ValueMap"
+)
+
+// SetterRule declares a key setter by method name and argument types.
+// The setter runs normally; its arguments are decoded on entry and every
+// value found is captured, map entries and vector elements one key each.
+type SetterRule struct {
+	Method  string    // Unqualified or qualified name, e.g. "setKey" or "Crypto::setKey"
+	Args    []ArgType // One per register from X0, this included; nil infers them from the demangled parameters
+	KeyType string
+	Risk    string
+}
+
+// setterRules are matched against every symbol. C++ setters carry their
+// parameter types in the mangled name; C functions such as SQLCipher's
+// need Args.
+var (
+	setterRules = []SetterRule{
+		{Method: "setKey", KeyType: "custom", Risk: "high"},
+		{Method: "setSecret", KeyType: "custom", Risk: "high"},
+		{Method: "setSecretKey", KeyType: "custom", Risk: "high"},
+		{Method: "setEncryptionKey", KeyType: "custom", Risk: "high"},
+		{Method: "setDecryptionKey", KeyType: "custom", Risk: "high"},
+		// int sqlite3_key(sqlite3*, const void* pKey, int nKey)
+		{Method: "sqlite3_key", Args: []ArgType{ArgSkip, ArgBuffer, ArgSkip}, KeyType: "sqlcipher", Risk: "critical"},
+		// int sqlite3_key_v2(sqlite3*, const char* zDbName, const void* pKey, int nKey)
+		{Method: "sqlite3_key_v2", Args: []ArgType{ArgSkip, ArgSkip, ArgBuffer, ArgSkip}, KeyType: "sqlcipher", Risk: "critical"},
+	}
+	setterRulesMu sync.RWMutex
+)
+
+func init() {
+	methods := make([]string, len(setterRules))
+	for i, r := range setterRules {
+		methods[i] = r.Method
+	}
+	stubs.RegisterDetector(setterRulesDetector("setter-rules", methods))
+}
+
+// RegisterSetterRule adds a key setter rule, replacing any rule for the
+// same method. Rules registered before Install are used by it; a new
+// method gets a detector of its own.
+func RegisterSetterRule(r SetterRule) {
+	setterRulesMu.Lock()
+	replaced := false
+	for i := range setterRules {
+		if setterRules[i].Method == r.Method {
+			setterRules[i] = r
+			replaced = true
+		}
+	}
+	if !replaced {
+		setterRules = append(setterRules, r)
+	}
+	setterRulesMu.Unlock()
+	if !replaced {
+		stubs.RegisterDetector(setterRulesDetector("setter-rules:"+r.Method, []string{r.Method}))
+	}
+}
+
+// setterRulesDetector matches and hooks the setters of methods.
+func setterRulesDetector(name string, methods []string) stubs.Detector {
+	return stubs.Detector{
+		Name:     name,
+		Patterns: methods,
+		Activate: func(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
+			return hookSetterRules(emu, imports, symbols, methods)
+		},
+		Description: "Key setters with std:: and cocos2d container arguments",
+	}
+}
+
+// activateSetterRules hooks the symbols that match any setter rule.
+func activateSetterRules(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
+	return hookSetterRules(emu, imports, symbols, nil)
+}
+
+// hookSetterRules hooks the symbols that match the rule of one of methods,
+// or of any method if methods is nil, and have at least one argument to
+// decode.
+func hookSetterRules(emu *emulator.Emulator, imports, symbols map[string]uint64, methods []string) int {
+	installed := 0
+	for name, addr := range symbols {
+		if addr == 0 {
+			continue
+		}
+		rule, ok := matchSetterRule(name)
+		if !ok || methods != nil && !slices.Contains(methods, rule.Method) {
+			continue
+		}
+		args := rule.Args
+		if args == nil {
+			args = inferArgTypes(name)
+		}
+		if !hasDecodedArg(args) {
+			continue
+		}
+		lib := stdLibOf(emulator.DemangleName(name))
+
+		if stubs.Debug {
+			stubs.DefaultRegistry.Log("setter", "rule-hook",
+				fmt.Sprintf("%s @ 0x%x %v %s", name, addr, args, lib.name))
+		}
+		_, isImport := imports[name]
+		if !emu.TryHookAddress(addr, makeSetterRuleHook(name, rule, args, lib, isImport)) {
+			continue // Another detector hooked it first
+		}
+		installed++
+	}
+
+	if installed > 0 {
+		stubs.DefaultRegistry.Log("setter", "rules", "key setter rules installed")
+	}
+	return installed
+}
+
+// matchSetterRule returns the rule whose method is the demangled name of
+// the symbol or its unqualified tail.
+func matchSetterRule(name string) (SetterRule, bool) {
+	qualified, _ := splitDemangled(emulator.DemangleName(name))
+	setterRulesMu.RLock()
+	defer setterRulesMu.RUnlock()
+	for _, r := range setterRules {
+		if qualified == r.Method || strings.HasSuffix(qualified, "::"+r.Method) {
+			return r, true
+		}
+	}
+	return SetterRule{}, false
+}
+
+// splitDemangled splits "ns::f(int, char const*) const" into the
+// qualified name and its parameter types.
+func splitDemangled(demangled string) (string, []string) {
+	open := strings.IndexByte(demangled, '(')
+	end := strings.LastIndexByte(demangled, ')')
+	if open < 0 || end < open {
+		return demangled, nil
+	}
+	name := demangled[:open]
+	// Drop a template function's return type: "bool f<int>(...)"
+	if i := strings.LastIndexByte(name, ' '); i >= 0 && !strings.Contains(name[i:], ">") {
+		name = name[i+1:]
+	}
+
+	var params []string
+	depth, start := 0, open+1
+	for i := open + 1; i < end; i++ {
+		switch demangled[i] {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, strings.TrimSpace(demangled[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if p := strings.TrimSpace(demangled[start:end]); p != "" {
+		params = append(params, p)
+	}
+	return name, params
+}
+
+// stdTypeNames reduces the libc++ and libstdc++ spellings of std:: types
+// to one: every std::string becomes "string" and the namespaces go.
+var stdTypeNames = strings.NewReplacer(
+	"std::__ndk1::basic_string<char, std::__ndk1::char_traits<char>, std::__ndk1::allocator<char> >", "string",
+	"std::__cxx11::basic_string<char, std::char_traits<char>, std::allocator<char> >", "string",
+	"std::basic_string<char, std::char_traits<char>, std::allocator<char> >", "string",
+	"std::string", "string",
+	"std::__ndk1::", "",
+	"std::", "",
+)
+
+// inferArgTypes derives argument types from a libc++ or libstdc++
+// symbol's demangled parameters. Nested names (_ZN...) are assumed to be member functions
+// with this in X0; floating point parameters take no X register.
+func inferArgTypes(name string) []ArgType {
+	_, params := splitDemangled(emulator.DemangleName(name))
+	var args []ArgType
+	if strings.HasPrefix(name, "_ZN") {
+		args = append(args, ArgSkip)
+	}
+	for i := 0; i < len(params); i++ {
+		p := strings.TrimSuffix(strings.TrimSuffix(params[i], "&"), " const")
+		switch {
+		case p == "float" || p == "double":
+			continue
+		case p == "char const*" || p == "unsigned char const*" || p == "char*" || p == "unsigned char*" ||
+			p == "void const*" || p == "void*":
+			if i+1 < len(params) && isIntegerType(params[i+1]) {
+				args = append(args, ArgBuffer, ArgSkip)
+				i++
+			} else if strings.HasPrefix(p, "char") {
+				args = append(args, ArgCString)
+			} else {
+				args = append(args, ArgSkip)
+			}
+		default:
+			args = append(args, containerArgType(p))
+		}
+	}
+	return args
+}
+
+// containerArgType maps a demangled libc++, libstdc++ or cocos2d type to
+// its ArgType.
+func containerArgType(t string) ArgType {
+	if t == "cocos2d::Value" {
+		return ArgValue
+	}
+	if !strings.HasPrefix(t, "std::") {
+		return ArgSkip
+	}
+	switch t = stdTypeNames.Replace(t); {
+	case t == "string":
+		return ArgString
+	case strings.HasPrefix(t, "vector<unsigned char,"), strings.HasPrefix(t, "vector<char,"),
+		strings.HasPrefix(t, "vector<signed char,"):
+		return ArgByteVector
+	case strings.HasPrefix(t, "vector<string,"):
+		return ArgStringVector
+	case strings.HasPrefix(t, "map<string, string,"):
+		return ArgStringMap
+	case strings.HasPrefix(t, "unordered_map<string, string,"):
+		return ArgStringHashMap
+	case strings.HasPrefix(t, "unordered_map<string, cocos2d::Value,"):
+		return ArgValueMap
+	case t == "shared_ptr<string>" || t == "shared_ptr<string >":
+		return ArgSharedString
+	case strings.HasPrefix(t, "shared_ptr<vector<unsigned char,"):
+		return ArgSharedBytes
+	}
+	return ArgSkip
+}
+
+func isIntegerType(t string) bool {
+	switch t {
+	case "int", "unsigned int", "long", "unsigned long", "long long", "unsigned long long":
+		return true
+	}
+	return false
+}
+
+func hasDecodedArg(args []ArgType) bool {
+	for _, a := range args {
+		if a != ArgSkip {
+			return true
+		}
+	}
+	return false
+}
+
+// setterValue is one decoded value and the suffix that names it in the
+// key source: "" for the first argument, "[argN]" for later ones, and the
+// map key or vector index for container elements.
+type setterValue struct {
+	suffix string
+	value  string
+}
+
+// decodeSetterArgs reads the setter's argument registers by type, in the
+// layouts of lib.
+func decodeSetterArgs(emu *emulator.Emulator, args []ArgType, lib *stdLib) []setterValue {
+	var out []setterValue
+	for i, t := range args {
+		if t == ArgSkip || i > 7 {
+			continue
+		}
+		suffix := ""
+		if len(out) > 0 {
+			suffix = fmt.Sprintf("[arg%d]", i)
+		}
+		ptr := emu.X(i)
+
+		switch t {
+		case ArgCString:
+			if s, err := emu.MemReadString(ptr, 256); err == nil && s != "" {
+				out = append(out, setterValue{suffix, s})
+			}
+		case ArgBuffer:
+			n := uint64(0)
+			if i < 7 {
+				n = emu.X(i + 1)
+			}
+			if n > 0 && n <= maxContainerBytes {
+				if data, err := emu.MemRead(ptr, n); err == nil {
+					out = append(out, setterValue{suffix, formatBytes(data)})
+				}
+			}
+		case ArgString:
+			if s, ok := lib.readString(emu, ptr); ok {
+				out = append(out, setterValue{suffix, s})
+			}
+		case ArgByteVector:
+			if data, ok := ReadVectorBytes(emu, ptr); ok && len(data) > 0 {
+				out = append(out, setterValue{suffix, formatBytes(data)})
+			}
+		case ArgSharedString:
+			if obj, ok := ReadSharedPtr(emu, ptr); ok {
+				if s, ok := lib.readString(emu, obj); ok {
+					out = append(out, setterValue{suffix, s})
+				}
+			}
+		case ArgSharedBytes:
+			if obj, ok := ReadSharedPtr(emu, ptr); ok {
+				if data, ok := ReadVectorBytes(emu, obj); ok && len(data) > 0 {
+					out = append(out, setterValue{suffix, formatBytes(data)})
+				}
+			}
+		case ArgValue:
+			if s, ok := lib.readCocosValue(emu, ptr, 0); ok && s != "" {
+				out = append(out, setterValue{suffix, s})
+			}
+		case ArgStringVector:
+			elems, _ := ReadVector(emu, ptr, lib.stringSize)
+			for j, e := range elems {
+				if s, ok := lib.readString(emu, e); ok {
+					out = append(out, setterValue{fmt.Sprintf("%s[%d]", suffix, j), s})
+				}
+			}
+		case ArgStringMap, ArgStringHashMap:
+			read := lib.readMap
+			if t == ArgStringHashMap {
+				read = lib.readUnorderedMap
+			}
+			entries, _ := read(emu, ptr, lib.stringSize)
+			for _, e := range entries {
+				k, _ := lib.readString(emu, e.Key)
+				if v, ok := lib.readString(emu, e.Value); ok {
+					out = append(out, setterValue{suffix + "[" + k + "]", v})
+				}
+			}
+		case ArgValueMap:
+			entries, _ := lib.readValueMap(emu, ptr)
+			for _, e := range entries {
+				if e[1] != "" {
+					out = append(out, setterValue{suffix + "[" + e[0] + "]", e[1]})
+				}
+			}
+		}
+	}
+	return out
+}
+
+// makeSetterRuleHook captures the decoded arguments of a rule's setter.
+// Defined setters run normally; imported ones return.
+func makeSetterRuleHook(funcName string, rule SetterRule, args []ArgType, lib *stdLib, isImport bool) func(*emulator.Emulator) bool {
+	return func(emu *emulator.Emulator) bool {
+		for _, v := range decodeSetterArgs(emu, args, lib) {
+			captureKey(CapturedKey{
+				Value:     v.value,
+				Source:    funcName + v.suffix,
+				Address:   emu.PC(),
+				KeyType:   rule.KeyType,
+				RiskLevel: rule.Risk,
+			})
+		}
+		if isImport {
+			stubs.ReturnFromStub(emu)
+		}
+		return false
+	}
+}
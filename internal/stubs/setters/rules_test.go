@@ -0,0 +1,318 @@
+package setters
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/stubs"
+	"github.com/zboralski/galago/internal/stubs/cxxabi"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+const (
+	setKeyString    = "_ZN6Crypto6setKeyERKNSt6__ndk112basic_stringIcNS0_11char_traitsIcEENS0_9allocatorIcEEEE"
+	setKeyVector    = "_ZN6Crypto6setKeyERKNSt6__ndk16vectorIhNS0_9allocatorIhEEEE"
+	setKeyBuffer    = "_ZN6Crypto6setKeyEPKhm"
+	setKeyShared    = "_ZN6Crypto6setKeyENSt6__ndk110shared_ptrINS0_12basic_stringIcNS0_11char_traitsIcEENS0_9allocatorIcEEEEEE"
+	setKeyValueMap  = "_ZN6Crypto12setSecretKeyERKNSt6__ndk113unordered_mapINS0_12basic_stringIcNS0_11char_traitsIcEENS0_9allocatorIcEEEEN7cocos2d5ValueENS0_4hashIS7_EENS0_8equal_toIS7_EENS5_INS0_4pairIKS7_S9_EEEEEE"
+	setKeyStringMap = "_ZN6Crypto16setEncryptionKeyERKNSt6__ndk13mapINS0_12basic_stringIcNS0_11char_traitsIcEENS0_9allocatorIcEEEES7_NS0_4lessIS7_EENS5_INS0_4pairIKS7_S7_EEEEEE"
+
+	// libstdc++, from g++ with _GLIBCXX_USE_CXX11_ABI=0 (COW) and 1 (cxx11)
+	setKeyCOW          = "_ZN6Crypto6setKeyERKSs"
+	setKeyCOWShared    = "_ZN6Crypto9setSecretESt10shared_ptrISsE"
+	setKeyCOWStringMap = "_ZN6Crypto16setEncryptionKeyERKSt3mapISsSsSt4lessISsESaISt4pairIKSsSsEEE"
+	setKeyGNUVector    = "_ZN6Crypto6setKeyERKSt6vectorIhSaIhEE"
+	setKeyCXX11        = "_ZN6Crypto6setKeyERKNSt7__cxx1112basic_stringIcSt11char_traitsIcESaIcEEE"
+	setKeyCXX11Shared  = "_ZN6Crypto9setSecretESt10shared_ptrINSt7__cxx1112basic_stringIcSt11char_traitsIcESaIcEEEE"
+	setKeyCXX11Map     = "_ZN6Crypto16setEncryptionKeyERKSt3mapINSt7__cxx1112basic_stringIcSt11char_traitsIcESaIcEEES6_St4lessIS6_ESaISt4pairIKS6_S6_EEE"
+	setKeyCXX11HashMap = "_ZN6Crypto16setDecryptionKeyERKSt13unordered_mapINSt7__cxx1112basic_stringIcSt11char_traitsIcESaIcEEES6_St4hashIS6_ESt8equal_toIS6_ESaISt4pairIKS6_S6_EEE"
+)
+
+func TestInferArgTypes(t *testing.T) {
+	tests := map[string][]ArgType{
+		setKeyString:    {ArgSkip, ArgString},
+		setKeyVector:    {ArgSkip, ArgByteVector},
+		setKeyBuffer:    {ArgSkip, ArgBuffer, ArgSkip},
+		setKeyShared:    {ArgSkip, ArgSharedString},
+		setKeyValueMap:  {ArgSkip, ArgValueMap},
+		setKeyStringMap: {ArgSkip, ArgStringMap},
+		"_Z6setKeyfPKc": {ArgCString},
+
+		setKeyCOW:          {ArgSkip, ArgString},
+		setKeyCOWShared:    {ArgSkip, ArgSharedString},
+		setKeyCOWStringMap: {ArgSkip, ArgStringMap},
+		setKeyGNUVector:    {ArgSkip, ArgByteVector},
+		setKeyCXX11:        {ArgSkip, ArgString},
+		setKeyCXX11Shared:  {ArgSkip, ArgSharedString},
+		setKeyCXX11Map:     {ArgSkip, ArgStringMap},
+		setKeyCXX11HashMap: {ArgSkip, ArgStringHashMap},
+	}
+	for name, want := range tests {
+		got := inferArgTypes(name)
+		if len(got) != len(want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %v, want %v", name, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestSetterRuleHooks(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	code := uint64(emulator.CodeBase)
+	symbols := map[string]uint64{}
+	for i, name := range []string{setKeyString, setKeyVector, setKeyBuffer, setKeyShared, setKeyValueMap, setKeyStringMap} {
+		addr := code + 0x100 + uint64(i)*4
+		emu.MemWrite(addr, []byte{0xc0, 0x03, 0x5f, 0xd6}) // RET
+		symbols[name] = addr
+	}
+	// Not a setter rule, and a rule with nothing to decode
+	symbols["_ZN6Crypto9setKeyLenEi"] = code + 0x200
+	symbols["_ZN6Crypto6setKeyEi"] = code + 0x204
+	if got := activateSetterRules(emu, nil, symbols); got != 6 {
+		t.Errorf("activateSetterRules = %d, want 6", got)
+	}
+
+	call := func(name string, args ...uint64) {
+		t.Helper()
+		testutil.Call(t, emu, symbols[name], args...)
+	}
+	str := func(s string) uint64 {
+		p := emu.Malloc(stdStringSize)
+		cxxabi.WriteSSOString(emu, p, s)
+		return p
+	}
+	u64s := func(vals ...uint64) uint64 {
+		p := emu.Malloc(uint64(len(vals)) * 8)
+		for i, v := range vals {
+			emu.MemWriteU64(p+uint64(i)*8, v)
+		}
+		return p
+	}
+	this := emu.Malloc(16)
+
+	call(setKeyString, this, str("string-key"))
+
+	bytes := emu.Malloc(4)
+	emu.MemWrite(bytes, []byte{0xde, 0xad, 0xbe, 0xef})
+	call(setKeyVector, this, u64s(bytes, bytes+4, bytes+4))
+	call(setKeyBuffer, this, bytes, 2)
+	call(setKeyShared, this, u64s(str("shared-key"), 0))
+
+	// ValueMap {"key": "vm-key", "n": 7} as a two-node hash chain
+	node := func(next uint64, key string) uint64 {
+		n := emu.Malloc(hashNodeValue + stdStringSize + cocosValueSize)
+		emu.MemWriteU64(n, next)
+		cxxabi.WriteSSOString(emu, n+hashNodeValue, key)
+		return n
+	}
+	n2 := node(0, "n")
+	emu.MemWriteU64(n2+hashNodeValue+stdStringSize, 7)
+	emu.MemWriteU32(n2+hashNodeValue+stdStringSize+8, uint32(CocosInteger))
+	n1 := node(n2, "key")
+	emu.MemWriteU64(n1+hashNodeValue+stdStringSize, str("vm-key"))
+	emu.MemWriteU32(n1+hashNodeValue+stdStringSize+8, uint32(CocosString))
+	call(setKeyValueMap, this, u64s(0, 0, n1, 2, 0))
+
+	// map<string, string> {"a": "map-a", "b": "map-b"} rooted at "b"
+	treeNode := func(left uint64, k, v string) uint64 {
+		n := emu.Malloc(treeNodeValue + 2*stdStringSize)
+		emu.MemWriteU64(n, left)
+		emu.MemWriteU64(n+8, 0)
+		cxxabi.WriteSSOString(emu, n+treeNodeValue, k)
+		cxxabi.WriteSSOString(emu, n+treeNodeValue+stdStringSize, v)
+		return n
+	}
+	root := treeNode(treeNode(0, "a", "map-a"), "b", "map-b")
+	call(setKeyStringMap, this, u64s(0, root, 2))
+
+	want := map[string]string{
+		setKeyString:             "string-key",
+		setKeyVector:             "deadbeef",
+		setKeyBuffer:             "dead",
+		setKeyShared:             "shared-key",
+		setKeyValueMap + "[key]": "vm-key",
+		setKeyValueMap + "[n]":   "7",
+		setKeyStringMap + "[a]":  "map-a",
+		setKeyStringMap + "[b]":  "map-b",
+	}
+	keys := GetCapturedKeys()
+	if len(keys) != len(want) {
+		t.Errorf("captured %d keys, want %d: %+v", len(keys), len(want), keys)
+	}
+	for _, k := range keys {
+		if want[k.Source] != k.Value {
+			t.Errorf("%s = %q, want %q", k.Source, k.Value, want[k.Source])
+		}
+	}
+}
+
+func TestSetterRuleHooksLibstdcxx(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	code := uint64(emulator.CodeBase)
+	symbols := map[string]uint64{}
+	for i, name := range []string{setKeyCOW, setKeyCXX11, setKeyCXX11Map} {
+		addr := code + 0x100 + uint64(i)*4
+		emu.MemWrite(addr, []byte{0xc0, 0x03, 0x5f, 0xd6}) // RET
+		symbols[name] = addr
+	}
+	if got := activateSetterRules(emu, nil, symbols); got != 3 {
+		t.Errorf("activateSetterRules = %d, want 3", got)
+	}
+
+	call := func(name string, args ...uint64) {
+		t.Helper()
+		testutil.Call(t, emu, symbols[name], args...)
+	}
+	// cxx11 strings are { char* ptr; size_t len; char buf[16]; }
+	writeCXX11 := func(p uint64, s string) {
+		data := emu.Malloc(uint64(len(s)) + 1)
+		emu.MemWrite(data, []byte(s))
+		emu.MemWriteU64(p, data)
+		emu.MemWriteU64(p+8, uint64(len(s)))
+	}
+	this := emu.Malloc(16)
+
+	cow := emu.Malloc(cxxabi.COWObjSize)
+	cxxabi.WriteCOWString(emu, cow, "cow-key")
+	call(setKeyCOW, this, cow)
+
+	cxx11 := emu.Malloc(cxxabi.CXX11ObjSize)
+	writeCXX11(cxx11, "cxx11-key")
+	call(setKeyCXX11, this, cxx11)
+
+	// map<string, string> {"a": "map-a", "b": "map-b"} rooted at "b", with
+	// the _Rb_tree_node_base links at +16 and the root and count in the header
+	treeNode := func(left uint64, k, v string) uint64 {
+		n := emu.Malloc(treeNodeValue + 2*cxxabi.CXX11ObjSize)
+		emu.MemWrite(n, make([]byte, treeNodeValue))
+		emu.MemWriteU64(n+16, left)
+		writeCXX11(n+treeNodeValue, k)
+		writeCXX11(n+treeNodeValue+cxxabi.CXX11ObjSize, v)
+		return n
+	}
+	m := emu.Malloc(48)
+	emu.MemWrite(m, make([]byte, 48))
+	emu.MemWriteU64(m+16, treeNode(treeNode(0, "a", "map-a"), "b", "map-b"))
+	emu.MemWriteU64(m+40, 2)
+	call(setKeyCXX11Map, this, m)
+
+	want := map[string]string{
+		setKeyCOW:              "cow-key",
+		setKeyCXX11:            "cxx11-key",
+		setKeyCXX11Map + "[a]": "map-a",
+		setKeyCXX11Map + "[b]": "map-b",
+	}
+	keys := GetCapturedKeys()
+	if len(keys) != len(want) {
+		t.Errorf("captured %d keys, want %d: %+v", len(keys), len(want), keys)
+	}
+	for _, k := range keys {
+		if want[k.Source] != k.Value {
+			t.Errorf("%s = %q, want %q", k.Source, k.Value, want[k.Source])
+		}
+	}
+}
+
+func TestRegisterSetterRule(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	saved := append([]SetterRule(nil), setterRules...)
+	defer func() { setterRules = saved }()
+	RegisterSetterRule(SetterRule{Method: "installKey", Args: []ArgType{ArgCString}, KeyType: "custom", Risk: "low"})
+	RegisterSetterRule(SetterRule{Method: "installKey", Args: []ArgType{ArgCString}, KeyType: "app", Risk: "high"})
+	if len(setterRules) != len(saved)+1 {
+		t.Errorf("%d rules after registering one method twice, want %d", len(setterRules), len(saved)+1)
+	}
+
+	code := uint64(emulator.CodeBase)
+	emu.MemWrite(code+0x100, []byte{0xc0, 0x03, 0x5f, 0xd6}) // RET
+	emu.MemWrite(code+0x104, []byte{0xc0, 0x03, 0x5f, 0xd6}) // RET
+	symbols := map[string]uint64{"installKey": code + 0x100, "sqlite3_key": code + 0x104}
+	activated := false
+	for _, m := range stubs.Detect(emu, symbols) {
+		if m.Name == "setter-rules:installKey" {
+			activated = m.Activated
+		}
+	}
+	if !activated {
+		t.Fatal("setter-rules:installKey not activated by a registered rule")
+	}
+	if got := activateSetterRules(emu, nil, symbols); got != 2 {
+		t.Errorf("activateSetterRules = %d, want 2", got)
+	}
+
+	key := testutil.CString(emu, "installed")
+	testutil.Call(t, emu, code+0x100, key)
+	emu.MemWrite(key, []byte{0x01, 0x02, 0x03, 0x04})
+	testutil.Call(t, emu, code+0x104, emu.Malloc(16), key, 3)
+
+	want := map[string]CapturedKey{
+		"installKey":  {Value: "installed", KeyType: "app", RiskLevel: "high"},
+		"sqlite3_key": {Value: "010203", KeyType: "sqlcipher", RiskLevel: "critical"},
+	}
+	keys := GetCapturedKeys()
+	if len(keys) != len(want) {
+		t.Errorf("captured %d keys, want %d: %+v", len(keys), len(want), keys)
+	}
+	for _, k := range keys {
+		w := want[k.Source]
+		if k.Value != w.Value || k.KeyType != w.KeyType || k.RiskLevel != w.RiskLevel {
+			t.Errorf("%s = %+v, want %+v", k.Source, k, w)
+		}
+	}
+}
+
+func TestSharedDetectorAddress(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	// aes_key::setKey(unsigned char const*, unsigned long) matches both the
+	// cocos2dx AES setter patterns and the setKey rule
+	const name = "_ZN7aes_key6setKeyEPKhm"
+	addr := uint64(emulator.CodeBase) + 0x100
+	emu.MemWrite(addr, []byte{0xc0, 0x03, 0x5f, 0xd6}) // RET
+	symbols := map[string]uint64{name: addr}
+	if got := activateCocos2dx(emu, nil, symbols); got != 1 {
+		t.Fatalf("activateCocos2dx = %d, want 1", got)
+	}
+	if got := activateSetterRules(emu, nil, symbols); got != 0 {
+		t.Errorf("activateSetterRules = %d on an address already hooked, want 0", got)
+	}
+
+	testutil.Call(t, emu, addr, 0, testutil.CString(emu, "shared-key"), 10)
+	keys := GetCapturedKeys()
+	if len(keys) != 1 || keys[0].Value != "shared-key" || keys[0].KeyType != "aes" {
+		t.Errorf("captured %+v, want shared-key from the cocos2dx hook only", keys)
+	}
+}
@@ -0,0 +1,138 @@
+package setters
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/fingerprint"
+	"github.com/zboralski/galago/internal/stubs"
+)
+
+// unrealKeySize is the size of an Unreal Engine pak AES-256 key (FAES::FAESKey).
+const unrealKeySize = 32
+
+func init() {
+	// Register Unreal Engine detector
+	stubs.RegisterDetector(stubs.Detector{
+		Name: "unreal",
+		Patterns: []string{
+			"FCoreDelegates",
+			"GetPakEncryptionKeyDelegate",
+			"RegisterEncryptionKeyCallback",
+		},
+		Fingerprint: unrealFingerprint,
+		Activate:    activateUnreal,
+		Description: "Unreal Engine pak AES-256 key extraction",
+	})
+}
+
+// unrealFingerprint reads the engine version from the "++UE4+Release-4.27" build string.
+func unrealFingerprint(emu *emulator.Emulator, symbols map[string]uint64) string {
+	if img := emu.Image(); img != nil {
+		if e, ok := fingerprint.Unreal(img); ok {
+			return e.String()
+		}
+	}
+	return "unreal"
+}
+
+// activateUnreal installs hooks on the libUE4.so pak encryption key path.
+//
+// UE4 games register their pak key with UE_REGISTER_ENCRYPTION_KEY, which
+// defines RegisterEncryptionKeyCallback(unsigned char OutKey[32]) and binds it
+// to FCoreDelegates::GetPakEncryptionKeyDelegate(). The engine later invokes
+// the delegate (via FPakPlatformFile::GetPakEncryptionKey) with a 32-byte
+// output buffer. We let those functions run and read the buffer on return.
+func activateUnreal(emu *emulator.Emulator, imports, symbols map[string]uint64) int {
+	installed := 0
+
+	for name, addr := range symbols {
+		if addr == 0 {
+			continue
+		}
+
+		// GetPakEncryptionKeyDelegate returns the delegate the key callback is bound to
+		if strings.Contains(name, "GetPakEncryptionKeyDelegate") {
+			_, isImport := imports[name]
+			emu.HookAddress(addr, makeUnrealDelegateHook(name, isImport))
+			installed++
+			continue
+		}
+
+		// RegisterEncryptionKeyCallback(unsigned char*) and
+		// FPakPlatformFile::GetPakEncryptionKey(FAES::FAESKey&, FGuid const&)
+		// both take the output key buffer in X0. Delegate accessors such as
+		// FCoreDelegates::GetRegisterEncryptionKeyDelegate take no buffer.
+		if (strings.Contains(name, "RegisterEncryptionKeyCallback") ||
+			strings.Contains(name, "GetPakEncryptionKey")) && !strings.Contains(name, "Delegate") {
+			if _, isImport := imports[name]; isImport {
+				continue
+			}
+			if stubs.Debug {
+				stubs.DefaultRegistry.Log("setter", "unreal-hook",
+					fmt.Sprintf("%s @ 0x%x", name, addr))
+			}
+			emu.HookAddress(addr, makeUnrealKeyCallbackHook(name))
+			installed++
+			continue
+		}
+	}
+
+	if installed > 0 {
+		stubs.DefaultRegistry.Log("setter", "unreal", "pak key hooks installed")
+	}
+	return installed
+}
+
+// makeUnrealDelegateHook logs access to the pak key delegate.
+// Internal definitions run normally; imported ones return a mock delegate.
+func makeUnrealDelegateHook(funcName string, isImport bool) func(*emulator.Emulator) bool {
+	return func(emu *emulator.Emulator) bool {
+		stubs.DefaultRegistry.Log("setter", funcName, stubs.FormatPtr("lr", emu.LR()))
+		if isImport {
+			emu.SetX(0, emu.GetMockObject())
+			stubs.ReturnFromStub(emu)
+		}
+		return false
+	}
+}
+
+// makeUnrealKeyCallbackHook creates a hook for functions that fill a 32-byte key buffer.
+// On entry it records the output buffer (X0); when the callback returns, the buffer
+// is read and captured as a hex-encoded AES-256 key.
+func makeUnrealKeyCallbackHook(funcName string) func(*emulator.Emulator) bool {
+	return func(emu *emulator.Emulator) bool {
+		outKey := emu.X(0)
+		if outKey == 0 {
+			return false
+		}
+
+		hookReturn(emu, func(emu *emulator.Emulator) {
+			data, err := emu.MemRead(outKey, unrealKeySize)
+			if err != nil || isZeroKey(data) {
+				return
+			}
+
+			captureKey(CapturedKey{
+				Value:     hex.EncodeToString(data),
+				Source:    funcName,
+				Address:   emu.PC(),
+				KeyType:   "aes256",
+				RiskLevel: "critical",
+			})
+		})
+		return false
+	}
+}
+
+// isZeroKey reports whether a key buffer was left unwritten.
+func isZeroKey(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package setters
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+	"github.com/zboralski/galago/internal/testutil"
+)
+
+func TestUnrealKeyCallback(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+	ClearCapturedKeys()
+	defer ClearCapturedKeys()
+
+	code := uint64(emulator.CodeBase)
+	symbols := map[string]uint64{
+		"_Z29RegisterEncryptionKeyCallbackPh":                     code + 0x100,
+		"_ZN14FCoreDelegates27GetPakEncryptionKeyDelegateEv":      code + 0x200,
+		"_ZN14FCoreDelegates32GetRegisterEncryptionKeyDelegateEv": code + 0x300,
+	}
+	// RegisterEncryptionKeyCallback copies the key at X1 to the buffer at X0
+	emu.MemWrite(symbols["_Z29RegisterEncryptionKeyCallbackPh"], []byte{
+		0x22, 0x0c, 0x40, 0xa9, // LDP X2, X3, [X1]
+		0x02, 0x0c, 0x00, 0xa9, // STP X2, X3, [X0]
+		0x22, 0x0c, 0x41, 0xa9, // LDP X2, X3, [X1, #16]
+		0x02, 0x0c, 0x01, 0xa9, // STP X2, X3, [X0, #16]
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+	})
+	// The delegate accessors return nothing useful; neither takes a key buffer
+	emu.MemWrite(symbols["_ZN14FCoreDelegates27GetPakEncryptionKeyDelegateEv"], []byte{0xc0, 0x03, 0x5f, 0xd6})
+	emu.MemWrite(symbols["_ZN14FCoreDelegates32GetRegisterEncryptionKeyDelegateEv"], []byte{0xc0, 0x03, 0x5f, 0xd6})
+	if got := activateUnreal(emu, map[string]uint64{}, symbols); got != 2 {
+		t.Errorf("activateUnreal = %d, want 2", got)
+	}
+
+	// The key is read on return, at the NOP after the call
+	call := func(name string, args ...uint64) {
+		t.Helper()
+		testutil.Call(t, emu, symbols[name], args...)
+	}
+
+	key, _ := hex.DecodeString("0123456789abcdeffedcba98765432100f1e2d3c4b5a69788796a5b4c3d2e1f0")
+	src := emu.Malloc(unrealKeySize)
+	emu.MemWrite(src, key)
+	// X0 is not a key buffer here, whatever it points at
+	call("_ZN14FCoreDelegates32GetRegisterEncryptionKeyDelegateEv", src)
+	call("_Z29RegisterEncryptionKeyCallbackPh", emu.Malloc(unrealKeySize), src)
+
+	keys := GetCapturedKeys()
+	if len(keys) != 1 {
+		t.Fatalf("captured %d keys, want 1: %+v", len(keys), keys)
+	}
+	want := CapturedKey{Value: hex.EncodeToString(key), Source: "_Z29RegisterEncryptionKeyCallbackPh", KeyType: "aes256", RiskLevel: "critical"}
+	if keys[0].Address = 0; keys[0] != want {
+		t.Errorf("key = %+v, want %+v", keys[0], want)
+	}
+}
@@ -0,0 +1,173 @@
+package stubs
+
+import (
+	"fmt"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// Syscall maps a Linux arm64 syscall number to the stub that implements it.
+// Stubs follow the libc convention (-1 with errno); the dispatcher converts
+// that to the kernel convention (-errno in X0).
+type Syscall struct {
+	Name string   // Kernel name (e.g., "newfstatat")
+	Stub string   // Registered stub implementing it; "" for Hook or unimplemented
+	Hook HookFunc // Syscall-only implementation (optional)
+}
+
+// syscallZero succeeds without doing anything. Used for signal, futex, and
+// scheduling calls that have no effect in a single-threaded emulation.
+func syscallZero(emu *emulator.Emulator) bool {
+	emu.SetX(0, 0)
+	ReturnFromStub(emu)
+	return false
+}
+
+// LinuxSyscalls is the arm64 syscall table (asm-generic/unistd.h).
+// Entries without a Stub or Hook are traced and fail with ENOSYS.
+var LinuxSyscalls = map[uint64]Syscall{
+	17:  {Name: "getcwd"},
+	23:  {Name: "dup", Stub: "dup"},
+	24:  {Name: "dup3", Stub: "dup3"},
+	25:  {Name: "fcntl", Stub: "fcntl"},
+	29:  {Name: "ioctl", Stub: "ioctl"},
+	34:  {Name: "mkdirat", Stub: "mkdirat"},
+	35:  {Name: "unlinkat", Stub: "unlinkat"},
+	37:  {Name: "linkat", Stub: "linkat"},
+	38:  {Name: "renameat", Stub: "renameat"},
+	46:  {Name: "ftruncate", Stub: "ftruncate"},
+	48:  {Name: "faccessat", Stub: "faccessat"},
+	49:  {Name: "chdir", Stub: "chdir"},
+	50:  {Name: "fchdir", Stub: "fchdir"},
+	52:  {Name: "fchmod", Stub: "fchmod"},
+	53:  {Name: "fchmodat", Stub: "fchmodat"},
+	54:  {Name: "fchownat", Stub: "fchownat"},
+	55:  {Name: "fchown", Stub: "fchown"},
+	56:  {Name: "openat", Stub: "openat"},
+	57:  {Name: "close", Stub: "close"},
+	59:  {Name: "pipe2", Stub: "pipe2"},
+	61:  {Name: "getdents64"},
+	62:  {Name: "lseek", Stub: "lseek"},
+	63:  {Name: "read", Stub: "read"},
+	64:  {Name: "write", Stub: "write"},
+	65:  {Name: "readv", Stub: "readv"},
+	66:  {Name: "writev", Stub: "writev"},
+	67:  {Name: "pread64", Stub: "pread64"},
+	68:  {Name: "pwrite64", Stub: "pwrite64"},
+	78:  {Name: "readlinkat", Stub: "readlinkat"},
+	79:  {Name: "newfstatat", Stub: "fstatat"},
+	80:  {Name: "fstat", Stub: "fstat"},
+	81:  {Name: "sync", Stub: "sync"},
+	82:  {Name: "fsync", Stub: "fsync"},
+	83:  {Name: "fdatasync", Stub: "fdatasync"},
+	93:  {Name: "exit", Stub: "_exit"},
+	94:  {Name: "exit_group", Stub: "_exit"},
+	96:  {Name: "set_tid_address", Stub: "gettid"},
+	98:  {Name: "futex", Hook: syscallZero},
+	101: {Name: "nanosleep", Stub: "nanosleep"},
+	113: {Name: "clock_gettime", Stub: "clock_gettime"},
+	124: {Name: "sched_yield", Stub: "sched_yield"},
+	129: {Name: "kill"},
+	131: {Name: "tgkill"},
+	132: {Name: "sigaltstack", Hook: syscallZero},
+	134: {Name: "rt_sigaction", Hook: syscallZero},
+	135: {Name: "rt_sigprocmask", Hook: syscallZero},
+	160: {Name: "uname"},
+	167: {Name: "prctl", Hook: syscallZero},
+	169: {Name: "gettimeofday", Stub: "gettimeofday"},
+	172: {Name: "getpid", Stub: "getpid"},
+	173: {Name: "getppid", Stub: "getppid"},
+	174: {Name: "getuid", Stub: "getuid"},
+	175: {Name: "geteuid", Stub: "geteuid"},
+	176: {Name: "getgid", Stub: "getgid"},
+	177: {Name: "getegid", Stub: "getegid"},
+	178: {Name: "gettid", Stub: "gettid"},
+	198: {Name: "socket", Stub: "socket"},
+	200: {Name: "bind", Stub: "bind"},
+	201: {Name: "listen", Stub: "listen"},
+	202: {Name: "accept", Stub: "accept"},
+	203: {Name: "connect", Stub: "connect"},
+	204: {Name: "getsockname", Stub: "getsockname"},
+	205: {Name: "getpeername", Stub: "getpeername"},
+	206: {Name: "sendto", Stub: "sendto"},
+	207: {Name: "recvfrom", Stub: "recvfrom"},
+	208: {Name: "setsockopt", Stub: "setsockopt"},
+	209: {Name: "getsockopt", Stub: "getsockopt"},
+	210: {Name: "shutdown", Stub: "shutdown"},
+	215: {Name: "munmap", Stub: "munmap"},
+	222: {Name: "mmap", Stub: "mmap"},
+	226: {Name: "mprotect", Stub: "mprotect"},
+	227: {Name: "msync", Stub: "msync"},
+	233: {Name: "madvise", Stub: "madvise"},
+	278: {Name: "getrandom", Stub: "getrandom"},
+}
+
+// InstallSyscalls hooks SVC #0 and dispatches Linux syscalls to registered
+// stubs, for code that issues syscalls inline to avoid PLT hooks.
+func (r *Registry) InstallSyscalls(emu *emulator.Emulator) error {
+	return emu.HookInterrupt(func(e *emulator.Emulator, intno uint32) bool {
+		if intno != emulator.IntrSVC {
+			r.Log("syscall", "exception", fmt.Sprintf("intno=%d pc=0x%x", intno, e.PC()))
+			return false // Run fails with UC_ERR_EXCEPTION
+		}
+		if r.dispatchSyscall(e) {
+			e.Stop()
+		}
+		return true
+	})
+}
+
+// dispatchSyscall runs the syscall in X8 with arguments in X0-X5 and
+// returns true to stop emulation.
+func (r *Registry) dispatchSyscall(emu *emulator.Emulator) bool {
+	nr := emu.X(8)
+	next := emu.PC() // Instruction after SVC
+	sc, ok := LinuxSyscalls[nr]
+	if !ok {
+		sc.Name = fmt.Sprintf("sys_%d", nr)
+	}
+
+	hook := sc.Hook
+	if hook == nil && sc.Stub != "" {
+		r.mu.RLock()
+		if def, ok := r.stubs[sc.Stub]; ok {
+			hook = def.Hook
+		}
+		r.mu.RUnlock()
+	}
+
+	// Stubs return to LR and report failure through errno. The kernel
+	// returns to the next instruction, leaves errno alone, and reports
+	// failure as -errno. With LR pointing past the SVC, a stub returns
+	// there; one that redirects PC keeps its target.
+	lr := emu.LR()
+	savedErrno := emu.Errno()
+	emu.SetErrno(0)
+	emu.SetLR(next)
+	defer func() {
+		emu.SetErrno(savedErrno)
+		emu.SetLR(lr)
+	}()
+
+	if hook == nil {
+		r.Log("syscall", sc.Name, fmt.Sprintf("unimplemented nr=%d args=[0x%x 0x%x 0x%x 0x%x 0x%x 0x%x]",
+			nr, emu.X(0), emu.X(1), emu.X(2), emu.X(3), emu.X(4), emu.X(5)))
+		emu.SetX(0, negErrno(ENOSYS))
+		return false
+	}
+
+	r.Log("syscall", sc.Name, fmt.Sprintf("nr=%d", nr))
+	stop := hook(emu)
+
+	if emu.X(0) == ^uint64(0) {
+		if errno := emu.Errno(); errno != 0 {
+			emu.SetX(0, negErrno(errno))
+		}
+	}
+	return stop
+}
+
+// negErrno encodes errno as a raw syscall return value.
+func negErrno(errno int) uint64 {
+	return uint64(-int64(errno))
+}
@@ -0,0 +1,47 @@
+// Package testutil calls guest code and stubs from tests.
+package testutil
+
+import (
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// stubAddr is where CallStub installs the hook under test.
+const stubAddr = emulator.StubBase + 0x100
+
+// Call calls fn from CodeBase through BLR X16, with args in X0 up, and
+// returns X0. Other registers are left as set. The call returns to a NOP,
+// so hooks on the return address run.
+func Call(t testing.TB, emu *emulator.Emulator, fn uint64, args ...uint64) uint64 {
+	t.Helper()
+	code := uint64(emulator.CodeBase)
+	emu.MemWrite(code, []byte{
+		0x00, 0x02, 0x3f, 0xd6, // BLR X16
+		0x1f, 0x20, 0x03, 0xd5, // NOP
+	})
+	emu.SetX(16, fn)
+	for i, a := range args {
+		emu.SetX(i, a)
+	}
+	if err := emu.Run(code, code+8); err != nil {
+		t.Fatalf("call %#x: %v", fn, err)
+	}
+	return emu.X(0)
+}
+
+// CallStub calls hook as a stub through BLR, so that it reads its
+// arguments from the registers and stack as already set.
+func CallStub(t testing.TB, emu *emulator.Emulator, hook func(*emulator.Emulator) bool) {
+	t.Helper()
+	emu.MemWrite(stubAddr, []byte{0x1f, 0x20, 0x03, 0xd5}) // NOP
+	emu.HookAddress(stubAddr, hook)
+	Call(t, emu, stubAddr)
+}
+
+// CString copies s and a NUL terminator to a new guest buffer.
+func CString(emu *emulator.Emulator, s string) uint64 {
+	p := emu.Malloc(uint64(len(s) + 1))
+	emu.MemWriteString(p, s)
+	return p
+}
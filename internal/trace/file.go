@@ -0,0 +1,389 @@
+package trace
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A trace file is a gzip stream: the magic, then records that each start
+// with a kind byte. Numbers are varints; an instruction's PC is stored as
+// its distance from the one after the previous PC, its code word only the
+// first time that PC runs or when the word there changed, and its
+// registers as the XOR of those that changed since the previous
+// instruction.
+const fileMagic = "GALAGOT2"
+
+const (
+	recHeader  = 'H' // binary, base, entry
+	recSymbol  = 'S' // addr, name, size (0 if unknown)
+	recInsn    = 'I' // pc delta, register mask, XOR deltas
+	recInsnNew = 'N' // pc delta, code word, register mask, XOR deltas
+	recMem     = 'M' // Guest store by the previous instruction: addr, data
+	recHost    = 'W' // Stub write for the next instruction: addr, data
+	recEvent   = 'E' // Stub event for the next instruction: category, name, detail
+)
+
+// NumRegs is the number of registers recorded: X0-X30 and SP.
+const NumRegs = 32
+
+// RegName names a recorded register.
+func RegName(i int) string {
+	if i == NumRegs-1 {
+		return "sp"
+	}
+	return fmt.Sprintf("x%d", i)
+}
+
+// Header describes the recorded run.
+type Header struct {
+	Binary string
+	Base   uint64
+	Entry  uint64
+}
+
+// Writer records a run to a trace file. Write errors are kept and
+// returned by Close.
+type Writer struct {
+	gz     *gzip.Writer
+	bw     *bufio.Writer
+	err    error
+	prevPC uint64
+	regs   [NumRegs]uint64
+	words  map[uint64]uint32 // Code word last recorded at each PC
+	buf    []byte
+}
+
+// NewWriter starts a trace file on w.
+func NewWriter(w io.Writer, h Header) *Writer {
+	t := &Writer{bw: bufio.NewWriterSize(w, 64*1024), words: make(map[uint64]uint32)}
+	t.gz, _ = gzip.NewWriterLevel(t.bw, gzip.BestSpeed)
+	t.write([]byte(fileMagic))
+	t.buf = append(t.buf[:0], recHeader)
+	t.buf = appendString(t.buf, h.Binary)
+	t.buf = binary.AppendUvarint(t.buf, h.Base)
+	t.buf = binary.AppendUvarint(t.buf, h.Entry)
+	t.write(t.buf)
+	return t
+}
+
+func (t *Writer) write(b []byte) {
+	if t.err == nil {
+		_, t.err = t.gz.Write(b)
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// Symbol names the size bytes at addr; a size of 0 leaves the symbol's
+// end unknown.
+func (t *Writer) Symbol(addr uint64, name string, size uint64) {
+	t.buf = append(t.buf[:0], recSymbol)
+	t.buf = binary.AppendUvarint(t.buf, addr)
+	t.buf = appendString(t.buf, name)
+	t.buf = binary.AppendUvarint(t.buf, size)
+	t.write(t.buf)
+}
+
+// Insn records an instruction about to run and the registers before it.
+// Code the guest rewrote is recorded with its new word.
+func (t *Writer) Insn(pc uint64, word uint32, regs [NumRegs]uint64) {
+	kind := byte(recInsn)
+	if old, ok := t.words[pc]; !ok || old != word {
+		t.words[pc] = word
+		kind = recInsnNew
+	}
+	t.buf = append(t.buf[:0], kind)
+	t.buf = binary.AppendVarint(t.buf, int64(pc-t.prevPC-4))
+	if kind == recInsnNew {
+		t.buf = binary.LittleEndian.AppendUint32(t.buf, word)
+	}
+	var mask uint32
+	for i, v := range regs {
+		if v != t.regs[i] {
+			mask |= 1 << i
+		}
+	}
+	t.buf = binary.AppendUvarint(t.buf, uint64(mask))
+	for i, v := range regs {
+		if mask&(1<<i) != 0 {
+			t.buf = binary.AppendUvarint(t.buf, v^t.regs[i])
+		}
+	}
+	t.write(t.buf)
+	t.prevPC, t.regs = pc, regs
+}
+
+// Mem records a store made by the last instruction.
+func (t *Writer) Mem(addr uint64, data []byte) {
+	t.data(recMem, addr, data)
+}
+
+// Host records a write a stub made, shown with the next instruction.
+func (t *Writer) Host(addr uint64, data []byte) {
+	t.data(recHost, addr, data)
+}
+
+func (t *Writer) data(kind byte, addr uint64, data []byte) {
+	t.buf = append(t.buf[:0], kind)
+	t.buf = binary.AppendUvarint(t.buf, addr)
+	t.buf = appendString(t.buf, string(data))
+	t.write(t.buf)
+}
+
+// Event records a stub event, shown with the next instruction.
+func (t *Writer) Event(category, name, detail string) {
+	t.buf = append(t.buf[:0], recEvent)
+	t.buf = appendString(t.buf, category)
+	t.buf = appendString(t.buf, name)
+	t.buf = appendString(t.buf, detail)
+	t.write(t.buf)
+}
+
+// Close finishes the file.
+func (t *Writer) Close() error {
+	if err := t.gz.Close(); t.err == nil {
+		t.err = err
+	}
+	if err := t.bw.Flush(); t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
+
+// Step is one recorded instruction with what happened around it.
+type Step struct {
+	Index  int // 1-based position in the run
+	PC     uint64
+	Word   uint32
+	Events []*Event // Stub events before it ran
+	Regs   []RegChange
+	Writes []MemWrite // Stub writes before it ran, then its stores
+}
+
+// RegChange is a register an instruction changed.
+type RegChange struct {
+	Reg   int // 0-30 for X0-X30, 31 for SP
+	Value uint64
+}
+
+// MemWrite is recorded memory contents after a write.
+type MemWrite struct {
+	Addr uint64
+	Data []byte
+	Host bool // Written by a stub
+}
+
+// Reader replays a trace file.
+type Reader struct {
+	Header Header
+
+	r       *bufio.Reader
+	prevPC  uint64
+	regs    [NumRegs]uint64
+	words   map[uint64]uint32
+	symbols []Symbol
+	cur     *Step
+	events  []*Event
+	host    []MemWrite
+	index   int
+	rerr    error
+}
+
+// Symbol is a named address seen in the trace.
+type Symbol struct {
+	Addr uint64
+	Name string
+	Size uint64 // 0 if unknown
+}
+
+// ErrNotTrace is returned for files that are not trace files.
+var ErrNotTrace = errors.New("not a galago trace file")
+
+// NewReader opens a trace file.
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, ErrNotTrace
+	}
+	t := &Reader{r: bufio.NewReader(gz), words: make(map[uint64]uint32)}
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(t.r, magic); err != nil || string(magic) != fileMagic {
+		return nil, ErrNotTrace
+	}
+	if kind, err := t.r.ReadByte(); err != nil || kind != recHeader {
+		return nil, ErrNotTrace
+	}
+	t.Header.Binary = t.string()
+	t.Header.Base = t.uvarint()
+	t.Header.Entry = t.uvarint()
+	if err := t.err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Symbol returns the closest symbol at or before addr seen so far, if
+// addr is inside it. Symbols of unknown size extend to the next one.
+func (t *Reader) Symbol(addr uint64) (Symbol, bool) {
+	i := sort.Search(len(t.symbols), func(i int) bool { return t.symbols[i].Addr > addr })
+	if i == 0 {
+		return Symbol{}, false
+	}
+	sym := t.symbols[i-1]
+	if sym.Size != 0 && addr-sym.Addr >= sym.Size {
+		return Symbol{}, false
+	}
+	return sym, true
+}
+
+func (t *Reader) addSymbol(s Symbol) {
+	i := sort.Search(len(t.symbols), func(i int) bool { return t.symbols[i].Addr >= s.Addr })
+	if i < len(t.symbols) && t.symbols[i].Addr == s.Addr {
+		t.symbols[i] = s
+		return
+	}
+	t.symbols = append(t.symbols, Symbol{})
+	copy(t.symbols[i+1:], t.symbols[i:])
+	t.symbols[i] = s
+}
+
+// Next returns the next instruction, or io.EOF after the last.
+func (t *Reader) Next() (*Step, error) {
+	for {
+		kind, err := t.r.ReadByte()
+		if err == io.EOF {
+			step := t.cur
+			t.cur = nil
+			if step == nil {
+				return nil, io.EOF
+			}
+			return step, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case recSymbol:
+			addr := t.uvarint()
+			name := t.string()
+			t.addSymbol(Symbol{addr, name, t.uvarint()})
+		case recEvent:
+			category, name, detail := t.string(), t.string(), t.string()
+			e := NewEvent(0, category, name, detail)
+			DefaultEnricher(e)
+			t.events = append(t.events, e)
+		case recHost:
+			addr := t.uvarint()
+			t.host = append(t.host, MemWrite{Addr: addr, Data: []byte(t.string()), Host: true})
+		case recMem:
+			addr := t.uvarint()
+			w := MemWrite{Addr: addr, Data: []byte(t.string())}
+			if t.cur != nil {
+				t.cur.Writes = append(t.cur.Writes, w)
+			}
+		case recInsn, recInsnNew:
+			pc := t.prevPC + 4 + uint64(t.varint())
+			if kind == recInsnNew {
+				var word [4]byte
+				t.read(word[:])
+				t.words[pc] = binary.LittleEndian.Uint32(word[:])
+			}
+			mask := uint32(t.uvarint())
+			var changes []RegChange
+			for i := range t.regs {
+				if mask&(1<<i) != 0 {
+					t.regs[i] ^= t.uvarint()
+					changes = append(changes, RegChange{i, t.regs[i]})
+				}
+			}
+			if err := t.err(); err != nil {
+				return nil, err
+			}
+			t.prevPC = pc
+
+			done := t.cur
+			if done != nil {
+				done.Regs = changes
+			}
+			t.index++
+			for _, e := range t.events {
+				e.PC = pc
+			}
+			t.cur = &Step{Index: t.index, PC: pc, Word: t.words[pc], Events: t.events, Writes: t.host}
+			t.events, t.host = nil, nil
+			if done != nil {
+				return done, nil
+			}
+		default:
+			return nil, fmt.Errorf("trace: bad record kind 0x%02x", kind)
+		}
+		if err := t.err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Reads keep the first error, checked once a record is decoded.
+func (t *Reader) fail(err error) {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if t.rerr == nil {
+		t.rerr = err
+	}
+}
+
+func (t *Reader) err() error { return t.rerr }
+
+func (t *Reader) read(b []byte) {
+	if t.rerr != nil {
+		return
+	}
+	if _, err := io.ReadFull(t.r, b); err != nil {
+		t.fail(err)
+	}
+}
+
+func (t *Reader) uvarint() uint64 {
+	if t.rerr != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(t.r)
+	if err != nil {
+		t.fail(err)
+	}
+	return v
+}
+
+func (t *Reader) varint() int64 {
+	if t.rerr != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(t.r)
+	if err != nil {
+		t.fail(err)
+	}
+	return v
+}
+
+func (t *Reader) string() string {
+	n := t.uvarint()
+	if n > 1<<24 {
+		t.fail(fmt.Errorf("trace: string of %d bytes", n))
+	}
+	if t.rerr != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	t.read(b)
+	return string(b)
+}
@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+// maxHostWrite bounds how much of one stub write is recorded.
+const maxHostWrite = 4096
+
+// Recorder writes every instruction of a run to a trace file, with no
+// limit on length: unlike the printed trace it never drops a line.
+type Recorder struct {
+	w       *Writer
+	emu     *emulator.Emulator
+	names   map[uint64]string
+	sizes   map[uint64]uint64
+	named   map[uint64]bool
+	pending []span // Guest stores not yet written: the data is read at the next instruction
+}
+
+type span struct {
+	addr uint64
+	size int
+}
+
+// NewRecorder records to w. Symbols are written the first time their
+// address runs, with the function size from the symbol table or the
+// distance to the next .eh_frame_hdr function start.
+func NewRecorder(w *Writer, info *emulator.ELFInfo) *Recorder {
+	r := &Recorder{
+		w:     w,
+		names: info.AddrNames(),
+		sizes: make(map[uint64]uint64, len(info.FuncSizes)+len(info.FuncStarts)),
+		named: make(map[uint64]bool),
+	}
+	for i := 0; i+1 < len(info.FuncStarts); i++ {
+		r.sizes[info.FuncStarts[i]] = info.FuncStarts[i+1] - info.FuncStarts[i]
+	}
+	for addr, size := range info.FuncSizes {
+		if size != 0 {
+			r.sizes[addr] = size
+		}
+	}
+	return r
+}
+
+// Install hooks every instruction, guest store, and stub write.
+func (r *Recorder) Install(emu *emulator.Emulator) error {
+	r.emu = emu
+	if err := emu.HookMemWrite(1, 0, func(e *emulator.Emulator, addr uint64, size int) {
+		r.pending = append(r.pending, span{addr, size})
+	}); err != nil {
+		return err
+	}
+	emu.HookHostWrite(func(e *emulator.Emulator, addr uint64, size int) {
+		r.flush(e)
+		if size > maxHostWrite {
+			size = maxHostWrite
+		}
+		if data, err := e.MemRead(addr, uint64(size)); err == nil {
+			r.w.Host(addr, data)
+		}
+	})
+	emu.HookCode(func(e *emulator.Emulator, addr uint64, size uint32) {
+		r.flush(e)
+		if name, ok := r.names[addr]; ok && !r.named[addr] {
+			r.named[addr] = true
+			r.w.Symbol(addr, name, r.sizes[addr])
+		}
+		word, _ := e.MemReadU32(addr)
+		r.w.Insn(addr, word, e.Regs())
+	})
+	return nil
+}
+
+// flush records the stores of the last instruction.
+func (r *Recorder) flush(emu *emulator.Emulator) {
+	for _, s := range r.pending {
+		if data, err := emu.MemRead(s.addr, uint64(s.size)); err == nil {
+			r.w.Mem(s.addr, data)
+		}
+	}
+	r.pending = r.pending[:0]
+}
+
+// Event records a stub event.
+func (r *Recorder) Event(category, name, detail string) {
+	r.w.Event(category, name, detail)
+}
+
+// Close records the last instruction's stores and finishes the file.
+func (r *Recorder) Close() error {
+	if r.emu != nil {
+		r.flush(r.emu)
+	}
+	return r.w.Close()
+}
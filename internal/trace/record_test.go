@@ -0,0 +1,125 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/zboralski/galago/internal/emulator"
+)
+
+func TestRecordReplay(t *testing.T) {
+	emu, err := emulator.New()
+	if err != nil {
+		t.Fatalf("Failed to create emulator: %v", err)
+	}
+	defer emu.Close()
+
+	code := uint64(emulator.CodeBase)
+	emu.MemWrite(code, []byte{
+		0x40, 0x05, 0x80, 0xd2, // MOV X0, #42
+		0x20, 0x00, 0x00, 0xf9, // STR X0, [X1]
+		0xc0, 0x03, 0x5f, 0xd6, // RET
+	})
+	buf := emu.Malloc(16)
+	emu.SetX(1, buf)
+	emu.SetLR(code + 0x100)
+
+	var file bytes.Buffer
+	rec := NewRecorder(NewWriter(&file, Header{Binary: "libf.so", Base: code, Entry: code}),
+		&emulator.ELFInfo{Symbols: map[string]uint64{"f": code}, FuncSizes: map[uint64]uint64{code: 12}})
+	if err := rec.Install(emu); err != nil {
+		t.Fatal(err)
+	}
+	if err := emu.Run(code, code+0x100); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	rec.Event("libc", "strlen", `"key"`)
+	emu.MemWrite(buf+8, []byte("hi"))
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header.Binary != "libf.so" || r.Header.Entry != code {
+		t.Errorf("Header = %+v", r.Header)
+	}
+	var steps []*Step
+	for {
+		step, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) != 3 {
+		t.Fatalf("got %d steps, want 3", len(steps))
+	}
+	if steps[0].PC != code || steps[0].Word != 0xd2800540 || steps[2].Index != 3 {
+		t.Errorf("steps[0] = %+v, steps[2] = %+v", steps[0], steps[2])
+	}
+	if want := []RegChange{{0, 42}}; !reflect.DeepEqual(steps[0].Regs, want) {
+		t.Errorf("MOV changed %+v, want %+v", steps[0].Regs, want)
+	}
+	if want := []MemWrite{{Addr: buf, Data: []byte{42, 0, 0, 0, 0, 0, 0, 0}}}; !reflect.DeepEqual(steps[1].Writes, want) {
+		t.Errorf("STR wrote %+v, want %+v", steps[1].Writes, want)
+	}
+	if sym, ok := r.Symbol(code + 8); !ok || sym.Name != "f" {
+		t.Errorf("Symbol(RET) = %+v, %v", sym, ok)
+	}
+	if sym, ok := r.Symbol(code + 12); ok {
+		t.Errorf("Symbol(past f) = %+v", sym)
+	}
+
+	// Events and stub writes after the last instruction belong to none
+	if len(steps[2].Events) != 0 || len(steps[2].Writes) != 0 {
+		t.Errorf("RET has %d events, %d writes", len(steps[2].Events), len(steps[2].Writes))
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("not a trace"))); err != ErrNotTrace {
+		t.Errorf("NewReader(garbage) = %v, want ErrNotTrace", err)
+	}
+}
+
+func TestRewrittenCode(t *testing.T) {
+	const pc = 0x1000
+	var file bytes.Buffer
+	w := NewWriter(&file, Header{})
+	var regs [NumRegs]uint64
+	// The guest patches its own instruction between two runs of it
+	for _, word := range []uint32{0xd503201f, 0xd503201f, 0xd2800540, 0xd2800540} {
+		w.Insn(pc, word, regs)
+		w.Insn(pc+4, 0xd65f03c0, regs)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var words []uint32
+	for {
+		step, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.PC == pc {
+			words = append(words, step.Word)
+		}
+	}
+	if want := []uint32{0xd503201f, 0xd503201f, 0xd2800540, 0xd2800540}; !reflect.DeepEqual(words, want) {
+		t.Errorf("words at 0x%x = %x, want %x", pc, words, want)
+	}
+}
@@ -28,6 +28,7 @@ const (
 	Android  Tag = "android"
 	Printf   Tag = "printf"
 	Locale   Tag = "locale"
+	Syscall  Tag = "syscall"
 )
 
 // Tags is a collection of tags with helper methods.